@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sm-medical/internal/crypto"
+	"strings"
+)
+
+// runGenSM2Key 生成持久化的SM2密钥对
+// 用法: go run ./cmd gen-sm2-key [-out ./config/sm2_private.pem] [-force]
+func runGenSM2Key(args []string) {
+	fs := flag.NewFlagSet("gen-sm2-key", flag.ExitOnError)
+	out := fs.String("out", "./config/sm2_private.pem", "私钥PEM文件路径(公钥写入同目录 *_pub.pem)")
+	force := fs.Bool("force", false, "覆盖已存在的密钥文件(会导致旧密钥加密的数据无法解密)")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*out); err == nil && !*force {
+		log.Fatalf("密钥文件 %s 已存在，如确需重新生成请使用 -force", *out)
+	}
+
+	priv, err := crypto.GenerateSM2KeyPair()
+	if err != nil {
+		log.Fatalf("生成SM2密钥失败: %v", err)
+	}
+
+	privPEM, err := crypto.EncodeSM2PrivateKeyPEM(priv)
+	if err != nil {
+		log.Fatalf("编码私钥失败: %v", err)
+	}
+	pubPEM, err := crypto.EncodeSM2PublicKeyPEM(&priv.PublicKey)
+	if err != nil {
+		log.Fatalf("编码公钥失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*out), 0755); err != nil {
+		log.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(*out, privPEM, 0600); err != nil {
+		log.Fatalf("写入私钥失败: %v", err)
+	}
+	pubOut := strings.TrimSuffix(*out, filepath.Ext(*out)) + "_pub.pem"
+	if err := os.WriteFile(pubOut, pubPEM, 0644); err != nil {
+		log.Fatalf("写入公钥失败: %v", err)
+	}
+
+	fmt.Println("SM2密钥对已生成")
+	fmt.Println("私钥文件:", *out)
+	fmt.Println("公钥文件:", pubOut)
+	fmt.Println("密钥标识:", crypto.SM2PublicKeyID(&priv.PublicKey))
+	fmt.Println("公钥(16进制):", crypto.EncodeSM2PublicKeyHex(&priv.PublicKey))
+	fmt.Println()
+	fmt.Println("在 config.yaml 中配置 crypto.sm2_key_file 指向私钥文件，")
+	fmt.Println("或将以下16进制私钥填入 crypto.sm2_private_key:")
+	fmt.Println(crypto.EncodeSM2PrivateKeyHex(priv))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"sm-medical/internal/crypto"
+)
+
+// runKMSEmulator 启动本地KMS模拟服务，主密钥只保存在本进程的密钥文件中
+// 用法: go run ./cmd kms-emulator [-addr 127.0.0.1:7800] [-key-file ./kms/master_keys.json] [-token xxx] [-rotate]
+func runKMSEmulator(args []string) {
+	fs := flag.NewFlagSet("kms-emulator", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:7800", "监听地址")
+	keyFile := fs.String("key-file", "./kms/master_keys.json", "主密钥文件路径(不存在时自动生成)")
+	token := fs.String("token", os.Getenv("KMS_TOKEN"), "访问令牌，与 crypto.key_provider.kms_token 一致(默认读取环境变量KMS_TOKEN)")
+	rotate := fs.Bool("rotate", false, "生成新的主密钥并设为当前主密钥(历史主密钥保留用于解包)")
+	fs.Parse(args)
+
+	kms, err := crypto.LoadKMSKeyFile(*keyFile, *rotate)
+	if err != nil {
+		log.Fatalf("加载主密钥失败: %v", err)
+	}
+	kms.SetToken(*token)
+	if *token == "" {
+		log.Println("Warning: 未设置访问令牌，KMS接口不做认证，仅限本机调试使用")
+	}
+
+	log.Printf("KMS emulator is running on %s, master key: %s", *addr, kms.ActiveKeyID())
+	if err := http.ListenAndServe(*addr, kms); err != nil {
+		log.Fatalf("Failed to start KMS emulator: %v", err)
+	}
+}
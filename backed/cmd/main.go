@@ -8,17 +8,62 @@ import (
 	"sm-medical/internal/api"
 	"sm-medical/internal/crypto"
 	"sm-medical/internal/middleware"
+	"sm-medical/internal/service"
 	"sm-medical/pkg/config"
 	"sm-medical/pkg/database"
+	"sm-medical/pkg/sender"
 )
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "gen-sm2-key":
+			runGenSM2Key(os.Args[2:])
+			return
+		case "kms-emulator":
+			runKMSEmulator(os.Args[2:])
+			return
+		default:
+			log.Fatalf("Unknown command: %s", os.Args[1])
+		}
+	}
+
 	// 加载配置
 	cfg := config.LoadConfig()
 
-	// 初始化国密算法
-	if err := crypto.InitCrypto(cfg.Crypto.SM4Key); err != nil {
-		log.Fatalf("Failed to init crypto: %v", err)
+	// 初始化国密算法（配置了密钥提供者时sm4_key可为空，仅用于解密历史数据）
+	if cfg.Crypto.SM4Key != "" || cfg.Crypto.KeyProvider.Type == "" {
+		if err := crypto.InitCrypto(cfg.Crypto.SM4Key); err != nil {
+			log.Fatalf("Failed to init crypto: %v", err)
+		}
+		if err := crypto.LoadSM4Keyring(cfg.Crypto.SM4Keys, cfg.Crypto.SM4ActiveKeyID); err != nil {
+			log.Fatalf("Failed to load SM4 keyring: %v", err)
+		}
+	}
+	if err := initKeyProvider(cfg.Crypto.KeyProvider); err != nil {
+		log.Fatalf("Failed to init key provider: %v", err)
+	}
+	log.Printf("SM4 active key: %s", crypto.ActiveEncryptionKeyID())
+	derived, err := crypto.InitBlindIndex(cfg.Crypto.BlindIndexKey)
+	if err != nil {
+		log.Fatalf("Failed to init blind index key: %v", err)
+	}
+	if derived {
+		log.Println("Warning: crypto.blind_index_key not set, blind index key derived from sm4_key")
+	}
+	if err := crypto.LoadSM2KeyPair(cfg.Crypto.SM2PrivateKey, cfg.Crypto.SM2PublicKey, cfg.Crypto.SM2KeyFile); err != nil {
+		log.Fatalf("Failed to load SM2 key pair: %v", err)
+	}
+	log.Printf("SM2 key loaded: %s", crypto.SM2KeyID)
+	if err := crypto.SetPasswordHashParams(crypto.PasswordHashParams{
+		Algorithm:        cfg.Crypto.PasswordHash.Algorithm,
+		ScryptN:          cfg.Crypto.PasswordHash.ScryptN,
+		ScryptR:          cfg.Crypto.PasswordHash.ScryptR,
+		ScryptP:          cfg.Crypto.PasswordHash.ScryptP,
+		PBKDF2Iterations: cfg.Crypto.PasswordHash.PBKDF2Iterations,
+	}); err != nil {
+		log.Fatalf("Invalid password hash config: %v", err)
 	}
 	log.Println("Crypto initialized successfully")
 
@@ -26,6 +71,30 @@ func main() {
 	if err := database.InitDatabase(&cfg.Database); err != nil {
 		log.Fatalf("Failed to init database: %v", err)
 	}
+
+	// 访问令牌吊销列表，memory仅适用于单实例部署
+	if cfg.JWT.RevocationStore == "memory" {
+		log.Println("Token revocation store: memory")
+	} else {
+		service.SetRevocationStore(service.NewDBRevocationStore())
+	}
+
+	// 验证码投递方式（邮件、短信）
+	if err := initSenders(cfg.Sender); err != nil {
+		log.Fatalf("Failed to init sender: %v", err)
+	}
+
+	// 加载角色权限（权限表为空时写入默认分配）
+	service.NewRBACService().Load()
+
+	// 恢复服务重启前未完成的重加密任务
+	service.NewReencryptService().ResumeInterrupted()
+
+	// 定期处理超时未接诊、超时未完成的问诊
+	service.NewConsultationService().StartScheduler()
+
+	// 为历史用户补算盲索引
+	go service.NewUserService().BackfillBlindIndexes()
 	
 	// 确保上传目录存在
 	if err := os.MkdirAll(cfg.Upload.UploadPath, 0755); err != nil {
@@ -39,7 +108,9 @@ func main() {
 	}
 
 	// 创建路由
-	r := gin.Default()
+	// 访问日志记录前遮盖URL中的token参数
+	r := gin.New()
+	r.Use(middleware.RedactQuery("token"), gin.Logger(), gin.Recovery())
 
 	// 注册中间件
 	r.Use(middleware.CORS())
@@ -61,3 +132,87 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// initKeyProvider 按配置初始化信封加密的主密钥提供者，type为空时不启用
+func initKeyProvider(cfg config.KeyProviderConfig) error {
+	var provider crypto.KeyProvider
+	switch cfg.Type {
+	case "":
+		return nil
+	case "config":
+		p, err := crypto.NewConfigKeyProvider(cfg.MasterKeys, cfg.MasterKeyID)
+		if err != nil {
+			return err
+		}
+		log.Println("Warning: master key loaded from config.yaml, use key_provider.type=kms in production")
+		provider = p
+	case "kms":
+		p, err := crypto.NewKMSKeyProvider(cfg.KMSEndpoint, cfg.KMSToken)
+		if err != nil {
+			return err
+		}
+		provider = p
+	default:
+		return fmt.Errorf("unknown key provider type: %s", cfg.Type)
+	}
+
+	crypto.SetKeyProvider(provider)
+	log.Printf("Envelope encryption enabled - provider: %s, master key: %s", cfg.Type, provider.MasterKeyID())
+	return nil
+}
+
+// initSenders 按配置设置邮件和短信发送器，未配置时写日志（console）
+func initSenders(cfg config.SenderConfig) error {
+	var fileSender *sender.FileSender
+	newFileSender := func() (sender.Sender, error) {
+		if fileSender == nil {
+			path := cfg.FilePath
+			if path == "" {
+				path = "./logs/outbox.log"
+			}
+			s, err := sender.NewFileSender(path)
+			if err != nil {
+				return nil, err
+			}
+			fileSender = s
+		}
+		return fileSender, nil
+	}
+
+	for _, ch := range []struct {
+		channel string
+		kind    string
+	}{
+		{sender.ChannelEmail, cfg.Mail},
+		{sender.ChannelSMS, cfg.SMS},
+	} {
+		var s sender.Sender
+		var err error
+		switch ch.kind {
+		case "", "console":
+			s = sender.NewConsoleSender()
+		case "file":
+			s, err = newFileSender()
+		case "smtp":
+			if ch.channel != sender.ChannelEmail {
+				return fmt.Errorf("smtp sender does not support channel: %s", ch.channel)
+			}
+			s, err = sender.NewSMTPSender(sender.SMTPConfig{
+				Host:     cfg.SMTP.Host,
+				Port:     cfg.SMTP.Port,
+				Username: cfg.SMTP.Username,
+				Password: cfg.SMTP.Password,
+				From:     cfg.SMTP.From,
+				SSL:      cfg.SMTP.SSL,
+			})
+		default:
+			return fmt.Errorf("unknown %s sender: %s", ch.channel, ch.kind)
+		}
+		if err != nil {
+			return err
+		}
+		sender.SetSender(ch.channel, s)
+		log.Printf("Sender ready - channel: %s, type: %s", ch.channel, s.Name())
+	}
+	return nil
+}
@@ -25,7 +25,7 @@ CREATE TABLE IF NOT EXISTS SM_user (
     phone VARCHAR(255) COMMENT '手机号(SM4加密)',
     real_name VARCHAR(255) COMMENT '真实姓名(SM4加密)',
     id_card VARCHAR(255) COMMENT '身份证号(SM4加密)',
-    identify ENUM('patient', 'admin', 'doctor') NOT NULL DEFAULT 'patient' COMMENT '身份标识',
+    identify ENUM('patient', 'admin', 'doctor', 'pharmacist') NOT NULL DEFAULT 'patient' COMMENT '身份标识',
     avatar VARCHAR(500) DEFAULT '/static/avatar/default.png' COMMENT '头像URL',
     gender TINYINT DEFAULT 0 COMMENT '性别(0:未知,1:男,2:女)',
     birth_date DATE COMMENT '出生日期',
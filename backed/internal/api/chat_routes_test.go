@@ -0,0 +1,294 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"sm-medical/internal/crypto"
+	"sm-medical/pkg/config"
+	"sm-medical/pkg/database"
+	"sm-medical/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	ws "github.com/gorilla/websocket"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 测试数据：问诊1的患者为10、接诊医生为20，用户30与该问诊无关
+const (
+	testConsultationID = 1
+	testPatientID      = 10
+	testDoctorID       = 20
+	testStrangerID     = 30
+	// 医生发给患者、患者发给医生的消息
+	testDoctorMessageID  = 100
+	testPatientMessageID = 101
+)
+
+var setupOnce sync.Once
+var testRouter *gin.Engine
+
+// chatTestRouter 使用内存数据库驱动和真实路由（含认证中间件）
+func chatTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	setupOnce.Do(func() {
+		gin.SetMode(gin.TestMode)
+		config.AppConfig = &config.Config{}
+		config.AppConfig.JWT.Secret = "chat-test-secret"
+		config.AppConfig.JWT.ExpiresIn = 900
+		if err := crypto.InitCrypto("0123456789abcdef0123456789abcdef"); err != nil {
+			panic(err)
+		}
+
+		sql.Register("chat-fake", fakeDriver{})
+		sqlDB, err := sql.Open("chat-fake", "")
+		if err != nil {
+			panic(err)
+		}
+		database.DB, err = gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		testRouter = gin.New()
+		RegisterRoutes(testRouter)
+	})
+	return testRouter
+}
+
+// tokenFor 签发测试用户的访问令牌
+func tokenFor(t *testing.T, userID int64, role string) string {
+	t.Helper()
+	token, err := utils.GenerateToken(userID, fmt.Sprintf("user%d", userID), role, fmt.Sprintf("session-%d", userID))
+	if err != nil {
+		t.Fatalf("签发令牌失败: %v", err)
+	}
+	return token
+}
+
+type chatCase struct {
+	name   string
+	userID int64
+	role   string
+	body   string // POST/PUT请求体，GET请求时为查询参数
+	status int
+}
+
+// memberCases 每个接口的四类请求：患者、接诊医生、无关用户、冒用他人ID
+func memberCases(patientBody, doctorBody, strangerBody, spoofedBody string) []chatCase {
+	return []chatCase{
+		{"patient", testPatientID, "patient", patientBody, http.StatusOK},
+		{"doctor", testDoctorID, "doctor", doctorBody, http.StatusOK},
+		{"stranger", testStrangerID, "patient", strangerBody, http.StatusForbidden},
+		{"spoofed", testPatientID, "patient", spoofedBody, http.StatusForbidden},
+	}
+}
+
+func TestChatRoutePermissions(t *testing.T) {
+	r := chatTestRouter(t)
+
+	routes := []struct {
+		method string
+		path   string
+		cases  []chatCase
+	}{
+		{"POST", "/api/chat/send", memberCases(
+			`{"consultationId":1,"messageType":1,"content":"hello"}`,
+			`{"consultationId":1,"messageType":1,"content":"hello"}`,
+			`{"consultationId":1,"messageType":1,"content":"hello"}`,
+			`{"consultationId":1,"senderId":20,"messageType":1,"content":"hello"}`,
+		)},
+		{"GET", "/api/chat/messages", memberCases(
+			"consultationId=1",
+			"consultationId=1",
+			"consultationId=1",
+			"consultationId=1&userId=20",
+		)},
+		{"GET", "/api/chat/unread-count", memberCases(
+			"consultationId=1",
+			"consultationId=1",
+			"consultationId=1",
+			"consultationId=1&userId=20",
+		)},
+		{"PUT", "/api/chat/mark-read", memberCases(
+			fmt.Sprintf(`{"messageId":%d}`, testDoctorMessageID),
+			fmt.Sprintf(`{"messageId":%d}`, testPatientMessageID),
+			fmt.Sprintf(`{"messageId":%d}`, testDoctorMessageID),
+			fmt.Sprintf(`{"messageId":%d,"userId":20}`, testPatientMessageID),
+		)},
+		{"GET", "/api/chat/online-status", []chatCase{
+			{"patient", testPatientID, "patient", "consultationId=1", http.StatusOK},
+			{"doctor", testDoctorID, "doctor", "consultationId=1", http.StatusOK},
+			{"stranger", testStrangerID, "patient", "consultationId=1", http.StatusForbidden},
+			// 在线状态以Token中的用户为准，查询参数中的userId被忽略
+			{"spoofed", testStrangerID, "patient", "consultationId=1&userId=10", http.StatusForbidden},
+		}},
+		{"POST", "/api/chat/typing", memberCases(
+			`{"consultationId":1,"typing":true}`,
+			`{"consultationId":1,"typing":true}`,
+			`{"consultationId":1,"typing":true}`,
+			`{"consultationId":1,"userId":20,"typing":true}`,
+		)},
+	}
+
+	for _, route := range routes {
+		for _, tc := range route.cases {
+			t.Run(route.path+"/"+tc.name, func(t *testing.T) {
+				var req *http.Request
+				if route.method == "GET" {
+					req = httptest.NewRequest(route.method, route.path+"?"+tc.body, nil)
+				} else {
+					req = httptest.NewRequest(route.method, route.path, strings.NewReader(tc.body))
+					req.Header.Set("Content-Type", "application/json")
+				}
+				req.Header.Set("Authorization", "Bearer "+tokenFor(t, tc.userID, tc.role))
+
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				if w.Code != tc.status {
+					t.Fatalf("状态码 = %d, 期望 %d, 响应: %s", w.Code, tc.status, w.Body.String())
+				}
+				var resp struct {
+					Code int `json:"code"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("解析响应失败: %v", err)
+				}
+				if resp.Code != tc.status {
+					t.Fatalf("响应码 = %d, 期望 %d", resp.Code, tc.status)
+				}
+			})
+		}
+	}
+}
+
+func TestChatRouteRequiresToken(t *testing.T) {
+	r := chatTestRouter(t)
+
+	req := httptest.NewRequest("GET", "/api/chat/messages?consultationId=1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp struct {
+		Code int `json:"code"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatalf("响应码 = %d, 期望 401", resp.Code)
+	}
+}
+
+func TestChatWebSocketHandshake(t *testing.T) {
+	server := httptest.NewServer(chatTestRouter(t))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat/ws?consultationId=1"
+
+	cases := []chatCase{
+		{"patient", testPatientID, "patient", "", http.StatusSwitchingProtocols},
+		{"doctor", testDoctorID, "doctor", "", http.StatusSwitchingProtocols},
+		{"stranger", testStrangerID, "patient", "", http.StatusForbidden},
+		{"spoofed", testPatientID, "patient", "&userId=20", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dialer := ws.Dialer{Subprotocols: []string{"bearer", tokenFor(t, tc.userID, tc.role)}}
+			conn, resp, err := dialer.Dial(wsURL+tc.body, nil)
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("握手失败: %v", err)
+			}
+			if resp.StatusCode != tc.status {
+				t.Fatalf("状态码 = %d, 期望 %d", resp.StatusCode, tc.status)
+			}
+		})
+	}
+
+	// 查询参数中的Token不再被接受
+	resp, err := http.Get(server.URL + "/api/chat/ws?consultationId=1&token=" + tokenFor(t, testPatientID, "patient"))
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("状态码 = %d, 期望 401", resp.StatusCode)
+	}
+}
+
+// fakeDriver 内存数据库驱动：按ID返回固定的问诊和消息，其余查询返回空结果，写操作直接成功
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return fakeResult{}, nil
+}
+
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 1, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	switch {
+	case strings.HasPrefix(query, "SELECT count("):
+		return &fakeRows{columns: []string{"count(*)"}, rows: [][]driver.Value{{int64(0)}}}, nil
+	case strings.Contains(query, "FROM `SM_consultation` WHERE id = ?") && args[0].Value == int64(testConsultationID):
+		return &fakeRows{
+			columns: []string{"id", "consultation_no", "patient_id", "doctor_id", "status"},
+			rows:    [][]driver.Value{{int64(testConsultationID), "C001", int64(testPatientID), int64(testDoctorID), int64(1)}},
+		}, nil
+	case strings.Contains(query, "FROM `SM_chat_message` WHERE id = ?"):
+		columns := []string{"id", "consultation_id", "sender_id", "receiver_id"}
+		switch args[0].Value {
+		case int64(testDoctorMessageID):
+			return &fakeRows{columns: columns, rows: [][]driver.Value{{int64(testDoctorMessageID), int64(testConsultationID), int64(testDoctorID), int64(testPatientID)}}}, nil
+		case int64(testPatientMessageID):
+			return &fakeRows{columns: columns, rows: [][]driver.Value{{int64(testPatientMessageID), int64(testConsultationID), int64(testPatientID), int64(testDoctorID)}}}, nil
+		}
+	}
+	return &fakeRows{columns: []string{"id"}}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -5,15 +5,25 @@ import (
 	"sm-medical/internal/service"
 	"sm-medical/pkg/utils"
 	"strconv"
+	"strings"
 )
 
+// AdminHandler 管理员接口，访问权限由路由上的 RequirePermission 声明
 type AdminHandler struct {
-	adminService *service.AdminService
+	adminService     *service.AdminService
+	reencryptService *service.ReencryptService
+	rbacService      *service.RBACService
+	mfaService       *service.MFAService
+	securityService  *service.SecurityEventService
 }
 
 func NewAdminHandler() *AdminHandler {
 	return &AdminHandler{
-		adminService: service.NewAdminService(),
+		adminService:     service.NewAdminService(),
+		reencryptService: service.NewReencryptService(),
+		rbacService:      service.NewRBACService(),
+		mfaService:       service.NewMFAService(),
+		securityService:  service.NewSecurityEventService(),
 	}
 }
 
@@ -85,12 +95,6 @@ func (h *AdminHandler) GetDoctorApplications(c *gin.Context) {
 
 // GetUsers 获取用户列表
 func (h *AdminHandler) GetUsers(c *gin.Context) {
-	role := c.GetString("role")
-	if role != "admin" {
-		utils.Forbidden(c, "无权限访问")
-		return
-	}
-
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	identify := c.Query("identify")
@@ -119,12 +123,6 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 
 // UpdateUserStatus 禁用/启用用户
 func (h *AdminHandler) UpdateUserStatus(c *gin.Context) {
-	role := c.GetString("role")
-	if role != "admin" {
-		utils.Forbidden(c, "无权限访问")
-		return
-	}
-
 	var req struct {
 		UserID int64 `json:"userId" binding:"required"`
 		Status int   `json:"status" binding:"required"` // 0:启用 1:禁用
@@ -145,12 +143,6 @@ func (h *AdminHandler) UpdateUserStatus(c *gin.Context) {
 
 // GetLoginLogs 获取登录日志
 func (h *AdminHandler) GetLoginLogs(c *gin.Context) {
-	role := c.GetString("role")
-	if role != "admin" {
-		utils.Forbidden(c, "无权限访问")
-		return
-	}
-
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	userIDStr := c.Query("userId")
@@ -183,3 +175,183 @@ func (h *AdminHandler) GetLoginLogs(c *gin.Context) {
 		"list":     list,
 	})
 }
+
+// GetSecurityEvents 获取登录异常检测发现的安全事件
+func (h *AdminHandler) GetSecurityEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	eventType := c.Query("eventType")
+
+	var status *int
+	if statusStr := c.Query("status"); statusStr != "" {
+		s, _ := strconv.Atoi(statusStr)
+		status = &s
+	}
+
+	var userID *int64
+	if userIDStr := c.Query("userId"); userIDStr != "" {
+		id, _ := strconv.ParseInt(userIDStr, 10, 64)
+		userID = &id
+	}
+
+	list, total, err := h.securityService.GetList(page, pageSize, eventType, status, userID)
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+		"list":     list,
+	})
+}
+
+// HandleSecurityEvent 处理安全事件（确认或标记为误报）
+func (h *AdminHandler) HandleSecurityEvent(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	var req struct {
+		EventID int64  `json:"eventId" binding:"required"`
+		Status  int    `json:"status" binding:"required"` // 1:已确认 2:误报
+		Note    string `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.securityService.Handle(adminID, req.EventID, req.Status, req.Note); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "已处理", nil)
+}
+
+// StartReencrypt 启动或恢复SM4重加密任务
+func (h *AdminHandler) StartReencrypt(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+	job, err := h.reencryptService.Start(adminID)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "重加密任务已启动", job)
+}
+
+// PauseReencrypt 暂停SM4重加密任务
+func (h *AdminHandler) PauseReencrypt(c *gin.Context) {
+	if err := h.reencryptService.Pause(); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "任务将在当前批次完成后暂停", nil)
+}
+
+// GetReencryptProgress 获取SM4重加密进度
+func (h *AdminHandler) GetReencryptProgress(c *gin.Context) {
+	progress, err := h.reencryptService.GetProgress()
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, progress)
+}
+
+// UpdateUserRole 分配用户角色（患者、药师、管理员）
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	var req struct {
+		UserID int64  `json:"userId" binding:"required"`
+		Role   string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.adminService.UpdateUserRole(adminID, req.UserID, req.Role); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "角色已更新", nil)
+}
+
+// ResetUserMFA 重置用户的两步验证（用户丢失身份验证器和恢复码时）
+func (h *AdminHandler) ResetUserMFA(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	var req struct {
+		UserID int64 `json:"userId" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.mfaService.Reset(adminID, req.UserID); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "两步验证已重置", nil)
+}
+
+// UnlockLogin 解除账号或IP的登录锁定
+func (h *AdminHandler) UnlockLogin(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	var req struct {
+		UserID int64  `json:"userId"`
+		IP     string `json:"ip"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.adminService.UnlockLogin(adminID, req.UserID, strings.TrimSpace(req.IP)); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "已解除登录锁定", nil)
+}
+
+// GetRolePermissions 获取权限目录和各角色权限
+func (h *AdminHandler) GetRolePermissions(c *gin.Context) {
+	utils.Success(c, h.rbacService.GetPolicies())
+}
+
+// UpdateRolePermissions 替换角色的全部权限
+func (h *AdminHandler) UpdateRolePermissions(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	var req struct {
+		Role        string   `json:"role" binding:"required"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.rbacService.UpdateRolePermissions(adminID, req.Role, req.Permissions); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "角色权限已更新", h.rbacService.GetPolicies())
+}
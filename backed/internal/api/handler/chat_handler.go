@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"sm-medical/internal/service"
 	"sm-medical/internal/websocket"
+	"sm-medical/pkg/utils"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -30,17 +32,48 @@ func InitChatHandler() {
 	
 	// 启动WebSocket中心
 	go chatHub.Run()
+
+	// 问诊结束、转诊等状态变化时推送到聊天室，问诊结束后由聊天室断开连接
+	service.SetConsultationChatNotifier(chatHub)
 	
 	log.Println("[ChatHandler] 聊天服务已初始化")
 }
 
+// wsAuthProtocol 通过 Sec-WebSocket-Protocol 传递Token时使用的协议标记
+// 浏览器无法为WebSocket设置Authorization头，客户端使用 new WebSocket(url, ["bearer", token])
+// 不接受查询参数中的Token，避免Token随完整URL写入访问日志和代理日志
+const wsAuthProtocol = "bearer"
+
 // WebSocketConnect WebSocket连接处理
+// 握手时校验Sec-WebSocket-Protocol中的JWT，并校验用户是该问诊的患者、主诊医生或会诊医生
 func WebSocketConnect(c *gin.Context) {
-	// 获取参数
-	userIDStr := c.Query("userId")
-	consultationIDStr := c.Query("consultationId")
+	token := wsToken(c.Request)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "请先登录",
+		})
+		return
+	}
+
+	claims, err := utils.ParseToken(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Token无效或已过期",
+		})
+		return
+	}
+	if claims.SessionID == "" || service.IsSessionRevoked(claims.SessionID) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "登录已失效，请重新登录",
+		})
+		return
+	}
 
-	if userIDStr == "" || consultationIDStr == "" {
+	consultationIDStr := c.Query("consultationId")
+	if consultationIDStr == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
 			"message": "缺少必要参数",
@@ -48,26 +81,47 @@ func WebSocketConnect(c *gin.Context) {
 		return
 	}
 
-	userID, err := strconv.ParseInt(userIDStr, 10, 64)
+	consultationID, err := strconv.ParseInt(consultationIDStr, 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
-			"message": "用户ID格式错误",
+			"message": "问诊ID格式错误",
 		})
 		return
 	}
 
-	consultationID, err := strconv.ParseInt(consultationIDStr, 10, 64)
+	// 兼容旧客户端仍传userId，但必须与Token一致
+	if userIDStr := c.Query("userId"); userIDStr != "" && userIDStr != strconv.FormatInt(claims.UserID, 10) {
+		log.Printf("[WebSocket] 用户ID与Token不一致 - Token用户: %d, 参数: %s", claims.UserID, userIDStr)
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "无权限进入该问诊",
+		})
+		return
+	}
+
+	consultation, err := chatService.CheckMembership(claims.UserID, consultationID)
 	if err != nil {
+		log.Printf("[WebSocket] 拒绝连接 - 用户ID: %d, 问诊ID: %d, 原因: %v", claims.UserID, consultationID, err)
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": err.Error(),
+		})
+		return
+	}
+	if consultation.Status >= 2 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
-			"message": "问诊ID格式错误",
+			"message": "问诊已结束",
 		})
 		return
 	}
 
+	// 通过子协议传Token时必须回应所选协议，否则浏览器会断开连接
+	responseHeader := http.Header{"Sec-WebSocket-Protocol": {wsAuthProtocol}}
+
 	// 升级HTTP连接为WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, responseHeader)
 	if err != nil {
 		log.Printf("[WebSocket] 升级失败: %v", err)
 		return
@@ -78,9 +132,12 @@ func WebSocketConnect(c *gin.Context) {
 		Hub:            chatHub,
 		Conn:           conn,
 		Send:           make(chan []byte, 256),
-		UserID:         userID,
+		UserID:         claims.UserID,
 		ConsultationID: consultationID,
 	}
+	if claims.ExpiresAt != nil {
+		client.ExpiresAt = claims.ExpiresAt.Time
+	}
 
 	// 注册客户端
 	chatHub.Register <- client
@@ -90,6 +147,24 @@ func WebSocketConnect(c *gin.Context) {
 	go client.ReadPump()
 }
 
+// wsToken 从Sec-WebSocket-Protocol中获取Token
+func wsToken(r *http.Request) string {
+	protocols := ws.Subprotocols(r)
+	for i, p := range protocols {
+		if p == wsAuthProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// CloseConsultationConnections 断开问诊的所有WebSocket连接
+func CloseConsultationConnections(consultationID int64, reason string) {
+	if chatHub != nil {
+		chatHub.CloseConsultation(consultationID, reason)
+	}
+}
+
 // SendMessage 发送消息
 func SendMessage(c *gin.Context) {
 	var req service.SendMessageRequest
@@ -100,6 +175,9 @@ func SendMessage(c *gin.Context) {
 		})
 		return
 	}
+	if !bindActor(c, &req.SenderID) || !requireMember(c, req.SenderID, req.ConsultationID) {
+		return
+	}
 
 	// 调用服务层发送消息
 	message, err := chatService.SendMessage(&req)
@@ -111,8 +189,8 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
-	// 通过WebSocket推送给接收者
-	chatHub.SendToUser(message.ConsultationID, message.ReceiverID, "chat", message)
+	// 通过WebSocket推送给问诊的其他成员（患者、主诊医生和会诊医生）
+	chatHub.SendToOthers(message.ConsultationID, message.SenderID, "chat", message)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -131,6 +209,9 @@ func GetMessageList(c *gin.Context) {
 		})
 		return
 	}
+	if !bindActor(c, &req.UserID) || !requireMember(c, req.UserID, req.ConsultationID) {
+		return
+	}
 
 	result, err := chatService.GetMessageList(&req)
 	if err != nil {
@@ -158,6 +239,12 @@ func GetUnreadCount(c *gin.Context) {
 		})
 		return
 	}
+	if !bindActor(c, &req.UserID) {
+		return
+	}
+	if req.ConsultationID > 0 && !requireMember(c, req.UserID, req.ConsultationID) {
+		return
+	}
 
 	result, err := chatService.GetUnreadCount(&req)
 	if err != nil {
@@ -185,8 +272,18 @@ func MarkAsRead(c *gin.Context) {
 		})
 		return
 	}
+	if !bindActor(c, &req.UserID) {
+		return
+	}
 
 	if err := chatService.MarkAsRead(&req); err != nil {
+		if errors.Is(err, service.ErrNotMessageReceiver) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
 			"message": err.Error(),
@@ -220,6 +317,10 @@ func GetOnlineStatus(c *gin.Context) {
 		return
 	}
 
+	if !requireMember(c, c.GetInt64("userID"), consultationID) {
+		return
+	}
+
 	onlineUsers := chatHub.GetOnlineUsers(consultationID)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -236,7 +337,7 @@ func GetOnlineStatus(c *gin.Context) {
 func SendTypingStatus(c *gin.Context) {
 	var req struct {
 		ConsultationID int64 `json:"consultationId" binding:"required"`
-		UserID         int64 `json:"userId" binding:"required"`
+		UserID         int64 `json:"userId"` // 由认证信息填充
 		Typing         bool  `json:"typing"`
 	}
 
@@ -247,6 +348,12 @@ func SendTypingStatus(c *gin.Context) {
 		})
 		return
 	}
+	if !bindActor(c, &req.UserID) {
+		return
+	}
+	if !requireMember(c, req.UserID, req.ConsultationID) {
+		return
+	}
 
 	// 广播正在输入状态
 	chatHub.SendToConsultation(req.ConsultationID, "typing", gin.H{
@@ -259,3 +366,32 @@ func SendTypingStatus(c *gin.Context) {
 		"message": "发送成功",
 	})
 }
+
+// bindActor 使用认证中间件设置的userID作为操作人
+// 客户端仍可传入用户ID（兼容旧版本），但必须与当前登录用户一致，否则拒绝请求
+func bindActor(c *gin.Context, claimed *int64) bool {
+	userID := c.GetInt64("userID")
+	if *claimed != 0 && *claimed != userID {
+		log.Printf("[Chat] 拒绝跨用户请求 - 当前用户: %d, 请求用户: %d, 路径: %s", userID, *claimed, c.Request.URL.Path)
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "无权限操作其他用户的数据",
+		})
+		return false
+	}
+	*claimed = userID
+	return true
+}
+
+// requireMember 校验用户是问诊的患者、主诊医生或会诊医生，否则拒绝请求
+func requireMember(c *gin.Context, userID, consultationID int64) bool {
+	if _, err := chatService.CheckMembership(userID, consultationID); err != nil {
+		log.Printf("[Chat] 拒绝非问诊成员请求 - 用户: %d, 问诊ID: %d, 路径: %s", userID, consultationID, c.Request.URL.Path)
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": err.Error(),
+		})
+		return false
+	}
+	return true
+}
@@ -23,6 +23,7 @@ func (h *ConsultationHandler) Create(c *gin.Context) {
 
 	var req struct {
 		DoctorID       *int64                 `json:"doctorId"`
+		FollowUpOf     *int64                 `json:"followUpOf"` // 复诊关联的上次问诊ID
 		ChiefComplaint string                 `json:"chiefComplaint" binding:"required"`
 		Symptoms       map[string]interface{} `json:"symptoms" binding:"required"`
 		NeedAI         bool                   `json:"needAI"`
@@ -33,7 +34,7 @@ func (h *ConsultationHandler) Create(c *gin.Context) {
 		return
 	}
 
-	consultation, err := h.service.Create(userID, req.DoctorID, req.ChiefComplaint, req.Symptoms, req.NeedAI)
+	consultation, err := h.service.Create(userID, req.DoctorID, req.FollowUpOf, req.ChiefComplaint, req.Symptoms, req.NeedAI)
 	if err != nil {
 		utils.InternalError(c, err.Error())
 		return
@@ -47,9 +48,14 @@ func (h *ConsultationHandler) GetList(c *gin.Context) {
 	userID := c.GetInt64("userID")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
-	role := c.DefaultQuery("role", "patient")
+	role := c.GetString("role") // 以Token中的角色为准，不信任查询参数
 	statusStr := c.Query("status")
 
+	if role != "patient" && role != "doctor" {
+		utils.Forbidden(c, "无权限访问")
+		return
+	}
+
 	var status *int
 	if statusStr != "" {
 		s, _ := strconv.Atoi(statusStr)
@@ -119,17 +125,290 @@ func (h *ConsultationHandler) Finish(c *gin.Context) {
 		ConsultationID int64                   `json:"consultationId" binding:"required"`
 		Diagnosis      string                 `json:"diagnosis" binding:"required"`
 		Prescription   interface{}            `json:"prescription"` // 可以是字符串或药品列表
+		FollowUpDays   int                    `json:"followUpDays"` // 大于0时安排该天数后复诊
+		FollowUpNote   string                 `json:"followUpNote"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.BadRequest(c, "参数错误")
 		return
 	}
+	if req.FollowUpDays < 0 || req.FollowUpDays > 365 {
+		utils.BadRequest(c, "复诊时间须在1-365天内")
+		return
+	}
 
 	if err := h.service.Finish(userID, req.ConsultationID, req.Diagnosis, req.Prescription); err != nil {
 		utils.BadRequest(c, err.Error())
 		return
 	}
 
+	if req.FollowUpDays > 0 {
+		plan, err := h.service.ScheduleFollowUp(userID, req.ConsultationID, req.FollowUpDays, req.FollowUpNote)
+		if err != nil {
+			utils.SuccessWithMessage(c, "问诊已完成，但复诊安排失败: "+err.Error(), nil)
+			return
+		}
+		utils.SuccessWithMessage(c, "问诊已完成", gin.H{"followUpPlan": plan})
+		return
+	}
+
 	utils.SuccessWithMessage(c, "问诊已完成", nil)
 }
+
+// Cancel 患者取消问诊
+func (h *ConsultationHandler) Cancel(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		ConsultationID int64  `json:"consultationId" binding:"required"`
+		Reason         string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.service.Cancel(userID, req.ConsultationID, req.Reason); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "问诊已取消", nil)
+}
+
+// Decline 医生拒绝接诊
+func (h *ConsultationHandler) Decline(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		ConsultationID int64  `json:"consultationId" binding:"required"`
+		Reason         string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误，请填写拒绝原因")
+		return
+	}
+
+	if err := h.service.Decline(userID, req.ConsultationID, req.Reason); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "已拒绝接诊", nil)
+}
+
+// Transfer 转诊给指定医生或目标科室
+func (h *ConsultationHandler) Transfer(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		ConsultationID int64  `json:"consultationId" binding:"required"`
+		TargetDoctorID int64  `json:"targetDoctorId"`
+		TargetDept     string `json:"targetDept"`
+		Note           string `json:"note" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误，请填写转诊说明")
+		return
+	}
+
+	result, err := h.service.Transfer(userID, req.ConsultationID, req.TargetDoctorID, req.TargetDept, req.Note)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "转诊成功", result)
+}
+
+// Reopen 重新打开已完成或已超时的问诊
+func (h *ConsultationHandler) Reopen(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	role := c.GetString("role")
+
+	var req struct {
+		ConsultationID int64  `json:"consultationId" binding:"required"`
+		Reason         string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.service.Reopen(userID, role, req.ConsultationID, req.Reason); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "问诊已重新打开", nil)
+}
+
+// GetEvents 问诊状态变更历史
+func (h *ConsultationHandler) GetEvents(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	consultationID, err := strconv.ParseInt(c.Query("consultationId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "问诊ID格式错误")
+		return
+	}
+
+	events, err := h.service.GetEvents(userID, consultationID)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, events)
+}
+
+// GetParticipants 多学科会诊的主诊医生和会诊医生
+func (h *ConsultationHandler) GetParticipants(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	consultationID, err := strconv.ParseInt(c.Query("consultationId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "问诊ID格式错误")
+		return
+	}
+
+	participants, err := h.service.GetParticipants(userID, consultationID)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, participants)
+}
+
+// InviteParticipant 主诊医生邀请会诊医生
+func (h *ConsultationHandler) InviteParticipant(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		ConsultationID int64  `json:"consultationId" binding:"required"`
+		DoctorID       int64  `json:"doctorId" binding:"required"`
+		Note           string `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	result, err := h.service.InviteParticipant(userID, req.ConsultationID, req.DoctorID, req.Note)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "已邀请会诊", result)
+}
+
+// RemoveParticipant 主诊医生移除会诊医生，或会诊医生退出会诊
+func (h *ConsultationHandler) RemoveParticipant(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		ConsultationID int64 `json:"consultationId" binding:"required"`
+		DoctorID       int64 `json:"doctorId"` // 为空时退出自己
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+	if req.DoctorID == 0 {
+		req.DoctorID = userID
+	}
+
+	if err := h.service.RemoveParticipant(userID, req.ConsultationID, req.DoctorID); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "已退出会诊", nil)
+}
+
+// SubmitOpinion 会诊医生提交会诊意见
+func (h *ConsultationHandler) SubmitOpinion(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		ConsultationID int64  `json:"consultationId" binding:"required"`
+		Opinion        string `json:"opinion" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误，请填写会诊意见")
+		return
+	}
+
+	if err := h.service.SubmitOpinion(userID, req.ConsultationID, req.Opinion); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "会诊意见已提交", nil)
+}
+
+// GetFollowUpPrefill 发起复诊时预填上次问诊的信息
+func (h *ConsultationHandler) GetFollowUpPrefill(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	consultationID, err := strconv.ParseInt(c.Query("consultationId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "问诊ID格式错误")
+		return
+	}
+
+	prefill, err := h.service.GetFollowUpPrefill(userID, consultationID)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, prefill)
+}
+
+// ScheduleFollowUp 接诊医生为已完成的问诊安排或重新安排复诊
+func (h *ConsultationHandler) ScheduleFollowUp(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		ConsultationID int64  `json:"consultationId" binding:"required"`
+		Days           int    `json:"days" binding:"required"`
+		Note           string `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	plan, err := h.service.ScheduleFollowUp(userID, req.ConsultationID, req.Days, req.Note)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "复诊已安排", plan)
+}
+
+// GetFollowUps 患者待复诊的计划
+func (h *ConsultationHandler) GetFollowUps(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	plans, err := h.service.GetFollowUps(userID)
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, plans)
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"sm-medical/internal/service"
+	"sm-medical/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IntegrationHandler HIS、药房等院内系统通过服务账号API密钥调用的集成接口，以及服务账号的管理接口
+type IntegrationHandler struct {
+	apiKeyService       *service.APIKeyService
+	recordService       *service.RecordService
+	prescriptionService *service.PrescriptionService
+}
+
+func NewIntegrationHandler() *IntegrationHandler {
+	return &IntegrationHandler{
+		apiKeyService:       service.NewAPIKeyService(),
+		recordService:       service.NewRecordService(),
+		prescriptionService: service.NewPrescriptionService(),
+	}
+}
+
+// ExportRecords 导出病历（授权范围 record:export）
+func (h *IntegrationHandler) ExportRecords(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+	patientID, _ := strconv.ParseInt(c.Query("patientId"), 10, 64)
+
+	list, total, err := h.recordService.ExportRecords(patientID, c.Query("startDate"), c.Query("endDate"), page, pageSize)
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"list":     list,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+// GetPrescription 按处方编号查询处方（授权范围 prescription:read）
+func (h *IntegrationHandler) GetPrescription(c *gin.Context) {
+	detail, err := h.prescriptionService.GetByPrescriptionNo(c.Param("prescriptionNo"))
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, detail)
+}
+
+// GetServiceAccounts 服务账号列表
+func (h *IntegrationHandler) GetServiceAccounts(c *gin.Context) {
+	list, err := h.apiKeyService.ListServiceAccounts()
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"list":   list,
+		"scopes": service.APIScopeCatalog,
+	})
+}
+
+// CreateServiceAccount 创建服务账号
+func (h *IntegrationHandler) CreateServiceAccount(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	account, err := h.apiKeyService.CreateServiceAccount(adminID, req.Name, req.Description)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "创建成功", account)
+}
+
+// UpdateServiceAccountStatus 启用或禁用服务账号
+func (h *IntegrationHandler) UpdateServiceAccountStatus(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	var req struct {
+		ServiceAccountID int64 `json:"serviceAccountId" binding:"required"`
+		Status           *int  `json:"status" binding:"required"` // 0:启用 1:禁用
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.apiKeyService.UpdateServiceAccountStatus(adminID, req.ServiceAccountID, *req.Status); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "操作成功", nil)
+}
+
+// GetKeys API密钥列表，可按服务账号过滤
+func (h *IntegrationHandler) GetKeys(c *gin.Context) {
+	serviceAccountID, _ := strconv.ParseInt(c.Query("serviceAccountId"), 10, 64)
+
+	list, err := h.apiKeyService.ListKeys(serviceAccountID)
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, list)
+}
+
+// CreateKey 创建API密钥，完整密钥只在响应中出现一次
+func (h *IntegrationHandler) CreateKey(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	var req struct {
+		ServiceAccountID int64    `json:"serviceAccountId" binding:"required"`
+		Name             string   `json:"name"`
+		Scopes           []string `json:"scopes" binding:"required"`
+		RateLimit        int      `json:"rateLimit"`     // 每分钟调用上限，不填使用默认值
+		ExpiresInDays    int      `json:"expiresInDays"` // 有效天数，不填或超过上限时使用上限
+		SM2PublicKey     string   `json:"sm2PublicKey"`  // 填写后要求请求签名（PEM或16进制）
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	key, err := h.apiKeyService.CreateKey(adminID, req.ServiceAccountID, req.Name, req.Scopes, req.RateLimit, req.ExpiresInDays, req.SM2PublicKey)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "创建成功，请立即保存密钥，关闭后将无法再次查看", key)
+}
+
+// RevokeKey 吊销API密钥
+func (h *IntegrationHandler) RevokeKey(c *gin.Context) {
+	adminID := c.GetInt64("userID")
+
+	if err := h.apiKeyService.RevokeKey(adminID, c.Param("keyId")); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "已吊销", nil)
+}
+
+// GetAudits API调用审计
+func (h *IntegrationHandler) GetAudits(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	serviceAccountID, _ := strconv.ParseInt(c.Query("serviceAccountId"), 10, 64)
+
+	list, total, err := h.apiKeyService.GetAudits(page, pageSize, serviceAccountID, c.Query("keyId"))
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+		"list":     list,
+	})
+}
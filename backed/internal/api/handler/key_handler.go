@@ -2,6 +2,7 @@ package handler
 
 import (
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"sm-medical/internal/crypto"
 	"sm-medical/pkg/utils"
 )
@@ -12,12 +13,50 @@ func NewKeyHandler() *KeyHandler {
 	return &KeyHandler{}
 }
 
-// Generate 生成密钥
+// Generate 获取服务端SM2公钥（兼容旧接口，密钥持久化后不再变化）
 func (h *KeyHandler) Generate(c *gin.Context) {
 	publicKey := crypto.GetSM2PublicKeyHex()
 
 	utils.Success(c, gin.H{
 		"publicKey": publicKey,
+		"keyId":     crypto.SM2KeyID,
 		"message":   "密钥已生成",
 	})
 }
+
+// GetSM2PublicKey 发布服务端SM2公钥（可缓存）
+func (h *KeyHandler) GetSM2PublicKey(c *gin.Context) {
+	etag := `"` + crypto.SM2KeyID + `"`
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("ETag", etag)
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"keyId":        crypto.SM2KeyID,
+		"algorithm":    "SM2",
+		"cipherMode":   "C1C3C2",
+		"publicKey":    crypto.GetSM2PublicKeyHex(),
+		"publicKeyPem": crypto.GetSM2PublicKeyPEM(),
+		"transport":    "SM2(SM4会话密钥)+SM4-GCM", // 加密请求体格式见 crypto.TransportEnvelope
+	})
+}
+
+// GetCACertificate 发布内部CA根证书，用于校验医生签名证书
+func (h *KeyHandler) GetCACertificate(c *gin.Context) {
+	_, caPEM, err := crypto.CACertificate()
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	utils.Success(c, gin.H{
+		"keyId":          crypto.SM2KeyID,
+		"algorithm":      "SM2WithSM3",
+		"certificatePem": caPEM,
+	})
+}
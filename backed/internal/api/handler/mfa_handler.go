@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"sm-medical/internal/service"
+	"sm-medical/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAHandler TOTP两步验证接口
+type MFAHandler struct {
+	mfaService  *service.MFAService
+	userService *service.UserService
+}
+
+func NewMFAHandler() *MFAHandler {
+	return &MFAHandler{
+		mfaService:  service.NewMFAService(),
+		userService: service.NewUserService(),
+	}
+}
+
+// LoginVerify 登录第二步：提交动态口令或恢复码，成功后签发令牌
+func (h *MFAHandler) LoginVerify(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfaToken" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	result, err := h.userService.CompleteMFALogin(req.MFAToken, req.Code, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		loginError(c, err)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "登录成功", result)
+}
+
+// LoginSetup 强制两步验证的用户在登录过程中获取待绑定的密钥
+func (h *MFAHandler) LoginSetup(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfaToken" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	result, err := h.mfaService.SetupLoginEnrollment(req.MFAToken)
+	if err != nil {
+		utils.Unauthorized(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// GetStatus 查询两步验证状态
+func (h *MFAHandler) GetStatus(c *gin.Context) {
+	result, err := h.mfaService.Status(c.GetInt64("userID"), c.GetString("role"))
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// Setup 生成待绑定的密钥，返回密钥和 otpauth:// 地址
+func (h *MFAHandler) Setup(c *gin.Context) {
+	result, err := h.mfaService.Setup(c.GetInt64("userID"))
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// Enable 提交动态口令完成绑定，返回恢复码
+func (h *MFAHandler) Enable(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	codes, err := h.mfaService.Enable(c.GetInt64("userID"), req.Code)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "两步验证已启用，请妥善保存恢复码", gin.H{
+		"recoveryCodes": codes,
+	})
+}
+
+// Disable 关闭两步验证
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.mfaService.Disable(c.GetInt64("userID"), c.GetString("role"), req.Code); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "两步验证已关闭", nil)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(c.GetInt64("userID"), req.Code)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "恢复码已重新生成，旧恢复码已失效", gin.H{
+		"recoveryCodes": codes,
+	})
+}
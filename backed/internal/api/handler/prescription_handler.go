@@ -9,11 +9,13 @@ import (
 
 type PrescriptionHandler struct {
 	prescriptionService *service.PrescriptionService
+	signatureService    *service.SignatureService
 }
 
 func NewPrescriptionHandler() *PrescriptionHandler {
 	return &PrescriptionHandler{
 		prescriptionService: service.NewPrescriptionService(),
+		signatureService:    service.NewSignatureService(),
 	}
 }
 
@@ -68,7 +70,9 @@ func (h *PrescriptionHandler) GetPrescriptionDetail(c *gin.Context) {
 		return
 	}
 
-	detail, err := h.prescriptionService.GetPrescriptionDetail(userID, prescriptionID)
+	// 拥有审方权限（药师、管理员）可查看全部处方，否则只能查看本人相关处方
+	canReview := service.HasPermission(c.GetString("role"), service.PermPrescriptionReview)
+	detail, err := h.prescriptionService.GetPrescriptionDetail(userID, prescriptionID, canReview)
 	if err != nil {
 		utils.BadRequest(c, err.Error())
 		return
@@ -76,3 +80,20 @@ func (h *PrescriptionHandler) GetPrescriptionDetail(c *gin.Context) {
 
 	utils.Success(c, detail)
 }
+
+// VerifyPrescription 按处方编号验证处方签名
+func (h *PrescriptionHandler) VerifyPrescription(c *gin.Context) {
+	prescriptionNo := c.Query("prescriptionNo")
+	if prescriptionNo == "" {
+		utils.BadRequest(c, "缺少处方编号")
+		return
+	}
+
+	result, err := h.signatureService.VerifyPrescription(prescriptionNo)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
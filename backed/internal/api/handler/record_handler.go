@@ -8,12 +8,14 @@ import (
 )
 
 type RecordHandler struct {
-	service *service.RecordService
+	service          *service.RecordService
+	signatureService *service.SignatureService
 }
 
 func NewRecordHandler() *RecordHandler {
 	return &RecordHandler{
-		service: service.NewRecordService(),
+		service:          service.NewRecordService(),
+		signatureService: service.NewSignatureService(),
 	}
 }
 
@@ -58,3 +60,23 @@ func (h *RecordHandler) GetDetail(c *gin.Context) {
 
 	utils.Success(c, detail)
 }
+
+// Verify 验证病历签名
+func (h *RecordHandler) Verify(c *gin.Context) {
+	userID := c.GetInt64("userID")
+	recordIDStr := c.Query("recordId")
+
+	recordID, err := strconv.ParseInt(recordIDStr, 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "病历ID格式错误")
+		return
+	}
+
+	result, err := h.signatureService.VerifyRecord(userID, recordID)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, result)
+}
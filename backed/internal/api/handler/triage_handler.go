@@ -20,13 +20,6 @@ func NewTriageHandler() *TriageHandler {
 // UpdateOnlineStatus 更新医生在线状态
 func (h *TriageHandler) UpdateOnlineStatus(c *gin.Context) {
 	userID := c.GetInt64("userID")
-	role := c.GetString("role")
-
-	// 只有医生可以更新在线状态
-	if role != "doctor" {
-		utils.Forbidden(c, "只有医生可以更新在线状态")
-		return
-	}
 
 	var req struct {
 		IsOnline bool `json:"isOnline" binding:"required"`
@@ -57,13 +50,6 @@ func (h *TriageHandler) UpdateOnlineStatus(c *gin.Context) {
 // ManualAssignDoctor 手动触发智能分诊
 func (h *TriageHandler) ManualAssignDoctor(c *gin.Context) {
 	// userID := c.GetInt64("userID")  // TODO: 用于验证consultationId是否属于当前用户
-	role := c.GetString("role")
-
-	// 只有患者可以手动分诊
-	if role != "patient" {
-		utils.Forbidden(c, "只有患者可以使用此功能")
-		return
-	}
 
 	var req struct {
 		ConsultationID  int64  `json:"consultationId" binding:"required"`
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"log"
+	"math"
 	"sm-medical/internal/model"
 	"sm-medical/internal/service"
 	"sm-medical/pkg/utils"
@@ -10,12 +12,16 @@ import (
 )
 
 type UserHandler struct {
-	userService *service.UserService
+	userService    *service.UserService
+	certService    *service.DoctorCertService
+	sessionService *service.SessionService
 }
 
 func NewUserHandler() *UserHandler {
 	return &UserHandler{
-		userService: service.NewUserService(),
+		userService:    service.NewUserService(),
+		certService:    service.NewDoctorCertService(),
+		sessionService: service.NewSessionService(),
 	}
 }
 
@@ -105,20 +111,52 @@ func (h *UserHandler) Login(c *gin.Context) {
 	log.Printf("[登录请求] 密码前16位: %s...", req.Password[:16])
 
 	// 调用service登录
-	token, userInfo, err := h.userService.Login(req.Username, req.Password, c.ClientIP())
+	result, err := h.userService.Login(req.Username, req.Password, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
 		log.Printf("[登录失败] 用户名: %s, 错误: %v", req.Username, err)
-		utils.Unauthorized(c, err.Error())
+		loginError(c, err)
+		return
+	}
+
+	// 需要两步验证时返回第二步凭证
+	if result["mfaRequired"] == true {
+		utils.SuccessWithMessage(c, "请输入两步验证动态口令", result)
 		return
 	}
 
 	log.Printf("[登录成功] 用户名: %s", req.Username)
-	utils.SuccessWithMessage(c, "登录成功", gin.H{
-		"token":     token,
-		"tokenType": "Bearer",
-		"expiresIn": 7200,
-		"userInfo":  userInfo,
-	})
+	utils.SuccessWithMessage(c, "登录成功", result)
+}
+
+// loginError 登录失败响应，账号或IP被锁定时返回429和Retry-After
+func loginError(c *gin.Context, err error) {
+	var lockErr *service.LoginLockedError
+	if errors.As(err, &lockErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockErr.RetryAfter.Seconds()))))
+		utils.TooManyRequests(c, err.Error())
+		return
+	}
+	utils.Unauthorized(c, err.Error())
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换，旧刷新令牌作废
+func (h *UserHandler) RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	tokens, err := h.sessionService.Refresh(req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		utils.Unauthorized(c, err.Error())
+		return
+	}
+
+	utils.Success(c, tokens)
 }
 
 // GetUserInfo 获取用户信息
@@ -293,8 +331,53 @@ func (h *UserHandler) GetDoctorDetail(c *gin.Context) {
 	utils.Success(c, userInfo)
 }
 
-// Logout 退出登录
+// GetDoctorCertificate 获取医生SM2签名证书
+func (h *UserHandler) GetDoctorCertificate(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("userId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "用户ID格式错误")
+		return
+	}
+
+	cert, err := h.certService.GetDoctorCertificate(userID)
+	if err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.Success(c, cert)
+}
+
+// GetSessions 获取当前用户的登录会话（设备管理）
+func (h *UserHandler) GetSessions(c *gin.Context) {
+	list, err := h.sessionService.ListSessions(c.GetInt64("userID"), c.GetString("sessionID"))
+	if err != nil {
+		utils.InternalError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"list":  list,
+		"total": len(list),
+	})
+}
+
+// RevokeSession 下线指定会话
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	if err := h.sessionService.RevokeSession(c.GetInt64("userID"), c.Param("sessionId")); err != nil {
+		utils.NotFound(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(c, "已下线", nil)
+}
+
+// Logout 退出登录，吊销当前会话的访问令牌和刷新令牌
 func (h *UserHandler) Logout(c *gin.Context) {
-	// JWT无状态，客户端删除token即可
+	if err := h.sessionService.Logout(c.GetInt64("userID"), c.GetString("sessionID")); err != nil {
+		log.Printf("[退出登录] 吊销会话失败 - 用户ID: %d, 错误: %v", c.GetInt64("userID"), err)
+		utils.InternalError(c, "退出失败")
+		return
+	}
 	utils.SuccessWithMessage(c, "退出成功", nil)
 }
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"sm-medical/internal/service"
+	"sm-medical/pkg/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerificationHandler 邮箱/手机验证和找回密码接口
+type VerificationHandler struct {
+	userService *service.UserService
+}
+
+func NewVerificationHandler() *VerificationHandler {
+	return &VerificationHandler{
+		userService: service.NewUserService(),
+	}
+}
+
+// SendContactCode 向当前用户的邮箱或手机号发送验证码
+func (h *VerificationHandler) SendContactCode(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		Channel string `json:"channel" binding:"required,oneof=email phone"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	result, err := h.userService.SendContactCode(userID, req.Channel, c.ClientIP())
+	if err != nil {
+		verificationError(c, err)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "验证码已发送", result)
+}
+
+// ConfirmContact 提交验证码完成邮箱或手机号验证
+func (h *VerificationHandler) ConfirmContact(c *gin.Context) {
+	userID := c.GetInt64("userID")
+
+	var req struct {
+		Channel string `json:"channel" binding:"required,oneof=email phone"`
+		Code    string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if err := h.userService.ConfirmContact(userID, req.Channel, req.Code); err != nil {
+		verificationError(c, err)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "验证成功", nil)
+}
+
+// ForgotPassword 忘记密码，向账号绑定的邮箱或手机号发送重置验证码
+func (h *VerificationHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Account string `json:"account" binding:"required"` // 用户名、邮箱或手机号
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	result := h.userService.ForgotPassword(req.Account, c.ClientIP())
+	utils.SuccessWithMessage(c, "如果账号存在，验证码已发送到绑定的邮箱或手机号", result)
+}
+
+// VerifyResetCode 校验重置验证码，返回一次性重置凭证
+func (h *VerificationHandler) VerifyResetCode(c *gin.Context) {
+	var req struct {
+		Account string `json:"account" binding:"required"`
+		Code    string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	result, err := h.userService.VerifyResetCode(req.Account, req.Code)
+	if err != nil {
+		verificationError(c, err)
+		return
+	}
+
+	utils.Success(c, result)
+}
+
+// ResetPassword 使用重置凭证设置新密码
+func (h *VerificationHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		ResetToken      string `json:"resetToken" binding:"required"`
+		NewPassword     string `json:"newPassword" binding:"required"`
+		ConfirmPassword string `json:"confirmPassword" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "参数错误")
+		return
+	}
+
+	if req.NewPassword != req.ConfirmPassword {
+		utils.BadRequest(c, "两次密码不一致")
+		return
+	}
+
+	if err := h.userService.ResetPassword(req.ResetToken, req.NewPassword); err != nil {
+		verificationError(c, err)
+		return
+	}
+
+	utils.SuccessWithMessage(c, "密码已重置，请使用新密码登录", nil)
+}
+
+// verificationError 验证码相关的错误响应，发送过于频繁时返回429和Retry-After
+func verificationError(c *gin.Context, err error) {
+	var limitErr *service.SendRateLimitError
+	if errors.As(err, &limitErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+		utils.TooManyRequests(c, err.Error())
+		return
+	}
+	utils.BadRequest(c, err.Error())
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"sm-medical/internal/api/handler"
 	"sm-medical/internal/middleware"
+	"sm-medical/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,25 +15,50 @@ func RegisterRoutes(r *gin.Engine) {
 
 	// 用户模块
 	userHandler := handler.NewUserHandler()
+	mfaHandler := handler.NewMFAHandler()
+	verificationHandler := handler.NewVerificationHandler()
 	user := api.Group("/user")
 	{
 		// 公开接口
-		user.POST("/register", userHandler.Register)
-		user.POST("/login", userHandler.Login)
+		user.POST("/register", middleware.TransportDecrypt(), userHandler.Register) // 支持SM2+SM4加密请求体
+		user.POST("/login", middleware.TransportDecrypt(), userHandler.Login)
+		user.POST("/refresh", userHandler.RefreshToken) // 刷新访问令牌（轮换刷新令牌）
+		user.POST("/login/mfa", mfaHandler.LoginVerify)      // 登录第二步：提交动态口令或恢复码
+		user.POST("/login/mfa/setup", mfaHandler.LoginSetup) // 强制两步验证的用户登录时绑定
+
+		// 找回密码
+		user.POST("/password/forgot", verificationHandler.ForgotPassword)       // 忘记密码：发送重置验证码
+		user.POST("/password/reset/verify", verificationHandler.VerifyResetCode) // 校验重置验证码，换取重置凭证
+		user.POST("/password/reset", verificationHandler.ResetPassword)          // 使用重置凭证设置新密码
+
 		user.GET("/doctors", userHandler.GetDoctors)
 		user.GET("/doctor/:userId", userHandler.GetDoctorDetail)
+		user.GET("/doctor/:userId/certificate", userHandler.GetDoctorCertificate) // 医生签名证书
 
 		// 需要认证的接口
 		auth := user.Group("")
 		auth.Use(middleware.AuthMiddleware())
 		{
 			auth.GET("/info", userHandler.GetUserInfo) // 获取当前用户信息，需要登录
-			auth.PUT("/profile", userHandler.UpdateProfile)
+			auth.PUT("/profile", middleware.TransportDecrypt(), userHandler.UpdateProfile)
 			auth.PUT("/password", userHandler.ChangePassword)
 			// 以下接口已废弃，现在区分医生和患者在注册页面完成
 			// auth.POST("/apply-doctor", userHandler.ApplyDoctor)
 			// auth.GET("/doctor-application", userHandler.GetDoctorApplication)
 			auth.POST("/logout", userHandler.Logout)
+			auth.GET("/sessions", userHandler.GetSessions)                 // 登录设备列表
+			auth.DELETE("/sessions/:sessionId", userHandler.RevokeSession) // 下线指定设备
+
+			// 邮箱/手机验证
+			auth.POST("/verify/send", verificationHandler.SendContactCode)   // 发送邮箱/手机验证码
+			auth.POST("/verify/confirm", verificationHandler.ConfirmContact) // 提交验证码完成验证
+
+			// 两步验证
+			auth.GET("/mfa", mfaHandler.GetStatus)                                // 两步验证状态
+			auth.POST("/mfa/setup", mfaHandler.Setup)                             // 生成待绑定的TOTP密钥
+			auth.POST("/mfa/enable", mfaHandler.Enable)                           // 校验动态口令后启用
+			auth.POST("/mfa/disable", mfaHandler.Disable)                         // 关闭两步验证
+			auth.POST("/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes) // 重新生成恢复码
 		}
 	}
 
@@ -41,11 +67,27 @@ func RegisterRoutes(r *gin.Engine) {
 	consultation := api.Group("/consultation")
 	consultation.Use(middleware.AuthMiddleware())
 	{
-		consultation.POST("/create", consultationHandler.Create)
+		consultation.POST("/create", middleware.RequirePermission(service.PermConsultationCreate), middleware.TransportDecrypt(), consultationHandler.Create)
 		consultation.GET("/list", consultationHandler.GetList)
 		consultation.GET("/detail", consultationHandler.GetDetail)
-		consultation.POST("/accept", consultationHandler.Accept)
-		consultation.POST("/finish", consultationHandler.Finish)
+		consultation.POST("/accept", middleware.RequirePermission(service.PermConsultationAccept), consultationHandler.Accept)
+		consultation.POST("/finish", middleware.RequirePermission(service.PermConsultationFinish), consultationHandler.Finish)
+		consultation.POST("/cancel", middleware.RequirePermission(service.PermConsultationCreate), consultationHandler.Cancel)     // 患者取消问诊
+		consultation.POST("/decline", middleware.RequirePermission(service.PermConsultationAccept), consultationHandler.Decline)   // 医生拒绝接诊
+		consultation.POST("/transfer", middleware.RequirePermission(service.PermConsultationAccept), consultationHandler.Transfer) // 医生转诊
+		consultation.POST("/reopen", consultationHandler.Reopen)                                                                   // 重新打开已结束的问诊
+		consultation.GET("/events", consultationHandler.GetEvents)                                                                 // 状态变更历史
+
+		// 多学科会诊
+		consultation.GET("/participants", consultationHandler.GetParticipants)                                                                         // 主诊医生和会诊医生
+		consultation.POST("/participants/invite", middleware.RequirePermission(service.PermConsultationAccept), consultationHandler.InviteParticipant) // 邀请会诊医生
+		consultation.POST("/participants/remove", middleware.RequirePermission(service.PermConsultationAccept), consultationHandler.RemoveParticipant) // 移除或退出会诊
+		consultation.POST("/participants/opinion", middleware.RequirePermission(service.PermConsultationAccept), consultationHandler.SubmitOpinion)    // 提交会诊意见
+
+		// 复诊
+		consultation.GET("/follow-up/prefill", middleware.RequirePermission(service.PermConsultationCreate), consultationHandler.GetFollowUpPrefill) // 发起复诊时预填上次问诊
+		consultation.POST("/follow-up/schedule", middleware.RequirePermission(service.PermConsultationFinish), consultationHandler.ScheduleFollowUp) // 安排复诊
+		consultation.GET("/follow-ups", consultationHandler.GetFollowUps)                                                                            // 患者待复诊计划
 	}
 
 	// 病历模块
@@ -55,6 +97,7 @@ func RegisterRoutes(r *gin.Engine) {
 	{
 		record.GET("/list", recordHandler.GetList)
 		record.GET("/detail", recordHandler.GetDetail)
+		record.GET("/verify", recordHandler.Verify) // 验证病历签名
 	}
 
 	// 通知模块
@@ -72,6 +115,8 @@ func RegisterRoutes(r *gin.Engine) {
 	key := api.Group("/key")
 	{
 		key.POST("/generate", keyHandler.Generate).Use(middleware.AuthMiddleware())
+		key.GET("/sm2-public", keyHandler.GetSM2PublicKey) // 公开接口，可缓存
+		key.GET("/ca-cert", keyHandler.GetCACertificate)   // 内部CA根证书
 	}
 
 	// 文件上传
@@ -87,9 +132,10 @@ func RegisterRoutes(r *gin.Engine) {
 	prescription := api.Group("/prescription")
 	prescription.Use(middleware.AuthMiddleware())
 	{
-		prescription.GET("/medicines/search", prescriptionHandler.SearchMedicines)           // 搜索药品
-		prescription.POST("/medicines/recommend", prescriptionHandler.GetRecommendedMedicines) // AI推荐药品
-		prescription.GET("/:prescriptionId", prescriptionHandler.GetPrescriptionDetail)       // 获取处方详情
+		prescription.GET("/medicines/search", middleware.RequirePermission(service.PermMedicineSearch), prescriptionHandler.SearchMedicines)              // 搜索药品
+		prescription.POST("/medicines/recommend", middleware.RequirePermission(service.PermMedicineSearch), prescriptionHandler.GetRecommendedMedicines) // AI推荐药品
+		prescription.GET("/verify", middleware.RequirePermission(service.PermPrescriptionVerify), prescriptionHandler.VerifyPrescription)               // 验证处方签名
+		prescription.GET("/:prescriptionId", middleware.RequirePermission(service.PermPrescriptionView), prescriptionHandler.GetPrescriptionDetail)     // 获取处方详情
 	}
 
 	// 聊天模块
@@ -112,6 +158,14 @@ func RegisterRoutes(r *gin.Engine) {
 		}
 	}
 
+	// 院内系统集成接口（服务账号API密钥认证，不使用用户登录令牌）
+	integrationHandler := handler.NewIntegrationHandler()
+	integration := api.Group("/integration")
+	{
+		integration.GET("/records/export", middleware.APIKeyAuth(service.ScopeRecordExport), integrationHandler.ExportRecords)                      // 导出病历
+		integration.GET("/prescriptions/:prescriptionNo", middleware.APIKeyAuth(service.ScopePrescriptionRead), integrationHandler.GetPrescription) // 按编号查询处方
+	}
+
 	// 管理员模块
 	adminHandler := handler.NewAdminHandler()
 	admin := api.Group("/user/admin")
@@ -120,9 +174,28 @@ func RegisterRoutes(r *gin.Engine) {
 		// 以下接口已废弃，现在医生注册直接生效，不需要审核
 		// admin.PUT("/review-doctor", adminHandler.ReviewDoctorApplication)
 		// admin.GET("/doctor-applications", adminHandler.GetDoctorApplications)
-		admin.GET("/users", adminHandler.GetUsers)
-		admin.PUT("/status", adminHandler.UpdateUserStatus)
-		admin.GET("/login-logs", adminHandler.GetLoginLogs)
+		admin.GET("/users", middleware.RequirePermission(service.PermUserManage), adminHandler.GetUsers)
+		admin.PUT("/status", middleware.RequirePermission(service.PermUserManage), adminHandler.UpdateUserStatus)
+		admin.PUT("/role", middleware.RequirePermission(service.PermUserManage), adminHandler.UpdateUserRole) // 分配用户角色
+		admin.POST("/mfa/reset", middleware.RequirePermission(service.PermUserManage), adminHandler.ResetUserMFA) // 重置用户两步验证
+		admin.GET("/login-logs", middleware.RequirePermission(service.PermLogView), adminHandler.GetLoginLogs)
+		admin.POST("/unlock", middleware.RequirePermission(service.PermUserManage), adminHandler.UnlockLogin) // 解除账号/IP登录锁定
+		admin.GET("/security-events", middleware.RequirePermission(service.PermSecurityManage), adminHandler.GetSecurityEvents)          // 登录异常安全事件
+		admin.PUT("/security-events/handle", middleware.RequirePermission(service.PermSecurityManage), adminHandler.HandleSecurityEvent) // 处理安全事件
+		admin.POST("/crypto/reencrypt", middleware.RequirePermission(service.PermCryptoManage), adminHandler.StartReencrypt)       // 启动/恢复密钥轮换重加密
+		admin.POST("/crypto/reencrypt/pause", middleware.RequirePermission(service.PermCryptoManage), adminHandler.PauseReencrypt) // 暂停重加密
+		admin.GET("/crypto/reencrypt", middleware.RequirePermission(service.PermCryptoManage), adminHandler.GetReencryptProgress)  // 查询重加密进度
+		admin.GET("/rbac", middleware.RequirePermission(service.PermRBACManage), adminHandler.GetRolePermissions)                  // 权限目录和角色权限
+		admin.PUT("/rbac", middleware.RequirePermission(service.PermRBACManage), adminHandler.UpdateRolePermissions)               // 修改角色权限
+
+		// 服务账号和API密钥
+		admin.GET("/service-accounts", middleware.RequirePermission(service.PermIntegrationManage), integrationHandler.GetServiceAccounts)                // 服务账号列表和授权范围目录
+		admin.POST("/service-accounts", middleware.RequirePermission(service.PermIntegrationManage), integrationHandler.CreateServiceAccount)             // 创建服务账号
+		admin.PUT("/service-accounts/status", middleware.RequirePermission(service.PermIntegrationManage), integrationHandler.UpdateServiceAccountStatus) // 启用/禁用服务账号
+		admin.GET("/service-accounts/keys", middleware.RequirePermission(service.PermIntegrationManage), integrationHandler.GetKeys)                      // API密钥列表
+		admin.POST("/service-accounts/keys", middleware.RequirePermission(service.PermIntegrationManage), integrationHandler.CreateKey)                   // 创建API密钥
+		admin.DELETE("/service-accounts/keys/:keyId", middleware.RequirePermission(service.PermIntegrationManage), integrationHandler.RevokeKey)          // 吊销API密钥
+		admin.GET("/service-accounts/audits", middleware.RequirePermission(service.PermIntegrationManage), integrationHandler.GetAudits)                  // API调用审计
 	}
 
 	// 智能分诊模块
@@ -130,8 +203,8 @@ func RegisterRoutes(r *gin.Engine) {
 	triage := api.Group("/triage")
 	triage.Use(middleware.AuthMiddleware())
 	{
-		triage.PUT("/online-status", triageHandler.UpdateOnlineStatus)      // 更新医生在线状态
-		triage.POST("/auto-assign", triageHandler.ManualAssignDoctor)       // 手动触发智能分诊
+		triage.PUT("/online-status", middleware.RequirePermission(service.PermDoctorOnline), triageHandler.UpdateOnlineStatus)      // 更新医生在线状态
+		triage.POST("/auto-assign", middleware.RequirePermission(service.PermConsultationCreate), triageHandler.ManualAssignDoctor) // 手动触发智能分诊
 		triage.GET("/workload", triageHandler.GetDoctorWorkload)           // 获取医生负载信息
 	}
 }
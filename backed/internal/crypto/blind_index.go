@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/tjfoc/gmsm/sm3"
+)
+
+// 盲索引：对敏感字段的规范化明文计算HMAC-SM3，用于在随机化加密的列上做精确匹配查询
+// 不同字段使用不同的域前缀，相同值在不同字段上的索引互不相同
+
+// 盲索引字段
+const (
+	BlindIndexEmail    = "email"
+	BlindIndexPhone    = "phone"
+	BlindIndexRealName = "real_name"
+	BlindIndexIDCard   = "id_card"
+	BlindIndexIP       = "ip" // 登录锁定按IP统计，不保存明文IP
+)
+
+// blindIndexKey 盲索引密钥（与SM4数据密钥分离）
+var blindIndexKey []byte
+
+// InitBlindIndex 初始化盲索引密钥
+// keyHex为空时由 crypto.sm4_key 派生（derived=true），生产环境应单独配置
+func InitBlindIndex(keyHex string) (derived bool, err error) {
+	keyHex = strings.TrimSpace(keyHex)
+	if keyHex == "" {
+		if len(SM4Key) == 0 {
+			return false, errors.New("SM4密钥未初始化，无法派生盲索引密钥")
+		}
+		mac := hmac.New(sm3.New, SM4Key)
+		mac.Write([]byte("sm-medical blind index"))
+		blindIndexKey = mac.Sum(nil)
+		return true, nil
+	}
+
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return false, errors.New("盲索引密钥必须是16进制字符串")
+	}
+	if len(key) < 16 {
+		return false, errors.New("盲索引密钥长度至少16字节(32位16进制)")
+	}
+	blindIndexKey = key
+	return false, nil
+}
+
+// BlindIndex 计算字段的盲索引，空值返回空字符串
+func BlindIndex(field, value string) string {
+	value = normalizeBlindIndexValue(field, value)
+	if value == "" {
+		return ""
+	}
+
+	mac := hmac.New(sm3.New, blindIndexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// normalizeBlindIndexValue 规范化明文，使书写差异不影响匹配
+func normalizeBlindIndexValue(field, value string) string {
+	value = strings.TrimSpace(value)
+	switch field {
+	case BlindIndexEmail:
+		return strings.ToLower(value)
+	case BlindIndexPhone:
+		// 只保留数字，去掉+86国家码
+		digits := strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, value)
+		if len(digits) == 13 && strings.HasPrefix(digits, "86") {
+			digits = digits[2:]
+		}
+		return digits
+	case BlindIndexIDCard:
+		return strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+	case BlindIndexRealName:
+		return strings.Join(strings.Fields(value), " ")
+	}
+	return value
+}
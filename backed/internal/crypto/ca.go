@@ -0,0 +1,268 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/sm3"
+	"github.com/tjfoc/gmsm/x509"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// 内部CA：以医院SM2密钥作为根密钥，为每位医生签发SM2签名证书
+
+// DoctorCertValidity 医生证书有效期
+const DoctorCertValidity = 2 * 365 * 24 * time.Hour
+
+// caOrganization 证书颁发机构名称
+const caOrganization = "SM Medical"
+
+// 医生私钥口令保护参数（PBKDF2-SM3派生SM4密钥）
+const (
+	sealedKeyScheme     = "pbkdf2-sm3"
+	sealedKeyIterations = 100000
+	sealedKeySaltLen    = 16
+)
+
+var (
+	// ErrCertificateInvalid 证书不是由本院CA签发或已过期
+	ErrCertificateInvalid = errors.New("证书无效或不是由本院CA签发")
+	// ErrSealedKeyInvalid 私钥口令错误或密文损坏
+	ErrSealedKeyInvalid = errors.New("医生私钥解锁失败，口令错误或密文已损坏")
+)
+
+var (
+	caMu    sync.Mutex
+	caCert  *x509.Certificate
+	caPEM   string
+	caKeyID string
+)
+
+// DoctorCertSubject 医生证书主体信息
+type DoctorCertSubject struct {
+	DoctorID   int64
+	Username   string
+	RealName   string
+	Dept       string
+	CertNumber string // 医师执业证书编号
+}
+
+// IssuedCertificate 签发结果
+type IssuedCertificate struct {
+	SerialNumber   string
+	CertificatePEM string
+	NotBefore      time.Time
+	NotAfter       time.Time
+}
+
+// CACertificate 获取内部CA根证书（由医院SM2密钥自签名，密钥变化时重新生成）
+func CACertificate() (*x509.Certificate, string, error) {
+	if SM2PrivateKey == nil {
+		return nil, "", ErrSM2KeyNotConfigured
+	}
+
+	caMu.Lock()
+	defer caMu.Unlock()
+
+	if caCert != nil && caKeyID == SM2KeyID {
+		return caCert, caPEM, nil
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName:   caOrganization + " Internal CA",
+			Organization: []string{caOrganization},
+		},
+		NotBefore:             time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2044, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          publicKeySKI(SM2PublicKey),
+		SignatureAlgorithm:    x509.SM2WithSM3,
+	}
+
+	certPEM, err := x509.CreateCertificateToPem(template, template, SM2PublicKey, SM2PrivateKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("生成CA证书失败: %w", err)
+	}
+	cert, err := x509.ReadCertificateFromPem(certPEM)
+	if err != nil {
+		return nil, "", fmt.Errorf("解析CA证书失败: %w", err)
+	}
+
+	caCert = cert
+	caPEM = string(certPEM)
+	caKeyID = SM2KeyID
+	return caCert, caPEM, nil
+}
+
+// IssueDoctorCertificate 为医生公钥签发证书
+func IssueDoctorCertificate(subject DoctorCertSubject, pub *sm2.PublicKey, validity time.Duration) (*IssuedCertificate, error) {
+	parent, _, err := CACertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, err
+	}
+
+	commonName := subject.Username
+	if subject.RealName != "" {
+		commonName = subject.RealName + " (" + subject.Username + ")"
+	}
+	name := pkix.Name{
+		CommonName:   commonName,
+		Organization: []string{caOrganization},
+		SerialNumber: strconv.FormatInt(subject.DoctorID, 10),
+	}
+	if subject.Dept != "" {
+		name.OrganizationalUnit = []string{subject.Dept}
+	}
+	if subject.CertNumber != "" {
+		// description属性记录医师执业证书编号
+		name.ExtraNames = append(name.ExtraNames, pkix.AttributeTypeAndValue{Type: asn1.ObjectIdentifier{2, 5, 4, 13}, Value: subject.CertNumber})
+	}
+
+	notBefore := time.Now().Add(-5 * time.Minute)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               name,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		SubjectKeyId:          publicKeySKI(pub),
+		SignatureAlgorithm:    x509.SM2WithSM3,
+	}
+
+	certPEM, err := x509.CreateCertificateToPem(template, parent, pub, SM2PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("签发医生证书失败: %w", err)
+	}
+
+	return &IssuedCertificate{
+		SerialNumber:   strings.ToUpper(serial.Text(16)),
+		CertificatePEM: string(certPEM),
+		NotBefore:      template.NotBefore,
+		NotAfter:       template.NotAfter,
+	}, nil
+}
+
+// VerifyDoctorCertificate 校验证书由本院CA签发且在at时刻处于有效期内，返回证书公钥
+func VerifyDoctorCertificate(certPEM string, at time.Time) (*sm2.PublicKey, error) {
+	parent, _, err := CACertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ReadCertificateFromPem([]byte(certPEM))
+	if err != nil {
+		return nil, ErrCertificateInvalid
+	}
+	if err := cert.CheckSignatureFrom(parent); err != nil {
+		return nil, ErrCertificateInvalid
+	}
+	if at.Before(cert.NotBefore) || at.After(cert.NotAfter) {
+		return nil, fmt.Errorf("证书不在有效期内(%s ~ %s)", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"))
+	}
+
+	// gmsm解析证书得到的是SM2曲线上的ecdsa公钥
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != sm2.P256Sm2() {
+		return nil, ErrCertificateInvalid
+	}
+	return &sm2.PublicKey{Curve: pub.Curve, X: pub.X, Y: pub.Y}, nil
+}
+
+// SealSM2PrivateKey 使用口令派生密钥加密SM2私钥
+// 格式: pbkdf2-sm3$<迭代次数>$<base64(salt)>$<base64(nonce|密文|tag)>
+func SealSM2PrivateKey(priv *sm2.PrivateKey, password string) (string, error) {
+	der, err := x509.MarshalSm2UnecryptedPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, sealedKeySaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	aead, err := newSM4GCM(deriveSealingKey(password, salt, sealedKeyIterations))
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, der, []byte(sealedKeyScheme))
+
+	return strings.Join([]string{
+		sealedKeyScheme,
+		strconv.Itoa(sealedKeyIterations),
+		base64.StdEncoding.EncodeToString(salt),
+		base64.StdEncoding.EncodeToString(sealed),
+	}, "$"), nil
+}
+
+// OpenSM2PrivateKey 使用口令解锁SealSM2PrivateKey加密的私钥
+func OpenSM2PrivateKey(sealed, password string) (*sm2.PrivateKey, error) {
+	parts := strings.Split(sealed, "$")
+	if len(parts) != 4 || parts[0] != sealedKeyScheme {
+		return nil, ErrSealedKeyInvalid
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return nil, ErrSealedKeyInvalid
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrSealedKeyInvalid
+	}
+	data, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, ErrSealedKeyInvalid
+	}
+
+	aead, err := newSM4GCM(deriveSealingKey(password, salt, iterations))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrSealedKeyInvalid
+	}
+	der, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(sealedKeyScheme))
+	if err != nil {
+		return nil, ErrSealedKeyInvalid
+	}
+
+	return x509.ParsePKCS8UnecryptedPrivateKey(der)
+}
+
+// deriveSealingKey PBKDF2-SM3派生16字节SM4密钥
+func deriveSealingKey(password string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(password), salt, iterations, 16, sm3.New)
+}
+
+// publicKeySKI 证书SubjectKeyId（公钥SM3摘要前20字节）
+func publicKeySKI(pub *sm2.PublicKey) []byte {
+	sum, _ := hex.DecodeString(SM3Hash(EncodeSM2PublicKeyHex(pub)))
+	return sum[:20]
+}
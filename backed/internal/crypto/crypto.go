@@ -1,20 +1,36 @@
 package crypto
 
 import (
+	"crypto/cipher"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"strings"
 	"github.com/tjfoc/gmsm/sm2"
 	"github.com/tjfoc/gmsm/sm3"
 	"github.com/tjfoc/gmsm/sm4"
 )
 
+const (
+	// sm4GCMVersion SM4-GCM密文格式版本（旧版ECB密文无前缀，视为v1）
+	sm4GCMVersion = "v2"
+)
+
+var (
+	ErrUnknownCiphertextVersion = errors.New("未知的密文版本")
+	ErrUnknownKeyID             = errors.New("未知的密钥标识")
+	ErrCiphertextTooShort       = errors.New("密文长度不足")
+	ErrCiphertextTampered       = errors.New("密文校验失败，数据可能被篡改")
+)
+
 var (
 	SM4Key        []byte
 	SM2PrivateKey *sm2.PrivateKey
 	SM2PublicKey  *sm2.PublicKey
 )
 
-// InitCrypto 初始化国密算法
+// InitCrypto 初始化国密算法（SM4密钥），SM2密钥由 LoadSM2KeyPair 加载
 func InitCrypto(sm4KeyHex string) error {
 	// 初始化SM4密钥
 	var err error
@@ -22,13 +38,17 @@ func InitCrypto(sm4KeyHex string) error {
 	if err != nil {
 		return err
 	}
+	if len(SM4Key) != 16 {
+		return errors.New("SM4密钥长度必须为16字节(32位16进制)")
+	}
 
-	// 生成SM2密钥对
-	SM2PrivateKey, err = sm2.GenerateKey(rand.Reader)
-	if err != nil {
+	// 初始化密钥环，crypto.sm4_key 作为默认活动密钥
+	if err := SM4Keys.AddKey(LegacySM4KeyID, SM4Key); err != nil {
+		return err
+	}
+	if err := SM4Keys.SetActive(LegacySM4KeyID); err != nil {
 		return err
 	}
-	SM2PublicKey = &SM2PrivateKey.PublicKey
 
 	return nil
 }
@@ -45,31 +65,95 @@ func SM3HashWithSalt(data, salt string) string {
 	return SM3Hash(data + salt)
 }
 
-// SM4Encrypt SM4加密
+// SM4Encrypt SM4-GCM加密（随机nonce，带版本和密钥标识前缀）
+// 密文格式: v2:<keyID>:<base64(nonce|密文|tag)>；配置了密钥提供者时使用信封加密(v3)
 func SM4Encrypt(plaintext string) (string, error) {
 	if plaintext == "" {
 		return "", nil
 	}
 
-	ciphertext, err := sm4.Sm4Ecb(SM4Key, []byte(plaintext), true)
+	if p := CurrentKeyProvider(); p != nil {
+		return sm4EncryptEnvelope(p, plaintext)
+	}
+
+	keyID, key, err := SM4Keys.Active()
 	if err != nil {
 		return "", err
 	}
 
-	return hex.EncodeToString(ciphertext), nil
+	aead, err := newSM4GCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sm4GCMVersion + ":" + keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
 }
 
-// SM4Decrypt SM4解密
+// SM4Decrypt SM4解密，支持信封密文(v3)、GCM密文(v2)和旧版ECB密文（纯16进制，无前缀）
 func SM4Decrypt(ciphertext string) (string, error) {
 	if ciphertext == "" {
 		return "", nil
 	}
 
+	if !strings.Contains(ciphertext, ":") {
+		return sm4DecryptECB(ciphertext)
+	}
+
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) == 3 && parts[0] == sm4EnvelopeVersion {
+		return sm4DecryptEnvelope(parts[1], parts[2])
+	}
+	if len(parts) != 3 || parts[0] != sm4GCMVersion {
+		return "", ErrUnknownCiphertextVersion
+	}
+	key, err := SM4Keys.Key(parts[1])
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newSM4GCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrCiphertextTooShort
+	}
+
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", ErrCiphertextTampered
+	}
+
+	return string(plaintext), nil
+}
+
+// IsLegacySM4Ciphertext 判断是否为旧版ECB密文
+func IsLegacySM4Ciphertext(ciphertext string) bool {
+	return ciphertext != "" && !strings.Contains(ciphertext, ":")
+}
+
+// sm4DecryptECB 解密旧版ECB密文
+func sm4DecryptECB(ciphertext string) (string, error) {
 	data, err := hex.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
 	}
 
+	if len(SM4Key) == 0 {
+		return "", ErrUnknownKeyID
+	}
 	plaintext, err := sm4.Sm4Ecb(SM4Key, data, false)
 	if err != nil {
 		return "", err
@@ -78,6 +162,15 @@ func SM4Decrypt(ciphertext string) (string, error) {
 	return string(plaintext), nil
 }
 
+// newSM4GCM 创建SM4-GCM实例
+func newSM4GCM(key []byte) (cipher.AEAD, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
 // SM2Encrypt SM2加密
 func SM2Encrypt(plaintext string) (string, error) {
 	if plaintext == "" {
@@ -111,10 +204,10 @@ func SM2Decrypt(ciphertext string) (string, error) {
 	return string(plaintext), nil
 }
 
-// GetSM2PublicKeyHex 获取SM2公钥的16进制字符串
+// GetSM2PublicKeyHex 获取SM2公钥的16进制字符串(04||X||Y)
 func GetSM2PublicKeyHex() string {
 	if SM2PublicKey == nil {
 		return ""
 	}
-	return hex.EncodeToString(SM2PublicKey.X.Bytes()) + hex.EncodeToString(SM2PublicKey.Y.Bytes())
+	return EncodeSM2PublicKeyHex(SM2PublicKey)
 }
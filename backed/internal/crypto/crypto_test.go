@@ -0,0 +1,159 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testSM4KeyHex = "0123456789abcdef0123456789abcdef"
+
+// resetSM4Keys 重置全局密钥环，只保留 crypto.sm4_key 对应的k1
+func resetSM4Keys(t *testing.T) {
+	t.Helper()
+	SetKeyProvider(nil)
+	SM4Keys = NewSM4Keyring()
+	if err := InitCrypto(testSM4KeyHex); err != nil {
+		t.Fatalf("初始化SM4密钥失败: %v", err)
+	}
+}
+
+func TestSM4EncryptRoundTrip(t *testing.T) {
+	resetSM4Keys(t)
+
+	for _, plaintext := range []string{"13800138000", "张三", strings.Repeat("病历", 500)} {
+		ciphertext, err := SM4Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("加密失败: %v", err)
+		}
+		if !strings.HasPrefix(ciphertext, "v2:k1:") {
+			t.Fatalf("密文格式 = %q, 期望 v2:k1: 前缀", ciphertext)
+		}
+		got, err := SM4Decrypt(ciphertext)
+		if err != nil {
+			t.Fatalf("解密失败: %v", err)
+		}
+		if got != plaintext {
+			t.Fatalf("解密结果 = %q, 期望 %q", got, plaintext)
+		}
+	}
+
+	// 随机nonce，相同明文的密文不同
+	a, _ := SM4Encrypt("13800138000")
+	b, _ := SM4Encrypt("13800138000")
+	if a == b {
+		t.Fatal("相同明文两次加密得到相同密文")
+	}
+
+	if c, err := SM4Encrypt(""); err != nil || c != "" {
+		t.Fatalf("空明文加密 = %q, %v", c, err)
+	}
+}
+
+func TestSM4DecryptAfterRotation(t *testing.T) {
+	resetSM4Keys(t)
+
+	old, err := SM4Encrypt("13800138000")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if err := SM4Keys.AddKey("k2", []byte("fedcba9876543210")); err != nil {
+		t.Fatalf("添加密钥失败: %v", err)
+	}
+	if err := SM4Keys.SetActive("k2"); err != nil {
+		t.Fatalf("切换活动密钥失败: %v", err)
+	}
+
+	rotated, err := SM4Encrypt("13800138000")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if !strings.HasPrefix(rotated, "v2:k2:") {
+		t.Fatalf("轮换后密文 = %q, 期望 v2:k2: 前缀", rotated)
+	}
+	for _, c := range []string{old, rotated} {
+		if got, err := SM4Decrypt(c); err != nil || got != "13800138000" {
+			t.Fatalf("解密 %q = %q, %v", c, got, err)
+		}
+	}
+}
+
+func TestSM4DecryptTampered(t *testing.T) {
+	resetSM4Keys(t)
+	if err := SM4Keys.AddKey("k2", []byte("fedcba9876543210")); err != nil {
+		t.Fatalf("添加密钥失败: %v", err)
+	}
+
+	ciphertext, err := SM4Encrypt("13800138000")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, "v2:k1:"))
+	if err != nil {
+		t.Fatalf("解析密文失败: %v", err)
+	}
+
+	// flip 翻转密文中指定位置的一位
+	flip := func(i int) string {
+		b := append([]byte(nil), sealed...)
+		b[i] ^= 0x01
+		return "v2:k1:" + base64.StdEncoding.EncodeToString(b)
+	}
+
+	cases := []struct {
+		name       string
+		ciphertext string
+		err        error
+	}{
+		{"nonce", flip(0), ErrCiphertextTampered},
+		{"ciphertext", flip(12), ErrCiphertextTampered},
+		{"tag", flip(len(sealed) - 1), ErrCiphertextTampered},
+		{"other key", strings.Replace(ciphertext, ":k1:", ":k2:", 1), ErrCiphertextTampered},
+		{"unknown key", strings.Replace(ciphertext, ":k1:", ":k9:", 1), ErrUnknownKeyID},
+		{"unknown version", strings.Replace(ciphertext, "v2:", "v9:", 1), ErrUnknownCiphertextVersion},
+		{"truncated", "v2:k1:" + base64.StdEncoding.EncodeToString(sealed[:20]), ErrCiphertextTooShort},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SM4Decrypt(tc.ciphertext)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("解密错误 = %v, 期望 %v", err, tc.err)
+			}
+			if got != "" {
+				t.Fatalf("篡改密文返回了明文 %q", got)
+			}
+		})
+	}
+}
+
+func TestSM4DecryptLegacyECB(t *testing.T) {
+	resetSM4Keys(t)
+
+	// 旧版本使用 crypto.sm4_key 以ECB模式加密"13800138000"得到的16进制密文
+	const legacy = "c577cf911dc967af55e85c88b20ab5a5"
+	if !IsLegacySM4Ciphertext(legacy) {
+		t.Fatal("未识别为旧版ECB密文")
+	}
+	got, err := SM4Decrypt(legacy)
+	if err != nil {
+		t.Fatalf("解密旧版密文失败: %v", err)
+	}
+	if got != "13800138000" {
+		t.Fatalf("解密结果 = %q, 期望 13800138000", got)
+	}
+
+	// 活动密钥轮换后，旧版密文仍使用k1解密
+	if err := SM4Keys.AddKey("k2", []byte("fedcba9876543210")); err != nil {
+		t.Fatalf("添加密钥失败: %v", err)
+	}
+	if err := SM4Keys.SetActive("k2"); err != nil {
+		t.Fatalf("切换活动密钥失败: %v", err)
+	}
+	if got, err := SM4Decrypt(legacy); err != nil || got != "13800138000" {
+		t.Fatalf("轮换后解密旧版密文 = %q, %v", got, err)
+	}
+	if !NeedsReencrypt(legacy) {
+		t.Fatal("旧版密文应需要重新加密")
+	}
+}
@@ -0,0 +1,354 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 信封加密：加密值使用随机数据密钥(DEK)，DEK由主密钥(KEK)包裹后与密文一起存储
+// 同一数据密钥在使用次数和时间上限内被多个加密值共用（每次加密使用独立的随机nonce），避免每个字段都访问一次KMS
+// 主密钥由 KeyProvider 管理，可以放在配置文件中（开发环境），也可以放在独立的KMS进程中，
+// 使主密钥不出现在 config.yaml 和数据库主机上
+// 信封密文格式: v3:<包裹的数据密钥>:<base64(nonce|密文|tag)>
+// 包裹的数据密钥格式: <主密钥标识>.<base64(nonce|数据密钥密文|tag)>
+
+const (
+	// sm4EnvelopeVersion 信封加密密文格式版本
+	sm4EnvelopeVersion = "v3"
+	// EnvelopeKeyIDPrefix 信封密文在密钥轮换中的标识前缀，完整标识为 kms:<主密钥标识>
+	EnvelopeKeyIDPrefix = "kms:"
+	// dataKeyLen 数据密钥长度
+	dataKeyLen = 16
+	// dataKeyCacheSize 已解包数据密钥的缓存上限，避免每次读取都访问KMS
+	dataKeyCacheSize = 4096
+	// dataKeyMaxUses 同一数据密钥最多加密的值数量，超过后申请新的数据密钥
+	dataKeyMaxUses = 10000
+	// dataKeyMaxAge 同一数据密钥用于加密的最长时间
+	dataKeyMaxAge = 10 * time.Minute
+)
+
+var (
+	ErrWrappedKeyInvalid = errors.New("包裹的数据密钥格式错误")
+	ErrNoKeyProvider     = errors.New("未配置密钥提供者，无法解密信封密文")
+)
+
+// KeyProvider 主密钥提供者
+type KeyProvider interface {
+	// MasterKeyID 当前用于包裹数据密钥的主密钥标识
+	MasterKeyID() string
+	// GetDataKey 生成新的数据密钥，返回明文数据密钥和被主密钥包裹后的数据密钥
+	GetDataKey() ([]byte, string, error)
+	// Wrap 使用当前主密钥包裹数据密钥
+	Wrap(dataKey []byte) (string, error)
+	// Unwrap 解包数据密钥（支持历史主密钥）
+	Unwrap(wrapped string) ([]byte, error)
+}
+
+var (
+	keyProviderMu sync.RWMutex
+	keyProvider   KeyProvider
+)
+
+// SetKeyProvider 设置密钥提供者，设置后新数据使用信封加密；传入nil恢复使用SM4密钥环
+func SetKeyProvider(p KeyProvider) {
+	keyProviderMu.Lock()
+	keyProvider = p
+	keyProviderMu.Unlock()
+	dataKeys.reset()
+	encryptionDataKey.reset()
+}
+
+// CurrentKeyProvider 获取当前密钥提供者，未配置时返回nil
+func CurrentKeyProvider() KeyProvider {
+	keyProviderMu.RLock()
+	defer keyProviderMu.RUnlock()
+	return keyProvider
+}
+
+// ActiveEncryptionKeyID 新数据加密使用的密钥标识
+// 配置了密钥提供者时为 kms:<主密钥标识>，否则为SM4密钥环的活动密钥
+func ActiveEncryptionKeyID() string {
+	if p := CurrentKeyProvider(); p != nil {
+		return EnvelopeKeyIDPrefix + p.MasterKeyID()
+	}
+	return SM4Keys.ActiveKeyID()
+}
+
+// ConfigKeyProvider 主密钥来自配置文件的密钥提供者，适用于开发和测试环境
+type ConfigKeyProvider struct {
+	ring *SM4Keyring
+}
+
+// NewConfigKeyProvider 创建配置主密钥提供者
+// masterKeys: 主密钥标识 -> 32位16进制密钥，activeID为当前包裹使用的主密钥
+func NewConfigKeyProvider(masterKeys map[string]string, activeID string) (*ConfigKeyProvider, error) {
+	ring := NewSM4Keyring()
+	for id, keyHex := range masterKeys {
+		if err := validateMasterKeyID(id); err != nil {
+			return nil, err
+		}
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("主密钥 %s 格式错误: %w", id, err)
+		}
+		if err := ring.AddKey(id, key); err != nil {
+			return nil, err
+		}
+	}
+	if err := ring.SetActive(activeID); err != nil {
+		return nil, err
+	}
+	return &ConfigKeyProvider{ring: ring}, nil
+}
+
+// MasterKeyID 当前主密钥标识
+func (p *ConfigKeyProvider) MasterKeyID() string {
+	return p.ring.ActiveKeyID()
+}
+
+// GetDataKey 生成并包裹新的数据密钥
+func (p *ConfigKeyProvider) GetDataKey() ([]byte, string, error) {
+	dataKey := make([]byte, dataKeyLen)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, "", err
+	}
+	wrapped, err := p.Wrap(dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return dataKey, wrapped, nil
+}
+
+// Wrap 使用当前主密钥包裹数据密钥
+func (p *ConfigKeyProvider) Wrap(dataKey []byte) (string, error) {
+	id, key, err := p.ring.Active()
+	if err != nil {
+		return "", err
+	}
+	return WrapDataKey(id, key, dataKey)
+}
+
+// Unwrap 解包数据密钥
+func (p *ConfigKeyProvider) Unwrap(wrapped string) ([]byte, error) {
+	id, err := WrappedKeyID(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	key, err := p.ring.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	return UnwrapDataKey(key, wrapped)
+}
+
+// WrapDataKey 使用主密钥(SM4-GCM)包裹数据密钥，主密钥标识作为附加认证数据
+func WrapDataKey(masterKeyID string, masterKey, dataKey []byte) (string, error) {
+	if len(dataKey) != dataKeyLen {
+		return "", fmt.Errorf("数据密钥长度必须为%d字节", dataKeyLen)
+	}
+
+	aead, err := newSM4GCM(masterKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, dataKey, []byte(masterKeyID))
+	return masterKeyID + "." + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// UnwrapDataKey 使用主密钥解包数据密钥
+func UnwrapDataKey(masterKey []byte, wrapped string) ([]byte, error) {
+	id, data, found := strings.Cut(wrapped, ".")
+	if !found || id == "" {
+		return nil, ErrWrappedKeyInvalid
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, ErrWrappedKeyInvalid
+	}
+
+	aead, err := newSM4GCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrWrappedKeyInvalid
+	}
+
+	nonce, body := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, body, []byte(id))
+	if err != nil {
+		return nil, ErrCiphertextTampered
+	}
+	return dataKey, nil
+}
+
+// WrappedKeyID 获取包裹数据密钥时使用的主密钥标识
+func WrappedKeyID(wrapped string) (string, error) {
+	id, _, found := strings.Cut(wrapped, ".")
+	if !found || id == "" {
+		return "", ErrWrappedKeyInvalid
+	}
+	return id, nil
+}
+
+// validateMasterKeyID 主密钥标识不能包含密文分隔符，且需能放入重加密任务的目标密钥字段
+func validateMasterKeyID(id string) error {
+	if id == "" || len(id) > 32 || strings.ContainsAny(id, ":.") {
+		return fmt.Errorf("主密钥标识不合法: %q", id)
+	}
+	return nil
+}
+
+// sm4EncryptEnvelope 使用当前数据密钥加密，包裹后的数据密钥作为附加认证数据
+func sm4EncryptEnvelope(p KeyProvider, plaintext string) (string, error) {
+	dataKey, wrapped, err := encryptionDataKey.get(p)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newSM4GCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(wrapped))
+	return sm4EnvelopeVersion + ":" + wrapped + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// sm4DecryptEnvelope 解密信封密文
+func sm4DecryptEnvelope(wrapped, data string) (string, error) {
+	dataKey, err := unwrapCached(wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newSM4GCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrCiphertextTooShort
+	}
+
+	nonce, body := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, body, []byte(wrapped))
+	if err != nil {
+		return "", ErrCiphertextTampered
+	}
+	return string(plaintext), nil
+}
+
+// unwrapCached 解包数据密钥，优先使用缓存
+func unwrapCached(wrapped string) ([]byte, error) {
+	if key, ok := dataKeys.get(wrapped); ok {
+		return key, nil
+	}
+
+	p := CurrentKeyProvider()
+	if p == nil {
+		return nil, ErrNoKeyProvider
+	}
+	key, err := p.Unwrap(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != dataKeyLen {
+		return nil, ErrWrappedKeyInvalid
+	}
+	dataKeys.put(wrapped, key)
+	return key, nil
+}
+
+// activeDataKey 当前用于加密的数据密钥
+type activeDataKey struct {
+	mu          sync.Mutex
+	key         []byte
+	wrapped     string
+	masterKeyID string
+	uses        int
+	createdAt   time.Time
+}
+
+var encryptionDataKey = &activeDataKey{}
+
+// get 获取加密使用的数据密钥，主密钥已轮换或达到使用次数、时间上限时向密钥提供者申请新的数据密钥
+func (a *activeDataKey) get(p KeyProvider) ([]byte, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.key == nil || a.uses >= dataKeyMaxUses || time.Since(a.createdAt) > dataKeyMaxAge || a.masterKeyID != p.MasterKeyID() {
+		dataKey, wrapped, err := p.GetDataKey()
+		if err != nil {
+			return nil, "", fmt.Errorf("获取数据密钥失败: %w", err)
+		}
+		if strings.Contains(wrapped, ":") {
+			return nil, "", ErrWrappedKeyInvalid
+		}
+		masterKeyID, err := WrappedKeyID(wrapped)
+		if err != nil {
+			return nil, "", err
+		}
+		dataKeys.put(wrapped, dataKey)
+		a.key, a.wrapped, a.masterKeyID = dataKey, wrapped, masterKeyID
+		a.uses, a.createdAt = 0, time.Now()
+	}
+
+	a.uses++
+	return a.key, a.wrapped, nil
+}
+
+func (a *activeDataKey) reset() {
+	a.mu.Lock()
+	a.key, a.wrapped, a.masterKeyID = nil, "", ""
+	a.mu.Unlock()
+}
+
+// dataKeyCache 已解包数据密钥缓存（包裹后的数据密钥 -> 明文数据密钥），达到上限时整体清空
+type dataKeyCache struct {
+	mu   sync.RWMutex
+	keys map[string][]byte
+}
+
+var dataKeys = &dataKeyCache{keys: make(map[string][]byte)}
+
+func (c *dataKeyCache) get(wrapped string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keys[wrapped]
+	return key, ok
+}
+
+func (c *dataKeyCache) put(wrapped string, key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.keys) >= dataKeyCacheSize {
+		c.keys = make(map[string][]byte)
+	}
+	c.keys[wrapped] = key
+}
+
+func (c *dataKeyCache) reset() {
+	c.mu.Lock()
+	c.keys = make(map[string][]byte)
+	c.mu.Unlock()
+}
@@ -0,0 +1,164 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LegacySM4KeyID 配置项 crypto.sm4_key 对应的密钥标识
+// 旧版ECB密文和确定性加密字段始终使用该密钥
+const LegacySM4KeyID = "k1"
+
+// SM4Keys 全局SM4密钥环
+var SM4Keys = NewSM4Keyring()
+
+// SM4Keyring SM4密钥环，保存多个版本的密钥，其中一个为当前加密使用的活动密钥
+type SM4Keyring struct {
+	mu       sync.RWMutex
+	keys     map[string][]byte
+	activeID string
+}
+
+// NewSM4Keyring 创建空密钥环
+func NewSM4Keyring() *SM4Keyring {
+	return &SM4Keyring{
+		keys: make(map[string][]byte),
+	}
+}
+
+// AddKey 添加密钥
+func (k *SM4Keyring) AddKey(id string, key []byte) error {
+	if id == "" || strings.Contains(id, ":") {
+		return fmt.Errorf("密钥标识不合法: %q", id)
+	}
+	if len(key) != 16 {
+		return fmt.Errorf("密钥 %s 长度必须为16字节", id)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if existing, ok := k.keys[id]; ok && string(existing) != string(key) {
+		return fmt.Errorf("密钥标识 %s 已存在且内容不同", id)
+	}
+	k.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// SetActive 设置活动密钥
+func (k *SM4Keyring) SetActive(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("活动密钥 %s 不存在", id)
+	}
+	k.activeID = id
+	return nil
+}
+
+// ActiveKeyID 获取活动密钥标识
+func (k *SM4Keyring) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.activeID
+}
+
+// Active 获取活动密钥
+func (k *SM4Keyring) Active() (string, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[k.activeID]
+	if !ok {
+		return "", nil, errors.New("未配置活动SM4密钥")
+	}
+	return k.activeID, key, nil
+}
+
+// Key 根据标识获取密钥
+func (k *SM4Keyring) Key(id string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	return key, nil
+}
+
+// KeyIDs 获取所有密钥标识
+func (k *SM4Keyring) KeyIDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// LoadSM4Keyring 加载配置中的附加密钥并设置活动密钥
+// keys: 密钥标识 -> 32位16进制密钥；activeID为空时保持使用 crypto.sm4_key
+func LoadSM4Keyring(keys map[string]string, activeID string) error {
+	for id, keyHex := range keys {
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return fmt.Errorf("密钥 %s 格式错误: %w", id, err)
+		}
+		if err := SM4Keys.AddKey(id, key); err != nil {
+			return err
+		}
+	}
+
+	if activeID == "" {
+		activeID = LegacySM4KeyID
+	}
+	return SM4Keys.SetActive(activeID)
+}
+
+// SM4KeyIDOf 获取密文使用的密钥标识，旧版ECB密文返回 LegacySM4KeyID，信封密文返回 kms:<主密钥标识>
+func SM4KeyIDOf(ciphertext string) string {
+	if ciphertext == "" {
+		return ""
+	}
+	if IsLegacySM4Ciphertext(ciphertext) {
+		return LegacySM4KeyID
+	}
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	if parts[0] == sm4EnvelopeVersion {
+		id, err := WrappedKeyID(parts[1])
+		if err != nil {
+			return ""
+		}
+		return EnvelopeKeyIDPrefix + id
+	}
+	return parts[1]
+}
+
+// NeedsReencrypt 判断密文是否需要在当前加密密钥下重新加密
+func NeedsReencrypt(ciphertext string) bool {
+	if ciphertext == "" {
+		return false
+	}
+	return IsLegacySM4Ciphertext(ciphertext) || SM4KeyIDOf(ciphertext) != ActiveEncryptionKeyID()
+}
+
+// SM4Reencrypt 解密后使用当前加密密钥重新加密
+func SM4Reencrypt(ciphertext string) (string, error) {
+	plaintext, err := SM4Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return SM4Encrypt(plaintext)
+}
@@ -0,0 +1,377 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 本地KMS模拟服务：主密钥保存在独立进程的密钥文件中，业务服务只通过HTTP获取和解包数据密钥
+// 接口（均需 Authorization: Bearer <token>）:
+//   GET  /v1/key      当前主密钥标识
+//   POST /v1/datakey  生成数据密钥 -> {"keyId","plaintext","wrapped"}
+//   POST /v1/wrap     {"plaintext"} -> {"wrapped"}
+//   POST /v1/unwrap   {"wrapped"} -> {"plaintext"}
+// plaintext 为16进制编码的数据密钥
+
+// kmsRequest KMS请求体
+type kmsRequest struct {
+	Plaintext string `json:"plaintext,omitempty"`
+	Wrapped   string `json:"wrapped,omitempty"`
+}
+
+// kmsResponse KMS响应体
+type kmsResponse struct {
+	KeyID     string `json:"keyId,omitempty"`
+	Plaintext string `json:"plaintext,omitempty"`
+	Wrapped   string `json:"wrapped,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// kmsKeyIDRefresh 主密钥标识的刷新间隔，KMS轮换主密钥后最迟在此时间后生效
+const kmsKeyIDRefresh = time.Minute
+
+// KMSKeyProvider 通过HTTP访问KMS模拟服务的密钥提供者
+type KMSKeyProvider struct {
+	endpoint string
+	token    string
+	client   *http.Client
+
+	mu        sync.RWMutex
+	keyID     string
+	checkedAt time.Time // 最近一次从KMS确认主密钥标识的时间
+}
+
+// NewKMSKeyProvider 创建KMS密钥提供者，创建时查询主密钥标识，同时检查KMS是否可用
+func NewKMSKeyProvider(endpoint, token string) (*KMSKeyProvider, error) {
+	if endpoint == "" {
+		return nil, errors.New("未配置KMS服务地址")
+	}
+
+	p := &KMSKeyProvider{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		token:    token,
+		client:   &http.Client{Timeout: 5 * time.Second},
+	}
+
+	if err := p.refreshKeyID(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// MasterKeyID 当前主密钥标识，超过刷新间隔时重新向KMS查询，查询失败时沿用已知标识
+func (p *KMSKeyProvider) MasterKeyID() string {
+	p.mu.RLock()
+	keyID, checkedAt := p.keyID, p.checkedAt
+	p.mu.RUnlock()
+
+	if time.Since(checkedAt) < kmsKeyIDRefresh {
+		return keyID
+	}
+	if err := p.refreshKeyID(); err != nil {
+		log.Printf("[KMS] 刷新主密钥标识失败，沿用 %s: %v", keyID, err)
+		p.setKeyID(keyID)
+		return keyID
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.keyID
+}
+
+// refreshKeyID 向KMS查询当前主密钥标识
+func (p *KMSKeyProvider) refreshKeyID() error {
+	var resp kmsResponse
+	if err := p.call(http.MethodGet, "/v1/key", nil, &resp); err != nil {
+		return err
+	}
+	if err := validateMasterKeyID(resp.KeyID); err != nil {
+		return err
+	}
+	p.setKeyID(resp.KeyID)
+	return nil
+}
+
+// setKeyID 记录KMS返回的主密钥标识（查询和包裹响应中都会返回）
+func (p *KMSKeyProvider) setKeyID(keyID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if keyID != p.keyID && p.keyID != "" {
+		log.Printf("[KMS] 主密钥已轮换 - %s -> %s", p.keyID, keyID)
+	}
+	p.keyID = keyID
+	p.checkedAt = time.Now()
+}
+
+// GetDataKey 由KMS生成数据密钥
+func (p *KMSKeyProvider) GetDataKey() ([]byte, string, error) {
+	var resp kmsResponse
+	if err := p.call(http.MethodPost, "/v1/datakey", &kmsRequest{}, &resp); err != nil {
+		return nil, "", err
+	}
+	dataKey, err := hex.DecodeString(resp.Plaintext)
+	if err != nil || len(dataKey) != dataKeyLen {
+		return nil, "", errors.New("KMS返回的数据密钥格式错误")
+	}
+	if validateMasterKeyID(resp.KeyID) == nil {
+		p.setKeyID(resp.KeyID)
+	}
+	return dataKey, resp.Wrapped, nil
+}
+
+// Wrap 由KMS包裹数据密钥
+func (p *KMSKeyProvider) Wrap(dataKey []byte) (string, error) {
+	var resp kmsResponse
+	if err := p.call(http.MethodPost, "/v1/wrap", &kmsRequest{Plaintext: hex.EncodeToString(dataKey)}, &resp); err != nil {
+		return "", err
+	}
+	if validateMasterKeyID(resp.KeyID) == nil {
+		p.setKeyID(resp.KeyID)
+	}
+	return resp.Wrapped, nil
+}
+
+// Unwrap 由KMS解包数据密钥
+func (p *KMSKeyProvider) Unwrap(wrapped string) ([]byte, error) {
+	var resp kmsResponse
+	if err := p.call(http.MethodPost, "/v1/unwrap", &kmsRequest{Wrapped: wrapped}, &resp); err != nil {
+		return nil, err
+	}
+	dataKey, err := hex.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, errors.New("KMS返回的数据密钥格式错误")
+	}
+	return dataKey, nil
+}
+
+// call 调用KMS接口
+func (p *KMSKeyProvider) call(method, path string, body *kmsRequest, out *kmsResponse) error {
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = data
+	}
+
+	req, err := http.NewRequest(method, p.endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("访问KMS失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("KMS响应格式错误(HTTP %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("KMS请求失败(HTTP %d): %s", resp.StatusCode, out.Error)
+	}
+	return nil
+}
+
+// kmsKeyFile KMS模拟服务的主密钥文件
+type kmsKeyFile struct {
+	ActiveKeyID string            `json:"activeKeyId"`
+	Keys        map[string]string `json:"keys"` // 主密钥标识 -> 16进制主密钥
+}
+
+// KMSEmulator 本地KMS模拟服务
+type KMSEmulator struct {
+	mu    sync.RWMutex
+	ring  *SM4Keyring
+	token string
+}
+
+// LoadKMSKeyFile 加载主密钥文件，文件不存在时生成标识为 m1 的主密钥；rotate为true时追加新主密钥并设为当前主密钥
+func LoadKMSKeyFile(path string, rotate bool) (*KMSEmulator, error) {
+	var file kmsKeyFile
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("主密钥文件格式错误: %w", err)
+		}
+	case os.IsNotExist(err):
+		file.Keys = make(map[string]string)
+		rotate = true
+	default:
+		return nil, err
+	}
+
+	if rotate {
+		key := make([]byte, 16)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		var id string
+		for i := len(file.Keys) + 1; ; i++ {
+			id = fmt.Sprintf("m%d", i)
+			if _, exists := file.Keys[id]; !exists {
+				break
+			}
+		}
+		file.Keys[id] = hex.EncodeToString(key)
+		file.ActiveKeyID = id
+
+		data, err := json.MarshalIndent(&file, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	ring := NewSM4Keyring()
+	for id, keyHex := range file.Keys {
+		if err := validateMasterKeyID(id); err != nil {
+			return nil, err
+		}
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("主密钥 %s 格式错误: %w", id, err)
+		}
+		if err := ring.AddKey(id, key); err != nil {
+			return nil, err
+		}
+	}
+	if err := ring.SetActive(file.ActiveKeyID); err != nil {
+		return nil, err
+	}
+	return &KMSEmulator{ring: ring}, nil
+}
+
+// SetToken 设置访问令牌，为空时不校验
+func (e *KMSEmulator) SetToken(token string) {
+	e.mu.Lock()
+	e.token = token
+	e.mu.Unlock()
+}
+
+// ActiveKeyID 当前主密钥标识
+func (e *KMSEmulator) ActiveKeyID() string {
+	return e.ring.ActiveKeyID()
+}
+
+// ServeHTTP 处理KMS请求
+func (e *KMSEmulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !e.authorized(r) {
+		writeKMSResponse(w, http.StatusUnauthorized, &kmsResponse{Error: "未授权"})
+		return
+	}
+
+	var req kmsRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeKMSResponse(w, http.StatusBadRequest, &kmsResponse{Error: "请求格式错误"})
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/key":
+		writeKMSResponse(w, http.StatusOK, &kmsResponse{KeyID: e.ring.ActiveKeyID()})
+
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/datakey":
+		dataKey := make([]byte, dataKeyLen)
+		if _, err := rand.Read(dataKey); err != nil {
+			writeKMSResponse(w, http.StatusInternalServerError, &kmsResponse{Error: err.Error()})
+			return
+		}
+		id, wrapped, err := e.wrap(dataKey)
+		if err != nil {
+			writeKMSResponse(w, http.StatusInternalServerError, &kmsResponse{Error: err.Error()})
+			return
+		}
+		writeKMSResponse(w, http.StatusOK, &kmsResponse{KeyID: id, Plaintext: hex.EncodeToString(dataKey), Wrapped: wrapped})
+
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/wrap":
+		dataKey, err := hex.DecodeString(req.Plaintext)
+		if err != nil {
+			writeKMSResponse(w, http.StatusBadRequest, &kmsResponse{Error: "数据密钥格式错误"})
+			return
+		}
+		id, wrapped, err := e.wrap(dataKey)
+		if err != nil {
+			writeKMSResponse(w, http.StatusBadRequest, &kmsResponse{Error: err.Error()})
+			return
+		}
+		writeKMSResponse(w, http.StatusOK, &kmsResponse{KeyID: id, Wrapped: wrapped})
+
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/unwrap":
+		id, err := WrappedKeyID(req.Wrapped)
+		if err != nil {
+			writeKMSResponse(w, http.StatusBadRequest, &kmsResponse{Error: err.Error()})
+			return
+		}
+		key, err := e.ring.Key(id)
+		if err != nil {
+			writeKMSResponse(w, http.StatusNotFound, &kmsResponse{Error: "未知的主密钥: " + id})
+			return
+		}
+		dataKey, err := UnwrapDataKey(key, req.Wrapped)
+		if err != nil {
+			writeKMSResponse(w, http.StatusBadRequest, &kmsResponse{Error: err.Error()})
+			return
+		}
+		writeKMSResponse(w, http.StatusOK, &kmsResponse{KeyID: id, Plaintext: hex.EncodeToString(dataKey)})
+
+	default:
+		writeKMSResponse(w, http.StatusNotFound, &kmsResponse{Error: "接口不存在"})
+	}
+}
+
+// wrap 使用当前主密钥包裹数据密钥
+func (e *KMSEmulator) wrap(dataKey []byte) (string, string, error) {
+	id, key, err := e.ring.Active()
+	if err != nil {
+		return "", "", err
+	}
+	wrapped, err := WrapDataKey(id, key, dataKey)
+	return id, wrapped, err
+}
+
+// authorized 校验访问令牌
+func (e *KMSEmulator) authorized(r *http.Request) bool {
+	e.mu.RLock()
+	token := e.token
+	e.mu.RUnlock()
+
+	if token == "" {
+		return true
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// writeKMSResponse 输出JSON响应
+func writeKMSResponse(w http.ResponseWriter, status int, resp *kmsResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,263 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tjfoc/gmsm/sm3"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// 密码存储格式（PHC风格，携带算法参数，便于调整强度后平滑升级）
+//   $scrypt$n=32768,r=8,p=1$<base64(salt)>$<base64(hash)>
+//   $pbkdf2-sm3$i=210000$<base64(salt)>$<base64(hash)>
+// 不以$开头的是旧格式: SM3(密码 + 用户名)，登录成功后自动升级
+
+// 支持的密码哈希算法
+const (
+	PasswordAlgScrypt    = "scrypt"
+	PasswordAlgPBKDF2SM3 = "pbkdf2-sm3"
+)
+
+const (
+	passwordSaltLen = 16
+	passwordHashLen = 32
+)
+
+// ErrPasswordHashFormat 密码哈希格式错误
+var ErrPasswordHashFormat = errors.New("密码哈希格式错误")
+
+// PasswordHashParams 密码哈希参数
+type PasswordHashParams struct {
+	Algorithm        string // scrypt 或 pbkdf2-sm3
+	ScryptN          int    // CPU/内存开销，2的幂
+	ScryptR          int
+	ScryptP          int
+	PBKDF2Iterations int
+}
+
+// DefaultPasswordHashParams 默认参数（scrypt约占用32MB内存）
+var DefaultPasswordHashParams = PasswordHashParams{
+	Algorithm:        PasswordAlgScrypt,
+	ScryptN:          32768,
+	ScryptR:          8,
+	ScryptP:          1,
+	PBKDF2Iterations: 210000,
+}
+
+var (
+	passwordParamsMu sync.RWMutex
+	passwordParams   = DefaultPasswordHashParams
+	dummyPassword    string // 按当前参数计算的占位哈希，参数变化时重新计算
+)
+
+// SetPasswordHashParams 设置新密码使用的哈希参数，未填写的字段使用默认值
+func SetPasswordHashParams(params PasswordHashParams) error {
+	if params.Algorithm == "" {
+		params.Algorithm = DefaultPasswordHashParams.Algorithm
+	}
+	if params.ScryptN == 0 {
+		params.ScryptN = DefaultPasswordHashParams.ScryptN
+	}
+	if params.ScryptR == 0 {
+		params.ScryptR = DefaultPasswordHashParams.ScryptR
+	}
+	if params.ScryptP == 0 {
+		params.ScryptP = DefaultPasswordHashParams.ScryptP
+	}
+	if params.PBKDF2Iterations == 0 {
+		params.PBKDF2Iterations = DefaultPasswordHashParams.PBKDF2Iterations
+	}
+
+	switch params.Algorithm {
+	case PasswordAlgScrypt:
+		if params.ScryptN < 2 || params.ScryptN&(params.ScryptN-1) != 0 {
+			return fmt.Errorf("scrypt参数n必须是大于1的2的幂: %d", params.ScryptN)
+		}
+		if params.ScryptR < 1 || params.ScryptP < 1 {
+			return errors.New("scrypt参数r和p必须大于0")
+		}
+	case PasswordAlgPBKDF2SM3:
+		if params.PBKDF2Iterations < 10000 {
+			return fmt.Errorf("pbkdf2-sm3迭代次数过低: %d", params.PBKDF2Iterations)
+		}
+	default:
+		return fmt.Errorf("不支持的密码哈希算法: %s", params.Algorithm)
+	}
+
+	passwordParamsMu.Lock()
+	passwordParams = params
+	dummyPassword = ""
+	passwordParamsMu.Unlock()
+	return nil
+}
+
+// CurrentPasswordHashParams 获取当前密码哈希参数
+func CurrentPasswordHashParams() PasswordHashParams {
+	passwordParamsMu.RLock()
+	defer passwordParamsMu.RUnlock()
+	return passwordParams
+}
+
+// HashPassword 使用当前参数和随机盐计算密码哈希
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return hashPasswordWith(CurrentPasswordHashParams(), password, salt)
+}
+
+// VerifyPassword 校验密码，needsRehash表示哈希为旧格式或参数已过时，应使用HashPassword重新计算
+// legacySalt为旧格式使用的盐（用户名）
+func VerifyPassword(password, encoded, legacySalt string) (ok bool, needsRehash bool) {
+	if !strings.HasPrefix(encoded, "$") {
+		legacy := SM3HashWithSalt(password, legacySalt)
+		return subtle.ConstantTimeCompare([]byte(legacy), []byte(encoded)) == 1, true
+	}
+
+	params, salt, hash, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, false
+	}
+
+	computed, err := derivePasswordKey(params, password, salt, len(hash))
+	if err != nil || subtle.ConstantTimeCompare(computed, hash) != 1 {
+		return false, false
+	}
+	return true, passwordParamsOutdated(params)
+}
+
+// VerifyDummyPassword 账号不存在时对固定的占位哈希做一次校验，使其与真实校验开销一致，
+// 避免通过响应时间判断用户名、邮箱或手机号是否已注册
+func VerifyDummyPassword(password string) {
+	VerifyPassword(password, dummyPasswordHash(), "")
+}
+
+// dummyPasswordHash 获取按当前参数计算的占位哈希
+func dummyPasswordHash() string {
+	passwordParamsMu.Lock()
+	defer passwordParamsMu.Unlock()
+	if dummyPassword == "" {
+		salt := make([]byte, passwordSaltLen)
+		encoded, err := hashPasswordWith(passwordParams, "sm-medical-dummy-password", salt)
+		if err != nil {
+			return ""
+		}
+		dummyPassword = encoded
+	}
+	return dummyPassword
+}
+
+// hashPasswordWith 按指定参数计算并编码密码哈希
+func hashPasswordWith(params PasswordHashParams, password string, salt []byte) (string, error) {
+	hash, err := derivePasswordKey(params, password, salt, passwordHashLen)
+	if err != nil {
+		return "", err
+	}
+
+	var settings string
+	switch params.Algorithm {
+	case PasswordAlgScrypt:
+		settings = fmt.Sprintf("n=%d,r=%d,p=%d", params.ScryptN, params.ScryptR, params.ScryptP)
+	case PasswordAlgPBKDF2SM3:
+		settings = fmt.Sprintf("i=%d", params.PBKDF2Iterations)
+	}
+
+	return strings.Join([]string{
+		"",
+		params.Algorithm,
+		settings,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	}, "$"), nil
+}
+
+// derivePasswordKey 计算密码派生值
+func derivePasswordKey(params PasswordHashParams, password string, salt []byte, keyLen int) ([]byte, error) {
+	switch params.Algorithm {
+	case PasswordAlgScrypt:
+		return scrypt.Key([]byte(password), salt, params.ScryptN, params.ScryptR, params.ScryptP, keyLen)
+	case PasswordAlgPBKDF2SM3:
+		return pbkdf2.Key([]byte(password), salt, params.PBKDF2Iterations, keyLen, sm3.New), nil
+	}
+	return nil, fmt.Errorf("不支持的密码哈希算法: %s", params.Algorithm)
+}
+
+// parsePasswordHash 解析编码后的密码哈希
+func parsePasswordHash(encoded string) (PasswordHashParams, []byte, []byte, error) {
+	var params PasswordHashParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[0] != "" {
+		return params, nil, nil, ErrPasswordHashFormat
+	}
+	params.Algorithm = parts[1]
+
+	for _, kv := range strings.Split(parts[2], ",") {
+		k, v, found := strings.Cut(kv, "=")
+		if !found {
+			return params, nil, nil, ErrPasswordHashFormat
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return params, nil, nil, ErrPasswordHashFormat
+		}
+		switch k {
+		case "n":
+			params.ScryptN = n
+		case "r":
+			params.ScryptR = n
+		case "p":
+			params.ScryptP = n
+		case "i":
+			params.PBKDF2Iterations = n
+		default:
+			return params, nil, nil, ErrPasswordHashFormat
+		}
+	}
+
+	switch params.Algorithm {
+	case PasswordAlgScrypt:
+		if params.ScryptN == 0 || params.ScryptR == 0 || params.ScryptP == 0 {
+			return params, nil, nil, ErrPasswordHashFormat
+		}
+	case PasswordAlgPBKDF2SM3:
+		if params.PBKDF2Iterations == 0 {
+			return params, nil, nil, ErrPasswordHashFormat
+		}
+	default:
+		return params, nil, nil, ErrPasswordHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return params, nil, nil, ErrPasswordHashFormat
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(hash) == 0 {
+		return params, nil, nil, ErrPasswordHashFormat
+	}
+	return params, salt, hash, nil
+}
+
+// passwordParamsOutdated 判断哈希参数是否与当前配置不一致
+func passwordParamsOutdated(params PasswordHashParams) bool {
+	current := CurrentPasswordHashParams()
+	if params.Algorithm != current.Algorithm {
+		return true
+	}
+	switch params.Algorithm {
+	case PasswordAlgScrypt:
+		return params.ScryptN != current.ScryptN || params.ScryptR != current.ScryptR || params.ScryptP != current.ScryptP
+	case PasswordAlgPBKDF2SM3:
+		return params.PBKDF2Iterations != current.PBKDF2Iterations
+	}
+	return true
+}
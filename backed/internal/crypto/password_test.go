@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+// setTestPasswordParams 使用较低强度的参数加快测试，结束后恢复默认值
+func setTestPasswordParams(t *testing.T, params PasswordHashParams) {
+	t.Helper()
+	if err := SetPasswordHashParams(params); err != nil {
+		t.Fatalf("设置密码哈希参数失败: %v", err)
+	}
+	t.Cleanup(func() {
+		SetPasswordHashParams(DefaultPasswordHashParams)
+	})
+}
+
+func TestPasswordHashRoundTrip(t *testing.T) {
+	cases := []struct {
+		params PasswordHashParams
+		prefix string
+	}{
+		{PasswordHashParams{Algorithm: PasswordAlgScrypt, ScryptN: 1024, ScryptR: 8, ScryptP: 1}, "$scrypt$n=1024,r=8,p=1$"},
+		{PasswordHashParams{Algorithm: PasswordAlgPBKDF2SM3, PBKDF2Iterations: 10000}, "$pbkdf2-sm3$i=10000$"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.params.Algorithm, func(t *testing.T) {
+			setTestPasswordParams(t, tc.params)
+
+			encoded, err := HashPassword("Passw0rd!")
+			if err != nil {
+				t.Fatalf("计算密码哈希失败: %v", err)
+			}
+			if !strings.HasPrefix(encoded, tc.prefix) {
+				t.Fatalf("哈希格式 = %q, 期望 %q 前缀", encoded, tc.prefix)
+			}
+
+			ok, needsRehash := VerifyPassword("Passw0rd!", encoded, "alice")
+			if !ok || needsRehash {
+				t.Fatalf("校验正确密码 = %v, needsRehash = %v", ok, needsRehash)
+			}
+			if ok, _ := VerifyPassword("passw0rd!", encoded, "alice"); ok {
+				t.Fatal("错误密码校验通过")
+			}
+
+			// 随机盐，相同密码的哈希不同
+			again, _ := HashPassword("Passw0rd!")
+			if again == encoded {
+				t.Fatal("相同密码两次哈希结果相同")
+			}
+		})
+	}
+}
+
+func TestVerifyLegacyPassword(t *testing.T) {
+	legacy := SM3HashWithSalt("Passw0rd!", "alice")
+
+	ok, needsRehash := VerifyPassword("Passw0rd!", legacy, "alice")
+	if !ok || !needsRehash {
+		t.Fatalf("校验旧格式哈希 = %v, needsRehash = %v, 期望 true, true", ok, needsRehash)
+	}
+	if ok, _ := VerifyPassword("wrong", legacy, "alice"); ok {
+		t.Fatal("旧格式哈希错误密码校验通过")
+	}
+	// 旧格式以用户名为盐
+	if ok, _ := VerifyPassword("Passw0rd!", legacy, "bob"); ok {
+		t.Fatal("旧格式哈希使用其他用户名校验通过")
+	}
+}
+
+func TestPasswordNeedsRehashOnOutdatedParams(t *testing.T) {
+	setTestPasswordParams(t, PasswordHashParams{Algorithm: PasswordAlgScrypt, ScryptN: 1024, ScryptR: 8, ScryptP: 1})
+	encoded, err := HashPassword("Passw0rd!")
+	if err != nil {
+		t.Fatalf("计算密码哈希失败: %v", err)
+	}
+
+	updates := []PasswordHashParams{
+		{Algorithm: PasswordAlgScrypt, ScryptN: 2048, ScryptR: 8, ScryptP: 1},
+		{Algorithm: PasswordAlgScrypt, ScryptN: 1024, ScryptR: 8, ScryptP: 2},
+		{Algorithm: PasswordAlgPBKDF2SM3, PBKDF2Iterations: 10000},
+	}
+	for _, params := range updates {
+		if err := SetPasswordHashParams(params); err != nil {
+			t.Fatalf("设置密码哈希参数失败: %v", err)
+		}
+		ok, needsRehash := VerifyPassword("Passw0rd!", encoded, "alice")
+		if !ok || !needsRehash {
+			t.Fatalf("参数 %+v: 校验 = %v, needsRehash = %v, 期望 true, true", params, ok, needsRehash)
+		}
+	}
+}
+
+func TestVerifyPasswordMalformedHash(t *testing.T) {
+	for _, encoded := range []string{
+		"$scrypt$n=1024,r=8$c2FsdA$aGFzaA",
+		"$scrypt$n=abc,r=8,p=1$c2FsdA$aGFzaA",
+		"$md5$i=1$c2FsdA$aGFzaA",
+		"$pbkdf2-sm3$i=10000$c2FsdA$",
+		"$pbkdf2-sm3$i=10000$c2FsdA",
+	} {
+		if ok, needsRehash := VerifyPassword("Passw0rd!", encoded, "alice"); ok || needsRehash {
+			t.Fatalf("格式错误的哈希 %q: 校验 = %v, needsRehash = %v", encoded, ok, needsRehash)
+		}
+	}
+}
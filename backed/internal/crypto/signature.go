@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/tjfoc/gmsm/sm2"
+	"strings"
+)
+
+// SM2Sign 使用服务端(医院级)SM2私钥对数据签名，返回16进制DER签名和签名密钥标识
+func SM2Sign(data []byte) (string, string, error) {
+	if SM2PrivateKey == nil {
+		return "", "", errors.New("SM2私钥未加载")
+	}
+	signature, err := SM2SignWithKey(SM2PrivateKey, data)
+	if err != nil {
+		return "", "", err
+	}
+	return signature, SM2KeyID, nil
+}
+
+// SM2SignWithKey 使用指定SM2私钥签名(SM3摘要，默认用户标识)
+func SM2SignWithKey(priv *sm2.PrivateKey, data []byte) (string, error) {
+	signature, err := priv.Sign(rand.Reader, data, nil)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature), nil
+}
+
+// SM2Verify 验证16进制DER签名
+func SM2Verify(pub *sm2.PublicKey, data []byte, signatureHex string) bool {
+	if pub == nil || signatureHex == "" {
+		return false
+	}
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return false
+	}
+	return pub.Verify(data, signature)
+}
+
+// APIRequestSigningPayload 服务账号SM2请求签名的原文：
+// 请求方法\n路径(含查询参数)\n时间戳(毫秒)\nnonce\nSM3(请求体)
+func APIRequestSigningPayload(method, path, timestamp, nonce string, body []byte) []byte {
+	return []byte(strings.Join([]string{method, path, timestamp, nonce, SM3Hash(string(body))}, "\n"))
+}
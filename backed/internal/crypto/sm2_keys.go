@@ -0,0 +1,141 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"github.com/tjfoc/gmsm/sm2"
+	"github.com/tjfoc/gmsm/x509"
+)
+
+// ErrSM2KeyNotConfigured 未配置SM2密钥
+var ErrSM2KeyNotConfigured = errors.New("未配置SM2密钥，请先执行 `go run ./cmd gen-sm2-key` 生成密钥文件，或在 crypto.sm2_private_key 中填写私钥")
+
+// SM2KeyID 当前SM2公钥标识（公钥SM3摘要前16位）
+var SM2KeyID string
+
+// LoadSM2KeyPair 加载持久化的SM2密钥对
+// privateKey/publicKey 支持PEM或16进制格式；privateKey为空时从keyFile读取PEM私钥
+// publicKey可为空，非空时必须与私钥匹配
+func LoadSM2KeyPair(privateKey, publicKey, keyFile string) error {
+	source := strings.TrimSpace(privateKey)
+	origin := "crypto.sm2_private_key"
+	if source == "" && keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("SM2密钥文件 %s 不存在: %w", keyFile, ErrSM2KeyNotConfigured)
+			}
+			return fmt.Errorf("读取SM2密钥文件 %s 失败: %w", keyFile, err)
+		}
+		source = strings.TrimSpace(string(data))
+		origin = keyFile
+	}
+	if source == "" {
+		return ErrSM2KeyNotConfigured
+	}
+
+	priv, err := ParseSM2PrivateKey(source)
+	if err != nil {
+		return fmt.Errorf("SM2私钥(%s)格式错误: %w", origin, err)
+	}
+
+	if strings.TrimSpace(publicKey) != "" {
+		pub, err := ParseSM2PublicKey(publicKey)
+		if err != nil {
+			return fmt.Errorf("SM2公钥(crypto.sm2_public_key)格式错误: %w", err)
+		}
+		if pub.X.Cmp(priv.PublicKey.X) != 0 || pub.Y.Cmp(priv.PublicKey.Y) != 0 {
+			return errors.New("SM2公钥与私钥不匹配")
+		}
+	}
+
+	SM2PrivateKey = priv
+	SM2PublicKey = &priv.PublicKey
+	SM2KeyID = SM2PublicKeyID(SM2PublicKey)
+	return nil
+}
+
+// GenerateSM2KeyPair 生成新的SM2密钥对
+func GenerateSM2KeyPair() (*sm2.PrivateKey, error) {
+	return sm2.GenerateKey(rand.Reader)
+}
+
+// ParseSM2PrivateKey 解析PEM(PKCS#8)或16进制格式的SM2私钥
+func ParseSM2PrivateKey(data string) (*sm2.PrivateKey, error) {
+	data = strings.TrimSpace(data)
+	if strings.HasPrefix(data, "-----BEGIN") {
+		return x509.ReadPrivateKeyFromPem([]byte(data), nil)
+	}
+
+	if len(data) == 0 || len(data) > 64 {
+		return nil, errors.New("16进制私钥长度应为64位")
+	}
+	priv, err := x509.ReadPrivateKeyFromHex(data)
+	if err != nil {
+		return nil, err
+	}
+	if priv.D.Cmp(big.NewInt(0)) <= 0 {
+		return nil, errors.New("私钥不能为0")
+	}
+	return priv, nil
+}
+
+// ParseSM2PublicKey 解析PEM或16进制(04||X||Y)格式的SM2公钥
+func ParseSM2PublicKey(data string) (*sm2.PublicKey, error) {
+	data = strings.TrimSpace(data)
+	var pub *sm2.PublicKey
+	var err error
+	if strings.HasPrefix(data, "-----BEGIN") {
+		pub, err = x509.ReadPublicKeyFromPem([]byte(data))
+	} else {
+		pub, err = x509.ReadPublicKeyFromHex(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, errors.New("公钥不在SM2曲线上")
+	}
+	return pub, nil
+}
+
+// EncodeSM2PrivateKeyPEM 将私钥编码为PEM(PKCS#8，未加密)
+func EncodeSM2PrivateKeyPEM(priv *sm2.PrivateKey) ([]byte, error) {
+	return x509.WritePrivateKeyToPem(priv, nil)
+}
+
+// EncodeSM2PublicKeyPEM 将公钥编码为PEM
+func EncodeSM2PublicKeyPEM(pub *sm2.PublicKey) ([]byte, error) {
+	return x509.WritePublicKeyToPem(pub)
+}
+
+// EncodeSM2PrivateKeyHex 将私钥编码为64位16进制
+func EncodeSM2PrivateKeyHex(priv *sm2.PrivateKey) string {
+	return fmt.Sprintf("%064x", priv.D)
+}
+
+// EncodeSM2PublicKeyHex 将公钥编码为16进制(04||X||Y)
+func EncodeSM2PublicKeyHex(pub *sm2.PublicKey) string {
+	return x509.WritePublicKeyToHex(pub)
+}
+
+// SM2PublicKeyID 计算公钥标识
+func SM2PublicKeyID(pub *sm2.PublicKey) string {
+	return SM3Hash(EncodeSM2PublicKeyHex(pub))[:16]
+}
+
+// GetSM2PublicKeyPEM 获取当前SM2公钥的PEM
+func GetSM2PublicKeyPEM() string {
+	if SM2PublicKey == nil {
+		return ""
+	}
+	data, err := EncodeSM2PublicKeyPEM(SM2PublicKey)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
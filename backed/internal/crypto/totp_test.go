@@ -0,0 +1,93 @@
+package crypto
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录B的SHA-1测试向量，密钥为ASCII "12345678901234567890"，取8位口令的后6位
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatalf("计算口令失败: %v", err)
+		}
+		if code != v.code {
+			t.Fatalf("时间 %d: 口令 = %s, 期望 %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateTOTPRFC6238(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0))
+		if !ok {
+			t.Fatalf("时间 %d: 口令 %s 校验失败", v.unix, v.code)
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Fatalf("时间 %d: 时间步 = %d, 期望 %d", v.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	// 口令所在时间步为 1111111111/30 = 37037037
+	const code = "050471"
+	const codeStep = int64(37037037)
+	base := codeStep * totpPeriod
+
+	cases := []struct {
+		name string
+		unix int64
+		ok   bool
+	}{
+		{"同一步开始", base, true},
+		{"同一步结束", base + totpPeriod - 1, true},
+		{"客户端慢一步", base + totpPeriod, true},
+		{"客户端快一步", base - totpPeriod, true},
+		{"慢两步", base + 2*totpPeriod, false},
+		{"快两步", base - 2*totpPeriod, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(tc.unix, 0))
+			if ok != tc.ok {
+				t.Fatalf("校验结果 = %v, 期望 %v", ok, tc.ok)
+			}
+			// 返回的是口令本身所在的时间步，而不是当前时间步，防重放依赖该值
+			if ok && step != codeStep {
+				t.Fatalf("时间步 = %d, 期望 %d", step, codeStep)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsMalformed(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, code := range []string{"", "05047", "0504710", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+			t.Fatalf("口令 %q 校验通过", code)
+		}
+	}
+	// 前后空白被忽略
+	if _, ok := ValidateTOTP(rfc6238Secret, " 050471 ", now); !ok {
+		t.Fatal("带空白的正确口令校验失败")
+	}
+	if _, ok := ValidateTOTP("not-base32!", "050471", now); ok {
+		t.Fatal("非法密钥校验通过")
+	}
+}
@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// 传输层混合加密：客户端生成随机SM4会话密钥，用服务端SM2公钥(C1C3C2)加密后随请求发送，
+// 请求体使用会话密钥SM4-GCM加密。附加认证数据绑定请求方法、路径、nonce和时间戳，
+// 密文不能被挪到其他接口使用，nonce和时间戳也不能被篡改
+//
+// 请求体格式:
+//   {"keyId":"<服务端SM2密钥标识>","encryptedKey":"<16进制SM2密文>","nonce":"<随机串>",
+//    "timestamp":<毫秒时间戳>,"ciphertext":"<base64(iv|密文|tag)>"}
+// 请求AAD: <METHOD> <path>\n<nonce>\n<timestamp>
+// 响应AAD: response\n<nonce>
+
+const (
+	// transportSessionKeyLen 会话密钥长度
+	transportSessionKeyLen = 16
+	// sm2CipherOverhead SM2密文(C1C3C2，含04前缀)相对明文的长度
+	sm2CipherOverhead = 1 + 64 + 32
+)
+
+var (
+	ErrTransportKeyMismatch = errors.New("请求使用的SM2公钥已过期，请重新获取服务端公钥")
+	ErrTransportKeyInvalid  = errors.New("会话密钥解密失败")
+	ErrTransportDecrypt     = errors.New("请求体解密失败")
+)
+
+// TransportEnvelope 加密请求体
+type TransportEnvelope struct {
+	KeyID        string `json:"keyId"`
+	EncryptedKey string `json:"encryptedKey"`
+	Nonce        string `json:"nonce"`
+	Timestamp    int64  `json:"timestamp"`
+	Ciphertext   string `json:"ciphertext"`
+}
+
+// OpenTransportEnvelope 解密请求体，返回会话密钥（用于加密响应）和明文
+func OpenTransportEnvelope(env *TransportEnvelope, method, path string) ([]byte, []byte, error) {
+	if env.KeyID != "" && env.KeyID != SM2KeyID {
+		return nil, nil, ErrTransportKeyMismatch
+	}
+
+	sessionKey, err := decryptSessionKey(env.EncryptedKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, nil, ErrTransportDecrypt
+	}
+	aead, err := newSM4GCM(sessionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, nil, ErrTransportDecrypt
+	}
+
+	iv, body := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, iv, body, transportRequestAAD(method, path, env.Nonce, env.Timestamp))
+	if err != nil {
+		return nil, nil, ErrTransportDecrypt
+	}
+	return sessionKey, plaintext, nil
+}
+
+// SealTransportResponse 使用会话密钥加密响应体
+func SealTransportResponse(sessionKey []byte, nonce string, body []byte) (string, error) {
+	aead, err := newSM4GCM(sessionKey)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(iv, iv, body, []byte("response\n"+nonce))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSessionKey 使用服务端SM2私钥解密会话密钥
+// 兼容不带04前缀的密文（sm-crypto等前端库的默认输出）
+func decryptSessionKey(encryptedKeyHex string) ([]byte, error) {
+	data, err := hex.DecodeString(encryptedKeyHex)
+	if err != nil {
+		return nil, ErrTransportKeyInvalid
+	}
+	if len(data) == sm2CipherOverhead-1+transportSessionKeyLen {
+		data = append([]byte{0x04}, data...)
+	}
+	if len(data) != sm2CipherOverhead+transportSessionKeyLen || SM2PrivateKey == nil {
+		return nil, ErrTransportKeyInvalid
+	}
+
+	key, err := sm2.Decrypt(SM2PrivateKey, data, sm2.C1C3C2)
+	if err != nil || len(key) != transportSessionKeyLen {
+		return nil, ErrTransportKeyInvalid
+	}
+	return key, nil
+}
+
+// transportRequestAAD 请求附加认证数据
+func transportRequestAAD(method, path, nonce string, timestamp int64) []byte {
+	return []byte(method + " " + path + "\n" + nonce + "\n" + strconv.FormatInt(timestamp, 10))
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/service"
+	"sm-medical/pkg/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// APIKeyHeader 服务账号API密钥请求头
+	APIKeyHeader = "X-API-Key"
+	// APITimestampHeader SM2请求签名的时间戳（毫秒）
+	APITimestampHeader = "X-SM-Timestamp"
+	// APINonceHeader SM2请求签名的随机串，同一密钥在时间窗口内不能重复
+	APINonceHeader = "X-SM-Nonce"
+	// APISignatureHeader SM2请求签名（16进制DER），原文见 crypto.APIRequestSigningPayload
+	APISignatureHeader = "X-SM-Signature"
+)
+
+// apiNonces 服务账号签名请求已使用的nonce，按 密钥前缀:nonce 记录
+var apiNonces = &nonceCache{nonces: make(map[string]time.Time)}
+
+// APIKeyAuth 服务账号API密钥认证中间件，用于HIS、药房等院内系统调用的集成接口
+// 依次校验密钥、授权范围、限流，密钥绑定了SM2公钥时还要求请求签名；每次调用（含被拒绝的）都记录审计
+func APIKeyAuth(scope string) gin.HandlerFunc {
+	apiKeyService := service.NewAPIKeyService()
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		audit := &model.APIKeyAudit{
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Scope:    scope,
+			ClientIP: c.ClientIP(),
+		}
+		defer func() {
+			audit.DurationMs = time.Since(start).Milliseconds()
+			apiKeyService.Audit(audit)
+		}()
+
+		reject := func(code int, msg string) {
+			audit.StatusCode = code
+			audit.Msg = msg
+			utils.Error(c, code, msg)
+			c.Abort()
+		}
+
+		rawKey := strings.TrimSpace(c.GetHeader(APIKeyHeader))
+		if rawKey == "" {
+			reject(401, "缺少API密钥")
+			return
+		}
+		keyID, _, _ := strings.Cut(rawKey, ".")
+		audit.KeyID = truncate(keyID, 32)
+
+		principal, key, err := apiKeyService.Authenticate(rawKey)
+		if key != nil {
+			audit.APIKeyID = &key.ID
+			audit.ServiceAccountID = &key.ServiceAccountID
+		}
+		if err != nil {
+			log.Printf("[服务账号] 认证失败 - 密钥: %s, 路径: %s, IP: %s, 错误: %v", audit.KeyID, audit.Path, audit.ClientIP, err)
+			reject(401, err.Error())
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			log.Printf("[服务账号] 授权范围不足 - 密钥: %s, 需要: %s, 路径: %s", keyID, scope, audit.Path)
+			reject(403, "API密钥未授权该操作")
+			return
+		}
+
+		if ok, retryAfter := apiKeyService.Allow(principal.Key); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			reject(429, "调用过于频繁，请稍后再试")
+			return
+		}
+
+		if principal.PublicKey != nil {
+			if msg := verifyAPISignature(c, principal); msg != "" {
+				log.Printf("[服务账号] 签名校验失败 - 密钥: %s, 路径: %s, IP: %s, 原因: %s", keyID, audit.Path, audit.ClientIP, msg)
+				reject(401, msg)
+				return
+			}
+			audit.Signed = true
+		}
+
+		c.Set("apiKeyID", principal.Key.ID)
+		c.Set("serviceAccountID", principal.Account.ID)
+
+		// 接口的HTTP状态码统一为200，审计记录响应体中的业务状态码
+		writer := &responseCodeWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		audit.StatusCode = writer.code
+		if !writer.parsed {
+			audit.StatusCode = c.Writer.Status()
+		}
+	}
+}
+
+// responseCodeWriter 从响应体开头解析 utils.Response 的业务状态码
+type responseCodeWriter struct {
+	gin.ResponseWriter
+	code   int
+	parsed bool
+}
+
+func (w *responseCodeWriter) Write(data []byte) (int, error) {
+	w.parse(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCodeWriter) WriteString(s string) (int, error) {
+	w.parse([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseCodeWriter) parse(data []byte) {
+	if w.parsed {
+		return
+	}
+	w.parsed = true
+	w.code = w.ResponseWriter.Status()
+	rest, ok := bytes.CutPrefix(data, []byte(`{"code":`))
+	if !ok {
+		return
+	}
+	end := bytes.IndexByte(rest, ',')
+	if end < 0 {
+		return
+	}
+	if code, err := strconv.Atoi(string(rest[:end])); err == nil {
+		w.code = code
+	}
+}
+
+// verifyAPISignature 校验服务账号请求的SM2签名，失败时返回原因
+func verifyAPISignature(c *gin.Context, principal *service.APIPrincipal) string {
+	timestamp := c.GetHeader(APITimestampHeader)
+	nonce := c.GetHeader(APINonceHeader)
+	signature := c.GetHeader(APISignatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return "该API密钥要求SM2请求签名"
+	}
+	if len(nonce) < 16 || len(nonce) > 64 {
+		return "nonce长度必须为16-64位"
+	}
+
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "时间戳格式错误"
+	}
+	window := service.APISignatureWindow()
+	sentAt := time.UnixMilli(ms)
+	if skew := time.Since(sentAt); skew > window || skew < -window {
+		return "请求已过期，请校准时间后重试"
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxTransportBodySize+1))
+	if err != nil || len(body) > maxTransportBodySize {
+		return "请求体过大或读取失败"
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	payload := crypto.APIRequestSigningPayload(c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body)
+	if !crypto.SM2Verify(principal.PublicKey, payload, signature) {
+		return "请求签名无效"
+	}
+
+	// 签名通过后才记录nonce，避免伪造请求占用nonce
+	if !apiNonces.add(principal.Key.KeyID+":"+nonce, sentAt.Add(window)) {
+		return "重复的请求"
+	}
+	return ""
+}
+
+// truncate 截断过长的字符串
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
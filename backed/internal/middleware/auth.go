@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"github.com/gin-gonic/gin"
+	"sm-medical/internal/service"
 	"sm-medical/pkg/utils"
 	"strings"
 )
@@ -33,10 +34,18 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 检查会话是否已退出或被吊销
+		if claims.SessionID == "" || service.IsSessionRevoked(claims.SessionID) {
+			utils.Unauthorized(c, "登录已失效，请重新登录")
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存入context
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("sessionID", claims.SessionID)
 
 		c.Next()
 	}
@@ -47,7 +56,8 @@ func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Authorization, Accept, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Authorization, Accept, X-Requested-With, X-SM-Encrypted, X-SM-Encrypt-Response")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-SM-Encrypted")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -58,3 +68,21 @@ func CORS() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RedactQuery 在访问日志记录前遮盖URL中的敏感查询参数，避免Token等凭据写入日志
+func RedactQuery(keys ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		redacted := false
+		for _, key := range keys {
+			if _, ok := query[key]; ok {
+				query.Set(key, "***")
+				redacted = true
+			}
+		}
+		if redacted {
+			c.Request.URL.RawQuery = query.Encode()
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log"
+	"sm-medical/internal/service"
+	"sm-medical/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission 权限校验中间件，需放在 AuthMiddleware 之后
+// 角色拥有的权限由 service.RBACService 维护，管理员可在运行时调整
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if !service.HasPermission(role, permission) {
+			log.Printf("[权限] 拒绝访问 - 用户ID: %d, 角色: %s, 需要权限: %s, 路径: %s",
+				c.GetInt64("userID"), role, permission, c.Request.URL.Path)
+			utils.Forbidden(c, "无权限访问")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"sm-medical/internal/crypto"
+	"sm-medical/pkg/config"
+	"sm-medical/pkg/utils"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// TransportEncryptedHeader 请求体为SM2+SM4混合加密时携带的请求头
+	TransportEncryptedHeader = "X-SM-Encrypted"
+	// TransportEncryptResponseHeader 要求使用会话密钥加密响应时携带的请求头
+	TransportEncryptResponseHeader = "X-SM-Encrypt-Response"
+
+	// defaultReplayWindow 默认允许的时间戳偏差（秒）
+	defaultReplayWindow = 300
+	// maxTransportBodySize 加密请求体大小上限
+	maxTransportBodySize = 1 << 20
+)
+
+// TransportDecrypt 传输层解密中间件，用于注册、登录等提交敏感数据的接口
+// 请求头 X-SM-Encrypted: 1 时按 crypto.TransportEnvelope 解密请求体，再交给后续处理函数绑定；
+// 请求头 X-SM-Encrypt-Response: 1 时使用同一会话密钥加密响应。
+// crypto.transport.required 为true时拒绝未加密的请求
+func TransportDecrypt() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := transportConfig()
+
+		if c.GetHeader(TransportEncryptedHeader) != "1" {
+			if cfg.Required {
+				utils.BadRequest(c, "该接口要求加密传输")
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxTransportBodySize+1))
+		if err != nil || len(data) > maxTransportBodySize {
+			utils.BadRequest(c, "请求体过大或读取失败")
+			c.Abort()
+			return
+		}
+
+		var env crypto.TransportEnvelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			utils.BadRequest(c, "加密请求格式错误")
+			c.Abort()
+			return
+		}
+		if len(env.Nonce) < 16 || len(env.Nonce) > 64 {
+			utils.BadRequest(c, "nonce长度必须为16-64位")
+			c.Abort()
+			return
+		}
+
+		window := time.Duration(cfg.ReplayWindow) * time.Second
+		if window <= 0 {
+			window = defaultReplayWindow * time.Second
+		}
+		sentAt := time.UnixMilli(env.Timestamp)
+		if skew := time.Since(sentAt); skew > window || skew < -window {
+			utils.BadRequest(c, "请求已过期，请校准设备时间后重试")
+			c.Abort()
+			return
+		}
+
+		sessionKey, plaintext, err := crypto.OpenTransportEnvelope(&env, c.Request.Method, c.Request.URL.Path)
+		if err != nil {
+			log.Printf("[传输加密] 解密失败 - 路径: %s, IP: %s, 错误: %v", c.Request.URL.Path, c.ClientIP(), err)
+			utils.BadRequest(c, err.Error())
+			c.Abort()
+			return
+		}
+
+		// 解密成功后才记录nonce，避免伪造请求占用nonce
+		if !transportNonces.add(env.Nonce, sentAt.Add(window)) {
+			log.Printf("[传输加密] 重放请求 - 路径: %s, IP: %s, nonce: %s", c.Request.URL.Path, c.ClientIP(), env.Nonce)
+			utils.BadRequest(c, "重复的请求")
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(plaintext))
+		c.Request.ContentLength = int64(len(plaintext))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("transportEncrypted", true)
+
+		if c.GetHeader(TransportEncryptResponseHeader) != "1" {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		ciphertext, err := crypto.SealTransportResponse(sessionKey, env.Nonce, writer.body.Bytes())
+		if err != nil {
+			log.Printf("[传输加密] 响应加密失败 - 路径: %s, 错误: %v", c.Request.URL.Path, err)
+			c.Writer.Header().Del(TransportEncryptedHeader)
+			c.Writer.Write(writer.body.Bytes())
+			return
+		}
+
+		c.Writer.Header().Set(TransportEncryptedHeader, "1")
+		c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		payload, _ := json.Marshal(gin.H{
+			"encrypted":  true,
+			"nonce":      env.Nonce,
+			"ciphertext": ciphertext,
+		})
+		c.Writer.Write(payload)
+	}
+}
+
+// transportConfig 读取传输加密配置
+func transportConfig() config.TransportConfig {
+	if config.AppConfig == nil {
+		return config.TransportConfig{}
+	}
+	return config.AppConfig.Crypto.Transport
+}
+
+// bufferedResponseWriter 缓存处理函数的响应体，加密后再写出
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// nonceCache 已使用的nonce（nonce -> 过期时间），过期后时间戳校验会先拒绝，不需要继续保存
+type nonceCache struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastPurge time.Time
+}
+
+var transportNonces = &nonceCache{nonces: make(map[string]time.Time)}
+
+// add 记录nonce，已存在时返回false
+func (n *nonceCache) add(nonce string, expiresAt time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(n.lastPurge) > time.Minute {
+		for k, exp := range n.nonces {
+			if now.After(exp) {
+				delete(n.nonces, k)
+			}
+		}
+		n.lastPurge = now
+	}
+
+	if exp, ok := n.nonces[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	n.nonces[nonce] = expiresAt
+	return true
+}
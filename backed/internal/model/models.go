@@ -1,19 +1,26 @@
 package model
 
 import (
+	"sm-medical/internal/crypto"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // User 用户表模型
 type User struct {
 	ID             int64     `gorm:"primaryKey;autoIncrement" json:"userId"`
 	Username       string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"username"`
-	Password       string    `gorm:"type:varchar(128);not null" json:"-"` // SM3加密
-	Email          string    `gorm:"type:varchar(255);uniqueIndex;not null" json:"email"` // SM4加密
-	Phone          string    `gorm:"type:varchar(255)" json:"phone"` // SM4加密
-	RealName       string    `gorm:"type:varchar(255);column:real_name" json:"realName"` // SM4加密
-	IDCard         string    `gorm:"type:varchar(255);column:id_card" json:"idCard"` // SM4加密
-	Role           string    `gorm:"type:varchar(20);column:identify;not null;default:user" json:"role"` // user, admin, doctor
+	Password       string    `gorm:"type:varchar(128);not null" json:"-"` // 密码哈希($scrypt$...或$pbkdf2-sm3$...，旧数据为SM3(密码+用户名))
+	Email          string    `gorm:"serializer:sm4;type:varchar(512);not null" json:"email"` // SM4加密
+	Phone          string    `gorm:"serializer:sm4;type:varchar(512)" json:"phone"` // SM4加密
+	RealName       string    `gorm:"serializer:sm4;type:varchar(512);column:real_name" json:"realName"` // SM4加密
+	IDCard         string    `gorm:"serializer:sm4;type:varchar(512);column:id_card" json:"idCard"` // SM4加密
+	EmailBidx      string    `gorm:"type:varchar(64);uniqueIndex;column:email_bidx" json:"-"` // 邮箱盲索引(HMAC-SM3)
+	PhoneBidx      string    `gorm:"type:varchar(64);index;column:phone_bidx" json:"-"` // 手机号盲索引
+	RealNameBidx   string    `gorm:"type:varchar(64);index;column:real_name_bidx" json:"-"` // 真实姓名盲索引
+	IDCardBidx     string    `gorm:"type:varchar(64);index;column:id_card_bidx" json:"-"` // 身份证号盲索引
+	Role           string    `gorm:"type:varchar(20);column:identify;not null;default:user" json:"role"` // patient, doctor, pharmacist, admin
 	Avatar         string    `gorm:"type:varchar(500)" json:"avatar"`
 	Gender         int       `gorm:"type:tinyint;default:0" json:"gender"` // 0:未知 1:男 2:女
 	BirthDate      string    `gorm:"type:varchar(20);column:birth_date" json:"birthDate"`
@@ -31,22 +38,38 @@ type User struct {
 	CreatedAt      time.Time `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 	LastLoginTime  *time.Time `gorm:"column:last_login_time" json:"lastLoginTime"`
-	LastLoginIP    string    `gorm:"type:varchar(255);column:last_login_ip" json:"-"` // SM4加密
+	LastLoginIP    string    `gorm:"serializer:sm4;type:varchar(512);column:last_login_ip" json:"-"` // SM4加密
+	EmailVerifiedAt *time.Time `gorm:"column:email_verified_at" json:"emailVerifiedAt"` // 邮箱验证时间，修改邮箱后清空
+	PhoneVerifiedAt *time.Time `gorm:"column:phone_verified_at" json:"phoneVerifiedAt"` // 手机号验证时间，修改手机号后清空
 }
 
 func (User) TableName() string {
 	return "SM_user"
 }
 
+// BeforeSave 每次写入时根据明文重新计算盲索引（加密由sm4序列化器完成）
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	u.RefreshBlindIndexes()
+	return nil
+}
+
+// RefreshBlindIndexes 计算敏感字段的盲索引
+func (u *User) RefreshBlindIndexes() {
+	u.EmailBidx = crypto.BlindIndex(crypto.BlindIndexEmail, u.Email)
+	u.PhoneBidx = crypto.BlindIndex(crypto.BlindIndexPhone, u.Phone)
+	u.RealNameBidx = crypto.BlindIndex(crypto.BlindIndexRealName, u.RealName)
+	u.IDCardBidx = crypto.BlindIndex(crypto.BlindIndexIDCard, u.IDCard)
+}
+
 // DoctorApplication 医生申请记录
 type DoctorApplication struct {
 	ID            int64     `gorm:"primaryKey;autoIncrement" json:"applicationId"`
 	UserID        int64     `gorm:"not null;index" json:"userId"`
 	ApplicationNo string    `gorm:"type:varchar(50);not null;unique;column:application_no" json:"applicationNo"` // 申请编号
-	RealName      string    `gorm:"type:varchar(255);not null;column:real_name" json:"realName"`
-	IDCard        string    `gorm:"type:varchar(255);not null;column:id_card" json:"idCard"`
-	Phone         string    `gorm:"type:varchar(255);not null" json:"phone"`
-	Email         string    `gorm:"type:varchar(255);not null" json:"email"` // 邮箱
+	RealName      string    `gorm:"serializer:sm4;type:varchar(512);not null;column:real_name" json:"realName"` // SM4加密
+	IDCard        string    `gorm:"serializer:sm4;type:varchar(512);not null;column:id_card" json:"idCard"` // SM4加密
+	Phone         string    `gorm:"serializer:sm4;type:varchar(512);not null" json:"phone"` // SM4加密
+	Email         string    `gorm:"serializer:sm4;type:varchar(512);not null" json:"email"` // 邮箱(SM4加密)
 	DoctorCert    string    `gorm:"type:varchar(500);not null;column:doctor_cert" json:"doctorCert"`
 	DoctorTitle   string    `gorm:"type:varchar(50);not null;column:doctor_title" json:"doctorTitle"`
 	DoctorDept    string    `gorm:"type:varchar(50);not null;column:doctor_dept" json:"doctorDept"`
@@ -74,23 +97,27 @@ type Consultation struct {
 	PatientID         int64     `gorm:"not null;index;column:patient_id" json:"patientId"`
 	DoctorID          *int64    `gorm:"index;column:doctor_id" json:"doctorId"`
 	ConsultationNo    string    `gorm:"type:varchar(50);uniqueIndex;not null;column:consultation_no" json:"consultationNo"`
-	ChiefComplaint    string    `gorm:"type:text;column:chief_complaint" json:"chiefComplaint"` // SM4加密
+	ChiefComplaint    string    `gorm:"serializer:sm4;type:text;column:chief_complaint" json:"chiefComplaint"` // SM4加密
 	SymptomsEncrypted string    `gorm:"type:text;column:symptoms_encrypted" json:"-"` // Paillier加密
 	Symptoms          string    `gorm:"-" json:"symptoms"` // 解密后的症状
 	AIRiskScore       *int      `gorm:"column:ai_risk_score" json:"aiRiskScore"`
 	AIDiagnosis       string    `gorm:"type:text;column:ai_diagnosis" json:"aiDiagnosis"`
 	AISuggestions     string    `gorm:"type:text;column:ai_suggestions" json:"aiSuggestions"`
-	DoctorDiagnosis   string    `gorm:"type:text;column:doctor_diagnosis" json:"doctorDiagnosis"` // SM4加密
-	Prescription      string    `gorm:"type:text" json:"prescription"` // SM4加密
-	Status            int       `gorm:"type:tinyint;default:0;index" json:"status"` // 0:待接诊 1:问诊中 2:已完成 3:已取消
+	DoctorDiagnosis   string    `gorm:"serializer:sm4;type:text;column:doctor_diagnosis" json:"doctorDiagnosis"` // SM4加密
+	Prescription      string    `gorm:"serializer:sm4;type:text" json:"prescription"` // SM4加密
+	Status            int       `gorm:"type:tinyint;default:0;index" json:"status"` // 0:待接诊 1:问诊中 2:已完成 3:已取消 4:已超时
 	StatusText        string    `gorm:"-" json:"statusText"`
 	NeedAI            bool      `gorm:"type:tinyint;default:1;column:need_ai" json:"needAI"`
 	AutoAssigned      bool      `gorm:"type:tinyint;default:0;column:auto_assigned" json:"autoAssigned"` // 是否自动分诊
 	AssignedReason    string    `gorm:"type:varchar(200);column:assigned_reason" json:"assignedReason"` // 分诊原因
 	RecommendedDept   string    `gorm:"type:varchar(100);column:recommended_dept" json:"recommendedDept"` // AI推荐科室
+	UrgencyLevel      string    `gorm:"type:varchar(20);column:urgency_level" json:"urgencyLevel"` // AI判定的紧急程度: normal/attention/urgent/emergency
+	ReassignCount     int       `gorm:"default:0;column:reassign_count" json:"reassignCount"` // 超过待接诊时限后重新分诊的次数
+	FollowUpOf        *int64    `gorm:"index;column:follow_up_of" json:"followUpOf"` // 复诊关联的上一次问诊
 	CreatedAt         time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
 	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 	CompletedAt       *time.Time `gorm:"column:completed_at" json:"completedAt"`
+	StatusChangedAt   *time.Time `gorm:"column:status_changed_at" json:"statusChangedAt"` // 最近一次状态变更时间
 	
 	// 关联字段
 	PatientName       string    `gorm:"-" json:"patientName"`
@@ -102,6 +129,63 @@ func (Consultation) TableName() string {
 	return "SM_consultation"
 }
 
+// ConsultationEvent 问诊状态变更历史
+type ConsultationEvent struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"eventId"`
+	ConsultationID int64     `gorm:"not null;index;column:consultation_id" json:"consultationId"`
+	EventType      string    `gorm:"type:varchar(20);not null;column:event_type" json:"eventType"` // create, accept, finish, cancel, decline, timeout, reopen, reassign, expire, transfer
+	FromStatus     *int      `gorm:"type:tinyint;column:from_status" json:"fromStatus"`             // 创建事件为空
+	ToStatus       int       `gorm:"type:tinyint;not null;column:to_status" json:"toStatus"`
+	OperatorID     *int64    `gorm:"column:operator_id" json:"operatorId"` // 系统触发时为空
+	OperatorRole   string    `gorm:"type:varchar(20);column:operator_role" json:"operatorRole"`
+	DoctorID       *int64    `gorm:"column:doctor_id" json:"doctorId"` // 变更后的接诊医生
+	Note           string    `gorm:"type:varchar(500)" json:"note"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (ConsultationEvent) TableName() string {
+	return "SM_consultation_event"
+}
+
+// ConsultationParticipant 多学科会诊(MDT)参与医生，主诊医生即问诊的接诊医生，这里只记录受邀的会诊医生
+type ConsultationParticipant struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement" json:"participantId"`
+	ConsultationID int64      `gorm:"not null;uniqueIndex:uk_consultation_doctor;column:consultation_id" json:"consultationId"`
+	DoctorID       int64      `gorm:"not null;uniqueIndex:uk_consultation_doctor;index;column:doctor_id" json:"doctorId"`
+	Role           string     `gorm:"type:varchar(20);not null;default:consultant" json:"role"` // consultant
+	InvitedBy      int64      `gorm:"not null;column:invited_by" json:"invitedBy"`
+	InviteNote     string     `gorm:"type:varchar(500);column:invite_note" json:"inviteNote"`
+	Opinion        string     `gorm:"serializer:sm4;type:text" json:"opinion"` // 会诊意见，SM4加密
+	OpinionAt      *time.Time `gorm:"column:opinion_at" json:"opinionAt"`
+	Status         int        `gorm:"type:tinyint;not null;default:0" json:"status"` // 0:参与中 1:已退出
+	LeftAt         *time.Time `gorm:"column:left_at" json:"leftAt"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (ConsultationParticipant) TableName() string {
+	return "SM_consultation_participant"
+}
+
+// ConsultationFollowUp 复诊计划，医生完成问诊时安排，到期前提醒患者
+type ConsultationFollowUp struct {
+	ID                     int64      `gorm:"primaryKey;autoIncrement" json:"followUpId"`
+	ConsultationID         int64      `gorm:"not null;index;column:consultation_id" json:"consultationId"` // 安排复诊的问诊
+	PatientID              int64      `gorm:"not null;index;column:patient_id" json:"patientId"`
+	DoctorID               int64      `gorm:"not null;column:doctor_id" json:"doctorId"`
+	DueAt                  time.Time  `gorm:"not null;index;column:due_at" json:"dueAt"` // 建议复诊日期
+	Note                   string     `gorm:"type:varchar(500)" json:"note"`
+	Status                 int        `gorm:"type:tinyint;not null;default:0" json:"status"` // 0:待复诊 1:已复诊 2:已取消
+	RemindedAt             *time.Time `gorm:"column:reminded_at" json:"remindedAt"`
+	FollowUpConsultationID *int64     `gorm:"column:follow_up_consultation_id" json:"followUpConsultationId"` // 患者发起的复诊问诊
+	CreatedAt              time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt              time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (ConsultationFollowUp) TableName() string {
+	return "SM_consultation_follow_up"
+}
+
 // MedicalRecord 电子病历
 type MedicalRecord struct {
 	ID              int64     `gorm:"primaryKey;autoIncrement" json:"recordId"`
@@ -109,17 +193,20 @@ type MedicalRecord struct {
 	PatientID       int64     `gorm:"not null;index;column:patient_id" json:"patientId"`
 	ConsultationID  *int64    `gorm:"index;column:consultation_id" json:"consultationId"`
 	RecordType      int       `gorm:"type:tinyint;not null;column:record_type" json:"recordType"` // 1:门诊 2:在线问诊
-	ChiefComplaint  string    `gorm:"type:text;column:chief_complaint" json:"chiefComplaint"` // SM4加密
-	PresentIllness  string    `gorm:"type:text;column:present_illness" json:"presentIllness"` // SM4加密
-	PastHistory     string    `gorm:"type:text;column:past_history" json:"pastHistory"` // SM4加密
-	Diagnosis       string    `gorm:"type:text" json:"diagnosis"` // SM4加密
-	Treatment       string    `gorm:"type:text;column:treatment_plan" json:"treatment"` // SM4加密
+	ChiefComplaint  string    `gorm:"serializer:sm4;type:text;column:chief_complaint" json:"chiefComplaint"` // SM4加密
+	PresentIllness  string    `gorm:"serializer:sm4;type:text;column:present_illness" json:"presentIllness"` // SM4加密
+	PastHistory     string    `gorm:"serializer:sm4;type:text;column:past_history" json:"pastHistory"` // SM4加密
+	Diagnosis       string    `gorm:"serializer:sm4;type:text" json:"diagnosis"` // SM4加密
+	Treatment       string    `gorm:"serializer:sm4;type:text;column:treatment_plan" json:"treatment"` // SM4加密
 	DoctorID        *int64    `gorm:"column:doctor_id" json:"doctorId"`
 	DoctorName      string    `gorm:"-" json:"doctorName"`
 	DoctorDept      string    `gorm:"-" json:"doctorDept"`
 	AIAdvice        string    `gorm:"type:text;column:ai_advice" json:"aiAdvice"`
 	Symptoms        string    `gorm:"-" json:"symptoms"` // 前端需要的症状信息
 	DataHash        string    `gorm:"type:varchar(128);column:data_hash" json:"hashValue"` // SM3哈希
+	Signature       string    `gorm:"type:text;column:signature" json:"signature"` // SM2签名(16进制DER)
+	SignerKeyID     string    `gorm:"type:varchar(64);column:signer_key_id" json:"signerKeyId"` // 签名密钥标识
+	SignedAt        *time.Time `gorm:"column:signed_at" json:"signedAt"`
 	CreatedAt       time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
 	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
 }
@@ -151,7 +238,8 @@ type LoginLog struct {
 	ID            int64     `gorm:"primaryKey;autoIncrement" json:"logId"`
 	UserID        *int64    `gorm:"column:user_id" json:"userId"`
 	Username      string    `gorm:"type:varchar(50);column:username" json:"username"`
-	LoginIP       string    `gorm:"type:varchar(255);not null;column:login_ip" json:"-"` // SM4加密
+	LoginIP       string    `gorm:"serializer:sm4;type:varchar(512);not null;column:login_ip" json:"-"` // SM4加密
+	IPBidx        string    `gorm:"type:varchar(64);index;column:ip_bidx" json:"-"` // IP盲索引，用于按IP统计
 	LoginLocation string    `gorm:"type:varchar(100);column:login_location" json:"loginLocation"`
 	Browser       string    `gorm:"type:varchar(50)" json:"browser"`
 	OS            string    `gorm:"type:varchar(50);column:os" json:"os"`
@@ -198,11 +286,14 @@ type Prescription struct {
 	ConsultationID   int64      `gorm:"not null;index;column:consultation_id" json:"consultationId"`
 	PatientID        int64      `gorm:"not null;index;column:patient_id" json:"patientId"`
 	DoctorID         int64      `gorm:"not null;index;column:doctor_id" json:"doctorId"`
-	Diagnosis        string     `gorm:"type:text" json:"diagnosis"` // SM4加密
+	Diagnosis        string     `gorm:"serializer:sm4;type:text" json:"diagnosis"` // SM4加密
 	PrescriptionType int        `gorm:"type:tinyint;default:1;column:prescription_type" json:"prescriptionType"`
 	TotalAmount      float64    `gorm:"type:decimal(10,2);default:0.00;column:total_amount" json:"totalAmount"`
 	Status           int        `gorm:"type:tinyint;default:0;index" json:"status"`
 	DataHash         string     `gorm:"type:varchar(128);column:data_hash" json:"dataHash"` // SM3哈希
+	Signature        string     `gorm:"type:text;column:signature" json:"signature"` // SM2签名(16进制DER)
+	SignerKeyID      string     `gorm:"type:varchar(64);column:signer_key_id" json:"signerKeyId"` // 签名密钥标识
+	SignedAt         *time.Time `gorm:"column:signed_at" json:"signedAt"`
 	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt        time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
 	
@@ -245,7 +336,7 @@ type ChatMessage struct {
 	SenderID       int64      `gorm:"not null;index;column:sender_id" json:"senderId"`
 	ReceiverID     int64      `gorm:"not null;index;column:receiver_id" json:"receiverId"`
 	MessageType    int        `gorm:"type:tinyint;not null;default:1;column:message_type" json:"messageType"` // 1:文本 2:图片 3:语音 4:处方 5:系统
-	Content        string     `gorm:"type:text" json:"content"` // SM4加密
+	Content        string     `gorm:"serializer:sm4;type:text" json:"content"` // SM4加密
 	FileURL        string     `gorm:"type:varchar(500);column:file_url" json:"fileUrl"`
 	FileSize       int        `gorm:"type:int;column:file_size" json:"fileSize"`
 	Duration       int        `gorm:"type:int" json:"duration"` // 语音时长
@@ -280,3 +371,243 @@ type ChatUnreadCount struct {
 func (ChatUnreadCount) TableName() string {
 	return "SM_chat_unread_count"
 }
+
+// CryptoReencryptJob SM4密钥轮换重加密任务
+type CryptoReencryptJob struct {
+	ID           int64      `gorm:"primaryKey;autoIncrement" json:"jobId"`
+	TargetKeyID  string     `gorm:"type:varchar(64);not null;column:target_key_id" json:"targetKeyId"` // 目标密钥标识
+	Status       string     `gorm:"type:varchar(20);not null;index" json:"status"` // running, paused, completed, failed
+	CurrentTable string     `gorm:"type:varchar(64);column:current_table" json:"currentTable"` // 当前处理的表(断点)
+	LastID       int64      `gorm:"default:0;column:last_id" json:"lastId"` // 当前表已处理的最大ID(断点)
+	Scanned      int64      `gorm:"default:0" json:"scanned"` // 已扫描行数
+	Reencrypted  int64      `gorm:"default:0" json:"reencrypted"` // 已重加密行数
+	Failed       int64      `gorm:"default:0" json:"failed"` // 解密失败的字段数
+	ErrorMsg     string     `gorm:"type:text;column:error_msg" json:"errorMsg"`
+	CreatedBy    int64      `gorm:"column:created_by" json:"createdBy"`
+	StartedAt    *time.Time `gorm:"column:started_at" json:"startedAt"`
+	FinishedAt   *time.Time `gorm:"column:finished_at" json:"finishedAt"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (CryptoReencryptJob) TableName() string {
+	return "SM_crypto_reencrypt_job"
+}
+
+// DoctorCertificate 医生SM2签名证书（由内部CA签发）
+type DoctorCertificate struct {
+	ID                  int64      `gorm:"primaryKey;autoIncrement" json:"certId"`
+	DoctorID            int64      `gorm:"not null;index;column:doctor_id" json:"doctorId"`
+	SerialNumber        string     `gorm:"type:varchar(64);uniqueIndex;not null;column:serial_number" json:"serialNumber"`
+	KeyID               string     `gorm:"type:varchar(64);index;not null;column:key_id" json:"keyId"` // 公钥标识，与文档SignerKeyID对应
+	PublicKey           string     `gorm:"type:varchar(200);not null;column:public_key" json:"publicKey"`
+	CertificatePEM      string     `gorm:"type:text;not null;column:certificate_pem" json:"certificatePem"`
+	EncryptedPrivateKey string     `gorm:"type:text;not null;column:encrypted_private_key" json:"-"` // 口令派生密钥加密的私钥
+	Status              string     `gorm:"type:varchar(20);not null;index" json:"status"` // active, revoked
+	NotBefore           time.Time  `gorm:"column:not_before" json:"notBefore"`
+	NotAfter            time.Time  `gorm:"column:not_after" json:"notAfter"`
+	RevokedAt           *time.Time `gorm:"column:revoked_at" json:"revokedAt"`
+	RevokeReason        string     `gorm:"type:varchar(255);column:revoke_reason" json:"revokeReason"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt           time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (DoctorCertificate) TableName() string {
+	return "SM_doctor_certificate"
+}
+
+// RolePermission 角色权限分配（管理员可在运行时调整）
+type RolePermission struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Role       string    `gorm:"type:varchar(20);not null;uniqueIndex:uk_role_permission" json:"role"`
+	Permission string    `gorm:"type:varchar(64);not null;uniqueIndex:uk_role_permission" json:"permission"`
+	CreatedBy  int64     `gorm:"column:created_by" json:"createdBy"` // 0表示系统初始化
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (RolePermission) TableName() string {
+	return "SM_role_permission"
+}
+
+// UserSession 登录会话，一次登录对应一个会话，刷新令牌每次使用后轮换
+type UserSession struct {
+	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID        string     `gorm:"type:varchar(64);uniqueIndex;not null;column:session_id" json:"sessionId"`
+	UserID           int64      `gorm:"index;not null;column:user_id" json:"userId"`
+	RefreshTokenHash string     `gorm:"type:varchar(64);not null;column:refresh_token_hash" json:"-"` // 当前刷新令牌的SM3哈希
+	PrevTokenHash    string     `gorm:"type:varchar(64);column:prev_token_hash" json:"-"`             // 上一个刷新令牌的SM3哈希，再次出现说明令牌被盗用
+	ClientIP         string     `gorm:"serializer:sm4;type:varchar(512);column:client_ip" json:"clientIp"` // SM4加密
+	UserAgent        string     `gorm:"type:varchar(255);column:user_agent" json:"userAgent"`
+	Device           string     `gorm:"type:varchar(20)" json:"device"` // PC, Mobile, Tablet
+	Browser          string     `gorm:"type:varchar(50)" json:"browser"`
+	OS               string     `gorm:"type:varchar(50);column:os" json:"os"`
+	ExpiresAt        time.Time  `gorm:"not null;column:expires_at" json:"expiresAt"` // 刷新令牌过期时间
+	LastRefreshAt    *time.Time `gorm:"column:last_refresh_at" json:"lastRefreshAt"`
+	RevokedAt        *time.Time `gorm:"column:revoked_at" json:"revokedAt"`
+	RevokeReason     string     `gorm:"type:varchar(100);column:revoke_reason" json:"revokeReason"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt        time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (UserSession) TableName() string {
+	return "SM_user_session"
+}
+
+// TokenRevocation 已吊销会话的访问令牌黑名单，过期时间之后该会话签发的访问令牌均已失效
+type TokenRevocation struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	SessionID string    `gorm:"type:varchar(64);uniqueIndex;not null;column:session_id" json:"sessionId"`
+	UserID    int64     `gorm:"not null;column:user_id" json:"userId"`
+	Reason    string    `gorm:"type:varchar(100)" json:"reason"`
+	ExpiresAt time.Time `gorm:"index;not null;column:expires_at" json:"expiresAt"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (TokenRevocation) TableName() string {
+	return "SM_token_revocation"
+}
+
+// UserMFA 用户TOTP两步验证设置
+type UserMFA struct {
+	ID           int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       int64      `gorm:"uniqueIndex;not null;column:user_id" json:"userId"`
+	Secret       string     `gorm:"serializer:sm4;type:varchar(512);not null" json:"-"` // TOTP密钥，SM4加密
+	Enabled      bool       `gorm:"not null;default:false" json:"enabled"`             // 绑定时校验动态口令成功后启用
+	LastUsedStep int64      `gorm:"column:last_used_step" json:"-"`                    // 最近使用的口令时间步，防止重放
+	EnabledAt    *time.Time `gorm:"column:enabled_at" json:"enabledAt"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (UserMFA) TableName() string {
+	return "SM_user_mfa"
+}
+
+// MFARecoveryCode 两步验证恢复码，丢失身份验证器时一次性使用
+type MFARecoveryCode struct {
+	ID        int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64      `gorm:"index;not null;column:user_id" json:"userId"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;column:code_hash" json:"-"` // SM3(恢复码+用户ID)
+	UsedAt    *time.Time `gorm:"column:used_at" json:"usedAt"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (MFARecoveryCode) TableName() string {
+	return "SM_mfa_recovery_code"
+}
+
+// LoginLockout 登录失败计数和锁定状态，按账号和IP分别统计
+type LoginLockout struct {
+	ID            int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Scope         string     `gorm:"type:varchar(10);not null;uniqueIndex:uk_login_lockout" json:"scope"`   // account, ip
+	Subject       string     `gorm:"type:varchar(64);not null;uniqueIndex:uk_login_lockout" json:"subject"` // 用户ID或IP盲索引
+	UserID        *int64     `gorm:"column:user_id" json:"userId"`                                        // 账号锁定时的用户ID
+	Failures      int        `gorm:"not null;default:0" json:"failures"`                                  // 统计窗口内的连续失败次数
+	NextAttemptAt *time.Time `gorm:"column:next_attempt_at" json:"nextAttemptAt"`                         // 渐进延迟：此时间前拒绝登录
+	LockedUntil   *time.Time `gorm:"column:locked_until" json:"lockedUntil"`                              // 锁定截止时间
+	LastFailureAt time.Time  `gorm:"column:last_failure_at" json:"lastFailureAt"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (LoginLockout) TableName() string {
+	return "SM_login_lockout"
+}
+
+// VerificationCode 邮箱/手机验证码和密码重置令牌，只保存SM3哈希，使用一次后作废
+type VerificationCode struct {
+	ID         int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     int64      `gorm:"index;not null;column:user_id" json:"userId"`
+	Purpose    string     `gorm:"type:varchar(20);not null" json:"purpose"`                      // verify_email, verify_phone, reset_password, reset_token
+	Channel    string     `gorm:"type:varchar(10);not null" json:"channel"`                      // email, sms
+	TargetBidx string     `gorm:"type:varchar(64);index;column:target_bidx" json:"-"`            // 收件邮箱或手机号的盲索引
+	IPBidx     string     `gorm:"type:varchar(64);index;column:ip_bidx" json:"-"`                // 请求IP的盲索引，用于按IP限流
+	CodeHash   string     `gorm:"type:varchar(64);not null;index;column:code_hash" json:"-"`     // SM3(验证码+用户ID+用途)，重置令牌为SM3(令牌)
+	Attempts   int        `gorm:"not null;default:0" json:"attempts"`                            // 错误次数
+	ExpiresAt  time.Time  `gorm:"not null;column:expires_at" json:"expiresAt"`
+	UsedAt     *time.Time `gorm:"column:used_at" json:"usedAt"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (VerificationCode) TableName() string {
+	return "SM_verification_code"
+}
+
+// SecurityEvent 登录异常检测发现的安全事件
+type SecurityEvent struct {
+	ID         int64      `gorm:"primaryKey;autoIncrement" json:"eventId"`
+	EventType  string     `gorm:"type:varchar(30);not null;index;column:event_type" json:"eventType"` // impossible_travel, new_device, credential_stuffing, off_hours_admin
+	Severity   string     `gorm:"type:varchar(10);not null" json:"severity"`                         // low, medium, high
+	UserID     *int64     `gorm:"index;column:user_id" json:"userId"`                                // 撞库事件不针对单个用户，为空
+	Username   string     `gorm:"type:varchar(50)" json:"username"`
+	LoginLogID *int64     `gorm:"column:login_log_id" json:"loginLogId"`                             // 触发检测的登录日志
+	Subject    string     `gorm:"type:varchar(64);index" json:"-"`                                   // 去重标识：撞库为IP盲索引或global
+	IP         string     `gorm:"serializer:sm4;type:varchar(512);column:ip" json:"-"`               // SM4加密
+	Location   string     `gorm:"type:varchar(100)" json:"location"`
+	Detail     string     `gorm:"type:text" json:"detail"`
+	Status     int        `gorm:"type:tinyint;not null;default:0;index" json:"status"` // 0:待处理 1:已确认 2:误报
+	HandledBy  *int64     `gorm:"column:handled_by" json:"handledBy"`
+	HandledAt  *time.Time `gorm:"column:handled_at" json:"handledAt"`
+	HandleNote string     `gorm:"type:varchar(255);column:handle_note" json:"handleNote"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (SecurityEvent) TableName() string {
+	return "SM_security_event"
+}
+
+// ServiceAccount 服务账号，供HIS、药房等院内系统调用接口
+type ServiceAccount struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement" json:"serviceAccountId"`
+	Name        string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"type:varchar(255)" json:"description"`
+	Status      int       `gorm:"type:tinyint;not null;default:0" json:"status"` // 0:正常 1:禁用
+	CreatedBy   int64     `gorm:"not null;column:created_by" json:"createdBy"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (ServiceAccount) TableName() string {
+	return "SM_service_account"
+}
+
+// APIKey 服务账号的API密钥，完整密钥只在创建时返回一次，数据库保存SM3哈希
+type APIKey struct {
+	ID               int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	KeyID            string     `gorm:"type:varchar(32);uniqueIndex;not null;column:key_id" json:"keyId"` // 密钥前缀，随密钥一起出示
+	ServiceAccountID int64      `gorm:"not null;index;column:service_account_id" json:"serviceAccountId"`
+	Name             string     `gorm:"type:varchar(50)" json:"name"`
+	SecretHash       string     `gorm:"type:varchar(64);not null;column:secret_hash" json:"-"` // SM3(完整密钥)
+	Scopes           string     `gorm:"type:varchar(255);not null" json:"scopes"`              // 逗号分隔的授权范围
+	SM2PublicKey     string     `gorm:"type:text;column:sm2_public_key" json:"sm2PublicKey"`   // 配置后请求必须使用对应私钥签名
+	RateLimit        int        `gorm:"not null;default:0;column:rate_limit" json:"rateLimit"` // 每分钟最多请求数
+	ExpiresAt        *time.Time `gorm:"column:expires_at" json:"expiresAt"`
+	LastUsedAt       *time.Time `gorm:"column:last_used_at" json:"lastUsedAt"`
+	RevokedAt        *time.Time `gorm:"column:revoked_at" json:"revokedAt"`
+	CreatedBy        int64      `gorm:"not null;column:created_by" json:"createdBy"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (APIKey) TableName() string {
+	return "SM_api_key"
+}
+
+// APIKeyAudit API密钥调用审计，每次请求（含被拒绝的请求）记录一条
+type APIKeyAudit struct {
+	ID               int64     `gorm:"primaryKey;autoIncrement" json:"auditId"`
+	APIKeyID         *int64    `gorm:"index;column:api_key_id" json:"apiKeyId"` // 密钥不存在时为空
+	KeyID            string    `gorm:"type:varchar(32);column:key_id" json:"keyId"`
+	ServiceAccountID *int64    `gorm:"index;column:service_account_id" json:"serviceAccountId"`
+	Method           string    `gorm:"type:varchar(10)" json:"method"`
+	Path             string    `gorm:"type:varchar(255)" json:"path"`
+	Scope            string    `gorm:"type:varchar(50)" json:"scope"`
+	StatusCode       int       `gorm:"column:status_code" json:"statusCode"`
+	Signed           bool      `gorm:"type:tinyint" json:"signed"` // 是否通过SM2签名校验
+	ClientIP         string    `gorm:"serializer:sm4;type:varchar(512);column:client_ip" json:"-"` // SM4加密
+	Msg              string    `gorm:"type:varchar(255)" json:"msg"`
+	DurationMs       int64     `gorm:"column:duration_ms" json:"durationMs"`
+	CreatedAt        time.Time `gorm:"autoCreateTime;index" json:"createdAt"`
+}
+
+func (APIKeyAudit) TableName() string {
+	return "SM_api_key_audit"
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sm-medical/internal/crypto"
+
+	"gorm.io/gorm/schema"
+)
+
+// SM4Serializer 敏感字段透明加密，字段标签 gorm:"serializer:sm4"
+// 写入数据库时SM4-GCM加密，读取时解密（兼容旧版ECB密文），结构体中始终是明文
+// 解密失败时查询返回错误，不会静默得到空字符串
+type SM4Serializer struct{}
+
+func init() {
+	schema.RegisterSerializer("sm4", SM4Serializer{})
+}
+
+// Scan 读取时解密
+func (SM4Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var ciphertext string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		ciphertext = string(v)
+	case string:
+		ciphertext = v
+	default:
+		return fmt.Errorf("字段 %s 的数据库值类型 %T 无法解密", field.DBName, dbValue)
+	}
+
+	plaintext, err := crypto.SM4Decrypt(ciphertext)
+	if err != nil {
+		return fmt.Errorf("字段 %s 解密失败: %w", field.DBName, err)
+	}
+
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+// Value 写入时加密
+func (SM4Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("字段 %s 类型 %T 不支持SM4加密", field.DBName, fieldValue)
+	}
+
+	ciphertext, err := crypto.SM4Encrypt(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("字段 %s 加密失败: %w", field.DBName, err)
+	}
+	return ciphertext, nil
+}
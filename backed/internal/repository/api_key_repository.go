@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+	"time"
+)
+
+type APIKeyRepository struct{}
+
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{}
+}
+
+// CreateServiceAccount 创建服务账号
+func (r *APIKeyRepository) CreateServiceAccount(account *model.ServiceAccount) error {
+	return database.GetDB().Create(account).Error
+}
+
+// FindServiceAccount 根据ID查询服务账号
+func (r *APIKeyRepository) FindServiceAccount(id int64) (*model.ServiceAccount, error) {
+	var account model.ServiceAccount
+	if err := database.GetDB().First(&account, id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// ExistsServiceAccountName 服务账号名称是否已存在
+func (r *APIKeyRepository) ExistsServiceAccountName(name string) (bool, error) {
+	var count int64
+	err := database.GetDB().Model(&model.ServiceAccount{}).Where("name = ?", name).Count(&count).Error
+	return count > 0, err
+}
+
+// FindServiceAccounts 查询全部服务账号
+func (r *APIKeyRepository) FindServiceAccounts() ([]model.ServiceAccount, error) {
+	var accounts []model.ServiceAccount
+	err := database.GetDB().Order("id ASC").Find(&accounts).Error
+	return accounts, err
+}
+
+// UpdateServiceAccountStatus 启用或禁用服务账号
+func (r *APIKeyRepository) UpdateServiceAccountStatus(id int64, status int) error {
+	return database.GetDB().Model(&model.ServiceAccount{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// CreateKey 保存API密钥
+func (r *APIKeyRepository) CreateKey(key *model.APIKey) error {
+	return database.GetDB().Create(key).Error
+}
+
+// FindKeyByKeyID 根据密钥前缀查询
+func (r *APIKeyRepository) FindKeyByKeyID(keyID string) (*model.APIKey, error) {
+	var key model.APIKey
+	if err := database.GetDB().Where("key_id = ?", keyID).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FindKeysByServiceAccount 查询服务账号的全部密钥，serviceAccountID为0时查询全部
+func (r *APIKeyRepository) FindKeysByServiceAccount(serviceAccountID int64) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	query := database.GetDB().Model(&model.APIKey{})
+	if serviceAccountID > 0 {
+		query = query.Where("service_account_id = ?", serviceAccountID)
+	}
+	err := query.Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeKey 吊销密钥
+func (r *APIKeyRepository) RevokeKey(keyID string) (int64, error) {
+	result := database.GetDB().Model(&model.APIKey{}).
+		Where("key_id = ? AND revoked_at IS NULL", keyID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// TouchKey 更新最近使用时间
+func (r *APIKeyRepository) TouchKey(id int64, at time.Time) error {
+	return database.GetDB().Model(&model.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+// CreateAudit 保存调用审计
+func (r *APIKeyRepository) CreateAudit(audit *model.APIKeyAudit) error {
+	return database.GetDB().Create(audit).Error
+}
+
+// FindAudits 分页查询调用审计
+func (r *APIKeyRepository) FindAudits(page, pageSize int, serviceAccountID int64, keyID string) ([]model.APIKeyAudit, int64, error) {
+	var audits []model.APIKeyAudit
+	var total int64
+
+	query := database.GetDB().Model(&model.APIKeyAudit{})
+	if serviceAccountID > 0 {
+		query = query.Where("service_account_id = ?", serviceAccountID)
+	}
+	if keyID != "" {
+		query = query.Where("key_id = ?", keyID)
+	}
+
+	query.Count(&total)
+
+	offset := (page - 1) * pageSize
+	err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&audits).Error
+	return audits, total, err
+}
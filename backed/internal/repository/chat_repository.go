@@ -102,6 +102,18 @@ func (r *ChatRepository) UpdateUnreadCount(userID, consultationID int64, count i
 	`, userID, consultationID, count, lastMessageID, lastMessageTime).Error
 }
 
+// IncrementUnreadCount 未读消息数加一（多学科会诊中不是消息接收者的其他医生）
+func (r *ChatRepository) IncrementUnreadCount(userID, consultationID int64, lastMessageID int64, lastMessageTime time.Time) error {
+	return database.DB.Exec(`
+		INSERT INTO SM_chat_unread_count (user_id, consultation_id, unread_count, last_message_id, last_message_time)
+		VALUES (?, ?, 1, ?, ?)
+		ON DUPLICATE KEY UPDATE 
+			unread_count = unread_count + 1,
+			last_message_id = VALUES(last_message_id),
+			last_message_time = VALUES(last_message_time)
+	`, userID, consultationID, lastMessageID, lastMessageTime).Error
+}
+
 // GetUnreadCountByUser 获取用户所有问诊的未读消息统计
 func (r *ChatRepository) GetUnreadCountByUser(userID int64) ([]model.ChatUnreadCount, error) {
 	var counts []model.ChatUnreadCount
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+	"time"
+)
+
+type ConsultationFollowUpRepository struct{}
+
+func NewConsultationFollowUpRepository() *ConsultationFollowUpRepository {
+	return &ConsultationFollowUpRepository{}
+}
+
+// Create 创建复诊计划
+func (r *ConsultationFollowUpRepository) Create(followUp *model.ConsultationFollowUp) error {
+	return database.GetDB().Create(followUp).Error
+}
+
+// FindByConsultationID 查询问诊最近一次安排的复诊计划
+func (r *ConsultationFollowUpRepository) FindByConsultationID(consultationID int64) (*model.ConsultationFollowUp, error) {
+	var followUp model.ConsultationFollowUp
+	err := database.GetDB().Where("consultation_id = ?", consultationID).Order("id DESC").First(&followUp).Error
+	if err != nil {
+		return nil, err
+	}
+	return &followUp, nil
+}
+
+// FindByPatientID 查询患者待复诊的计划（按复诊日期正序）
+func (r *ConsultationFollowUpRepository) FindByPatientID(patientID int64) ([]model.ConsultationFollowUp, error) {
+	var followUps []model.ConsultationFollowUp
+	err := database.GetDB().Where("patient_id = ? AND status = 0", patientID).Order("due_at ASC").Find(&followUps).Error
+	return followUps, err
+}
+
+// CancelPending 取消问诊尚未复诊的计划（重新安排前调用）
+func (r *ConsultationFollowUpRepository) CancelPending(consultationID int64) error {
+	return database.GetDB().Model(&model.ConsultationFollowUp{}).
+		Where("consultation_id = ? AND status = 0", consultationID).
+		Update("status", 2).Error
+}
+
+// FindDueForReminder 查询复诊日期早于before且尚未提醒的计划
+func (r *ConsultationFollowUpRepository) FindDueForReminder(before time.Time, limit int) ([]model.ConsultationFollowUp, error) {
+	var followUps []model.ConsultationFollowUp
+	err := database.GetDB().
+		Where("status = 0 AND reminded_at IS NULL AND due_at <= ?", before).
+		Order("due_at ASC").Limit(limit).Find(&followUps).Error
+	return followUps, err
+}
+
+// MarkReminded 标记已提醒，返回false表示已被其他实例处理
+func (r *ConsultationFollowUpRepository) MarkReminded(id int64) (bool, error) {
+	result := database.GetDB().Model(&model.ConsultationFollowUp{}).
+		Where("id = ? AND reminded_at IS NULL", id).
+		Update("reminded_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// Complete 患者发起复诊后关联复诊问诊
+func (r *ConsultationFollowUpRepository) Complete(consultationID, followUpConsultationID int64) error {
+	return database.GetDB().Model(&model.ConsultationFollowUp{}).
+		Where("consultation_id = ? AND status = 0", consultationID).
+		Updates(map[string]interface{}{
+			"status":                    1,
+			"follow_up_consultation_id": followUpConsultationID,
+		}).Error
+}
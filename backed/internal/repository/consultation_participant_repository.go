@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+)
+
+type ConsultationParticipantRepository struct{}
+
+func NewConsultationParticipantRepository() *ConsultationParticipantRepository {
+	return &ConsultationParticipantRepository{}
+}
+
+// Find 查询医生在问诊中的参与记录（含已退出）
+func (r *ConsultationParticipantRepository) Find(consultationID, doctorID int64) (*model.ConsultationParticipant, error) {
+	var participant model.ConsultationParticipant
+	err := database.GetDB().Where("consultation_id = ? AND doctor_id = ?", consultationID, doctorID).First(&participant).Error
+	if err != nil {
+		return nil, err
+	}
+	return &participant, nil
+}
+
+// FindActive 查询问诊中参与中的会诊医生（按邀请时间正序）
+func (r *ConsultationParticipantRepository) FindActive(consultationID int64) ([]model.ConsultationParticipant, error) {
+	var participants []model.ConsultationParticipant
+	err := database.GetDB().Where("consultation_id = ? AND status = 0", consultationID).Order("id ASC").Find(&participants).Error
+	return participants, err
+}
+
+// IsActive 医生是否为问诊参与中的会诊医生
+func (r *ConsultationParticipantRepository) IsActive(consultationID, doctorID int64) bool {
+	var count int64
+	database.GetDB().Model(&model.ConsultationParticipant{}).
+		Where("consultation_id = ? AND doctor_id = ? AND status = 0", consultationID, doctorID).
+		Count(&count)
+	return count > 0
+}
+
+// Save 创建或更新参与记录
+func (r *ConsultationParticipantRepository) Save(participant *model.ConsultationParticipant) error {
+	return database.GetDB().Save(participant).Error
+}
@@ -3,6 +3,9 @@ package repository
 import (
 	"sm-medical/internal/model"
 	"sm-medical/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 type ConsultationRepository struct{}
@@ -41,15 +44,16 @@ func (r *ConsultationRepository) FindByUserRole(userID int64, role string, page,
 		// 医生可以看到：
 		// 1. 已经指定给自己的问诊（doctor_id = 自己的ID）
 		// 2. 如果没有筛选状态，也显示待接诊的问诊（doctor_id IS NULL 且 status = 0）
+		// 3. 受邀参与的多学科会诊
 		if status == nil {
-			// 没有状态筛选：显示指定给自己的 + 所有待接诊的
-			query = query.Where("doctor_id = ? OR (doctor_id IS NULL AND status = 0)", userID)
+			// 没有状态筛选：显示指定给自己的 + 所有待接诊的 + 参与会诊的
+			query = query.Where("doctor_id = ? OR (doctor_id IS NULL AND status = 0) OR id IN (?)", userID, participantSubQuery(userID))
 		} else if *status == 0 {
 			// 筛选待接诊：只显示指定给自己且待接诊的
 			query = query.Where("doctor_id = ? AND status = 0", userID)
 		} else {
-			// 筛选其他状态：只显示指定给自己的
-			query = query.Where("doctor_id = ?", userID)
+			// 筛选其他状态：显示指定给自己的 + 参与会诊的
+			query = query.Where("doctor_id = ? OR id IN (?)", userID, participantSubQuery(userID))
 		}
 	}
 
@@ -80,3 +84,59 @@ func (r *ConsultationRepository) FindByUserRole(userID int64, role string, page,
 
 	return consultations, total, err
 }
+
+// UpdateStatus 状态变更：仅当数据库中的状态仍为fromStatus时更新问诊，并在同一事务中写入变更历史
+// 返回false表示状态已被其他请求修改
+func (r *ConsultationRepository) UpdateStatus(consultation *model.Consultation, fromStatus int, event *model.ConsultationEvent) (bool, error) {
+	updated := false
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(consultation).Where("status = ?", fromStatus).Select("*").Omit("created_at").Updates(consultation)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		updated = true
+		return tx.Create(event).Error
+	})
+	return updated, err
+}
+
+// participantSubQuery 医生参与中的多学科会诊问诊ID
+func participantSubQuery(doctorID int64) *gorm.DB {
+	return database.GetDB().Model(&model.ConsultationParticipant{}).
+		Select("consultation_id").Where("doctor_id = ? AND status = 0", doctorID)
+}
+
+// CreateEvent 写入状态变更历史
+func (r *ConsultationRepository) CreateEvent(event *model.ConsultationEvent) error {
+	return database.GetDB().Create(event).Error
+}
+
+// FindEvents 查询问诊的状态变更历史（按时间正序）
+func (r *ConsultationRepository) FindEvents(consultationID int64) ([]model.ConsultationEvent, error) {
+	var events []model.ConsultationEvent
+	err := database.GetDB().Where("consultation_id = ?", consultationID).Order("id ASC").Find(&events).Error
+	return events, err
+}
+
+// FindStaleByStatus 查询处于指定状态且最近一次状态变更早于before的问诊（历史数据没有变更时间时按创建时间）
+func (r *ConsultationRepository) FindStaleByStatus(status int, before time.Time, limit int) ([]model.Consultation, error) {
+	var consultations []model.Consultation
+	err := database.GetDB().
+		Where("status = ? AND COALESCE(status_changed_at, created_at) < ?", status, before).
+		Order("id ASC").Limit(limit).Find(&consultations).Error
+	return consultations, err
+}
+
+// FindStaleByUrgency 查询处于指定状态且超过各自紧急程度时限的问诊，紧急程度高的优先
+// emergencyBefore、urgentBefore 分别为 emergency、urgent 问诊的截止时间，其余问诊使用 normalBefore
+func (r *ConsultationRepository) FindStaleByUrgency(status int, emergencyBefore, urgentBefore, normalBefore time.Time, limit int) ([]model.Consultation, error) {
+	var consultations []model.Consultation
+	err := database.GetDB().
+		Where(`status = ? AND COALESCE(status_changed_at, created_at) < CASE urgency_level
+			WHEN 'emergency' THEN ? WHEN 'urgent' THEN ? ELSE ? END`, status, emergencyBefore, urgentBefore, normalBefore).
+		Order("FIELD(urgency_level, 'urgent', 'emergency') DESC, id ASC").Limit(limit).Find(&consultations).Error
+	return consultations, err
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+	"time"
+)
+
+type DoctorCertRepository struct{}
+
+func NewDoctorCertRepository() *DoctorCertRepository {
+	return &DoctorCertRepository{}
+}
+
+// Create 保存签发的证书
+func (r *DoctorCertRepository) Create(cert *model.DoctorCertificate) error {
+	return database.GetDB().Create(cert).Error
+}
+
+// Update 更新证书
+func (r *DoctorCertRepository) Update(cert *model.DoctorCertificate) error {
+	return database.GetDB().Save(cert).Error
+}
+
+// FindActiveByDoctorID 查询医生当前有效证书
+func (r *DoctorCertRepository) FindActiveByDoctorID(doctorID int64) (*model.DoctorCertificate, error) {
+	var cert model.DoctorCertificate
+	err := database.GetDB().Where("doctor_id = ? AND status = ?", doctorID, "active").
+		Order("id DESC").First(&cert).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// FindByKeyID 根据公钥标识查询证书
+func (r *DoctorCertRepository) FindByKeyID(keyID string) (*model.DoctorCertificate, error) {
+	var cert model.DoctorCertificate
+	err := database.GetDB().Where("key_id = ?", keyID).Order("id DESC").First(&cert).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// RevokeByDoctorID 吊销医生所有有效证书
+func (r *DoctorCertRepository) RevokeByDoctorID(doctorID int64, reason string, revokedAt time.Time) (int64, error) {
+	result := database.GetDB().Model(&model.DoctorCertificate{}).
+		Where("doctor_id = ? AND status = ?", doctorID, "active").
+		Updates(map[string]interface{}{
+			"status":        "revoked",
+			"revoked_at":    revokedAt,
+			"revoke_reason": reason,
+		})
+	return result.RowsAffected, result.Error
+}
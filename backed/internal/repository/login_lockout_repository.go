@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+	"time"
+)
+
+type LoginLockoutRepository struct{}
+
+func NewLoginLockoutRepository() *LoginLockoutRepository {
+	return &LoginLockoutRepository{}
+}
+
+// Find 查询账号或IP的失败计数
+func (r *LoginLockoutRepository) Find(scope, subject string) (*model.LoginLockout, error) {
+	var lockout model.LoginLockout
+	err := database.GetDB().Where("scope = ? AND subject = ?", scope, subject).First(&lockout).Error
+	if err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+// Save 创建或更新失败计数
+func (r *LoginLockoutRepository) Save(lockout *model.LoginLockout) error {
+	return database.GetDB().Save(lockout).Error
+}
+
+// Delete 清除失败计数和锁定
+func (r *LoginLockoutRepository) Delete(scope, subject string) (int64, error) {
+	result := database.GetDB().Where("scope = ? AND subject = ?", scope, subject).Delete(&model.LoginLockout{})
+	return result.RowsAffected, result.Error
+}
+
+// FindLocked 查询锁定中的账号和IP
+func (r *LoginLockoutRepository) FindLocked() ([]model.LoginLockout, error) {
+	var list []model.LoginLockout
+	err := database.GetDB().
+		Where("locked_until > ?", time.Now()).
+		Order("locked_until DESC").
+		Find(&list).Error
+	return list, err
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"sm-medical/internal/model"
 	"sm-medical/pkg/database"
+	"time"
 )
 
 type LoginLogRepository struct{}
@@ -51,3 +52,36 @@ func (r *LoginLogRepository) FindAll(page, pageSize int, userID *int64, status *
 
 	return logs, total, err
 }
+
+// FindRecentSuccess 查询用户指定时间之后的成功登录（不含excludeID），按时间倒序
+func (r *LoginLogRepository) FindRecentSuccess(userID int64, since time.Time, excludeID int64, limit int) ([]model.LoginLog, error) {
+	var logs []model.LoginLog
+	err := database.DB.
+		Where("user_id = ? AND status = 1 AND login_time >= ? AND id <> ?", userID, since, excludeID).
+		Order("login_time DESC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
+
+// CountFailedUsernames 统计指定时间之后登录失败涉及的不同用户名数，ipBidx为空时统计全站
+func (r *LoginLogRepository) CountFailedUsernames(ipBidx string, since time.Time) (int64, error) {
+	var count int64
+	query := database.DB.Model(&model.LoginLog{}).Where("status = 0 AND login_time >= ?", since)
+	if ipBidx != "" {
+		query = query.Where("ip_bidx = ?", ipBidx)
+	}
+	err := query.Distinct("username").Count(&count).Error
+	return count, err
+}
+
+// FindFailedUserIDs 查询指定时间之后登录失败涉及的已存在账号，ipBidx为空时查询全站
+func (r *LoginLogRepository) FindFailedUserIDs(ipBidx string, since time.Time) ([]int64, error) {
+	var ids []int64
+	query := database.DB.Model(&model.LoginLog{}).Where("status = 0 AND login_time >= ? AND user_id IS NOT NULL", since)
+	if ipBidx != "" {
+		query = query.Where("ip_bidx = ?", ipBidx)
+	}
+	err := query.Distinct().Pluck("user_id", &ids).Error
+	return ids, err
+}
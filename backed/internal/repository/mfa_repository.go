@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type MFARepository struct{}
+
+func NewMFARepository() *MFARepository {
+	return &MFARepository{}
+}
+
+// FindByUserID 查询用户的两步验证设置
+func (r *MFARepository) FindByUserID(userID int64) (*model.UserMFA, error) {
+	var mfa model.UserMFA
+	err := database.GetDB().Where("user_id = ?", userID).First(&mfa).Error
+	if err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// Save 创建或更新两步验证设置
+func (r *MFARepository) Save(mfa *model.UserMFA) error {
+	return database.GetDB().Save(mfa).Error
+}
+
+// UpdateLastUsedStep 记录使用的口令时间步，只允许递增，返回false表示口令已被使用过
+func (r *MFARepository) UpdateLastUsedStep(userID, step int64) (bool, error) {
+	result := database.GetDB().Model(&model.UserMFA{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+// Delete 删除两步验证设置和恢复码
+func (r *MFARepository) Delete(userID int64) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.UserMFA{}).Error
+	})
+}
+
+// ReplaceRecoveryCodes 替换用户的全部恢复码
+func (r *MFARepository) ReplaceRecoveryCodes(userID int64, hashes []string) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]model.MFARecoveryCode, 0, len(hashes))
+		for _, h := range hashes {
+			codes = append(codes, model.MFARecoveryCode{UserID: userID, CodeHash: h})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode 使用恢复码，返回false表示恢复码不存在或已使用
+func (r *MFARepository) UseRecoveryCode(userID int64, hash string) (bool, error) {
+	result := database.GetDB().Model(&model.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// CountUnusedRecoveryCodes 统计剩余可用的恢复码
+func (r *MFARepository) CountUnusedRecoveryCodes(userID int64) (int64, error) {
+	var count int64
+	err := database.GetDB().Model(&model.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
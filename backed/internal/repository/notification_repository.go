@@ -51,3 +51,8 @@ func (r *NotificationRepository) MarkAsRead(userID int64, notificationIDs []int6
 			"read_at": readAt,
 		}).Error
 }
+
+// Create 创建通知
+func (r *NotificationRepository) Create(notification *model.Notification) error {
+	return database.GetDB().Create(notification).Error
+}
@@ -28,6 +28,13 @@ func (r *PrescriptionRepository) GetByID(id int64) (*model.Prescription, error)
 	return &prescription, err
 }
 
+// GetByPrescriptionNo 根据处方编号获取处方
+func (r *PrescriptionRepository) GetByPrescriptionNo(prescriptionNo string) (*model.Prescription, error) {
+	var prescription model.Prescription
+	err := database.DB.Where("prescription_no = ?", prescriptionNo).First(&prescription).Error
+	return &prescription, err
+}
+
 // GetByConsultationID 根据问诊ID获取处方
 func (r *PrescriptionRepository) GetByConsultationID(consultationID int64) (*model.Prescription, error) {
 	var prescription model.Prescription
@@ -38,7 +45,7 @@ func (r *PrescriptionRepository) GetByConsultationID(consultationID int64) (*mod
 // GetDetailsByPrescriptionID 获取处方明细
 func (r *PrescriptionRepository) GetDetailsByPrescriptionID(prescriptionID int64) ([]model.PrescriptionDetail, error) {
 	var details []model.PrescriptionDetail
-	err := database.DB.Where("prescription_id = ?", prescriptionID).Find(&details).Error
+	err := database.DB.Where("prescription_id = ?", prescriptionID).Order("id ASC").Find(&details).Error
 	return details, err
 }
 
@@ -69,3 +76,8 @@ func (r *PrescriptionRepository) GetByPatientID(patientID int64, page, pageSize
 func (r *PrescriptionRepository) Update(prescription *model.Prescription) error {
 	return database.DB.Save(prescription).Error
 }
+
+// UpdateStatus 更新处方状态
+func (r *PrescriptionRepository) UpdateStatus(id int64, status int) error {
+	return database.DB.Model(&model.Prescription{}).Where("id = ?", id).Update("status", status).Error
+}
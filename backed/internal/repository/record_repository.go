@@ -94,3 +94,28 @@ func (r *RecordRepository) FindByDoctorID(doctorID int64, page, pageSize int, st
 
 	return records, total, err
 }
+
+// FindForExport 按时间范围导出病历，patientID为0时导出全部患者
+func (r *RecordRepository) FindForExport(patientID int64, startDate, endDate string, page, pageSize int) ([]model.MedicalRecord, int64, error) {
+	var records []model.MedicalRecord
+	var total int64
+
+	query := database.GetDB().Model(&model.MedicalRecord{})
+	if patientID > 0 {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if startDate != "" {
+		query = query.Where("created_at >= ?", startDate)
+	}
+	if endDate != "" {
+		query = query.Where("created_at <= ?", endDate)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Offset(offset).Limit(pageSize).Order("id ASC").Find(&records).Error
+	return records, total, err
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+
+	"gorm.io/gorm/clause"
+)
+
+type ReencryptJobRepository struct{}
+
+func NewReencryptJobRepository() *ReencryptJobRepository {
+	return &ReencryptJobRepository{}
+}
+
+// Create 创建重加密任务
+func (r *ReencryptJobRepository) Create(job *model.CryptoReencryptJob) error {
+	return database.GetDB().Create(job).Error
+}
+
+// Update 更新重加密任务
+func (r *ReencryptJobRepository) Update(job *model.CryptoReencryptJob) error {
+	return database.GetDB().Save(job).Error
+}
+
+// FindLatest 查询最近一次重加密任务
+func (r *ReencryptJobRepository) FindLatest() (*model.CryptoReencryptJob, error) {
+	var job model.CryptoReencryptJob
+	err := database.GetDB().Order("id DESC").First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FindByStatus 查询指定状态的最近一次任务
+func (r *ReencryptJobRepository) FindByStatus(status string) (*model.CryptoReencryptJob, error) {
+	var job model.CryptoReencryptJob
+	err := database.GetDB().Where("status = ?", status).Order("id DESC").First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FindEncryptedRows 按ID顺序分批读取加密字段
+func (r *ReencryptJobRepository) FindEncryptedRows(table string, columns []string, lastID int64, limit int) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	err := database.GetDB().Table(table).
+		Select(append([]string{"id"}, columns...)).
+		Where("id > ?", lastID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&rows).Error
+	return rows, err
+}
+
+// FindEncryptedRow 读取单行的加密字段，行不存在时返回nil
+func (r *ReencryptJobRepository) FindEncryptedRow(table string, columns []string, id int64) (map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	err := database.GetDB().Table(table).
+		Select(append([]string{"id"}, columns...)).
+		Where("id = ?", id).
+		Limit(1).
+		Find(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0], nil
+}
+
+// UpdateEncryptedColumns 回写重加密后的字段（不修改updated_at）
+// 仅当字段仍为读取时的密文才更新，返回false表示该行已被并发修改或删除
+func (r *ReencryptJobRepository) UpdateEncryptedColumns(table string, id int64, values, previous map[string]interface{}) (bool, error) {
+	db := database.GetDB().Table(table).Where("id = ?", id)
+	for col, old := range previous {
+		db = db.Where(clause.Eq{Column: clause.Column{Name: col}, Value: old})
+	}
+	result := db.UpdateColumns(values)
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+
+	"gorm.io/gorm"
+)
+
+type RolePermissionRepository struct{}
+
+func NewRolePermissionRepository() *RolePermissionRepository {
+	return &RolePermissionRepository{}
+}
+
+// FindAll 查询全部角色权限分配
+func (r *RolePermissionRepository) FindAll() ([]model.RolePermission, error) {
+	var list []model.RolePermission
+	err := database.GetDB().Order("role ASC, permission ASC").Find(&list).Error
+	return list, err
+}
+
+// ReplaceRole 替换角色的全部权限
+func (r *RolePermissionRepository) ReplaceRole(role string, permissions []string, adminID int64) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", role).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		for _, p := range permissions {
+			if err := tx.Create(&model.RolePermission{Role: role, Permission: p, CreatedBy: adminID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CreateBatch 批量写入权限分配（初始化默认权限）
+func (r *RolePermissionRepository) CreateBatch(list []model.RolePermission) error {
+	return database.GetDB().Create(&list).Error
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+	"time"
+)
+
+type SecurityEventRepository struct{}
+
+func NewSecurityEventRepository() *SecurityEventRepository {
+	return &SecurityEventRepository{}
+}
+
+// Create 保存安全事件
+func (r *SecurityEventRepository) Create(event *model.SecurityEvent) error {
+	return database.GetDB().Create(event).Error
+}
+
+// FindByID 根据ID查询
+func (r *SecurityEventRepository) FindByID(id int64) (*model.SecurityEvent, error) {
+	var event model.SecurityEvent
+	if err := database.GetDB().First(&event, id).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// FindAll 分页查询安全事件
+func (r *SecurityEventRepository) FindAll(page, pageSize int, eventType string, status *int, userID *int64) ([]model.SecurityEvent, int64, error) {
+	var events []model.SecurityEvent
+	var total int64
+
+	query := database.GetDB().Model(&model.SecurityEvent{})
+	if eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	query.Count(&total)
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&events).Error
+	return events, total, err
+}
+
+// ExistsSince 指定时间之后是否已有同类型同标识的事件，用于去重
+func (r *SecurityEventRepository) ExistsSince(eventType, subject string, since time.Time) (bool, error) {
+	var count int64
+	err := database.GetDB().Model(&model.SecurityEvent{}).
+		Where("event_type = ? AND subject = ? AND created_at >= ?", eventType, subject, since).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Handle 处理事件
+func (r *SecurityEventRepository) Handle(id int64, status int, adminID int64, note string) error {
+	now := time.Now()
+	return database.GetDB().Model(&model.SecurityEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"handled_by":  adminID,
+			"handled_at":  &now,
+			"handle_note": note,
+		}).Error
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+type SessionRepository struct{}
+
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{}
+}
+
+// Create 创建登录会话
+func (r *SessionRepository) Create(session *model.UserSession) error {
+	return database.GetDB().Create(session).Error
+}
+
+// Update 更新登录会话
+func (r *SessionRepository) Update(session *model.UserSession) error {
+	return database.GetDB().Save(session).Error
+}
+
+// Rotate 轮换刷新令牌，仅当会话未吊销且当前刷新令牌哈希仍为expectedHash时更新
+// 返回false表示同一刷新令牌已被并发请求轮换，或会话已被吊销
+func (r *SessionRepository) Rotate(session *model.UserSession, expectedHash string) (bool, error) {
+	result := database.GetDB().Model(session).
+		Select("refresh_token_hash", "prev_token_hash", "client_ip", "user_agent", "device", "browser", "os", "last_refresh_at").
+		Where("refresh_token_hash = ? AND revoked_at IS NULL", expectedHash).
+		Updates(session)
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindBySessionID 根据会话标识查询
+func (r *SessionRepository) FindBySessionID(sessionID string) (*model.UserSession, error) {
+	var session model.UserSession
+	err := database.GetDB().Where("session_id = ?", sessionID).First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// FindActiveByUserID 查询用户未吊销且未过期的会话
+func (r *SessionRepository) FindActiveByUserID(userID int64) ([]model.UserSession, error) {
+	var sessions []model.UserSession
+	err := database.GetDB().
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("id DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke 吊销会话，已吊销的会话不重复更新
+func (r *SessionRepository) Revoke(sessionID, reason string) (bool, error) {
+	result := database.GetDB().Model(&model.UserSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{
+			"revoked_at":    time.Now(),
+			"revoke_reason": reason,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateRevocation 记录吊销的会话，重复记录时忽略
+func (r *SessionRepository) CreateRevocation(revocation *model.TokenRevocation) error {
+	return database.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(revocation).Error
+}
+
+// FindRevocationsAfter 查询ID大于lastID且未过期的吊销记录
+func (r *SessionRepository) FindRevocationsAfter(lastID int64) ([]model.TokenRevocation, error) {
+	var list []model.TokenRevocation
+	err := database.GetDB().
+		Where("id > ? AND expires_at > ?", lastID, time.Now()).
+		Order("id ASC").
+		Find(&list).Error
+	return list, err
+}
+
+// DeleteExpiredRevocations 删除已过期的吊销记录
+func (r *SessionRepository) DeleteExpiredRevocations() (int64, error) {
+	result := database.GetDB().Where("expires_at <= ?", time.Now()).Delete(&model.TokenRevocation{})
+	return result.RowsAffected, result.Error
+}
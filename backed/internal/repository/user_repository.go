@@ -3,6 +3,8 @@ package repository
 import (
 	"sm-medical/internal/model"
 	"sm-medical/pkg/database"
+
+	"gorm.io/gorm"
 )
 
 type UserRepository struct{}
@@ -17,8 +19,15 @@ func (r *UserRepository) Create(user *model.User) error {
 }
 
 // Update 更新用户
+// 当前问诊数只通过AdjustConsultationCount原子增减，整行保存时不回写，避免覆盖并发接诊的计数
 func (r *UserRepository) Update(user *model.User) error {
-	return database.GetDB().Save(user).Error
+	return database.GetDB().Omit("current_consultation_count").Save(user).Error
+}
+
+// AdjustConsultationCount 原子增减医生当前问诊数，不会小于0
+func (r *UserRepository) AdjustConsultationCount(id int64, delta int) error {
+	return database.GetDB().Model(&model.User{}).Where("id = ?", id).
+		Update("current_consultation_count", gorm.Expr("GREATEST(current_consultation_count + ?, 0)", delta)).Error
 }
 
 // FindByID 根据ID查找用户
@@ -49,15 +58,44 @@ func (r *UserRepository) ExistsByUsername(username string) (bool, error) {
 	return count > 0, err
 }
 
-// ExistsByEmail 检查邮箱是否存在
-func (r *UserRepository) ExistsByEmail(email string) (bool, error) {
+// ExistsByEmailBidx 根据邮箱盲索引检查邮箱是否存在
+func (r *UserRepository) ExistsByEmailBidx(emailBidx string) (bool, error) {
+	var count int64
+	err := database.GetDB().Model(&model.User{}).Where("email_bidx = ?", emailBidx).Count(&count).Error
+	return count > 0, err
+}
+
+// ExistsByPhoneBidx 根据手机号盲索引检查手机号是否存在，excludeUserID用于修改资料时排除本人
+func (r *UserRepository) ExistsByPhoneBidx(phoneBidx string, excludeUserID int64) (bool, error) {
 	var count int64
-	err := database.GetDB().Model(&model.User{}).Where("email = ?", email).Count(&count).Error
+	err := database.GetDB().Model(&model.User{}).Where("phone_bidx = ? AND id <> ?", phoneBidx, excludeUserID).Count(&count).Error
 	return count > 0, err
 }
 
-// FindDoctors 查询医生列表
-func (r *UserRepository) FindDoctors(page, pageSize int, dept, keyword string) ([]model.User, int64, error) {
+// FindByEmailBidx 根据邮箱盲索引查找用户
+func (r *UserRepository) FindByEmailBidx(emailBidx string) (*model.User, error) {
+	var user model.User
+	err := database.GetDB().Where("email_bidx = ?", emailBidx).First(&user).Error
+	return &user, err
+}
+
+// FindByPhoneBidx 根据手机号盲索引查找用户（历史数据中手机号可能重复）
+func (r *UserRepository) FindByPhoneBidx(phoneBidx string) ([]model.User, error) {
+	var users []model.User
+	err := database.GetDB().Where("phone_bidx = ?", phoneBidx).Limit(2).Find(&users).Error
+	return users, err
+}
+
+// FindMissingBlindIndex 分批查询尚未计算盲索引的用户
+func (r *UserRepository) FindMissingBlindIndex(lastID int64, limit int) ([]model.User, error) {
+	var users []model.User
+	err := database.GetDB().Where("id > ? AND (email_bidx IS NULL OR email_bidx = '')", lastID).
+		Order("id ASC").Limit(limit).Find(&users).Error
+	return users, err
+}
+
+// FindDoctors 查询医生列表，realNameBidx为关键词按真实姓名计算的盲索引
+func (r *UserRepository) FindDoctors(page, pageSize int, dept, keyword, realNameBidx string) ([]model.User, int64, error) {
 	var users []model.User
 	var total int64
 
@@ -68,7 +106,7 @@ func (r *UserRepository) FindDoctors(page, pageSize int, dept, keyword string) (
 	}
 
 	if keyword != "" {
-		query = query.Where("real_name LIKE ? OR doctor_title LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+		query = query.Where("real_name_bidx = ? OR doctor_title LIKE ?", realNameBidx, "%"+keyword+"%")
 	}
 
 	query.Count(&total)
@@ -95,7 +133,8 @@ func (r *UserRepository) FindDoctorApplication(userID int64) (*model.DoctorAppli
 }
 
 // FindAll 查询所有用户（分页，管理员用）
-func (r *UserRepository) FindAll(page, pageSize int, identify string, status *int, keyword string) ([]*model.User, int64, error) {
+// 用户名模糊匹配，邮箱/手机号/真实姓名/身份证号通过盲索引精确匹配
+func (r *UserRepository) FindAll(page, pageSize int, identify string, status *int, keyword string, keywordBidx map[string]string) ([]*model.User, int64, error) {
 	var users []*model.User
 	var total int64
 
@@ -110,7 +149,15 @@ func (r *UserRepository) FindAll(page, pageSize int, identify string, status *in
 	}
 
 	if keyword != "" {
-		query = query.Where("username LIKE ? OR email LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+		conditions := "username LIKE ?"
+		args := []interface{}{"%" + keyword + "%"}
+		for _, column := range []string{"email", "phone", "real_name", "id_card"} {
+			if bidx := keywordBidx[column]; bidx != "" {
+				conditions += " OR " + column + "_bidx = ?"
+				args = append(args, bidx)
+			}
+		}
+		query = query.Where(conditions, args...)
 	}
 
 	// 获取总数
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"sm-medical/internal/model"
+	"sm-medical/pkg/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type VerificationRepository struct{}
+
+func NewVerificationRepository() *VerificationRepository {
+	return &VerificationRepository{}
+}
+
+// Create 保存验证码
+func (r *VerificationRepository) Create(code *model.VerificationCode) error {
+	return database.GetDB().Create(code).Error
+}
+
+// FindLatestActive 查询用户某用途最近一条未使用且未过期的验证码
+func (r *VerificationRepository) FindLatestActive(userID int64, purpose string) (*model.VerificationCode, error) {
+	var code model.VerificationCode
+	err := database.GetDB().
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", userID, purpose, time.Now()).
+		Order("id DESC").
+		First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// FindActiveByHash 按哈希查询未使用且未过期的令牌
+func (r *VerificationRepository) FindActiveByHash(purpose, hash string) (*model.VerificationCode, error) {
+	var code model.VerificationCode
+	err := database.GetDB().
+		Where("purpose = ? AND code_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, hash, time.Now()).
+		First(&code).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// IncrementAttempts 错误次数加一
+func (r *VerificationRepository) IncrementAttempts(id int64) error {
+	return database.GetDB().Model(&model.VerificationCode{}).
+		Where("id = ?", id).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+// MarkUsed 标记已使用，条件更新保证并发时只有一个请求成功
+func (r *VerificationRepository) MarkUsed(id int64) (bool, error) {
+	result := database.GetDB().Model(&model.VerificationCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// InvalidateActive 作废用户某用途全部未使用的验证码（重新发送或流程完成时）
+func (r *VerificationRepository) InvalidateActive(userID int64, purpose string) error {
+	return database.GetDB().Model(&model.VerificationCode{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
+
+// CountByTargetSince 统计收件人在指定时间之后的发送次数
+func (r *VerificationRepository) CountByTargetSince(targetBidx string, since time.Time) (int64, error) {
+	var count int64
+	err := database.GetDB().Model(&model.VerificationCode{}).
+		Where("target_bidx = ? AND created_at > ?", targetBidx, since).
+		Count(&count).Error
+	return count, err
+}
+
+// CountByIPSince 统计IP在指定时间之后的发送次数
+func (r *VerificationRepository) CountByIPSince(ipBidx string, since time.Time) (int64, error) {
+	var count int64
+	err := database.GetDB().Model(&model.VerificationCode{}).
+		Where("ip_bidx = ? AND created_at > ?", ipBidx, since).
+		Count(&count).Error
+	return count, err
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"log"
 	"sm-medical/internal/crypto"
 	"sm-medical/internal/repository"
 	"time"
@@ -11,6 +12,9 @@ type AdminService struct {
 	userRepo        *repository.UserRepository
 	applicationRepo *repository.DoctorApplicationRepository
 	loginLogRepo    *repository.LoginLogRepository
+	certService     *DoctorCertService
+	sessionService  *SessionService
+	loginGuard      *LoginGuard
 }
 
 func NewAdminService() *AdminService {
@@ -18,6 +22,9 @@ func NewAdminService() *AdminService {
 		userRepo:        repository.NewUserRepository(),
 		applicationRepo: repository.NewDoctorApplicationRepository(),
 		loginLogRepo:    repository.NewLoginLogRepository(),
+		certService:     NewDoctorCertService(),
+		sessionService:  NewSessionService(),
+		loginGuard:      NewLoginGuard(),
 	}
 }
 
@@ -67,6 +74,7 @@ func (s *AdminService) ReviewDoctorApplication(adminID, applicationID int64, sta
 		if err := s.userRepo.Update(user); err != nil {
 			return err
 		}
+		// 审核时无法获得医生口令，签名证书在医生下次登录时签发
 	}
 
 	return nil
@@ -81,12 +89,6 @@ func (s *AdminService) GetDoctorApplications(page, pageSize int, status *int) ([
 
 	var result []map[string]interface{}
 	for _, app := range applications {
-		// 解密敏感信息
-		realName, _ := crypto.SM4Decrypt(app.RealName)
-		idCard, _ := crypto.SM4Decrypt(app.IDCard)
-		phone, _ := crypto.SM4Decrypt(app.Phone)
-		email, _ := crypto.SM4Decrypt(app.Email)
-
 		// 获取用户信息
 		user, _ := s.userRepo.FindByID(app.UserID)
 		username := ""
@@ -106,10 +108,10 @@ func (s *AdminService) GetDoctorApplications(page, pageSize int, status *int) ([
 			"applicationNo":  app.ApplicationNo,
 			"userId":         app.UserID,
 			"username":       username,
-			"realName":       realName,
-			"idCard":         idCard,
-			"phone":          phone,
-			"email":          email,
+			"realName":       app.RealName,
+			"idCard":         app.IDCard,
+			"phone":          app.Phone,
+			"email":          app.Email,
 			"doctorCert":     app.DoctorCert,
 			"doctorTitle":    app.DoctorTitle,
 			"doctorDept":     app.DoctorDept,
@@ -138,22 +140,29 @@ func (s *AdminService) GetDoctorApplications(page, pageSize int, status *int) ([
 
 // GetUsers 获取用户列表
 func (s *AdminService) GetUsers(page, pageSize int, identify string, status *int, keyword string) ([]map[string]interface{}, int64, error) {
-	users, total, err := s.userRepo.FindAll(page, pageSize, identify, status, keyword)
+	// 加密字段无法模糊查询，按盲索引精确匹配
+	var keywordBidx map[string]string
+	if keyword != "" {
+		keywordBidx = map[string]string{
+			"email":     crypto.BlindIndex(crypto.BlindIndexEmail, keyword),
+			"phone":     crypto.BlindIndex(crypto.BlindIndexPhone, keyword),
+			"real_name": crypto.BlindIndex(crypto.BlindIndexRealName, keyword),
+			"id_card":   crypto.BlindIndex(crypto.BlindIndexIDCard, keyword),
+		}
+	}
+	users, total, err := s.userRepo.FindAll(page, pageSize, identify, status, keyword, keywordBidx)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	var result []map[string]interface{}
 	for _, user := range users {
-		// 解密敏感信息
-		email, _ := crypto.SM4Decrypt(user.Email)
-		phone, _ := crypto.SM4Decrypt(user.Phone)
-
 		item := map[string]interface{}{
 			"userId":    user.ID,
 			"username":  user.Username,
-			"email":     email,
-			"phone":     phone,
+			"realName":  user.RealName,
+			"email":     user.Email,
+			"phone":     user.Phone,
 			"role":      user.Role,
 			"status":    user.Status,
 			"createdAt": user.CreatedAt.Format("2006-01-02 15:04:05"),
@@ -177,7 +186,59 @@ func (s *AdminService) UpdateUserStatus(userID int64, status int) error {
 	}
 
 	user.Status = status
-	return s.userRepo.Update(user)
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	if status != 1 {
+		return nil
+	}
+
+	// 禁用账号时立即退出全部会话
+	if err := s.sessionService.RevokeAllSessions(user.ID, "账号被管理员禁用"); err != nil {
+		log.Printf("[管理员] 吊销会话失败 - 用户ID: %d, 错误: %v", user.ID, err)
+	}
+
+	// 禁用医生账号时吊销其签名证书
+	if user.Role == "doctor" {
+		return s.certService.RevokeCertificates(user.ID, "账号被管理员禁用")
+	}
+	return nil
+}
+
+// UpdateUserRole 分配用户角色，医生角色需通过医生注册获得，不能在此分配或撤销
+func (s *AdminService) UpdateUserRole(adminID, userID int64, role string) error {
+	if role != "patient" && role != "pharmacist" && role != "admin" {
+		return errors.New("只能分配患者、药师或管理员角色")
+	}
+	if adminID == userID {
+		return errors.New("不能修改自己的角色")
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+	if user.Role == "doctor" {
+		return errors.New("医生账号的角色不能修改")
+	}
+	if user.Role == role {
+		return nil
+	}
+
+	oldRole := user.Role
+	user.Role = role
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// 访问令牌中携带角色，变更后需重新登录
+	if err := s.sessionService.RevokeAllSessions(user.ID, "角色变更"); err != nil {
+		log.Printf("[管理员] 吊销会话失败 - 用户ID: %d, 错误: %v", user.ID, err)
+	}
+
+	log.Printf("[管理员] 修改用户角色 - 管理员ID: %d, 用户ID: %d, %s -> %s", adminID, userID, oldRole, role)
+	return nil
 }
 
 // GetLoginLogs 获取登录日志
@@ -187,21 +248,46 @@ func (s *AdminService) GetLoginLogs(page, pageSize int, userID *int64, status *i
 		return nil, 0, err
 	}
 
+	// 当前锁定中的账号和IP，标记在日志上便于管理员解锁
+	lockedAccounts, lockedIPs, err := s.loginGuard.LockedSubjects()
+	if err != nil {
+		return nil, 0, err
+	}
+
 	var result []map[string]interface{}
 	for _, log := range logs {
-		// 解密IP
-		loginIP, _ := crypto.SM4Decrypt(log.LoginIP)
-
 		statusText := "失败"
 		if log.Status == 1 {
 			statusText = "成功"
 		}
 
+		var lockedUntil *time.Time
+		accountLocked, ipLocked := false, false
+		if log.UserID != nil {
+			if until, ok := lockedAccounts[*log.UserID]; ok {
+				accountLocked, lockedUntil = true, &until
+			}
+		}
+		ipBidx := log.IPBidx
+		if ipBidx == "" {
+			ipBidx = ipSubject(log.LoginIP)
+		}
+		if until, ok := lockedIPs[ipBidx]; ok {
+			ipLocked = true
+			if lockedUntil == nil || until.After(*lockedUntil) {
+				lockedUntil = &until
+			}
+		}
+		lockedUntilText := ""
+		if lockedUntil != nil {
+			lockedUntilText = lockedUntil.Format("2006-01-02 15:04:05")
+		}
+
 		result = append(result, map[string]interface{}{
 			"logId":         log.ID,
 			"userId":        log.UserID,
 			"username":      log.Username,
-			"loginIp":       loginIP,
+			"loginIp":       log.LoginIP,
 			"loginLocation": log.LoginLocation,
 			"browser":       log.Browser,
 			"os":            log.OS,
@@ -209,8 +295,30 @@ func (s *AdminService) GetLoginLogs(page, pageSize int, userID *int64, status *i
 			"statusText":    statusText,
 			"msg":           log.Msg,
 			"loginTime":     log.LoginTime.Format("2006-01-02 15:04:05"),
+			"accountLocked": accountLocked,
+			"ipLocked":      ipLocked,
+			"lockedUntil":   lockedUntilText,
 		})
 	}
 
 	return result, total, nil
 }
+
+// UnlockLogin 解除账号或IP的登录锁定
+func (s *AdminService) UnlockLogin(adminID, userID int64, ip string) error {
+	if userID == 0 && ip == "" {
+		return errors.New("请指定要解锁的用户或IP")
+	}
+	if userID > 0 {
+		if _, err := s.userRepo.FindByID(userID); err != nil {
+			return errors.New("用户不存在")
+		}
+	}
+
+	n, err := s.loginGuard.Unlock(userID, ip)
+	if err != nil {
+		return err
+	}
+	log.Printf("[管理员] 解除登录锁定 - 管理员ID: %d, 用户ID: %d, IP: %s, 清除记录: %d", adminID, userID, ip, n)
+	return nil
+}
@@ -0,0 +1,446 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sm-medical/pkg/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// API密钥格式: smk_<16位16进制>.<base64url随机串>，点号前为密钥前缀（可公开，用于查找），数据库只保存完整密钥的SM3哈希
+
+// API密钥授权范围
+const (
+	ScopeRecordExport     = "record:export"     // 导出病历
+	ScopePrescriptionRead = "prescription:read" // 按处方编号查询处方
+)
+
+// APIScopeCatalog 全部授权范围及说明
+var APIScopeCatalog = map[string]string{
+	ScopeRecordExport:     "导出病历",
+	ScopePrescriptionRead: "查询处方",
+}
+
+// apiKeyPrefix 密钥前缀，便于在日志和代码仓库中识别泄露的密钥
+const apiKeyPrefix = "smk_"
+
+// apiKeyTouchInterval 最近使用时间的更新间隔，避免每次请求都写库
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrAPIKeyInvalid          = errors.New("API密钥无效")
+	ErrAPIKeyExpired          = errors.New("API密钥已过期")
+	ErrAPIKeyRevoked          = errors.New("API密钥已吊销")
+	ErrServiceAccountDisabled = errors.New("服务账号已禁用")
+)
+
+// APIPrincipal 通过API密钥认证的调用方
+type APIPrincipal struct {
+	Key       *model.APIKey
+	Account   *model.ServiceAccount
+	PublicKey *sm2.PublicKey // 为nil时不要求请求签名
+}
+
+// HasScope 是否拥有授权范围
+func (p *APIPrincipal) HasScope(scope string) bool {
+	for _, s := range splitScopes(p.Key.Scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyService 服务账号和API密钥管理、认证、限流和调用审计
+type APIKeyService struct {
+	repo *repository.APIKeyRepository
+}
+
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{
+		repo: repository.NewAPIKeyRepository(),
+	}
+}
+
+// CreateServiceAccount 创建服务账号
+func (s *APIKeyService) CreateServiceAccount(adminID int64, name, description string) (map[string]interface{}, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 50 {
+		return nil, errors.New("服务账号名称不能为空且不超过50个字符")
+	}
+	if exists, err := s.repo.ExistsServiceAccountName(name); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, errors.New("服务账号名称已存在")
+	}
+
+	account := &model.ServiceAccount{
+		Name:        name,
+		Description: truncate(description, 255),
+		CreatedBy:   adminID,
+	}
+	if err := s.repo.CreateServiceAccount(account); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[服务账号] 创建 - 管理员ID: %d, 服务账号: %s(%d)", adminID, account.Name, account.ID)
+	return serviceAccountInfo(account), nil
+}
+
+// ListServiceAccounts 服务账号列表
+func (s *APIKeyService) ListServiceAccounts() ([]map[string]interface{}, error) {
+	accounts, err := s.repo.FindServiceAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(accounts))
+	for i := range accounts {
+		result = append(result, serviceAccountInfo(&accounts[i]))
+	}
+	return result, nil
+}
+
+// UpdateServiceAccountStatus 启用(0)或禁用(1)服务账号，禁用后其全部密钥立即失效
+func (s *APIKeyService) UpdateServiceAccountStatus(adminID, serviceAccountID int64, status int) error {
+	if status != 0 && status != 1 {
+		return errors.New("状态值无效")
+	}
+	if _, err := s.repo.FindServiceAccount(serviceAccountID); err != nil {
+		return errors.New("服务账号不存在")
+	}
+	if err := s.repo.UpdateServiceAccountStatus(serviceAccountID, status); err != nil {
+		return err
+	}
+
+	log.Printf("[服务账号] 状态变更 - 管理员ID: %d, 服务账号ID: %d, 状态: %d", adminID, serviceAccountID, status)
+	return nil
+}
+
+// CreateKey 为服务账号创建API密钥，完整密钥只在本次返回
+// sm2PublicKey 不为空时调用方必须使用对应私钥对请求签名
+func (s *APIKeyService) CreateKey(adminID, serviceAccountID int64, name string, scopes []string, rateLimit, expiresInDays int, sm2PublicKey string) (map[string]interface{}, error) {
+	account, err := s.repo.FindServiceAccount(serviceAccountID)
+	if err != nil {
+		return nil, errors.New("服务账号不存在")
+	}
+	if account.Status != 0 {
+		return nil, ErrServiceAccountDisabled
+	}
+
+	scopes, err = normalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := integrationConfig()
+	if rateLimit <= 0 {
+		rateLimit = cfg.DefaultRateLimit
+	}
+	if expiresInDays <= 0 || expiresInDays > cfg.MaxKeyDays {
+		expiresInDays = cfg.MaxKeyDays
+	}
+
+	publicKeyHex := ""
+	if strings.TrimSpace(sm2PublicKey) != "" {
+		pub, err := crypto.ParseSM2PublicKey(sm2PublicKey)
+		if err != nil {
+			return nil, errors.New("SM2公钥格式错误")
+		}
+		publicKeyHex = crypto.EncodeSM2PublicKeyHex(pub)
+	}
+
+	keyID, err := randomToken(8, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	keyID = apiKeyPrefix + keyID
+	secret, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	rawKey := keyID + "." + secret
+
+	expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+	key := &model.APIKey{
+		KeyID:            keyID,
+		ServiceAccountID: account.ID,
+		Name:             truncate(name, 50),
+		SecretHash:       crypto.SM3Hash(rawKey),
+		Scopes:           strings.Join(scopes, ","),
+		SM2PublicKey:     publicKeyHex,
+		RateLimit:        rateLimit,
+		ExpiresAt:        &expiresAt,
+		CreatedBy:        adminID,
+	}
+	if err := s.repo.CreateKey(key); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[服务账号] 创建API密钥 - 管理员ID: %d, 服务账号: %s, 密钥: %s, 范围: %s", adminID, account.Name, keyID, key.Scopes)
+	result := apiKeyInfo(key)
+	result["apiKey"] = rawKey
+	return result, nil
+}
+
+// ListKeys 查询服务账号的API密钥（不含密钥本身），serviceAccountID为0时查询全部
+func (s *APIKeyService) ListKeys(serviceAccountID int64) ([]map[string]interface{}, error) {
+	keys, err := s.repo.FindKeysByServiceAccount(serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(keys))
+	for i := range keys {
+		result = append(result, apiKeyInfo(&keys[i]))
+	}
+	return result, nil
+}
+
+// RevokeKey 吊销API密钥
+func (s *APIKeyService) RevokeKey(adminID int64, keyID string) error {
+	n, err := s.repo.RevokeKey(keyID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("密钥不存在或已吊销")
+	}
+
+	log.Printf("[服务账号] 吊销API密钥 - 管理员ID: %d, 密钥: %s", adminID, keyID)
+	return nil
+}
+
+// Authenticate 校验API密钥，返回调用方；错误时key可能非nil（密钥存在但已失效），用于审计
+func (s *APIKeyService) Authenticate(rawKey string) (*APIPrincipal, *model.APIKey, error) {
+	keyID, _, found := strings.Cut(rawKey, ".")
+	if !found || !strings.HasPrefix(keyID, apiKeyPrefix) {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+
+	key, err := s.repo.FindKeyByKeyID(keyID)
+	if err != nil {
+		return nil, nil, ErrAPIKeyInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(crypto.SM3Hash(rawKey)), []byte(key.SecretHash)) != 1 {
+		return nil, key, ErrAPIKeyInvalid
+	}
+	if key.RevokedAt != nil {
+		return nil, key, ErrAPIKeyRevoked
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, key, ErrAPIKeyExpired
+	}
+
+	account, err := s.repo.FindServiceAccount(key.ServiceAccountID)
+	if err != nil || account.Status != 0 {
+		return nil, key, ErrServiceAccountDisabled
+	}
+
+	principal := &APIPrincipal{Key: key, Account: account}
+	if key.SM2PublicKey != "" {
+		pub, err := crypto.ParseSM2PublicKey(key.SM2PublicKey)
+		if err != nil {
+			log.Printf("[服务账号] 密钥的SM2公钥无法解析 - 密钥: %s, 错误: %v", keyID, err)
+			return nil, key, ErrAPIKeyInvalid
+		}
+		principal.PublicKey = pub
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.repo.TouchKey(key.ID, now); err != nil {
+			log.Printf("[服务账号] 更新密钥使用时间失败 - 密钥: %s, 错误: %v", keyID, err)
+		}
+	}
+	return principal, key, nil
+}
+
+// Allow 按密钥限流（每分钟固定窗口），超出时返回需要等待的时间
+// 计数保存在本实例内存中，多实例部署时每个实例单独计数
+func (s *APIKeyService) Allow(key *model.APIKey) (bool, time.Duration) {
+	limit := key.RateLimit
+	if limit <= 0 {
+		limit = integrationConfig().DefaultRateLimit
+	}
+	return apiRateLimiter.allow(key.ID, limit, time.Now())
+}
+
+// Audit 记录一次API调用
+func (s *APIKeyService) Audit(audit *model.APIKeyAudit) {
+	audit.Path = truncate(audit.Path, 255)
+	audit.Msg = truncate(audit.Msg, 255)
+	if err := s.repo.CreateAudit(audit); err != nil {
+		log.Printf("[服务账号] 记录调用审计失败 - 密钥: %s, 路径: %s, 错误: %v", audit.KeyID, audit.Path, err)
+	}
+}
+
+// GetAudits 分页查询调用审计
+func (s *APIKeyService) GetAudits(page, pageSize int, serviceAccountID int64, keyID string) ([]map[string]interface{}, int64, error) {
+	audits, total, err := s.repo.FindAudits(page, pageSize, serviceAccountID, keyID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(audits))
+	for _, a := range audits {
+		result = append(result, map[string]interface{}{
+			"auditId":          a.ID,
+			"keyId":            a.KeyID,
+			"serviceAccountId": a.ServiceAccountID,
+			"method":           a.Method,
+			"path":             a.Path,
+			"scope":            a.Scope,
+			"statusCode":       a.StatusCode,
+			"signed":           a.Signed,
+			"clientIp":         a.ClientIP,
+			"msg":              a.Msg,
+			"durationMs":       a.DurationMs,
+			"createdAt":        a.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return result, total, nil
+}
+
+// rateWindow 固定窗口计数
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter 按密钥的每分钟固定窗口限流
+type rateLimiter struct {
+	mu        sync.Mutex
+	windows   map[int64]*rateWindow
+	lastPurge time.Time
+}
+
+var apiRateLimiter = &rateLimiter{windows: make(map[int64]*rateWindow)}
+
+func (l *rateLimiter) allow(id int64, limit int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPurge) > 10*time.Minute {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= time.Minute {
+				delete(l.windows, k)
+			}
+		}
+		l.lastPurge = now
+	}
+
+	w, ok := l.windows[id]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		w = &rateWindow{start: now.Truncate(time.Minute)}
+		l.windows[id] = w
+	}
+	if w.count >= limit {
+		return false, w.start.Add(time.Minute).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// integrationConfig 院内系统集成配置，未配置的项使用默认值
+func integrationConfig() config.IntegrationConfig {
+	var cfg config.IntegrationConfig
+	if config.AppConfig != nil {
+		cfg = config.AppConfig.Integration
+	}
+	if cfg.DefaultRateLimit <= 0 {
+		cfg.DefaultRateLimit = 60
+	}
+	if cfg.MaxKeyDays <= 0 {
+		cfg.MaxKeyDays = 365
+	}
+	if cfg.SignatureWindow <= 0 {
+		cfg.SignatureWindow = 300
+	}
+	return cfg
+}
+
+// APISignatureWindow SM2签名请求时间戳允许的偏差
+func APISignatureWindow() time.Duration {
+	return time.Duration(integrationConfig().SignatureWindow) * time.Second
+}
+
+// normalizeScopes 去重、排序并校验授权范围
+func normalizeScopes(scopes []string) ([]string, error) {
+	set := make(map[string]bool)
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if _, ok := APIScopeCatalog[scope]; !ok {
+			return nil, errors.New("未知的授权范围: " + scope)
+		}
+		set[scope] = true
+	}
+	if len(set) == 0 {
+		return nil, errors.New("请至少指定一个授权范围")
+	}
+
+	result := make([]string, 0, len(set))
+	for scope := range set {
+		result = append(result, scope)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// splitScopes 解析逗号分隔的授权范围
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return nil
+	}
+	return strings.Split(scopes, ",")
+}
+
+func serviceAccountInfo(account *model.ServiceAccount) map[string]interface{} {
+	return map[string]interface{}{
+		"serviceAccountId": account.ID,
+		"name":             account.Name,
+		"description":      account.Description,
+		"status":           account.Status,
+		"createdBy":        account.CreatedBy,
+		"createdAt":        account.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func apiKeyInfo(key *model.APIKey) map[string]interface{} {
+	status := "active"
+	switch {
+	case key.RevokedAt != nil:
+		status = "revoked"
+	case key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt):
+		status = "expired"
+	}
+
+	info := map[string]interface{}{
+		"keyId":             key.KeyID,
+		"serviceAccountId":  key.ServiceAccountID,
+		"name":              key.Name,
+		"scopes":            splitScopes(key.Scopes),
+		"rateLimit":         key.RateLimit,
+		"signatureRequired": key.SM2PublicKey != "",
+		"status":            status,
+		"createdAt":         key.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+	if key.ExpiresAt != nil {
+		info["expiresAt"] = key.ExpiresAt.Format("2006-01-02 15:04:05")
+	}
+	if key.LastUsedAt != nil {
+		info["lastUsedAt"] = key.LastUsedAt.Format("2006-01-02 15:04:05")
+	}
+	return info
+}
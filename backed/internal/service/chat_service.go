@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"sm-medical/internal/crypto"
 	"sm-medical/internal/model"
 	"sm-medical/internal/repository"
 	"time"
@@ -15,6 +14,7 @@ type ChatService struct {
 	chatRepo         *repository.ChatRepository
 	consultationRepo *repository.ConsultationRepository
 	userRepo         *repository.UserRepository
+	participantRepo  *repository.ConsultationParticipantRepository
 }
 
 // NewChatService 创建聊天服务实例
@@ -23,13 +23,17 @@ func NewChatService() *ChatService {
 		chatRepo:         repository.NewChatRepository(),
 		consultationRepo: repository.NewConsultationRepository(),
 		userRepo:         repository.NewUserRepository(),
+		participantRepo:  repository.NewConsultationParticipantRepository(),
 	}
 }
 
+// ErrNotMessageReceiver 只有消息接收者才能标记已读
+var ErrNotMessageReceiver = errors.New("无权限标记该消息")
+
 // SendMessageRequest 发送消息请求
 type SendMessageRequest struct {
 	ConsultationID int64  `json:"consultationId" binding:"required"`
-	SenderID       int64  `json:"senderId" binding:"required"`
+	SenderID       int64  `json:"senderId"` // 由认证信息填充，客户端传入时必须与当前用户一致
 	MessageType    int    `json:"messageType" binding:"required"` // 1:文本 2:图片 3:语音 4:处方 5:系统
 	Content        string `json:"content"`
 	FileURL        string `json:"fileUrl"`
@@ -38,6 +42,19 @@ type SendMessageRequest struct {
 	ExtraData      string `json:"extraData"`
 }
 
+// CheckMembership 校验用户是否为问诊的患者、主诊医生或会诊医生
+func (s *ChatService) CheckMembership(userID, consultationID int64) (*model.Consultation, error) {
+	consultation, err := s.consultationRepo.FindByID(consultationID)
+	if err != nil {
+		return nil, errors.New("问诊不存在")
+	}
+
+	if consultationMemberRole(s.participantRepo, consultation, userID) == "" {
+		return nil, errors.New("无权限进入该问诊")
+	}
+	return consultation, nil
+}
+
 // SendMessage 发送消息
 func (s *ChatService) SendMessage(req *SendMessageRequest) (*model.ChatMessage, error) {
 	// 1. 验证问诊存在性
@@ -46,42 +63,32 @@ func (s *ChatService) SendMessage(req *SendMessageRequest) (*model.ChatMessage,
 		return nil, errors.New("问诊不存在")
 	}
 
-	// 2. 确定接收者
+	// 2. 确定接收者：医生（含会诊医生）发给患者，患者发给主诊医生
 	var receiverID int64
-	if consultation.DoctorID != nil && req.SenderID == *consultation.DoctorID {
+	switch consultationMemberRole(s.participantRepo, consultation, req.SenderID) {
+	case ParticipantRoleLead, ParticipantRoleConsultant:
 		receiverID = consultation.PatientID
-	} else if req.SenderID == consultation.PatientID {
+	case MemberRolePatient:
 		if consultation.DoctorID != nil {
 			receiverID = *consultation.DoctorID
 		} else {
 			return nil, errors.New("问诊尚未分配医生")
 		}
-	} else {
+	default:
 		return nil, errors.New("无权限发送消息")
 	}
 
 	// 3. 生成消息编号
 	messageNo := generateMessageNo()
 
-	// 4. 加密消息内容
-	var encryptedContent string
-	if req.Content != "" {
-		encrypted, err := crypto.SM4Encrypt(req.Content)
-		if err != nil {
-			log.Printf("[ChatService] SM4加密失败: %v", err)
-			return nil, errors.New("消息加密失败")
-		}
-		encryptedContent = encrypted
-	}
-
-	// 5. 创建消息
+	// 4. 创建消息（内容由sm4序列化器加密存储）
 	message := &model.ChatMessage{
 		MessageNo:      messageNo,
 		ConsultationID: req.ConsultationID,
 		SenderID:       req.SenderID,
 		ReceiverID:     receiverID,
 		MessageType:    req.MessageType,
-		Content:        encryptedContent,
+		Content:        req.Content,
 		FileURL:        req.FileURL,
 		FileSize:       req.FileSize,
 		Duration:       req.Duration,
@@ -95,14 +102,24 @@ func (s *ChatService) SendMessage(req *SendMessageRequest) (*model.ChatMessage,
 		return nil, err
 	}
 
-	// 6. 更新接收者的未读消息统计
+	// 5. 更新接收者的未读消息统计
 	unreadCount, _ := s.chatRepo.GetUnreadCount(receiverID, req.ConsultationID)
 	err = s.chatRepo.UpdateUnreadCount(receiverID, req.ConsultationID, int(unreadCount+1), message.ID, message.CreatedAt)
 	if err != nil {
 		log.Printf("[ChatService] 更新未读统计失败: %v", err)
 	}
 
-	// 7. 填充发送者信息
+	// 多学科会诊时其他医生也计入未读
+	for _, memberID := range consultationMemberIDs(s.participantRepo, consultation) {
+		if memberID == req.SenderID || memberID == receiverID {
+			continue
+		}
+		if err := s.chatRepo.IncrementUnreadCount(memberID, req.ConsultationID, message.ID, message.CreatedAt); err != nil {
+			log.Printf("[ChatService] 更新未读统计失败: %v", err)
+		}
+	}
+
+	// 6. 填充发送者信息
 	sender, _ := s.userRepo.FindByID(req.SenderID)
 	if sender != nil {
 		message.SenderName = sender.Username // 使用 Username
@@ -123,7 +140,7 @@ func (s *ChatService) SendMessage(req *SendMessageRequest) (*model.ChatMessage,
 // GetMessageListRequest 获取消息列表请求
 type GetMessageListRequest struct {
 	ConsultationID int64 `form:"consultationId" binding:"required"`
-	UserID         int64 `form:"userId" binding:"required"`
+	UserID         int64 `form:"userId"` // 由认证信息填充
 	Page           int   `form:"page"`
 	PageSize       int   `form:"pageSize"`
 }
@@ -144,7 +161,7 @@ func (s *ChatService) GetMessageList(req *GetMessageListRequest) (*GetMessageLis
 		return nil, errors.New("问诊不存在")
 	}
 
-	if req.UserID != consultation.PatientID && (consultation.DoctorID == nil || req.UserID != *consultation.DoctorID) {
+	if consultationMemberRole(s.participantRepo, consultation, req.UserID) == "" {
 		return nil, errors.New("无权限查看消息")
 	}
 
@@ -163,20 +180,8 @@ func (s *ChatService) GetMessageList(req *GetMessageListRequest) (*GetMessageLis
 		return nil, err
 	}
 
-	// 4. 解密消息内容并填充发送者信息
+	// 4. 填充发送者信息
 	for i := range messages {
-		// 解密内容
-		if messages[i].Content != "" {
-			decrypted, err := crypto.SM4Decrypt(messages[i].Content)
-			if err != nil {
-				log.Printf("[ChatService] 消息解密失败 ID=%d: %v", messages[i].ID, err)
-				messages[i].Content = "[解密失败]"
-			} else {
-				messages[i].Content = decrypted
-			}
-		}
-
-		// 填充发送者信息
 		sender, _ := s.userRepo.FindByID(messages[i].SenderID)
 		if sender != nil {
 			messages[i].SenderName = sender.Username // 使用 Username
@@ -207,7 +212,7 @@ func (s *ChatService) GetMessageList(req *GetMessageListRequest) (*GetMessageLis
 
 // GetUnreadCountRequest 获取未读数量请求
 type GetUnreadCountRequest struct {
-	UserID         int64 `form:"userId" binding:"required"`
+	UserID         int64 `form:"userId"` // 由认证信息填充
 	ConsultationID int64 `form:"consultationId"`
 }
 
@@ -255,7 +260,7 @@ func (s *ChatService) GetUnreadCount(req *GetUnreadCountRequest) (interface{}, e
 // MarkAsReadRequest 标记已读请求
 type MarkAsReadRequest struct {
 	MessageID int64 `json:"messageId" binding:"required"`
-	UserID    int64 `json:"userId" binding:"required"`
+	UserID    int64 `json:"userId"` // 由认证信息填充
 }
 
 // MarkAsRead 标记消息已读
@@ -268,7 +273,7 @@ func (s *ChatService) MarkAsRead(req *MarkAsReadRequest) error {
 
 	// 验证权限(只有接收者才能标记已读)
 	if message.ReceiverID != req.UserID {
-		return errors.New("无权限标记该消息")
+		return ErrNotMessageReceiver
 	}
 
 	// 标记已读
@@ -287,20 +292,13 @@ func (s *ChatService) MarkAsRead(req *MarkAsReadRequest) error {
 func (s *ChatService) SendSystemMessage(consultationID int64, receiverID int64, content string) error {
 	messageNo := generateMessageNo()
 
-	// 加密内容
-	encryptedContent, err := crypto.SM4Encrypt(content)
-	if err != nil {
-		log.Printf("[ChatService] 系统消息加密失败: %v", err)
-		return err
-	}
-
 	message := &model.ChatMessage{
 		MessageNo:      messageNo,
 		ConsultationID: consultationID,
 		SenderID:       0, // 系统消息发送者ID为0
 		ReceiverID:     receiverID,
 		MessageType:    5, // 系统消息
-		Content:        encryptedContent,
+		Content:        content,
 		IsRead:         false,
 		CreatedAt:      time.Now(),
 	}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sm-medical/internal/model"
+	"strings"
+	"time"
+)
+
+// 复诊：患者基于已完成的问诊发起复诊，默认分配给原接诊医生；
+// 医生查看复诊时可看到此前的诊断、处方和生命体征变化，完成问诊时可安排复诊日期，到期前提醒患者
+
+const (
+	// followUpHistoryDepth 复诊详情中向前追溯的问诊次数
+	followUpHistoryDepth = 5
+	// followUpMaxDays 复诊日期最多安排在多少天后
+	followUpMaxDays = 365
+)
+
+// vitalKeys 问诊症状中记录的生命体征
+var vitalKeys = []string{"bloodPressure", "heartRate", "temperature", "bloodSugar"}
+
+// resolveFollowUp 校验复诊关联的问诊，未指定医生时默认由原接诊医生接诊
+func (s *ConsultationService) resolveFollowUp(patientID, previousID int64, doctorID *int64) (*model.Consultation, *int64, string, error) {
+	previous, err := s.repo.FindByID(previousID)
+	if err != nil || previous.PatientID != patientID {
+		return nil, nil, "", errors.New("复诊关联的问诊不存在")
+	}
+	if previous.Status != ConsultationCompleted {
+		return nil, nil, "", errors.New("只能对已完成的问诊发起复诊")
+	}
+	if doctorID != nil || previous.DoctorID == nil {
+		return previous, doctorID, "", nil
+	}
+
+	doctor, err := s.userRepo.FindByID(*previous.DoctorID)
+	if err != nil || doctor.Role != "doctor" || doctor.Status != 0 || doctor.CurrentConsultationCount >= doctor.MaxConsultationCount {
+		log.Printf("[复诊] 原接诊医生暂不可接诊，转为智能分诊 - 上次问诊ID: %d, 医生ID: %d", previousID, *previous.DoctorID)
+		return previous, nil, "", nil
+	}
+	return previous, &doctor.ID, "复诊: 原接诊医生" + doctor.RealName, nil
+}
+
+// GetFollowUpPrefill 患者发起复诊时预填上次问诊的主诉、症状和接诊医生
+func (s *ConsultationService) GetFollowUpPrefill(patientID, consultationID int64) (map[string]interface{}, error) {
+	previous, err := s.repo.FindByID(consultationID)
+	if err != nil || previous.PatientID != patientID {
+		return nil, errors.New("问诊不存在")
+	}
+	if previous.Status != ConsultationCompleted {
+		return nil, errors.New("只能对已完成的问诊发起复诊")
+	}
+
+	var symptoms map[string]interface{}
+	json.Unmarshal([]byte(previous.SymptomsEncrypted), &symptoms)
+
+	result := map[string]interface{}{
+		"followUpOf":     previous.ID,
+		"consultationNo": previous.ConsultationNo,
+		"chiefComplaint": previous.ChiefComplaint,
+		"symptoms":       symptoms,
+		"diagnosis":      previous.DoctorDiagnosis,
+		"completedAt":    formatTime(previous.CompletedAt),
+	}
+	if previous.DoctorID != nil {
+		if doctor, err := s.userRepo.FindByID(*previous.DoctorID); err == nil {
+			result["doctorId"] = doctor.ID
+			result["doctorName"] = doctor.RealName
+			result["doctorDept"] = doctor.DoctorDept
+			result["doctorAvailable"] = doctor.Status == 0 && doctor.CurrentConsultationCount < doctor.MaxConsultationCount
+		}
+	}
+	if plan, err := s.followUpRepo.FindByConsultationID(previous.ID); err == nil && plan.Status == 0 {
+		result["followUpPlan"] = followUpPlanMap(plan)
+	}
+	return result, nil
+}
+
+// ScheduleFollowUp 接诊医生为已完成的问诊安排复诊，重新安排时取消之前的计划
+func (s *ConsultationService) ScheduleFollowUp(doctorID, consultationID int64, days int, note string) (map[string]interface{}, error) {
+	if days <= 0 || days > followUpMaxDays {
+		return nil, fmt.Errorf("复诊时间须在1-%d天内", followUpMaxDays)
+	}
+
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return nil, errors.New("问诊不存在")
+	}
+	if consultation.DoctorID == nil || *consultation.DoctorID != doctorID {
+		return nil, errors.New("无权限操作")
+	}
+	if consultation.Status != ConsultationCompleted {
+		return nil, errors.New("问诊完成后才能安排复诊")
+	}
+
+	if err := s.followUpRepo.CancelPending(consultationID); err != nil {
+		return nil, err
+	}
+	plan := &model.ConsultationFollowUp{
+		ConsultationID: consultationID,
+		PatientID:      consultation.PatientID,
+		DoctorID:       doctorID,
+		DueAt:          time.Now().AddDate(0, 0, days),
+		Note:           truncate(strings.TrimSpace(note), 500),
+	}
+	if err := s.followUpRepo.Create(plan); err != nil {
+		return nil, err
+	}
+	log.Printf("[复诊] 安排复诊 - 问诊ID: %d, 医生ID: %d, 复诊日期: %s", consultationID, doctorID, plan.DueAt.Format("2006-01-02"))
+
+	content := fmt.Sprintf("医生建议您在 %s 前后复诊（问诊 %s），届时可在问诊记录中直接发起复诊", plan.DueAt.Format("2006-01-02"), consultation.ConsultationNo)
+	if plan.Note != "" {
+		content += "。医生说明: " + plan.Note
+	}
+	s.notifyConsultation(consultation.PatientID, consultation, "复诊安排", content)
+
+	return followUpPlanMap(plan), nil
+}
+
+// GetFollowUps 患者待复诊的计划
+func (s *ConsultationService) GetFollowUps(patientID int64) ([]map[string]interface{}, error) {
+	plans, err := s.followUpRepo.FindByPatientID(patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(plans))
+	for i := range plans {
+		item := followUpPlanMap(&plans[i])
+		item["consultationId"] = plans[i].ConsultationID
+		if doctor, err := s.userRepo.FindByID(plans[i].DoctorID); err == nil {
+			item["doctorName"] = doctor.RealName
+			item["doctorDept"] = doctor.DoctorDept
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// RemindFollowUps 复诊日期临近时提醒患者，返回提醒条数
+func (s *ConsultationService) RemindFollowUps() int {
+	before := time.Now().Add(time.Duration(consultationConfig().FollowUpRemindHours) * time.Hour)
+	plans, err := s.followUpRepo.FindDueForReminder(before, 100)
+	if err != nil {
+		log.Printf("[复诊] 查询待提醒复诊失败: %v", err)
+		return 0
+	}
+
+	count := 0
+	for i := range plans {
+		plan := &plans[i]
+		ok, err := s.followUpRepo.MarkReminded(plan.ID)
+		if err != nil || !ok {
+			continue
+		}
+		consultation, err := s.repo.FindByID(plan.ConsultationID)
+		if err != nil {
+			continue
+		}
+		s.notifyConsultation(plan.PatientID, consultation, "复诊提醒",
+			fmt.Sprintf("您的复诊日期为 %s（问诊 %s），请及时发起复诊", plan.DueAt.Format("2006-01-02"), consultation.ConsultationNo))
+		count++
+	}
+	return count
+}
+
+// followUpHistory 复诊问诊此前的诊断、处方（从近到远）和生命体征变化（从远到近，含本次）
+func (s *ConsultationService) followUpHistory(consultation *model.Consultation, symptoms map[string]interface{}) ([]map[string]interface{}, []map[string]interface{}) {
+	history := make([]map[string]interface{}, 0)
+	trends := []map[string]interface{}{vitalSnapshot(consultation, symptoms)}
+
+	previousID := consultation.FollowUpOf
+	for depth := 0; previousID != nil && depth < followUpHistoryDepth; depth++ {
+		previous, err := s.repo.FindByID(*previousID)
+		if err != nil || previous.PatientID != consultation.PatientID {
+			break
+		}
+
+		item := map[string]interface{}{
+			"consultationId": previous.ID,
+			"consultationNo": previous.ConsultationNo,
+			"chiefComplaint": previous.ChiefComplaint,
+			"diagnosis":      previous.DoctorDiagnosis,
+			"prescription":   previous.Prescription,
+			"completedAt":    formatTime(previous.CompletedAt),
+		}
+		if previous.DoctorID != nil {
+			if doctor, err := s.userRepo.FindByID(*previous.DoctorID); err == nil {
+				item["doctorName"] = doctor.RealName
+				item["doctorDept"] = doctor.DoctorDept
+			}
+		}
+		history = append(history, item)
+
+		var previousSymptoms map[string]interface{}
+		json.Unmarshal([]byte(previous.SymptomsEncrypted), &previousSymptoms)
+		trends = append([]map[string]interface{}{vitalSnapshot(previous, previousSymptoms)}, trends...)
+
+		previousID = previous.FollowUpOf
+	}
+	return history, trends
+}
+
+// vitalSnapshot 单次问诊记录的生命体征
+func vitalSnapshot(consultation *model.Consultation, symptoms map[string]interface{}) map[string]interface{} {
+	snapshot := map[string]interface{}{
+		"consultationId": consultation.ID,
+		"date":           consultation.CreatedAt.Format("2006-01-02"),
+	}
+	for _, key := range vitalKeys {
+		if v, ok := symptoms[key]; ok && v != "" && v != nil {
+			snapshot[key] = v
+		}
+	}
+	return snapshot
+}
+
+// followUpPlanMap 复诊计划
+func followUpPlanMap(plan *model.ConsultationFollowUp) map[string]interface{} {
+	return map[string]interface{}{
+		"followUpId": plan.ID,
+		"dueAt":      plan.DueAt.Format("2006-01-02"),
+		"note":       plan.Note,
+		"status":     plan.Status,
+		"reminded":   plan.RemindedAt != nil,
+	}
+}
+
+// formatTime 格式化可为空的时间
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"strings"
+	"time"
+)
+
+// 多学科会诊(MDT)：主诊医生（问诊的接诊医生）邀请其他医生作为会诊医生加入问诊，
+// 所有参与医生都能查看病情、在问诊聊天室中交流并提交会诊意见，由主诊医生汇总为联合诊断后完成问诊
+
+// 问诊成员角色
+const (
+	MemberRolePatient         = "patient"
+	ParticipantRoleLead       = "lead"
+	ParticipantRoleConsultant = "consultant"
+)
+
+// consultationMemberRole 用户在问诊中的角色：患者、主诊医生或参与中的会诊医生，不是成员时返回空
+func consultationMemberRole(participantRepo *repository.ConsultationParticipantRepository, c *model.Consultation, userID int64) string {
+	switch {
+	case userID == c.PatientID:
+		return MemberRolePatient
+	case c.DoctorID != nil && *c.DoctorID == userID:
+		return ParticipantRoleLead
+	case participantRepo.IsActive(c.ID, userID):
+		return ParticipantRoleConsultant
+	}
+	return ""
+}
+
+// consultationMemberIDs 问诊的全部成员：患者、主诊医生和参与中的会诊医生
+func consultationMemberIDs(participantRepo *repository.ConsultationParticipantRepository, c *model.Consultation) []int64 {
+	ids := []int64{c.PatientID}
+	if c.DoctorID != nil {
+		ids = append(ids, *c.DoctorID)
+	}
+	participants, err := participantRepo.FindActive(c.ID)
+	if err != nil {
+		log.Printf("[会诊] 查询会诊医生失败 - 问诊ID: %d, 错误: %v", c.ID, err)
+		return ids
+	}
+	for _, p := range participants {
+		if c.DoctorID == nil || p.DoctorID != *c.DoctorID {
+			ids = append(ids, p.DoctorID)
+		}
+	}
+	return ids
+}
+
+// InviteParticipant 主诊医生邀请其他医生参与会诊
+func (s *ConsultationService) InviteParticipant(leadID, consultationID, doctorID int64, note string) (map[string]interface{}, error) {
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return nil, errors.New("问诊不存在")
+	}
+	if consultation.DoctorID == nil || *consultation.DoctorID != leadID {
+		return nil, errors.New("只有主诊医生可以邀请会诊")
+	}
+	if consultation.Status != ConsultationInProgress {
+		return nil, errors.New("问诊" + ConsultationStatusText(consultation.Status) + "，不能邀请会诊")
+	}
+	if doctorID == leadID {
+		return nil, errors.New("不能邀请自己")
+	}
+
+	doctor, err := s.userRepo.FindByID(doctorID)
+	if err != nil || doctor.Role != "doctor" || doctor.Status != 0 {
+		return nil, errors.New("受邀医生不存在或不可接诊")
+	}
+
+	active, err := s.participantRepo.FindActive(consultationID)
+	if err != nil {
+		return nil, err
+	}
+	if max := consultationConfig().MaxParticipants; len(active) >= max {
+		return nil, fmt.Errorf("最多邀请%d名会诊医生", max)
+	}
+
+	participant, err := s.participantRepo.Find(consultationID, doctorID)
+	if err == nil && participant.Status == 0 {
+		return nil, errors.New("该医生已在会诊中")
+	}
+	if err != nil {
+		participant = &model.ConsultationParticipant{ConsultationID: consultationID, DoctorID: doctorID}
+	}
+	// 退出后再次受邀时沿用原记录，保留之前提交的意见
+	participant.Role = ParticipantRoleConsultant
+	participant.InvitedBy = leadID
+	participant.InviteNote = truncate(strings.TrimSpace(note), 500)
+	participant.Status = 0
+	participant.LeftAt = nil
+	if err := s.participantRepo.Save(participant); err != nil {
+		return nil, err
+	}
+
+	lead, _ := s.userRepo.FindByID(leadID)
+	leadName := ""
+	if lead != nil {
+		leadName = lead.RealName
+	}
+	log.Printf("[会诊] 邀请会诊医生 - 问诊ID: %d, 主诊医生: %d, 会诊医生: %d", consultationID, leadID, doctorID)
+
+	s.postSystemMessage(consultation, leadID, fmt.Sprintf("%s医生邀请%s医生（%s）参与会诊", leadName, doctor.RealName, doctor.DoctorDept))
+	content := fmt.Sprintf("%s医生邀请您参与问诊 %s 的多学科会诊", leadName, consultation.ConsultationNo)
+	if participant.InviteNote != "" {
+		content += "，说明: " + participant.InviteNote
+	}
+	s.notifyConsultation(doctorID, consultation, "会诊邀请", content)
+
+	return map[string]interface{}{
+		"participantId": participant.ID,
+		"doctorId":      doctor.ID,
+		"doctorName":    doctor.RealName,
+		"doctorDept":    doctor.DoctorDept,
+		"role":          participant.Role,
+	}, nil
+}
+
+// RemoveParticipant 主诊医生移除会诊医生，或会诊医生自行退出
+func (s *ConsultationService) RemoveParticipant(userID, consultationID, doctorID int64) error {
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return errors.New("问诊不存在")
+	}
+	isLead := consultation.DoctorID != nil && *consultation.DoctorID == userID
+	if !isLead && userID != doctorID {
+		return errors.New("无权限操作")
+	}
+
+	participant, err := s.participantRepo.Find(consultationID, doctorID)
+	if err != nil || participant.Status != 0 {
+		return errors.New("该医生不在会诊中")
+	}
+
+	now := time.Now()
+	participant.Status = 1
+	participant.LeftAt = &now
+	if err := s.participantRepo.Save(participant); err != nil {
+		return err
+	}
+	log.Printf("[会诊] 会诊医生退出 - 问诊ID: %d, 会诊医生: %d, 操作人: %d", consultationID, doctorID, userID)
+
+	doctorName := ""
+	if doctor, _ := s.userRepo.FindByID(doctorID); doctor != nil {
+		doctorName = doctor.RealName
+	}
+	if isLead && userID != doctorID {
+		s.postSystemMessage(consultation, userID, doctorName+"医生已结束参与会诊")
+		s.notifyConsultation(doctorID, consultation, "会诊已结束", fmt.Sprintf("主诊医生已结束您对问诊 %s 的会诊", consultation.ConsultationNo))
+	} else {
+		s.postSystemMessage(consultation, userID, doctorName+"医生已退出会诊")
+	}
+	if chatNotifier != nil {
+		chatNotifier.CloseMember(consultationID, doctorID, "participant removed")
+	}
+	return nil
+}
+
+// SubmitOpinion 会诊医生提交或更新会诊意见，主诊医生完成问诊时汇总为联合诊断
+func (s *ConsultationService) SubmitOpinion(doctorID, consultationID int64, opinion string) error {
+	opinion = strings.TrimSpace(opinion)
+	if opinion == "" {
+		return errors.New("请填写会诊意见")
+	}
+
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return errors.New("问诊不存在")
+	}
+	if consultation.Status != ConsultationInProgress {
+		return errors.New("问诊" + ConsultationStatusText(consultation.Status) + "，不能提交会诊意见")
+	}
+	participant, err := s.participantRepo.Find(consultationID, doctorID)
+	if err != nil || participant.Status != 0 {
+		return errors.New("您不是该问诊的会诊医生")
+	}
+
+	now := time.Now()
+	participant.Opinion = opinion
+	participant.OpinionAt = &now
+	if err := s.participantRepo.Save(participant); err != nil {
+		return err
+	}
+
+	if consultation.DoctorID != nil {
+		doctorName := ""
+		if doctor, _ := s.userRepo.FindByID(doctorID); doctor != nil {
+			doctorName = doctor.RealName
+		}
+		s.notifyConsultation(*consultation.DoctorID, consultation, "收到会诊意见",
+			fmt.Sprintf("%s医生提交了问诊 %s 的会诊意见", doctorName, consultation.ConsultationNo))
+	}
+	return nil
+}
+
+// GetParticipants 问诊的主诊医生和会诊医生，会诊意见只对医生可见
+func (s *ConsultationService) GetParticipants(userID, consultationID int64) ([]map[string]interface{}, error) {
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return nil, errors.New("问诊不存在")
+	}
+	role := consultationMemberRole(s.participantRepo, consultation, userID)
+	if role == "" {
+		return nil, errors.New("无权限访问")
+	}
+
+	result := make([]map[string]interface{}, 0)
+	if consultation.DoctorID != nil {
+		if lead, err := s.userRepo.FindByID(*consultation.DoctorID); err == nil {
+			result = append(result, map[string]interface{}{
+				"doctorId":   lead.ID,
+				"doctorName": lead.RealName,
+				"doctorDept": lead.DoctorDept,
+				"role":       ParticipantRoleLead,
+			})
+		}
+	}
+
+	participants, err := s.participantRepo.FindActive(consultationID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range participants {
+		item := map[string]interface{}{
+			"participantId": p.ID,
+			"doctorId":      p.DoctorID,
+			"role":          p.Role,
+		}
+		if doctor, err := s.userRepo.FindByID(p.DoctorID); err == nil {
+			item["doctorName"] = doctor.RealName
+			item["doctorDept"] = doctor.DoctorDept
+		}
+		if role != MemberRolePatient {
+			item["inviteNote"] = p.InviteNote
+			item["opinion"] = p.Opinion
+			if p.OpinionAt != nil {
+				item["opinionAt"] = p.OpinionAt.Format("2006-01-02 15:04:05")
+			}
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// jointDiagnosis 将会诊医生的意见附在主诊医生的诊断之后，形成联合诊断
+func (s *ConsultationService) jointDiagnosis(consultationID int64, diagnosis string) (string, []model.ConsultationParticipant) {
+	participants, err := s.participantRepo.FindActive(consultationID)
+	if err != nil {
+		log.Printf("[会诊] 查询会诊医生失败 - 问诊ID: %d, 错误: %v", consultationID, err)
+		return diagnosis, nil
+	}
+
+	var opinions []string
+	for _, p := range participants {
+		if p.Opinion == "" {
+			continue
+		}
+		name := ""
+		if doctor, err := s.userRepo.FindByID(p.DoctorID); err == nil {
+			name = fmt.Sprintf("%s（%s）", doctor.RealName, doctor.DoctorDept)
+		}
+		opinions = append(opinions, fmt.Sprintf("- %s: %s", name, p.Opinion))
+	}
+	if len(opinions) == 0 {
+		return diagnosis, participants
+	}
+	return diagnosis + "\n\n多学科会诊意见:\n" + strings.Join(opinions, "\n"), participants
+}
@@ -5,9 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"sm-medical/internal/crypto"
 	"sm-medical/internal/model"
 	"sm-medical/internal/repository"
+	"strings"
 	"time"
 )
 
@@ -17,6 +17,11 @@ type ConsultationService struct {
 	recordRepo        *repository.RecordRepository
 	prescriptionService *PrescriptionService
 	triageService     *TriageService
+	signatureService  *SignatureService
+	notificationService *NotificationService
+	chatRepo          *repository.ChatRepository
+	participantRepo   *repository.ConsultationParticipantRepository
+	followUpRepo      *repository.ConsultationFollowUpRepository
 }
 
 func NewConsultationService() *ConsultationService {
@@ -26,28 +31,44 @@ func NewConsultationService() *ConsultationService {
 		recordRepo:        repository.NewRecordRepository(),
 		prescriptionService: NewPrescriptionService(),
 		triageService:     NewTriageService(),
+		signatureService:  NewSignatureService(),
+		notificationService: NewNotificationService(),
+		chatRepo:          repository.NewChatRepository(),
+		participantRepo:   repository.NewConsultationParticipantRepository(),
+		followUpRepo:      repository.NewConsultationFollowUpRepository(),
 	}
 }
 
-// Create 创建问诊
-func (s *ConsultationService) Create(patientID int64, doctorID *int64, chiefComplaint string, symptoms map[string]interface{}, needAI bool) (map[string]interface{}, error) {
+// Create 创建问诊，followUpOf不为空时为复诊，未指定医生时默认由上次的接诊医生接诊
+func (s *ConsultationService) Create(patientID int64, doctorID, followUpOf *int64, chiefComplaint string, symptoms map[string]interface{}, needAI bool) (map[string]interface{}, error) {
+	var previous *model.Consultation
+	var followUpReason string
+	if followUpOf != nil {
+		var err error
+		previous, doctorID, followUpReason, err = s.resolveFollowUp(patientID, *followUpOf, doctorID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// 生成问诊编号
 	consultationNo := fmt.Sprintf("CN%d", time.Now().Unix())
 
-	// 加密主诉
-	encryptedComplaint, _ := crypto.SM4Encrypt(chiefComplaint)
-
 	// 序列化症状数据
 	symptomsJSON, _ := json.Marshal(symptoms)
 
+	now := time.Now()
 	consultation := &model.Consultation{
 		PatientID:         patientID,
 		DoctorID:          doctorID,
 		ConsultationNo:    consultationNo,
-		ChiefComplaint:    encryptedComplaint,
+		ChiefComplaint:    chiefComplaint, // sm4序列化器加密存储
 		SymptomsEncrypted: string(symptomsJSON),
 		NeedAI:            needAI,
-		Status:            0,
+		Status:            ConsultationPending,
+		StatusChangedAt:   &now,
+		FollowUpOf:        followUpOf,
+		AssignedReason:    followUpReason,
 	}
 
 	// AI智能诊断
@@ -59,6 +80,7 @@ func (s *ConsultationService) Create(patientID int64, doctorID *int64, chiefComp
 		consultation.AIDiagnosis = aiResult.Diagnosis
 		consultation.AISuggestions = aiResult.Suggestions
 		consultation.RecommendedDept = aiResult.RecommendedDept
+		consultation.UrgencyLevel = aiResult.UrgencyLevel
 	}
 
 	// 智能分诊:如果未指定医生且有AI推荐科室,自动分配医生
@@ -73,9 +95,6 @@ func (s *ConsultationService) Create(patientID int64, doctorID *int64, chiefComp
 			consultation.AssignedReason = assignReason
 			log.Printf("[智能分诊] 成功分配医生: %s(%s) - 原因: %s", 
 				assignedDoctor.RealName, assignedDoctor.DoctorDept, assignReason)
-			
-			// 更新医生负载
-			s.triageService.UpdateDoctorWorkload(assignedDoctor.ID, 1)
 		} else {
 			log.Printf("[智能分诊] 自动分配失败: %v,问诊将进入待接诊队列", err)
 		}
@@ -85,6 +104,25 @@ func (s *ConsultationService) Create(patientID int64, doctorID *int64, chiefComp
 		return nil, err
 	}
 
+	// 记录创建事件，指定或自动分配了医生时计入医生负载
+	note := ""
+	if consultation.AutoAssigned {
+		note = "智能分诊: " + consultation.AssignedReason
+	}
+	if previous != nil {
+		if note != "" {
+			note += "; "
+		}
+		note += "复诊: 上次问诊 " + previous.ConsultationNo
+		if err := s.followUpRepo.Complete(previous.ID, consultation.ID); err != nil {
+			log.Printf("[复诊] 关联复诊计划失败 - 上次问诊ID: %d, 错误: %v", previous.ID, err)
+		}
+	}
+	if err := s.repo.CreateEvent(s.newEvent(consultation, ConsultationEventCreate, nil, consultationOperator{ID: patientID, Role: "patient"}, note)); err != nil {
+		log.Printf("[问诊] 记录创建事件失败 - 问诊ID: %d, 错误: %v", consultation.ID, err)
+	}
+	s.syncWorkload(nil, ConsultationPending, consultation.DoctorID, consultation.Status)
+
 	result := map[string]interface{}{
 		"consultationId": consultation.ID,
 		"consultationNo": consultation.ConsultationNo,
@@ -92,6 +130,15 @@ func (s *ConsultationService) Create(patientID int64, doctorID *int64, chiefComp
 		"createdAt":      consultation.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
 
+	// 复诊默认由原接诊医生接诊，通知医生
+	if previous != nil {
+		result["followUpOf"] = previous.ID
+		if consultation.DoctorID != nil && previous.DoctorID != nil && *consultation.DoctorID == *previous.DoctorID {
+			s.notifyConsultation(*consultation.DoctorID, consultation, "患者发起复诊",
+				fmt.Sprintf("您接诊过的问诊 %s 的患者发起了复诊，可在问诊详情中查看既往诊断、处方和体征变化", previous.ConsultationNo))
+		}
+	}
+
 	// 如果自动分配了医生,返回分诊信息
 	if consultation.AutoAssigned && consultation.DoctorID != nil {
 		doctor, _ := s.userRepo.FindByID(*consultation.DoctorID)
@@ -134,24 +181,18 @@ func (s *ConsultationService) GetList(userID int64, role string, page, pageSize
 
 	var result []map[string]interface{}
 	for _, c := range consultations {
-		chiefComplaint, _ := crypto.SM4Decrypt(c.ChiefComplaint)
-		
-		statusText := "待接诊"
-		if c.Status == 1 {
-			statusText = "问诊中"
-		} else if c.Status == 2 {
-			statusText = "已完成"
-		}
+		statusText := ConsultationStatusText(c.Status)
 
 		result = append(result, map[string]interface{}{
 			"consultationId": c.ID,
 			"consultationNo": c.ConsultationNo,
 			"patientName":    c.PatientName,
 			"doctorName":     c.DoctorName,
-			"chiefComplaint": chiefComplaint,
+			"chiefComplaint": c.ChiefComplaint,
 			"status":         c.Status,
 			"statusText":     statusText,
 			"needAI":         c.NeedAI,
+			"followUpOf":     c.FollowUpOf,
 			"createdAt":      c.CreatedAt.Format("2006-01-02 15:04:05"),
 		})
 	}
@@ -166,38 +207,45 @@ func (s *ConsultationService) GetDetail(userID, consultationID int64) (map[strin
 		return nil, errors.New("问诊不存在")
 	}
 
-	// 权限检查
-	if consultation.PatientID != userID && (consultation.DoctorID == nil || *consultation.DoctorID != userID) {
+	// 权限检查：患者、主诊医生和会诊医生
+	memberRole := consultationMemberRole(s.participantRepo, consultation, userID)
+	if memberRole == "" {
 		return nil, errors.New("无权限访问")
 	}
 
-	// 解密数据
-	chiefComplaint, _ := crypto.SM4Decrypt(consultation.ChiefComplaint)
-	
 	var symptoms map[string]interface{}
 	json.Unmarshal([]byte(consultation.SymptomsEncrypted), &symptoms)
 
-	statusText := "待接诊"
-	if consultation.Status == 1 {
-		statusText = "问诊中"
-	} else if consultation.Status == 2 {
-		statusText = "已完成"
-	}
+	statusText := ConsultationStatusText(consultation.Status)
 
 	result := map[string]interface{}{
 		"consultationId": consultation.ID,
 		"consultationNo": consultation.ConsultationNo,
-		"chiefComplaint": chiefComplaint,
+		"chiefComplaint": consultation.ChiefComplaint,
 		"symptoms":       symptoms,
 		"status":         consultation.Status,
 		"statusText":     statusText,
 		"needAI":         consultation.NeedAI,
+		"memberRole":     memberRole,
 		"createdAt":      consultation.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
 
+	// 复诊：此前的诊断、处方和生命体征变化
+	if consultation.FollowUpOf != nil {
+		history, trends := s.followUpHistory(consultation, symptoms)
+		result["followUpOf"] = *consultation.FollowUpOf
+		result["history"] = history
+		result["vitalTrends"] = trends
+	}
+	if consultation.Status == ConsultationCompleted {
+		if plan, err := s.followUpRepo.FindByConsultationID(consultation.ID); err == nil && plan.Status != 2 {
+			result["followUpPlan"] = followUpPlanMap(plan)
+		}
+	}
+
 	if consultation.AIRiskScore != nil {
 		// 重新执行AI诊断以获取完整结果(因为数据库只存储了部分字段)
-		aiResult := s.performAIDiagnosis(chiefComplaint, symptoms)
+		aiResult := s.performAIDiagnosis(consultation.ChiefComplaint, symptoms)
 		result["aiDiagnosis"] = map[string]interface{}{
 			"riskScore":        *consultation.AIRiskScore,
 			"riskLevel":        s.getRiskLevel(*consultation.AIRiskScore),
@@ -222,19 +270,14 @@ func (s *ConsultationService) Accept(doctorID, consultationID int64) error {
 		return errors.New("问诊不存在")
 	}
 
-	if consultation.Status != 0 {
-		return errors.New("问诊状态不正确")
-	}
-
-	consultation.DoctorID = &doctorID
-	consultation.Status = 1
-
-	// 更新医生负载(+1)
-	if err := s.triageService.UpdateDoctorWorkload(doctorID, 1); err != nil {
-		log.Printf("[接诊] 更新医生负载失败: %v", err)
+	// 已分配给其他医生的问诊不能抢接
+	if consultation.DoctorID != nil && *consultation.DoctorID != doctorID {
+		return errors.New("该问诊已分配给其他医生")
 	}
 
-	return s.repo.Update(consultation)
+	return s.transition(consultation, ConsultationEventAccept, consultationOperator{ID: doctorID, Role: "doctor"}, "", func(c *model.Consultation) {
+		c.DoctorID = &doctorID
+	})
 }
 
 // Finish 完成问诊(支持处方)
@@ -253,8 +296,18 @@ func (s *ConsultationService) Finish(doctorID, consultationID int64, diagnosis s
 		return errors.New("无权限操作")
 	}
 
+	// 先校验状态，避免未接诊或已结束的问诊开出处方
+	if err := checkTransition(consultation, ConsultationEventFinish); err != nil {
+		return err
+	}
+	// 病历和处方由医生私钥签署，未解锁时不能完成问诊
+	if err := requireSigningKey(doctorID); err != nil {
+		return err
+	}
+
 	// 处理处方数据
 	var prescriptionText string
+	var prescriptionID int64
 	if prescriptionData != nil {
 		// 解析处方数据
 		var medicines []map[string]interface{}
@@ -280,11 +333,12 @@ func (s *ConsultationService) Finish(doctorID, consultationID int64, diagnosis s
 				}
 				
 				// 格式化处方为文本
-				prescriptionID, ok := prescriptionResult["prescriptionId"].(int64)
+				id, ok := prescriptionResult["prescriptionId"].(int64)
 				if !ok {
 					log.Printf("[Finish] 处方ID类型转换失败: %v", prescriptionResult["prescriptionId"])
 					return errors.New("处方ID类型错误")
 				}
+				prescriptionID = id
 				prescriptionText, _ = s.prescriptionService.FormatPrescriptionForRecord(prescriptionID)
 				log.Printf("[Finish] 处方创建成功 - 处方ID: %d", prescriptionID)
 			}
@@ -296,28 +350,28 @@ func (s *ConsultationService) Finish(doctorID, consultationID int64, diagnosis s
 		prescriptionText = "无处方"
 	}
 
-	// 加密诊断和处方
-	encryptedDiagnosis, _ := crypto.SM4Encrypt(diagnosis)
-	encryptedPrescription, _ := crypto.SM4Encrypt(prescriptionText)
-
-	consultation.DoctorDiagnosis = encryptedDiagnosis
-	consultation.Prescription = encryptedPrescription
-	consultation.Status = 2
-	now := time.Now()
-	consultation.CompletedAt = &now
+	// 多学科会诊时汇总会诊意见形成联合诊断
+	diagnosis, participants := s.jointDiagnosis(consultation.ID, diagnosis)
 
+	// 诊断和处方由sm4序列化器加密存储
 	log.Printf("[Finish] 更新问诊状态 - ID: %d, 新状态: 2", consultation.ID)
-	err = s.repo.Update(consultation)
+	err = s.transition(consultation, ConsultationEventFinish, consultationOperator{ID: doctorID, Role: "doctor"}, "", func(c *model.Consultation) {
+		now := time.Now()
+		c.DoctorDiagnosis = diagnosis
+		c.Prescription = prescriptionText
+		c.CompletedAt = &now
+	})
 	if err != nil {
 		log.Printf("[Finish] 更新问诊失败: %v", err)
+		// 问诊未能完成（如已被取消或超时结束），作废已开具的处方，避免留下没有对应问诊结果的签名处方
+		if prescriptionID > 0 {
+			if voidErr := s.prescriptionService.VoidPrescription(prescriptionID, "问诊完成失败: "+err.Error()); voidErr != nil {
+				log.Printf("[Finish] 作废处方失败 - 处方ID: %d, 错误: %v", prescriptionID, voidErr)
+			}
+		}
 		return err
 	}
 		
-	// 更新医生负载(-1)
-	if err := s.triageService.UpdateDoctorWorkload(doctorID, -1); err != nil {
-		log.Printf("[Finish] 更新医生负载失败: %v", err)
-	}
-		
 	// 自动创建病历
 	log.Printf("[Finish] 开始创建病历 - 问论ID: %d", consultationID)
 	err = s.createMedicalRecord(consultation, diagnosis, prescriptionText)
@@ -325,38 +379,287 @@ func (s *ConsultationService) Finish(doctorID, consultationID int64, diagnosis s
 		log.Printf("[Finish] 创建病历失败: %v", err)
 		// 病历创建失败不影响问诊完成,只记录日志
 	}
+
+	for _, p := range participants {
+		s.notifyConsultation(p.DoctorID, consultation, "会诊已结束",
+			fmt.Sprintf("问诊 %s 已由主诊医生完成，可在病历中查看联合诊断", consultation.ConsultationNo))
+	}
 		
 	return nil
 }
 
+// Cancel 患者取消待接诊或问诊中的问诊
+func (s *ConsultationService) Cancel(patientID, consultationID int64, reason string) error {
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return errors.New("问诊不存在")
+	}
+	if consultation.PatientID != patientID {
+		return errors.New("无权限操作")
+	}
+
+	if err := s.transition(consultation, ConsultationEventCancel, consultationOperator{ID: patientID, Role: "patient"}, reason, nil); err != nil {
+		return err
+	}
+
+	if consultation.DoctorID != nil {
+		s.notifyConsultation(*consultation.DoctorID, consultation, "问诊已取消",
+			fmt.Sprintf("患者已取消问诊 %s。%s", consultation.ConsultationNo, reason))
+	}
+	return nil
+}
+
+// Decline 医生拒绝分配给自己的待接诊问诊，问诊退回待接诊队列
+func (s *ConsultationService) Decline(doctorID, consultationID int64, reason string) error {
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return errors.New("问诊不存在")
+	}
+	if consultation.DoctorID == nil || *consultation.DoctorID != doctorID {
+		return errors.New("无权限操作")
+	}
+
+	err = s.transition(consultation, ConsultationEventDecline, consultationOperator{ID: doctorID, Role: "doctor"}, reason, func(c *model.Consultation) {
+		c.DoctorID = nil
+		c.AutoAssigned = false
+		c.AssignedReason = ""
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notifyConsultation(consultation.PatientID, consultation, "医生暂时无法接诊",
+		fmt.Sprintf("您的问诊 %s 已退回待接诊队列，将由其他医生接诊。", consultation.ConsultationNo))
+	return nil
+}
+
+// Reopen 患者或接诊医生在完成（或超时）后的规定天数内重新打开问诊，由原医生继续接诊
+func (s *ConsultationService) Reopen(userID int64, role string, consultationID int64, reason string) error {
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return errors.New("问诊不存在")
+	}
+	isPatient := consultation.PatientID == userID
+	isDoctor := consultation.DoctorID != nil && *consultation.DoctorID == userID
+	if !isPatient && !isDoctor {
+		return errors.New("无权限操作")
+	}
+	if consultation.DoctorID == nil {
+		return errors.New("问诊没有接诊医生，不能重新打开")
+	}
+
+	closedAt := consultation.UpdatedAt
+	if consultation.StatusChangedAt != nil {
+		closedAt = *consultation.StatusChangedAt
+	}
+	reopenDays := consultationConfig().ReopenDays
+	if time.Since(closedAt) > time.Duration(reopenDays)*24*time.Hour {
+		return fmt.Errorf("问诊结束已超过%d天，请发起新的问诊", reopenDays)
+	}
+
+	err = s.transition(consultation, ConsultationEventReopen, consultationOperator{ID: userID, Role: role}, reason, func(c *model.Consultation) {
+		c.CompletedAt = nil
+	})
+	if err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf("问诊 %s 已重新打开。%s", consultation.ConsultationNo, reason)
+	if isPatient {
+		s.notifyConsultation(*consultation.DoctorID, consultation, "患者重新打开了问诊", content)
+	} else {
+		s.notifyConsultation(consultation.PatientID, consultation, "医生重新打开了问诊", content)
+	}
+	return nil
+}
+
+// Transfer 接诊医生将问诊转给指定医生，或转到目标科室重新智能分诊
+// 转诊后问诊回到待接诊，由新医生接诊；聊天记录按问诊保存，新医生接诊后可查看全部历史
+func (s *ConsultationService) Transfer(doctorID, consultationID int64, targetDoctorID int64, targetDept, note string) (map[string]interface{}, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return nil, errors.New("请填写转诊说明")
+	}
+	if (targetDoctorID == 0) == (targetDept == "") {
+		return nil, errors.New("请指定目标医生或目标科室")
+	}
+
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return nil, errors.New("问诊不存在")
+	}
+	if consultation.DoctorID == nil || *consultation.DoctorID != doctorID {
+		return nil, errors.New("无权限操作")
+	}
+	if err := checkTransition(consultation, ConsultationEventTransfer); err != nil {
+		return nil, err
+	}
+
+	fromDoctor, _ := s.userRepo.FindByID(doctorID)
+
+	var target *model.User
+	assignReason := "转诊: 指定医生"
+	if targetDoctorID > 0 {
+		if targetDoctorID == doctorID {
+			return nil, errors.New("不能转诊给自己")
+		}
+		target, err = s.userRepo.FindByID(targetDoctorID)
+		if err != nil || target.Role != "doctor" || target.Status != 0 {
+			return nil, errors.New("目标医生不存在或不可接诊")
+		}
+		if target.CurrentConsultationCount >= target.MaxConsultationCount {
+			return nil, errors.New("目标医生已达最大接诊量，请选择其他医生或转到科室")
+		}
+	} else {
+		// 只在目标科室内分配，不使用跨科室的兜底规则
+		doctor, reason, err := s.triageService.AutoAssignDoctorInDept(consultationID, targetDept, doctorID)
+		if err != nil {
+			log.Printf("[转诊] 目标科室暂无可用医生，进入待接诊队列 - 问诊ID: %d, 科室: %s, 原因: %v", consultationID, targetDept, err)
+		} else {
+			target = doctor
+			assignReason = "转诊: " + reason
+		}
+	}
+
+	var eventNote string
+	if target != nil {
+		eventNote = fmt.Sprintf("转给%s医生（%s）: %s", target.RealName, target.DoctorDept, note)
+	} else {
+		eventNote = fmt.Sprintf("转到%s，等待接诊: %s", targetDept, note)
+	}
+
+	err = s.transition(consultation, ConsultationEventTransfer, consultationOperator{ID: doctorID, Role: "doctor"}, eventNote, func(c *model.Consultation) {
+		c.ReassignCount = 0
+		if targetDept != "" {
+			c.RecommendedDept = targetDept
+		}
+		if target == nil {
+			c.DoctorID = nil
+			c.AutoAssigned = false
+			c.AssignedReason = ""
+			return
+		}
+		c.DoctorID = &target.ID
+		c.AutoAssigned = targetDoctorID == 0
+		c.AssignedReason = truncate(assignReason, 200)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 在聊天记录中留下转诊说明，原医生退出聊天室
+	fromName := ""
+	if fromDoctor != nil {
+		fromName = fromDoctor.RealName
+	}
+	s.postSystemMessage(consultation, doctorID, fmt.Sprintf("%s医生已将问诊%s", fromName, eventNote))
+	if chatNotifier != nil {
+		chatNotifier.CloseMember(consultationID, doctorID, "consultation transferred")
+	}
+
+	content := fmt.Sprintf("您的问诊 %s 已转诊，%s", consultation.ConsultationNo, eventNote)
+	s.notifyConsultation(consultation.PatientID, consultation, "问诊已转诊", content)
+	if target != nil {
+		s.notifyConsultation(target.ID, consultation, "收到转诊问诊",
+			fmt.Sprintf("%s医生将问诊 %s 转给您，请查看转诊说明和聊天记录后接诊。说明: %s", fromName, consultation.ConsultationNo, note))
+	}
+
+	result := map[string]interface{}{
+		"consultationId": consultation.ID,
+		"status":         consultation.Status,
+		"statusText":     ConsultationStatusText(consultation.Status),
+	}
+	if target != nil {
+		result["doctorId"] = target.ID
+		result["doctorName"] = target.RealName
+		result["doctorDept"] = target.DoctorDept
+	}
+	return result, nil
+}
+
+// postSystemMessage 在问诊聊天记录中写入一条系统消息并推送给在线用户
+func (s *ConsultationService) postSystemMessage(consultation *model.Consultation, senderID int64, content string) {
+	message := &model.ChatMessage{
+		MessageNo:      generateMessageNo(),
+		ConsultationID: consultation.ID,
+		SenderID:       senderID,
+		ReceiverID:     consultation.PatientID,
+		MessageType:    5, // 系统消息
+		Content:        content,
+		CreatedAt:      time.Now(),
+	}
+	if err := s.chatRepo.CreateMessage(message); err != nil {
+		log.Printf("[问诊] 写入系统消息失败 - 问诊ID: %d, 错误: %v", consultation.ID, err)
+		return
+	}
+	unreadCount, _ := s.chatRepo.GetUnreadCount(consultation.PatientID, consultation.ID)
+	if err := s.chatRepo.UpdateUnreadCount(consultation.PatientID, consultation.ID, int(unreadCount+1), message.ID, message.CreatedAt); err != nil {
+		log.Printf("[问诊] 更新未读统计失败 - 问诊ID: %d, 错误: %v", consultation.ID, err)
+	}
+	if chatNotifier != nil {
+		message.SenderRole = "system"
+		chatNotifier.SendToConsultation(consultation.ID, "chat", message)
+	}
+}
+
+// GetEvents 问诊状态变更历史，患者本人和接诊医生可查看
+func (s *ConsultationService) GetEvents(userID, consultationID int64) ([]map[string]interface{}, error) {
+	consultation, err := s.repo.FindByID(consultationID)
+	if err != nil {
+		return nil, errors.New("问诊不存在")
+	}
+	if consultationMemberRole(s.participantRepo, consultation, userID) == "" {
+		return nil, errors.New("无权限访问")
+	}
+
+	events, err := s.repo.FindEvents(consultationID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(events))
+	for _, e := range events {
+		item := map[string]interface{}{
+			"eventId":      e.ID,
+			"eventType":    e.EventType,
+			"toStatus":     e.ToStatus,
+			"toStatusText": ConsultationStatusText(e.ToStatus),
+			"operatorId":   e.OperatorID,
+			"operatorRole": e.OperatorRole,
+			"doctorId":     e.DoctorID,
+			"note":         e.Note,
+			"createdAt":    e.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+		if e.FromStatus != nil {
+			item["fromStatus"] = *e.FromStatus
+			item["fromStatusText"] = ConsultationStatusText(*e.FromStatus)
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
 // createMedicalRecord 创建病历
 func (s *ConsultationService) createMedicalRecord(consultation *model.Consultation, diagnosis, prescription string) error {
 	// 生成病历编号
 	recordNo := fmt.Sprintf("MR%d", time.Now().Unix())
 	
-	// 解密主诉
-	chiefComplaint, _ := crypto.SM4Decrypt(consultation.ChiefComplaint)
-	
-	// 加密病历数据
-	encryptedChiefComplaint, _ := crypto.SM4Encrypt(chiefComplaint)
-	encryptedDiagnosis, _ := crypto.SM4Encrypt(diagnosis)
-	encryptedTreatment, _ := crypto.SM4Encrypt(prescription)
-	
-	// 生成数据哈希
-	dataForHash := fmt.Sprintf("%s|%s|%s", chiefComplaint, diagnosis, prescription)
-	dataHash := crypto.SM3Hash(dataForHash)
-	
+	// 病历数据由sm4序列化器加密存储
 	record := &model.MedicalRecord{
 		RecordNo:       recordNo,
 		PatientID:      consultation.PatientID,
 		ConsultationID: &consultation.ID,
 		RecordType:     2, // 2:在线问诊
-		ChiefComplaint: encryptedChiefComplaint,
-		Diagnosis:      encryptedDiagnosis,
-		Treatment:      encryptedTreatment,
+		ChiefComplaint: consultation.ChiefComplaint,
+		Diagnosis:      diagnosis,
+		Treatment:      prescription,
 		DoctorID:       consultation.DoctorID,
 		AIAdvice:       consultation.AIDiagnosis,
-		DataHash:       dataHash,
+	}
+	
+	// SM2签名(同时生成数据哈希)
+	if err := s.signatureService.SignRecord(record); err != nil {
+		return err
 	}
 	
 	err := s.recordRepo.Create(record)
@@ -0,0 +1,411 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sm-medical/internal/model"
+	"sm-medical/pkg/config"
+	"time"
+)
+
+// 问诊状态
+const (
+	ConsultationPending    = 0 // 待接诊
+	ConsultationInProgress = 1 // 问诊中
+	ConsultationCompleted  = 2 // 已完成
+	ConsultationCancelled  = 3 // 已取消
+	ConsultationTimedOut   = 4 // 已超时
+)
+
+// 问诊状态变更事件
+const (
+	ConsultationEventCreate   = "create"   // 患者发起
+	ConsultationEventAccept   = "accept"   // 医生接诊
+	ConsultationEventFinish   = "finish"   // 医生完成问诊
+	ConsultationEventCancel   = "cancel"   // 患者取消
+	ConsultationEventDecline  = "decline"  // 医生拒绝接诊，退回待接诊队列
+	ConsultationEventTimeout  = "timeout"  // 问诊中超时未完成，系统自动结束
+	ConsultationEventReopen   = "reopen"   // 已完成或已超时的问诊重新打开
+	ConsultationEventReassign = "reassign" // 超过待接诊时限，释放原医生并重新分诊
+	ConsultationEventExpire   = "expire"   // 重新分诊次数用完仍无人接诊，系统取消
+	ConsultationEventTransfer = "transfer" // 医生转诊给其他医生或科室，由新医生重新接诊
+)
+
+// consultationStatusText 状态说明
+var consultationStatusText = map[int]string{
+	ConsultationPending:    "待接诊",
+	ConsultationInProgress: "问诊中",
+	ConsultationCompleted:  "已完成",
+	ConsultationCancelled:  "已取消",
+	ConsultationTimedOut:   "已超时",
+}
+
+// ConsultationStatusText 问诊状态的中文说明
+func ConsultationStatusText(status int) string {
+	if text, ok := consultationStatusText[status]; ok {
+		return text
+	}
+	return "未知"
+}
+
+// consultationTransition 状态转换规则
+type consultationTransition struct {
+	name string // 操作名称，用于错误提示
+	from []int  // 允许的起始状态
+	to   int
+}
+
+// consultationTransitions 事件 -> 转换规则，不在表中的转换一律拒绝
+var consultationTransitions = map[string]consultationTransition{
+	ConsultationEventAccept:   {"接诊", []int{ConsultationPending}, ConsultationInProgress},
+	ConsultationEventFinish:   {"完成问诊", []int{ConsultationInProgress}, ConsultationCompleted},
+	ConsultationEventCancel:   {"取消问诊", []int{ConsultationPending, ConsultationInProgress}, ConsultationCancelled},
+	ConsultationEventDecline:  {"拒绝接诊", []int{ConsultationPending}, ConsultationPending},
+	ConsultationEventTimeout:  {"超时结束", []int{ConsultationInProgress}, ConsultationTimedOut},
+	ConsultationEventReopen:   {"重新打开", []int{ConsultationCompleted, ConsultationTimedOut}, ConsultationInProgress},
+	ConsultationEventReassign: {"重新分诊", []int{ConsultationPending}, ConsultationPending},
+	ConsultationEventExpire:   {"超时取消", []int{ConsultationPending}, ConsultationCancelled},
+	ConsultationEventTransfer: {"转诊", []int{ConsultationPending, ConsultationInProgress}, ConsultationPending},
+}
+
+// ErrConsultationStatusChanged 并发请求已修改问诊状态
+var ErrConsultationStatusChanged = errors.New("问诊状态已变化，请刷新后重试")
+
+// consultationOperator 触发状态变更的用户，ID为0表示系统
+type consultationOperator struct {
+	ID   int64
+	Role string
+}
+
+var systemOperator = consultationOperator{Role: "system"}
+
+// ConsultationChatNotifier 问诊聊天室的实时推送，由聊天模块注册（websocket.ChatHub）
+type ConsultationChatNotifier interface {
+	// CloseConsultation 问诊结束（完成、取消、超时）后断开全部连接
+	CloseConsultation(consultationID int64, reason string)
+	// CloseMember 用户不再是问诊参与人时断开其连接
+	CloseMember(consultationID, userID int64, reason string)
+	// SendToConsultation 向问诊的在线用户推送消息
+	SendToConsultation(consultationID int64, messageType string, data interface{})
+}
+
+var chatNotifier ConsultationChatNotifier
+
+// SetConsultationChatNotifier 注册问诊聊天室的实时推送
+func SetConsultationChatNotifier(n ConsultationChatNotifier) {
+	chatNotifier = n
+}
+
+// checkTransition 检查问诊当前状态是否允许该事件
+func checkTransition(consultation *model.Consultation, event string) error {
+	rule, ok := consultationTransitions[event]
+	if !ok {
+		return fmt.Errorf("未知的问诊操作: %s", event)
+	}
+	for _, from := range rule.from {
+		if consultation.Status == from {
+			return nil
+		}
+	}
+	return fmt.Errorf("问诊%s，不能%s", ConsultationStatusText(consultation.Status), rule.name)
+}
+
+// transition 执行状态转换：校验规则，apply修改问诊的其他字段，条件更新并写入变更历史，最后同步医生负载
+func (s *ConsultationService) transition(consultation *model.Consultation, event string, operator consultationOperator, note string, apply func(c *model.Consultation)) error {
+	if err := checkTransition(consultation, event); err != nil {
+		return err
+	}
+
+	fromStatus := consultation.Status
+	var fromDoctorID *int64
+	if consultation.DoctorID != nil {
+		id := *consultation.DoctorID
+		fromDoctorID = &id
+	}
+
+	if apply != nil {
+		apply(consultation)
+	}
+	now := time.Now()
+	consultation.Status = consultationTransitions[event].to
+	consultation.StatusChangedAt = &now
+
+	updated, err := s.repo.UpdateStatus(consultation, fromStatus, s.newEvent(consultation, event, &fromStatus, operator, note))
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrConsultationStatusChanged
+	}
+
+	log.Printf("[问诊] 状态变更 - 问诊ID: %d, 事件: %s, %s -> %s, 操作人: %s(%d)",
+		consultation.ID, event, ConsultationStatusText(fromStatus), ConsultationStatusText(consultation.Status), operator.Role, operator.ID)
+	s.syncWorkload(fromDoctorID, fromStatus, consultation.DoctorID, consultation.Status)
+	if !isActiveConsultation(consultation.Status) && chatNotifier != nil {
+		chatNotifier.CloseConsultation(consultation.ID, "consultation "+event)
+	}
+	return nil
+}
+
+// ExpireInactive 将问诊中超过 timeout_hours 仍未完成的问诊结束为已超时，返回处理数量
+func (s *ConsultationService) ExpireInactive() int {
+	timeout := time.Duration(consultationConfig().TimeoutHours) * time.Hour
+	consultations, err := s.repo.FindStaleByStatus(ConsultationInProgress, time.Now().Add(-timeout), 100)
+	if err != nil {
+		log.Printf("[问诊] 查询超时问诊失败: %v", err)
+		return 0
+	}
+
+	expired := 0
+	for i := range consultations {
+		consultation := &consultations[i]
+		note := fmt.Sprintf("接诊后超过%d小时未完成", consultationConfig().TimeoutHours)
+		if err := s.transition(consultation, ConsultationEventTimeout, systemOperator, note, nil); err != nil {
+			if !errors.Is(err, ErrConsultationStatusChanged) {
+				log.Printf("[问诊] 超时结束失败 - 问诊ID: %d, 错误: %v", consultation.ID, err)
+			}
+			continue
+		}
+		expired++
+
+		content := fmt.Sprintf("问诊 %s %s，已自动结束。如需继续，可在%d天内重新打开。", consultation.ConsultationNo, note, consultationConfig().ReopenDays)
+		s.notifyConsultation(consultation.PatientID, consultation, "问诊已超时结束", content)
+		if consultation.DoctorID != nil {
+			s.notifyConsultation(*consultation.DoctorID, consultation, "问诊已超时结束", content)
+		}
+	}
+	return expired
+}
+
+// ExpirePending 处理超过待接诊时限（按AI紧急程度区分）仍未被接诊的问诊：
+// 释放原医生负载并通过智能分诊重新分配给其他医生，重新分诊次数用完后取消问诊；返回处理数量
+func (s *ConsultationService) ExpirePending() int {
+	cfg := consultationConfig()
+	// 每个紧急程度使用各自的截止时间筛选，避免未超时的普通问诊占满批次
+	now := time.Now()
+	consultations, err := s.repo.FindStaleByUrgency(ConsultationPending,
+		now.Add(-pendingSLA("emergency")), now.Add(-pendingSLA("urgent")), now.Add(-pendingSLA("")), 100)
+	if err != nil {
+		log.Printf("[问诊] 查询超时待接诊问诊失败: %v", err)
+		return 0
+	}
+
+	handled := 0
+	for i := range consultations {
+		consultation := &consultations[i]
+		sla := pendingSLA(consultation.UrgencyLevel)
+
+		var err error
+		if consultation.ReassignCount < cfg.MaxReassign {
+			err = s.reassignPending(consultation, sla)
+		} else {
+			err = s.expirePending(consultation)
+		}
+		if err != nil {
+			if !errors.Is(err, ErrConsultationStatusChanged) {
+				log.Printf("[问诊] 处理超时待接诊问诊失败 - 问诊ID: %d, 错误: %v", consultation.ID, err)
+			}
+			continue
+		}
+		handled++
+	}
+	return handled
+}
+
+// reassignPending 释放原医生并重新分诊，排除此前分配过的医生；没有可用医生时退回待接诊队列
+func (s *ConsultationService) reassignPending(consultation *model.Consultation, sla time.Duration) error {
+	hadDoctor := consultation.DoctorID != nil
+	exclude := s.assignedDoctorIDs(consultation)
+	doctor, reason, assignErr := s.triageService.AutoAssignDoctor(consultation.ID, consultation.RecommendedDept, exclude...)
+
+	note := fmt.Sprintf("超过%d分钟未被接诊", int(sla.Minutes()))
+	if assignErr != nil {
+		note += "，暂无其他可用医生: " + assignErr.Error()
+	} else {
+		note += "，重新分诊: " + reason
+	}
+
+	err := s.transition(consultation, ConsultationEventReassign, systemOperator, note, func(c *model.Consultation) {
+		c.ReassignCount++
+		if assignErr != nil {
+			c.DoctorID = nil
+			c.AutoAssigned = false
+			c.AssignedReason = ""
+			return
+		}
+		c.DoctorID = &doctor.ID
+		c.AutoAssigned = true
+		c.AssignedReason = reason
+	})
+	if err != nil {
+		return err
+	}
+
+	if assignErr != nil {
+		s.notifyConsultation(consultation.PatientID, consultation, "正在为您寻找医生",
+			fmt.Sprintf("您的问诊 %s 暂未被接诊，已进入待接诊队列，我们会尽快安排医生。", consultation.ConsultationNo))
+		return nil
+	}
+	content := fmt.Sprintf("您的问诊 %s 已分配给%s医生（%s）。", consultation.ConsultationNo, doctor.RealName, doctor.DoctorDept)
+	if hadDoctor {
+		content = fmt.Sprintf("您的问诊 %s 原医生暂未接诊，已重新分配给%s医生（%s）。", consultation.ConsultationNo, doctor.RealName, doctor.DoctorDept)
+	}
+	s.notifyConsultation(consultation.PatientID, consultation, "已为您重新分配医生", content)
+	s.notifyConsultation(doctor.ID, consultation, "新的待接诊问诊",
+		fmt.Sprintf("问诊 %s 已分配给您，请尽快接诊。", consultation.ConsultationNo))
+	return nil
+}
+
+// expirePending 重新分诊次数用完仍无人接诊，取消问诊并通知患者
+func (s *ConsultationService) expirePending(consultation *model.Consultation) error {
+	note := fmt.Sprintf("重新分诊%d次后仍无医生接诊", consultation.ReassignCount)
+	if err := s.transition(consultation, ConsultationEventExpire, systemOperator, note, nil); err != nil {
+		return err
+	}
+
+	s.notifyConsultation(consultation.PatientID, consultation, "问诊已取消",
+		fmt.Sprintf("很抱歉，您的问诊 %s 长时间无医生接诊，已自动取消，请重新发起问诊或前往线下就医。", consultation.ConsultationNo))
+	return nil
+}
+
+// assignedDoctorIDs 问诊当前及历史上分配过的医生
+func (s *ConsultationService) assignedDoctorIDs(consultation *model.Consultation) []int64 {
+	seen := make(map[int64]bool)
+	if consultation.DoctorID != nil {
+		seen[*consultation.DoctorID] = true
+	}
+	events, err := s.repo.FindEvents(consultation.ID)
+	if err != nil {
+		log.Printf("[问诊] 查询状态变更历史失败 - 问诊ID: %d, 错误: %v", consultation.ID, err)
+	}
+	for _, e := range events {
+		if e.DoctorID != nil {
+			seen[*e.DoctorID] = true
+		}
+	}
+
+	ids := make([]int64, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// pendingSLA 待接诊时限，AI判定为urgent、emergency的问诊使用更短的时限
+func pendingSLA(urgencyLevel string) time.Duration {
+	cfg := consultationConfig()
+	minutes := cfg.PendingSLAMinutes
+	switch urgencyLevel {
+	case "emergency":
+		minutes = cfg.EmergencySLAMinutes
+	case "urgent":
+		minutes = cfg.UrgentSLAMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// StartScheduler 启动问诊的定期检查：待接诊超时重新分诊或取消、问诊中超时结束
+func (s *ConsultationService) StartScheduler() {
+	interval := time.Duration(consultationConfig().CheckInterval) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n := s.ExpirePending(); n > 0 {
+				log.Printf("[问诊] 已处理超时待接诊问诊 - 共 %d 条", n)
+			}
+			if n := s.ExpireInactive(); n > 0 {
+				log.Printf("[问诊] 已结束超时问诊 - 共 %d 条", n)
+			}
+			if n := s.RemindFollowUps(); n > 0 {
+				log.Printf("[复诊] 已发送复诊提醒 - 共 %d 条", n)
+			}
+		}
+	}()
+	log.Printf("[问诊] 定期检查已启动 - 间隔: %s", interval)
+}
+
+// newEvent 构造状态变更历史
+func (s *ConsultationService) newEvent(consultation *model.Consultation, event string, fromStatus *int, operator consultationOperator, note string) *model.ConsultationEvent {
+	e := &model.ConsultationEvent{
+		ConsultationID: consultation.ID,
+		EventType:      event,
+		FromStatus:     fromStatus,
+		ToStatus:       consultation.Status,
+		OperatorRole:   operator.Role,
+		DoctorID:       consultation.DoctorID,
+		Note:           truncate(note, 500),
+	}
+	if operator.ID > 0 {
+		e.OperatorID = &operator.ID
+	}
+	return e
+}
+
+// syncWorkload 医生负载等于其待接诊和问诊中的问诊数，状态或接诊医生变化后增减
+func (s *ConsultationService) syncWorkload(fromDoctorID *int64, fromStatus int, toDoctorID *int64, toStatus int) {
+	fromActive := fromDoctorID != nil && isActiveConsultation(fromStatus)
+	toActive := toDoctorID != nil && isActiveConsultation(toStatus)
+	if fromActive && toActive && *fromDoctorID == *toDoctorID {
+		return
+	}
+	if fromActive {
+		if err := s.triageService.UpdateDoctorWorkload(*fromDoctorID, -1); err != nil {
+			log.Printf("[问诊] 更新医生负载失败 - 医生ID: %d, 错误: %v", *fromDoctorID, err)
+		}
+	}
+	if toActive {
+		if err := s.triageService.UpdateDoctorWorkload(*toDoctorID, 1); err != nil {
+			log.Printf("[问诊] 更新医生负载失败 - 医生ID: %d, 错误: %v", *toDoctorID, err)
+		}
+	}
+}
+
+// isActiveConsultation 待接诊和问诊中的问诊计入医生负载
+func isActiveConsultation(status int) bool {
+	return status == ConsultationPending || status == ConsultationInProgress
+}
+
+// notifyConsultation 发送问诊相关通知，失败只记录日志
+func (s *ConsultationService) notifyConsultation(userID int64, consultation *model.Consultation, title, content string) {
+	if err := s.notificationService.Notify(userID, "consultation", title, content, &consultation.ID, "consultation"); err != nil {
+		log.Printf("[问诊] 发送通知失败 - 用户ID: %d, 问诊ID: %d, 错误: %v", userID, consultation.ID, err)
+	}
+}
+
+// consultationConfig 问诊状态流转配置，未配置的项使用默认值
+func consultationConfig() config.ConsultationConfig {
+	var cfg config.ConsultationConfig
+	if config.AppConfig != nil {
+		cfg = config.AppConfig.Consultation
+	}
+	if cfg.ReopenDays <= 0 {
+		cfg.ReopenDays = 7
+	}
+	if cfg.TimeoutHours <= 0 {
+		cfg.TimeoutHours = 48
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = 60
+	}
+	if cfg.PendingSLAMinutes <= 0 {
+		cfg.PendingSLAMinutes = 30
+	}
+	if cfg.UrgentSLAMinutes <= 0 {
+		cfg.UrgentSLAMinutes = 10
+	}
+	if cfg.EmergencySLAMinutes <= 0 {
+		cfg.EmergencySLAMinutes = 5
+	}
+	if cfg.MaxReassign <= 0 {
+		cfg.MaxReassign = 2
+	}
+	if cfg.MaxParticipants <= 0 {
+		cfg.MaxParticipants = 5
+	}
+	if cfg.FollowUpRemindHours <= 0 {
+		cfg.FollowUpRemindHours = 24
+	}
+	return cfg
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sync"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// DoctorCertService 医生SM2签名证书服务
+// 医生私钥使用登录口令派生的密钥加密保存，登录时解锁并缓存在内存中用于签署病历和处方
+type DoctorCertService struct {
+	certRepo *repository.DoctorCertRepository
+	userRepo *repository.UserRepository
+}
+
+func NewDoctorCertService() *DoctorCertService {
+	return &DoctorCertService{
+		certRepo: repository.NewDoctorCertRepository(),
+		userRepo: repository.NewUserRepository(),
+	}
+}
+
+// unlockedDoctorKey 已解锁的医生签名私钥
+type unlockedDoctorKey struct {
+	key   *sm2.PrivateKey
+	keyID string
+}
+
+// cachedDoctorKey 缓存的医生签名私钥及持有它的登录会话
+type cachedDoctorKey struct {
+	*unlockedDoctorKey
+	sessions map[string]time.Time // 会话标识 -> 会话过期时间
+}
+
+// doctorSigningKeys 已解锁的医生私钥缓存（医生ID -> 私钥）
+// 有效期与登录会话（刷新令牌）一致，持有私钥的会话全部退出、吊销或过期后不再可用
+var doctorSigningKeys = struct {
+	sync.RWMutex
+	keys map[int64]*cachedDoctorKey
+}{keys: make(map[int64]*cachedDoctorKey)}
+
+// IssueCertificate 为医生生成SM2密钥对并签发证书，password为医生登录口令，返回证书和未缓存的私钥
+func (s *DoctorCertService) IssueCertificate(user *model.User, password string) (*model.DoctorCertificate, *unlockedDoctorKey, error) {
+	if user.Role != "doctor" || user.CertStatus != "approved" {
+		return nil, nil, errors.New("仅已认证的医生可签发证书")
+	}
+
+	priv, err := crypto.GenerateSM2KeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issued, err := crypto.IssueDoctorCertificate(crypto.DoctorCertSubject{
+		DoctorID:   user.ID,
+		Username:   user.Username,
+		RealName:   user.RealName,
+		Dept:       user.DoctorDept,
+		CertNumber: user.CertNumber,
+	}, &priv.PublicKey, crypto.DoctorCertValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed, err := crypto.SealSM2PrivateKey(priv, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert := &model.DoctorCertificate{
+		DoctorID:            user.ID,
+		SerialNumber:        issued.SerialNumber,
+		KeyID:               crypto.SM2PublicKeyID(&priv.PublicKey),
+		PublicKey:           crypto.EncodeSM2PublicKeyHex(&priv.PublicKey),
+		CertificatePEM:      issued.CertificatePEM,
+		EncryptedPrivateKey: sealed,
+		Status:              "active",
+		NotBefore:           issued.NotBefore,
+		NotAfter:            issued.NotAfter,
+	}
+	if err := s.certRepo.Create(cert); err != nil {
+		return nil, nil, err
+	}
+
+	log.Printf("[医生证书] 签发证书 - 医生ID: %d, 序列号: %s, 密钥标识: %s", user.ID, cert.SerialNumber, cert.KeyID)
+	return cert, &unlockedDoctorKey{key: priv, keyID: cert.KeyID}, nil
+}
+
+// UnlockSigningKey 医生口令校验通过后解锁签名私钥；尚无有效证书的已认证医生在此补发证书
+// 返回的私钥不会立即缓存，两步验证通过、会话创建后才放入缓存
+func (s *DoctorCertService) UnlockSigningKey(user *model.User, password string) *unlockedDoctorKey {
+	if user.Role != "doctor" || user.CertStatus != "approved" {
+		return nil
+	}
+
+	cert, err := s.certRepo.FindActiveByDoctorID(user.ID)
+	if err != nil || time.Now().After(cert.NotAfter) {
+		_, unlocked, err := s.IssueCertificate(user, password)
+		if err != nil {
+			log.Printf("[医生证书] 补发证书失败 - 医生ID: %d, 错误: %v", user.ID, err)
+		}
+		return unlocked
+	}
+
+	priv, err := crypto.OpenSM2PrivateKey(cert.EncryptedPrivateKey, password)
+	if err != nil {
+		log.Printf("[医生证书] 解锁私钥失败 - 医生ID: %d, 错误: %v", user.ID, err)
+		return nil
+	}
+	return &unlockedDoctorKey{key: priv, keyID: cert.KeyID}
+}
+
+// RewrapPrivateKey 医生修改密码后使用新口令重新加密私钥
+func (s *DoctorCertService) RewrapPrivateKey(doctorID int64, oldPassword, newPassword string) error {
+	cert, err := s.certRepo.FindActiveByDoctorID(doctorID)
+	if err != nil {
+		return nil // 无有效证书，下次登录时补发
+	}
+
+	priv, err := crypto.OpenSM2PrivateKey(cert.EncryptedPrivateKey, oldPassword)
+	if err != nil {
+		return err
+	}
+	sealed, err := crypto.SealSM2PrivateKey(priv, newPassword)
+	if err != nil {
+		return err
+	}
+
+	cert.EncryptedPrivateKey = sealed
+	return s.certRepo.Update(cert)
+}
+
+// RevokeCertificates 吊销医生的全部有效证书并清除已解锁的私钥
+func (s *DoctorCertService) RevokeCertificates(doctorID int64, reason string) error {
+	dropDoctorSigningKey(doctorID)
+
+	count, err := s.certRepo.RevokeByDoctorID(doctorID, reason, time.Now())
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("[医生证书] 吊销证书 - 医生ID: %d, 数量: %d, 原因: %s", doctorID, count, reason)
+	}
+	return nil
+}
+
+// GetDoctorCertificate 获取医生当前有效证书（公开信息）
+func (s *DoctorCertService) GetDoctorCertificate(doctorID int64) (map[string]interface{}, error) {
+	user, err := s.userRepo.FindByID(doctorID)
+	if err != nil || user.Role != "doctor" {
+		return nil, errors.New("医生不存在")
+	}
+
+	cert, err := s.certRepo.FindActiveByDoctorID(doctorID)
+	if err != nil {
+		return nil, errors.New("该医生暂无有效证书")
+	}
+
+	_, caPEM, err := crypto.CACertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"doctorId":       cert.DoctorID,
+		"serialNumber":   cert.SerialNumber,
+		"keyId":          cert.KeyID,
+		"publicKey":      cert.PublicKey,
+		"certificatePem": cert.CertificatePEM,
+		"caCertificate":  caPEM,
+		"status":         cert.Status,
+		"notBefore":      cert.NotBefore.Format("2006-01-02 15:04:05"),
+		"notAfter":       cert.NotAfter.Format("2006-01-02 15:04:05"),
+	}, nil
+}
+
+// resolveCertificate 根据签名密钥标识查找医生证书，并校验证书在签名时刻有效
+func (s *DoctorCertService) resolveCertificate(keyID string, signedAt time.Time) (*sm2.PublicKey, *model.DoctorCertificate, error) {
+	cert, err := s.certRepo.FindByKeyID(keyID)
+	if err != nil {
+		return nil, nil, errors.New("未知的签名密钥: " + keyID)
+	}
+
+	// 吊销前签署的文档仍然有效，吊销后签署的视为无效
+	if cert.Status == "revoked" && cert.RevokedAt != nil && !signedAt.Before(*cert.RevokedAt) {
+		return nil, cert, errors.New("签名证书已于 " + cert.RevokedAt.Format("2006-01-02 15:04:05") + " 吊销")
+	}
+
+	pub, err := crypto.VerifyDoctorCertificate(cert.CertificatePEM, signedAt)
+	if err != nil {
+		return nil, cert, err
+	}
+	return pub, cert, nil
+}
+
+// doctorSigningKey 获取医生已解锁的签名私钥，至少有一个持有私钥的会话仍然有效
+func doctorSigningKey(doctorID int64) (*sm2.PrivateKey, string, bool) {
+	doctorSigningKeys.RLock()
+	defer doctorSigningKeys.RUnlock()
+
+	entry, ok := doctorSigningKeys.keys[doctorID]
+	if !ok {
+		return nil, "", false
+	}
+	now := time.Now()
+	for sessionID, expiresAt := range entry.sessions {
+		if now.Before(expiresAt) && !IsSessionRevoked(sessionID) {
+			return entry.key, entry.keyID, true
+		}
+	}
+	return nil, "", false
+}
+
+// cacheDoctorSigningKey 缓存医生已解锁的私钥，由登录会话持有直到会话过期
+func cacheDoctorSigningKey(doctorID int64, sessionID string, expiresAt time.Time, unlocked *unlockedDoctorKey) {
+	doctorSigningKeys.Lock()
+	defer doctorSigningKeys.Unlock()
+
+	entry, ok := doctorSigningKeys.keys[doctorID]
+	if !ok || entry.keyID != unlocked.keyID {
+		entry = &cachedDoctorKey{unlockedDoctorKey: unlocked, sessions: make(map[string]time.Time)}
+		doctorSigningKeys.keys[doctorID] = entry
+	}
+	now := time.Now()
+	for id, exp := range entry.sessions {
+		if now.After(exp) {
+			delete(entry.sessions, id)
+		}
+	}
+	entry.sessions[sessionID] = expiresAt
+}
+
+// releaseDoctorSigningKey 会话退出或吊销后释放其持有的私钥，没有会话持有时清除
+func releaseDoctorSigningKey(doctorID int64, sessionID string) {
+	doctorSigningKeys.Lock()
+	defer doctorSigningKeys.Unlock()
+
+	entry, ok := doctorSigningKeys.keys[doctorID]
+	if !ok {
+		return
+	}
+	delete(entry.sessions, sessionID)
+	if len(entry.sessions) == 0 {
+		delete(doctorSigningKeys.keys, doctorID)
+	}
+}
+
+// dropDoctorSigningKey 清除医生已解锁的私钥
+func dropDoctorSigningKey(doctorID int64) {
+	doctorSigningKeys.Lock()
+	delete(doctorSigningKeys.keys, doctorID)
+	doctorSigningKeys.Unlock()
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sm-medical/pkg/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 安全事件类型
+const (
+	EventImpossibleTravel   = "impossible_travel"   // 不可能的移动：两次登录地点距离过远、间隔过短
+	EventNewDevice          = "new_device"          // 新设备登录
+	EventCredentialStuffing = "credential_stuffing" // 撞库：短时间内大量不同用户名登录失败
+	EventOffHoursAdmin      = "off_hours_admin"     // 管理员非工作时间登录
+)
+
+// 安全事件级别
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// 安全事件处理状态
+const (
+	SecurityEventOpen          = 0
+	SecurityEventConfirmed     = 1
+	SecurityEventFalsePositive = 2
+)
+
+// stuffingGlobalSubject 全站撞库事件的去重标识
+const stuffingGlobalSubject = "global"
+
+// earthRadiusKm 地球平均半径
+const earthRadiusKm = 6371.0
+
+// stuffingMu 撞库检测串行执行，避免并发的失败登录重复生成事件
+var stuffingMu sync.Mutex
+
+// LoginAnomalyDetector 登录异常检测：不可能的移动、新设备、撞库、管理员非工作时间登录
+// 发现异常时记录安全事件并给受影响的用户发送站内通知
+type LoginAnomalyDetector struct {
+	loginLogRepo        *repository.LoginLogRepository
+	eventRepo           *repository.SecurityEventRepository
+	notificationService *NotificationService
+}
+
+func NewLoginAnomalyDetector() *LoginAnomalyDetector {
+	return &LoginAnomalyDetector{
+		loginLogRepo:        repository.NewLoginLogRepository(),
+		eventRepo:           repository.NewSecurityEventRepository(),
+		notificationService: NewNotificationService(),
+	}
+}
+
+// Inspect 检查一条登录日志，role为登录用户的角色（账号不存在时为空）
+func (d *LoginAnomalyDetector) Inspect(entry *model.LoginLog, role string) {
+	cfg := loginAnomalyConfig()
+	if cfg.Disabled {
+		return
+	}
+
+	if entry.Status != 1 {
+		d.checkCredentialStuffing(entry, cfg)
+		return
+	}
+	if entry.UserID == nil {
+		return
+	}
+
+	since := entry.LoginTime.AddDate(0, 0, -cfg.NewDeviceLookbackDays)
+	history, err := d.loginLogRepo.FindRecentSuccess(*entry.UserID, since, entry.ID, 100)
+	if err != nil {
+		log.Printf("[异常检测] 查询登录历史失败 - 用户ID: %d, 错误: %v", *entry.UserID, err)
+		return
+	}
+
+	d.checkNewDevice(entry, history)
+	if len(history) > 0 {
+		d.checkImpossibleTravel(entry, &history[0], cfg)
+	}
+	if role == "admin" {
+		d.checkOffHoursAdmin(entry, cfg)
+	}
+}
+
+// checkNewDevice 浏览器和操作系统与历史成功登录都不同时视为新设备，首次登录不提醒
+func (d *LoginAnomalyDetector) checkNewDevice(entry *model.LoginLog, history []model.LoginLog) {
+	if len(history) == 0 {
+		return
+	}
+	current := deviceKey(entry.Browser, entry.OS)
+	for _, h := range history {
+		if deviceKey(h.Browser, h.OS) == current {
+			return
+		}
+	}
+
+	detail := fmt.Sprintf("首次使用 %s / %s 登录", entry.Browser, entry.OS)
+	d.raise(entry, EventNewDevice, SeverityLow, "", detail,
+		"新设备登录提醒",
+		fmt.Sprintf("您的账号于 %s 在新设备（%s / %s）上登录%s。如非本人操作，请立即修改密码，并在“登录设备”中下线该设备。",
+			entry.LoginTime.Format("2006-01-02 15:04:05"), entry.Browser, entry.OS, locationSuffix(entry.LoginLocation)))
+}
+
+// checkImpossibleTravel 与上一次成功登录比较，两地距离除以时间间隔超过最大速度时告警
+func (d *LoginAnomalyDetector) checkImpossibleTravel(entry, previous *model.LoginLog, cfg config.LoginAnomalyConfig) {
+	from, ok := LocateIP(previous.LoginIP)
+	if !ok || !from.HasCoords {
+		return
+	}
+	to, ok := LocateIP(entry.LoginIP)
+	if !ok || !to.HasCoords {
+		return
+	}
+
+	distance := haversineKm(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+	if distance < cfg.MinDistanceKm {
+		return
+	}
+	hours := entry.LoginTime.Sub(previous.LoginTime).Hours()
+	speed := math.Inf(1)
+	if hours > 0 {
+		speed = distance / hours
+	}
+	if speed <= cfg.MaxSpeedKmh {
+		return
+	}
+
+	detail := fmt.Sprintf("%s 在%s登录，%s 在%s登录，相距约%.0f公里，间隔%s",
+		previous.LoginTime.Format("2006-01-02 15:04:05"), from.Name,
+		entry.LoginTime.Format("2006-01-02 15:04:05"), to.Name,
+		distance, entry.LoginTime.Sub(previous.LoginTime).Round(time.Minute))
+	d.raise(entry, EventImpossibleTravel, SeverityHigh, "", detail,
+		"异地登录提醒",
+		fmt.Sprintf("您的账号在短时间内先后于%s和%s登录（%s）。如非本人操作，账号密码可能已泄露，请立即修改密码并下线陌生设备。",
+			from.Name, to.Name, entry.LoginTime.Format("2006-01-02 15:04:05")))
+}
+
+// checkOffHoursAdmin 管理员在工作时间之外登录
+func (d *LoginAnomalyDetector) checkOffHoursAdmin(entry *model.LoginLog, cfg config.LoginAnomalyConfig) {
+	start, end := cfg.AdminWorkStartHour, cfg.AdminWorkEndHour
+	if end <= start {
+		return
+	}
+	hour := entry.LoginTime.Hour()
+	if hour >= start && hour < end {
+		return
+	}
+
+	detail := fmt.Sprintf("管理员于 %s 登录，不在工作时间 %02d:00-%02d:00 内", entry.LoginTime.Format("2006-01-02 15:04:05"), start, end)
+	d.raise(entry, EventOffHoursAdmin, SeverityMedium, "", detail,
+		"非工作时间登录提醒",
+		fmt.Sprintf("您的管理员账号于 %s 登录%s，不在工作时间内。如非本人操作，请立即修改密码并联系其他管理员。",
+			entry.LoginTime.Format("2006-01-02 15:04:05"), locationSuffix(entry.LoginLocation)))
+}
+
+// checkCredentialStuffing 窗口内同一IP或全站登录失败涉及的不同用户名数超过阈值时告警
+// 同一IP（或全站）在窗口内只记录一次，涉及的已存在账号各收到一条通知
+func (d *LoginAnomalyDetector) checkCredentialStuffing(entry *model.LoginLog, cfg config.LoginAnomalyConfig) {
+	stuffingMu.Lock()
+	defer stuffingMu.Unlock()
+
+	window := time.Duration(cfg.StuffingWindowMinutes) * time.Minute
+	since := entry.LoginTime.Add(-window)
+
+	checks := []struct {
+		ipBidx    string
+		subject   string
+		threshold int
+		scope     string
+	}{
+		{entry.IPBidx, entry.IPBidx, cfg.StuffingIPUsernames, "同一IP"},
+		{"", stuffingGlobalSubject, cfg.StuffingGlobalUsernames, "全站"},
+	}
+	for _, c := range checks {
+		if c.subject == "" {
+			continue
+		}
+		count, err := d.loginLogRepo.CountFailedUsernames(c.ipBidx, since)
+		if err != nil {
+			log.Printf("[异常检测] 统计登录失败失败 - 错误: %v", err)
+			return
+		}
+		if count < int64(c.threshold) {
+			continue
+		}
+		if exists, err := d.eventRepo.ExistsSince(EventCredentialStuffing, c.subject, since); err != nil || exists {
+			continue
+		}
+
+		event := &model.SecurityEvent{
+			EventType: EventCredentialStuffing,
+			Severity:  SeverityHigh,
+			Subject:   c.subject,
+			Detail:    fmt.Sprintf("%d分钟内%s登录失败涉及%d个不同用户名", cfg.StuffingWindowMinutes, c.scope, count),
+		}
+		if c.ipBidx != "" {
+			event.IP = entry.LoginIP
+			event.Location = entry.LoginLocation
+			event.LoginLogID = &entry.ID
+		}
+		if err := d.eventRepo.Create(event); err != nil {
+			log.Printf("[异常检测] 保存安全事件失败 - 类型: %s, 错误: %v", event.EventType, err)
+			return
+		}
+		log.Printf("[异常检测] 疑似撞库 - 事件ID: %d, %s", event.ID, event.Detail)
+
+		userIDs, err := d.loginLogRepo.FindFailedUserIDs(c.ipBidx, since)
+		if err != nil {
+			log.Printf("[异常检测] 查询受影响账号失败 - 事件ID: %d, 错误: %v", event.ID, err)
+			continue
+		}
+		for _, userID := range userIDs {
+			d.notify(userID, event.ID, "账号安全提醒",
+				"近期检测到针对大量账号的批量登录尝试，您的账号也在其中，登录均已失败。建议您修改为未在其他网站使用过的密码，并启用两步验证。")
+		}
+	}
+}
+
+// raise 记录针对单个用户的安全事件并通知该用户
+func (d *LoginAnomalyDetector) raise(entry *model.LoginLog, eventType, severity, subject, detail, title, content string) {
+	event := &model.SecurityEvent{
+		EventType:  eventType,
+		Severity:   severity,
+		UserID:     entry.UserID,
+		Username:   entry.Username,
+		LoginLogID: &entry.ID,
+		Subject:    subject,
+		IP:         entry.LoginIP,
+		Location:   entry.LoginLocation,
+		Detail:     detail,
+	}
+	if err := d.eventRepo.Create(event); err != nil {
+		log.Printf("[异常检测] 保存安全事件失败 - 类型: %s, 用户ID: %d, 错误: %v", eventType, *entry.UserID, err)
+		return
+	}
+	log.Printf("[异常检测] %s - 事件ID: %d, 用户ID: %d, %s", eventType, event.ID, *entry.UserID, detail)
+	d.notify(*entry.UserID, event.ID, title, content)
+}
+
+// notify 发送安全提醒通知
+func (d *LoginAnomalyDetector) notify(userID, eventID int64, title, content string) {
+	if err := d.notificationService.Notify(userID, "system", title, content, &eventID, "security_event"); err != nil {
+		log.Printf("[异常检测] 发送通知失败 - 用户ID: %d, 错误: %v", userID, err)
+	}
+}
+
+// IPLocationInfo IP所在地
+type IPLocationInfo struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+	HasCoords bool // 内网地址没有坐标，不参与不可能的移动判断
+}
+
+type ipLocationRange struct {
+	network *net.IPNet
+	info    IPLocationInfo
+}
+
+var (
+	ipLocationsOnce sync.Once
+	ipLocations     []ipLocationRange
+)
+
+// LocateIP 按 login_anomaly.ip_locations 配置查询IP所在地，内网和本机地址返回“内网”
+func LocateIP(ip string) (IPLocationInfo, bool) {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return IPLocationInfo{}, false
+	}
+
+	ipLocationsOnce.Do(loadIPLocations)
+	for _, r := range ipLocations {
+		if r.network.Contains(parsed) {
+			return r.info, true
+		}
+	}
+	if parsed.IsLoopback() || parsed.IsPrivate() {
+		return IPLocationInfo{Name: "内网"}, true
+	}
+	return IPLocationInfo{}, false
+}
+
+// loadIPLocations 解析IP段配置，格式错误的条目跳过
+func loadIPLocations() {
+	for _, l := range loginAnomalyConfig().IPLocations {
+		_, network, err := net.ParseCIDR(l.CIDR)
+		if err != nil {
+			log.Printf("[异常检测] IP段格式错误，已跳过: %s", l.CIDR)
+			continue
+		}
+		ipLocations = append(ipLocations, ipLocationRange{
+			network: network,
+			info:    IPLocationInfo{Name: l.Name, Latitude: l.Latitude, Longitude: l.Longitude, HasCoords: true},
+		})
+	}
+}
+
+// loginAnomalyConfig 登录异常检测配置，未配置的项使用默认值
+func loginAnomalyConfig() config.LoginAnomalyConfig {
+	var cfg config.LoginAnomalyConfig
+	if config.AppConfig != nil {
+		cfg = config.AppConfig.LoginAnomaly
+	}
+	if cfg.MaxSpeedKmh <= 0 {
+		cfg.MaxSpeedKmh = 900
+	}
+	if cfg.MinDistanceKm <= 0 {
+		cfg.MinDistanceKm = 300
+	}
+	if cfg.NewDeviceLookbackDays <= 0 {
+		cfg.NewDeviceLookbackDays = 90
+	}
+	if cfg.StuffingWindowMinutes <= 0 {
+		cfg.StuffingWindowMinutes = 10
+	}
+	if cfg.StuffingIPUsernames <= 0 {
+		cfg.StuffingIPUsernames = 10
+	}
+	if cfg.StuffingGlobalUsernames <= 0 {
+		cfg.StuffingGlobalUsernames = 100
+	}
+	if cfg.AdminWorkStartHour == 0 && cfg.AdminWorkEndHour == 0 {
+		cfg.AdminWorkStartHour, cfg.AdminWorkEndHour = 8, 20
+	}
+	return cfg
+}
+
+// deviceKey 设备标识：浏览器和操作系统名称，忽略版本号避免升级后误报
+func deviceKey(browser, os string) string {
+	return nameWithoutVersion(browser) + "|" + nameWithoutVersion(os)
+}
+
+// nameWithoutVersion 去掉 ParseUserAgent 结果中的版本号，如 "Chrome 120" -> "Chrome"
+func nameWithoutVersion(s string) string {
+	if i := strings.Index(s, " "); i > 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// locationSuffix 通知中的登录地点
+func locationSuffix(location string) string {
+	if location == "" {
+		return ""
+	}
+	return "（" + location + "）"
+}
+
+// haversineKm 两个经纬度之间的球面距离
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sm-medical/pkg/config"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 登录锁定统计范围
+const (
+	LockScopeAccount = "account"
+	LockScopeIP      = "ip"
+)
+
+// LoginLockedError 账号或IP处于渐进延迟或锁定中
+type LoginLockedError struct {
+	Scope      string
+	RetryAfter time.Duration
+	Locked     bool // true为锁定，false为渐进延迟
+}
+
+func (e *LoginLockedError) Error() string {
+	wait := retryAfterText(e.RetryAfter)
+	switch {
+	case e.Locked && e.Scope == LockScopeIP:
+		return "登录失败次数过多，当前IP已被临时锁定，请" + wait + "后再试"
+	case e.Locked:
+		return "登录失败次数过多，账号已被临时锁定，请" + wait + "后再试或联系管理员解锁"
+	default:
+		return "登录失败次数过多，请" + wait + "后再试"
+	}
+}
+
+// LoginGuard 登录防暴力破解：按账号和IP统计连续失败次数，超过阈值后渐进延迟，达到上限后临时锁定
+type LoginGuard struct {
+	repo *repository.LoginLockoutRepository
+}
+
+func NewLoginGuard() *LoginGuard {
+	return &LoginGuard{
+		repo: repository.NewLoginLockoutRepository(),
+	}
+}
+
+// CheckIP 检查IP是否允许尝试登录
+func (g *LoginGuard) CheckIP(ip string) error {
+	return g.check(LockScopeIP, ipSubject(ip))
+}
+
+// CheckAccount 检查账号是否允许尝试登录
+func (g *LoginGuard) CheckAccount(userID int64) error {
+	return g.check(LockScopeAccount, accountSubject(userID))
+}
+
+// RecordFailure 记录一次登录失败，userID为0表示账号不存在，只统计IP
+func (g *LoginGuard) RecordFailure(userID int64, ip string) {
+	cfg := loginGuardConfig()
+	if subject := ipSubject(ip); subject != "" {
+		g.recordFailure(LockScopeIP, subject, nil, cfg.IPDelayAfter, cfg.IPMaxFailures)
+	}
+	if userID > 0 {
+		g.recordFailure(LockScopeAccount, accountSubject(userID), &userID, cfg.DelayAfter, cfg.MaxFailures)
+	}
+}
+
+// RecordSuccess 登录成功后清除账号的失败计数；IP计数不清除，避免攻击者用自己的账号重置
+func (g *LoginGuard) RecordSuccess(userID int64) {
+	if _, err := g.repo.Delete(LockScopeAccount, accountSubject(userID)); err != nil {
+		log.Printf("[登录保护] 清除失败计数失败 - 用户ID: %d, 错误: %v", userID, err)
+	}
+}
+
+// Unlock 管理员解锁账号或IP
+func (g *LoginGuard) Unlock(userID int64, ip string) (int64, error) {
+	var total int64
+	if userID > 0 {
+		n, err := g.repo.Delete(LockScopeAccount, accountSubject(userID))
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	if subject := ipSubject(ip); subject != "" {
+		n, err := g.repo.Delete(LockScopeIP, subject)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// LockedSubjects 查询锁定中的账号（用户ID -> 截止时间）和IP（盲索引 -> 截止时间）
+func (g *LoginGuard) LockedSubjects() (map[int64]time.Time, map[string]time.Time, error) {
+	list, err := g.repo.FindLocked()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accounts := make(map[int64]time.Time)
+	ips := make(map[string]time.Time)
+	for _, l := range list {
+		switch {
+		case l.Scope == LockScopeAccount && l.UserID != nil:
+			accounts[*l.UserID] = *l.LockedUntil
+		case l.Scope == LockScopeIP:
+			ips[l.Subject] = *l.LockedUntil
+		}
+	}
+	return accounts, ips, nil
+}
+
+// check 检查锁定和渐进延迟
+func (g *LoginGuard) check(scope, subject string) error {
+	if subject == "" {
+		return nil
+	}
+	lockout, err := g.repo.Find(scope, subject)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[登录保护] 查询失败计数失败 - 范围: %s, 错误: %v", scope, err)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	if lockout.LockedUntil != nil && now.Before(*lockout.LockedUntil) {
+		return &LoginLockedError{Scope: scope, RetryAfter: lockout.LockedUntil.Sub(now), Locked: true}
+	}
+	if lockout.NextAttemptAt != nil && now.Before(*lockout.NextAttemptAt) {
+		return &LoginLockedError{Scope: scope, RetryAfter: lockout.NextAttemptAt.Sub(now)}
+	}
+	return nil
+}
+
+// recordFailure 增加失败计数，超过delayAfter后按2的幂延迟，达到maxFailures后锁定
+func (g *LoginGuard) recordFailure(scope, subject string, userID *int64, delayAfter, maxFailures int) {
+	cfg := loginGuardConfig()
+	now := time.Now()
+
+	lockout, err := g.repo.Find(scope, subject)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[登录保护] 查询失败计数失败 - 范围: %s, 错误: %v", scope, err)
+			return
+		}
+		lockout = &model.LoginLockout{Scope: scope, Subject: subject, UserID: userID}
+	}
+
+	// 超过统计窗口或锁定已到期，重新计数
+	window := time.Duration(cfg.WindowMinutes) * time.Minute
+	if now.Sub(lockout.LastFailureAt) > window || (lockout.LockedUntil != nil && now.After(*lockout.LockedUntil)) {
+		lockout.Failures = 0
+		lockout.LockedUntil = nil
+		lockout.NextAttemptAt = nil
+	}
+
+	lockout.Failures++
+	lockout.LastFailureAt = now
+
+	if lockout.Failures >= maxFailures {
+		until := now.Add(time.Duration(cfg.LockMinutes) * time.Minute)
+		lockout.LockedUntil = &until
+		lockout.NextAttemptAt = nil
+		log.Printf("[登录保护] 连续失败 %d 次，临时锁定 - 范围: %s, 标识: %s, 截止: %s",
+			lockout.Failures, scope, subject, until.Format("2006-01-02 15:04:05"))
+	} else if lockout.Failures > delayAfter {
+		max := time.Duration(cfg.MaxDelaySeconds) * time.Second
+		delay := max
+		if shift := lockout.Failures - delayAfter; shift < 16 && time.Second<<uint(shift) < max {
+			delay = time.Second << uint(shift)
+		}
+		next := now.Add(delay)
+		lockout.NextAttemptAt = &next
+	}
+
+	if err := g.repo.Save(lockout); err != nil {
+		log.Printf("[登录保护] 保存失败计数失败 - 范围: %s, 错误: %v", scope, err)
+	}
+}
+
+// loginGuardConfig 登录保护配置，未配置的项使用默认值
+func loginGuardConfig() config.LoginGuardConfig {
+	var cfg config.LoginGuardConfig
+	if config.AppConfig != nil {
+		cfg = config.AppConfig.LoginGuard
+	}
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = 5
+	}
+	if cfg.IPMaxFailures <= 0 {
+		cfg.IPMaxFailures = 20
+	}
+	if cfg.DelayAfter <= 0 {
+		cfg.DelayAfter = 2
+	}
+	if cfg.IPDelayAfter <= 0 {
+		cfg.IPDelayAfter = 10
+	}
+	if cfg.MaxDelaySeconds <= 0 {
+		cfg.MaxDelaySeconds = 30
+	}
+	if cfg.LockMinutes <= 0 {
+		cfg.LockMinutes = 15
+	}
+	if cfg.WindowMinutes <= 0 {
+		cfg.WindowMinutes = 15
+	}
+	return cfg
+}
+
+// accountSubject 账号锁定标识
+func accountSubject(userID int64) string {
+	return strconv.FormatInt(userID, 10)
+}
+
+// ipSubject IP锁定标识，使用盲索引避免保存明文IP
+func ipSubject(ip string) string {
+	return crypto.BlindIndex(crypto.BlindIndexIP, ip)
+}
+
+// retryAfterText 等待时间的中文描述
+func retryAfterText(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d秒", int(d.Seconds())+1)
+	}
+	return fmt.Sprintf("%d分钟", int(d.Minutes())+1)
+}
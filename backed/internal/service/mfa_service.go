@@ -0,0 +1,425 @@
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sm-medical/pkg/config"
+	"sm-medical/pkg/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 登录第二步凭证阶段
+const (
+	MFAStageVerify = "verify" // 已启用两步验证，提交动态口令或恢复码
+	MFAStageEnroll = "enroll" // 角色强制两步验证但尚未绑定，先绑定再提交动态口令
+)
+
+const (
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// maxMFAAttempts 每个登录第二步凭证允许的错误次数
+	maxMFAAttempts = 5
+	// defaultMFAChallengeTTL 登录第二步凭证默认有效期
+	defaultMFAChallengeTTL = 5 * time.Minute
+)
+
+var (
+	ErrMFAChallengeInvalid = errors.New("验证已过期，请重新登录")
+	ErrMFACodeInvalid      = errors.New("动态口令或恢复码错误")
+	ErrMFANotEnabled       = errors.New("未启用两步验证")
+)
+
+// MFAService TOTP两步验证服务
+type MFAService struct {
+	mfaRepo  *repository.MFARepository
+	userRepo *repository.UserRepository
+}
+
+func NewMFAService() *MFAService {
+	return &MFAService{
+		mfaRepo:  repository.NewMFARepository(),
+		userRepo: repository.NewUserRepository(),
+	}
+}
+
+// RequiredForRole 角色是否强制两步验证
+func RequiredForRole(role string) bool {
+	if config.AppConfig == nil {
+		return false
+	}
+	for _, r := range config.AppConfig.MFA.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// LoginChallenge 密码校验通过后判断是否需要两步验证，需要时返回第二步凭证，不需要时返回nil
+// signingKey 为第一步已解锁的医生签名私钥，随凭证保存到第二步通过
+func (s *MFAService) LoginChallenge(user *model.User, signingKey *unlockedDoctorKey) (map[string]interface{}, error) {
+	stage := ""
+	mfa, err := s.mfaRepo.FindByUserID(user.ID)
+	switch {
+	case err == nil && mfa.Enabled:
+		stage = MFAStageVerify
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	case RequiredForRole(user.Role):
+		stage = MFAStageEnroll
+	default:
+		return nil, nil
+	}
+
+	tokenID, err := randomToken(16, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	ttl := mfaChallengeTTL()
+	token, err := utils.GenerateMFAToken(user.ID, stage, tokenID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	mfaChallenges.add(tokenID, time.Now().Add(ttl), signingKey)
+
+	return map[string]interface{}{
+		"mfaRequired":      true,
+		"mfaSetupRequired": stage == MFAStageEnroll,
+		"mfaToken":         token,
+		"expiresIn":        int(ttl.Seconds()),
+	}, nil
+}
+
+// SetupLoginEnrollment 强制两步验证的用户在登录过程中生成待绑定的密钥
+func (s *MFAService) SetupLoginEnrollment(mfaToken string) (map[string]interface{}, error) {
+	claims, err := s.parseChallenge(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Stage != MFAStageEnroll {
+		return nil, errors.New("已绑定两步验证，请直接输入动态口令")
+	}
+	return s.Setup(claims.UserID)
+}
+
+// VerifyLoginChallenge 校验登录第二步，返回用户和第一步解锁的医生签名私钥；强制绑定时同时启用两步验证并返回恢复码
+// 凭证有效但口令错误时同时返回用户和错误，供调用方记录失败
+func (s *MFAService) VerifyLoginChallenge(mfaToken, code string) (*model.User, *unlockedDoctorKey, []string, error) {
+	claims, err := s.parseChallenge(mfaToken)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !mfaChallenges.attempt(claims.ID) {
+		return nil, nil, nil, ErrMFAChallengeInvalid
+	}
+
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		mfaChallenges.fail(claims.ID)
+		return nil, nil, nil, ErrMFAChallengeInvalid
+	}
+
+	var recoveryCodes []string
+	if claims.Stage == MFAStageEnroll {
+		recoveryCodes, err = s.Enable(user.ID, code)
+	} else {
+		err = s.verifyCode(user.ID, code, true)
+	}
+	if err != nil {
+		log.Printf("[两步验证] 登录校验失败 - 用户ID: %d, 错误: %v", user.ID, err)
+		mfaChallenges.fail(claims.ID)
+		return user, nil, nil, err
+	}
+
+	signingKey := mfaChallenges.finish(claims.ID)
+	return user, signingKey, recoveryCodes, nil
+}
+
+// Status 查询两步验证状态
+func (s *MFAService) Status(userID int64, role string) (map[string]interface{}, error) {
+	result := map[string]interface{}{
+		"enabled":  false,
+		"required": RequiredForRole(role),
+	}
+
+	mfa, err := s.mfaRepo.FindByUserID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result["enabled"] = mfa.Enabled
+	if mfa.Enabled {
+		remaining, _ := s.mfaRepo.CountUnusedRecoveryCodes(userID)
+		result["recoveryCodesRemaining"] = remaining
+		if mfa.EnabledAt != nil {
+			result["enabledAt"] = mfa.EnabledAt.Format("2006-01-02 15:04:05")
+		}
+	}
+	return result, nil
+}
+
+// Setup 生成待绑定的TOTP密钥，校验动态口令后才启用；已启用时需先关闭
+func (s *MFAService) Setup(userID int64) (map[string]interface{}, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	mfa, err := s.mfaRepo.FindByUserID(userID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		mfa = &model.UserMFA{UserID: userID}
+	case err != nil:
+		return nil, err
+	case mfa.Enabled:
+		return nil, errors.New("已启用两步验证")
+	}
+
+	secret, err := crypto.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	mfa.Secret = secret
+	if err := s.mfaRepo.Save(mfa); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"secret":     secret,
+		"otpauthUrl": crypto.TOTPURI(mfaIssuer(), user.Username, secret),
+	}, nil
+}
+
+// Enable 校验身份验证器生成的动态口令后启用两步验证，返回恢复码（只显示一次）
+func (s *MFAService) Enable(userID int64, code string) ([]string, error) {
+	mfa, err := s.mfaRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, errors.New("请先生成两步验证密钥")
+	}
+	if mfa.Enabled {
+		return nil, errors.New("已启用两步验证")
+	}
+
+	step, ok := crypto.ValidateTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrMFACodeInvalid
+	}
+
+	codes, err := s.newRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.EnabledAt = &now
+	mfa.LastUsedStep = step
+	if err := s.mfaRepo.Save(mfa); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[两步验证] 已启用 - 用户ID: %d", userID)
+	return codes, nil
+}
+
+// Disable 关闭两步验证，需提交动态口令或恢复码；强制两步验证的角色不能关闭
+func (s *MFAService) Disable(userID int64, role, code string) error {
+	if RequiredForRole(role) {
+		return errors.New("当前角色必须启用两步验证")
+	}
+	if err := s.verifyCode(userID, code, true); err != nil {
+		return err
+	}
+	if err := s.mfaRepo.Delete(userID); err != nil {
+		return err
+	}
+
+	log.Printf("[两步验证] 已关闭 - 用户ID: %d", userID)
+	return nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部作废
+func (s *MFAService) RegenerateRecoveryCodes(userID int64, code string) ([]string, error) {
+	if err := s.verifyCode(userID, code, false); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(userID)
+}
+
+// Reset 管理员为丢失身份验证器和恢复码的用户重置两步验证，用户下次登录时重新绑定
+func (s *MFAService) Reset(adminID, userID int64) error {
+	if _, err := s.userRepo.FindByID(userID); err != nil {
+		return errors.New("用户不存在")
+	}
+	if err := s.mfaRepo.Delete(userID); err != nil {
+		return err
+	}
+
+	log.Printf("[两步验证] 管理员重置 - 管理员ID: %d, 用户ID: %d", adminID, userID)
+	return nil
+}
+
+// verifyCode 校验动态口令，allowRecovery为true时也接受恢复码
+func (s *MFAService) verifyCode(userID int64, code string, allowRecovery bool) error {
+	mfa, err := s.mfaRepo.FindByUserID(userID)
+	if err != nil || !mfa.Enabled {
+		return ErrMFANotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := crypto.ValidateTOTP(mfa.Secret, code, time.Now()); ok {
+		fresh, err := s.mfaRepo.UpdateLastUsedStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return errors.New("动态口令已使用，请等待下一个口令")
+		}
+		return nil
+	}
+
+	if allowRecovery {
+		used, err := s.mfaRepo.UseRecoveryCode(userID, recoveryCodeHash(userID, code))
+		if err != nil {
+			return err
+		}
+		if used {
+			log.Printf("[两步验证] 使用恢复码 - 用户ID: %d", userID)
+			return nil
+		}
+	}
+	return ErrMFACodeInvalid
+}
+
+// newRecoveryCodes 生成并保存恢复码，格式 xxxxx-xxxxx
+func (s *MFAService) newRecoveryCodes(userID int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomToken(5, hex.EncodeToString)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, recoveryCodeHash(userID, code))
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// parseChallenge 解析登录第二步凭证，已使用或错误次数过多的凭证无效
+func (s *MFAService) parseChallenge(mfaToken string) (*utils.MFAClaims, error) {
+	claims, err := utils.ParseMFAToken(mfaToken)
+	if err != nil || !mfaChallenges.valid(claims.ID) {
+		return nil, ErrMFAChallengeInvalid
+	}
+	return claims, nil
+}
+
+// recoveryCodeHash 恢复码哈希，与用户ID绑定
+func recoveryCodeHash(userID int64, code string) string {
+	return crypto.SM3HashWithSalt(strings.ToLower(code), strconv.FormatInt(userID, 10))
+}
+
+// mfaIssuer 身份验证器App中显示的发行方
+func mfaIssuer() string {
+	if config.AppConfig != nil && config.AppConfig.MFA.Issuer != "" {
+		return config.AppConfig.MFA.Issuer
+	}
+	return "SM-Medical"
+}
+
+// mfaChallengeTTL 登录第二步凭证有效期
+func mfaChallengeTTL() time.Duration {
+	if config.AppConfig != nil && config.AppConfig.MFA.ChallengeExpiresIn > 0 {
+		return time.Duration(config.AppConfig.MFA.ChallengeExpiresIn) * time.Second
+	}
+	return defaultMFAChallengeTTL
+}
+
+// challengeTracker 登录第二步凭证的使用状态，凭证只能成功使用一次，错误次数过多后作废
+type challengeTracker struct {
+	mu         sync.Mutex
+	challenges map[string]*challengeState
+}
+
+type challengeState struct {
+	attempts   int
+	done       bool
+	expiresAt  time.Time
+	signingKey *unlockedDoctorKey // 第一步已解锁的医生签名私钥，第二步通过后才放入缓存
+}
+
+var mfaChallenges = &challengeTracker{challenges: make(map[string]*challengeState)}
+
+func (t *challengeTracker) add(id string, expiresAt time.Time, signingKey *unlockedDoctorKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for k, c := range t.challenges {
+		if now.After(c.expiresAt) {
+			delete(t.challenges, k)
+		}
+	}
+	t.challenges[id] = &challengeState{expiresAt: expiresAt, signingKey: signingKey}
+}
+
+// valid 凭证是否可用
+func (t *challengeTracker) valid(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.challenges[id]
+	return ok && !c.done && c.attempts < maxMFAAttempts && time.Now().Before(c.expiresAt)
+}
+
+// attempt 记录一次校验，超过次数返回false
+func (t *challengeTracker) attempt(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.challenges[id]
+	if !ok || c.done || c.attempts >= maxMFAAttempts {
+		return false
+	}
+	c.attempts++
+	return true
+}
+
+// fail 校验失败后调用，错误次数用尽时丢弃第一步解锁的医生签名私钥
+func (t *challengeTracker) fail(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.challenges[id]; ok && c.attempts >= maxMFAAttempts {
+		c.signingKey = nil
+	}
+}
+
+// finish 校验成功后作废凭证，取出第一步解锁的医生签名私钥
+func (t *challengeTracker) finish(id string) *unlockedDoctorKey {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.challenges[id]
+	if !ok {
+		return nil
+	}
+	c.done = true
+	signingKey := c.signingKey
+	c.signingKey = nil
+	return signingKey
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"sm-medical/internal/model"
 	"sm-medical/internal/repository"
 	"time"
 )
@@ -15,6 +16,18 @@ func NewNotificationService() *NotificationService {
 	}
 }
 
+// Notify 给用户发送站内通知
+func (s *NotificationService) Notify(userID int64, notifType, title, content string, relatedID *int64, relatedType string) error {
+	return s.repo.Create(&model.Notification{
+		UserID:           userID,
+		NotificationType: notifType,
+		Title:            title,
+		Content:          content,
+		RelatedID:        relatedID,
+		RelatedType:      relatedType,
+	})
+}
+
 // GetList 获取通知列表
 func (s *NotificationService) GetList(userID int64, page, pageSize int, notifType string) ([]map[string]interface{}, int64, error) {
 	notifications, total, err := s.repo.FindByUserID(userID, page, pageSize, notifType)
@@ -3,17 +3,21 @@ package service
 import (
 	"errors"
 	"fmt"
-	"sm-medical/internal/crypto"
+	"log"
 	"sm-medical/internal/model"
 	"sm-medical/internal/repository"
 	"strings"
 	"time"
 )
 
+// PrescriptionStatusVoided 处方状态：已作废（0:待审核,1:已审核,2:已配药,3:已取药,4:已作废）
+const PrescriptionStatusVoided = 4
+
 type PrescriptionService struct {
 	prescriptionRepo *repository.PrescriptionRepository
 	medicineRepo     *repository.MedicineRepository
 	consultationRepo *repository.ConsultationRepository
+	signatureService *SignatureService
 }
 
 func NewPrescriptionService() *PrescriptionService {
@@ -21,6 +25,7 @@ func NewPrescriptionService() *PrescriptionService {
 		prescriptionRepo: repository.NewPrescriptionRepository(),
 		medicineRepo:     repository.NewMedicineRepository(),
 		consultationRepo: repository.NewConsultationRepository(),
+		signatureService: NewSignatureService(),
 	}
 }
 
@@ -39,35 +44,32 @@ func (s *PrescriptionService) CreatePrescription(doctorID, consultationID int64,
 	if len(medicines) == 0 {
 		return nil, errors.New("处方药品不能为空")
 	}
+	if err := requireSigningKey(doctorID); err != nil {
+		return nil, err
+	}
 
 	// 生成处方编号
 	prescriptionNo := fmt.Sprintf("RX%d", time.Now().Unix())
 
-	// 加密诊断
-	encryptedDiagnosis, _ := crypto.SM4Encrypt(diagnosis)
-
 	// 先创建处方主表(不计算总金额,后面更新)
 	prescription := &model.Prescription{
 		PrescriptionNo:   prescriptionNo,
 		ConsultationID:   consultationID,
 		PatientID:        consultation.PatientID,
 		DoctorID:         doctorID,
-		Diagnosis:        encryptedDiagnosis,
+		Diagnosis:        diagnosis, // sm4序列化器加密存储
 		PrescriptionType: 1,
 		TotalAmount:      0, // 先设为0,添加明细后再更新
 		Status:           1, // 已审核(简化流程)
 	}
 
-	// 生成数据哈希(先用临时值)
-	dataForHash := fmt.Sprintf("%d|%s|0", consultationID, diagnosis)
-	prescription.DataHash = crypto.SM3Hash(dataForHash)
-
 	if err := s.prescriptionRepo.Create(prescription); err != nil {
 		return nil, err
 	}
 
 	// 创建处方明细并计算总金额
 	var details []map[string]interface{}
+	var createdDetails []model.PrescriptionDetail
 	var totalAmount float64
 	for _, med := range medicines {
 		medicineID := int64(med["medicineId"].(float64))
@@ -102,6 +104,7 @@ func (s *PrescriptionService) CreatePrescription(doctorID, consultationID int64,
 		}
 
 		if err := s.prescriptionRepo.CreateDetail(detail); err == nil {
+			createdDetails = append(createdDetails, *detail)
 			details = append(details, map[string]interface{}{
 				"medicineName":   detail.MedicineName,
 				"specification":  detail.Specification,
@@ -118,6 +121,12 @@ func (s *PrescriptionService) CreatePrescription(doctorID, consultationID int64,
 	
 	// 更新处方总金额
 	prescription.TotalAmount = totalAmount
+
+	// SM2签名(覆盖处方主表和明细)
+	if err := s.signatureService.SignPrescription(prescription, createdDetails); err != nil {
+		return nil, errors.New("处方签名失败: " + err.Error())
+	}
+
 	if err := s.prescriptionRepo.Update(prescription); err != nil {
 		return nil, err
 	}
@@ -134,22 +143,42 @@ func (s *PrescriptionService) CreatePrescription(doctorID, consultationID int64,
 }
 
 // GetPrescriptionDetail 获取处方详情
-func (s *PrescriptionService) GetPrescriptionDetail(userID, prescriptionID int64) (map[string]interface{}, error) {
+func (s *PrescriptionService) GetPrescriptionDetail(userID, prescriptionID int64, canReviewAll bool) (map[string]interface{}, error) {
 	prescription, err := s.prescriptionRepo.GetByID(prescriptionID)
 	if err != nil {
 		return nil, errors.New("处方不存在")
 	}
 
-	// 权限检查
-	if prescription.PatientID != userID && prescription.DoctorID != userID {
+	// 权限检查（审方人员可查看全部处方）
+	if !canReviewAll && prescription.PatientID != userID && prescription.DoctorID != userID {
 		return nil, errors.New("无权限访问")
 	}
 
-	// 解密诊断
-	diagnosis, _ := crypto.SM4Decrypt(prescription.Diagnosis)
+	return s.buildPrescriptionDetail(prescription), nil
+}
 
-	// 获取处方明细
-	details, _ := s.prescriptionRepo.GetDetailsByPrescriptionID(prescriptionID)
+// GetByPrescriptionNo 按处方编号查询处方详情（院内系统集成接口使用，附带签名信息供药房验签）
+func (s *PrescriptionService) GetByPrescriptionNo(prescriptionNo string) (map[string]interface{}, error) {
+	prescription, err := s.prescriptionRepo.GetByPrescriptionNo(prescriptionNo)
+	if err != nil {
+		return nil, errors.New("处方不存在")
+	}
+
+	result := s.buildPrescriptionDetail(prescription)
+	result["patientId"] = prescription.PatientID
+	result["doctorId"] = prescription.DoctorID
+	result["dataHash"] = prescription.DataHash
+	result["signature"] = prescription.Signature
+	result["signerKeyId"] = prescription.SignerKeyID
+	if prescription.SignedAt != nil {
+		result["signedAt"] = prescription.SignedAt.Format("2006-01-02 15:04:05")
+	}
+	return result, nil
+}
+
+// buildPrescriptionDetail 组装处方详情和明细
+func (s *PrescriptionService) buildPrescriptionDetail(prescription *model.Prescription) map[string]interface{} {
+	details, _ := s.prescriptionRepo.GetDetailsByPrescriptionID(prescription.ID)
 
 	var detailList []map[string]interface{}
 	for _, detail := range details {
@@ -172,7 +201,7 @@ func (s *PrescriptionService) GetPrescriptionDetail(userID, prescriptionID int64
 		"prescriptionId":   prescription.ID,
 		"prescriptionNo":   prescription.PrescriptionNo,
 		"consultationId":   prescription.ConsultationID,
-		"diagnosis":        diagnosis,
+		"diagnosis":        prescription.Diagnosis,
 		"prescriptionType": prescription.PrescriptionType,
 		"totalAmount":      prescription.TotalAmount,
 		"status":           prescription.Status,
@@ -180,7 +209,7 @@ func (s *PrescriptionService) GetPrescriptionDetail(userID, prescriptionID int64
 		"createdAt":        prescription.CreatedAt.Format("2006-01-02 15:04:05"),
 	}
 
-	return result, nil
+	return result
 }
 
 // SearchMedicines 搜索药品
@@ -279,6 +308,15 @@ func (s *PrescriptionService) extractMedicineCategories(aiDiagnosis string) []st
 	return categories
 }
 
+// VoidPrescription 作废处方（开具后问诊未能完成时调用），签名保留，核验时提示已作废
+func (s *PrescriptionService) VoidPrescription(prescriptionID int64, reason string) error {
+	if err := s.prescriptionRepo.UpdateStatus(prescriptionID, PrescriptionStatusVoided); err != nil {
+		return err
+	}
+	log.Printf("[处方] 处方已作废 - 处方ID: %d, 原因: %s", prescriptionID, reason)
+	return nil
+}
+
 // FormatPrescriptionForRecord 将处方格式化为病历文本
 func (s *PrescriptionService) FormatPrescriptionForRecord(prescriptionID int64) (string, error) {
 	prescription, err := s.prescriptionRepo.GetByID(prescriptionID)
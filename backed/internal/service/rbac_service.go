@@ -0,0 +1,198 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sort"
+	"sync"
+)
+
+// 权限标识
+const (
+	PermUserManage         = "user:manage"         // 用户列表、启用/禁用、分配角色
+	PermLogView            = "log:view"            // 查看登录日志
+	PermSecurityManage     = "security:manage"     // 查看和处理安全事件
+	PermIntegrationManage  = "integration:manage"  // 管理服务账号、API密钥和调用审计
+	PermCryptoManage       = "crypto:manage"       // 密钥轮换重加密
+	PermRBACManage         = "rbac:manage"         // 管理角色权限
+	PermConsultationCreate = "consultation:create" // 发起问诊、手动分诊
+	PermConsultationAccept = "consultation:accept" // 接诊
+	PermConsultationFinish = "consultation:finish" // 完成问诊、开具处方
+	PermDoctorOnline       = "doctor:online"       // 更新医生在线状态
+	PermMedicineSearch     = "medicine:search"     // 搜索药品、AI推荐药品
+	PermPrescriptionView   = "prescription:view"   // 查看本人相关处方
+	PermPrescriptionReview = "prescription:review" // 查看全部处方（药师审方）
+	PermPrescriptionVerify = "prescription:verify" // 验证处方签名
+)
+
+// Roles 系统角色
+var Roles = []string{"patient", "doctor", "pharmacist", "admin"}
+
+// PermissionCatalog 全部权限及说明
+var PermissionCatalog = map[string]string{
+	PermUserManage:         "用户管理",
+	PermLogView:            "查看登录日志",
+	PermSecurityManage:     "处理安全事件",
+	PermIntegrationManage:  "院内系统集成管理",
+	PermCryptoManage:       "密钥轮换重加密",
+	PermRBACManage:         "角色权限管理",
+	PermConsultationCreate: "发起问诊",
+	PermConsultationAccept: "接诊",
+	PermConsultationFinish: "完成问诊并开具处方",
+	PermDoctorOnline:       "更新在线状态",
+	PermMedicineSearch:     "搜索药品",
+	PermPrescriptionView:   "查看本人处方",
+	PermPrescriptionReview: "审核全部处方",
+	PermPrescriptionVerify: "验证处方签名",
+}
+
+// defaultRolePermissions 权限表为空时写入的默认分配
+var defaultRolePermissions = map[string][]string{
+	"patient":    {PermConsultationCreate, PermPrescriptionView, PermPrescriptionVerify},
+	"doctor":     {PermConsultationAccept, PermConsultationFinish, PermDoctorOnline, PermMedicineSearch, PermPrescriptionView, PermPrescriptionVerify},
+	"pharmacist": {PermMedicineSearch, PermPrescriptionView, PermPrescriptionReview, PermPrescriptionVerify},
+	"admin":      {PermUserManage, PermLogView, PermSecurityManage, PermIntegrationManage, PermCryptoManage, PermRBACManage, PermPrescriptionView, PermPrescriptionReview, PermPrescriptionVerify},
+}
+
+// rolePermissions 角色权限缓存（角色 -> 权限集合），启动时和修改后从数据库加载
+var rolePermissions = struct {
+	sync.RWMutex
+	perms map[string]map[string]bool
+}{perms: buildPermissionSets(defaultRolePermissions)}
+
+// HasPermission 判断角色是否拥有权限
+func HasPermission(role, permission string) bool {
+	rolePermissions.RLock()
+	defer rolePermissions.RUnlock()
+	return rolePermissions.perms[role][permission]
+}
+
+// RBACService 角色权限服务
+type RBACService struct {
+	repo *repository.RolePermissionRepository
+}
+
+func NewRBACService() *RBACService {
+	return &RBACService{
+		repo: repository.NewRolePermissionRepository(),
+	}
+}
+
+// Load 从数据库加载角色权限，表为空时写入默认分配；加载失败时继续使用默认分配
+func (s *RBACService) Load() {
+	list, err := s.repo.FindAll()
+	if err != nil {
+		log.Printf("[权限] 加载角色权限失败，使用默认权限: %v", err)
+		return
+	}
+
+	if len(list) == 0 {
+		for _, role := range Roles {
+			for _, p := range defaultRolePermissions[role] {
+				list = append(list, model.RolePermission{Role: role, Permission: p})
+			}
+		}
+		if err := s.repo.CreateBatch(list); err != nil {
+			log.Printf("[权限] 写入默认角色权限失败: %v", err)
+			return
+		}
+		log.Printf("[权限] 已写入默认角色权限 - 共 %d 条", len(list))
+	}
+
+	assigned := make(map[string][]string)
+	for _, rp := range list {
+		assigned[rp.Role] = append(assigned[rp.Role], rp.Permission)
+	}
+
+	rolePermissions.Lock()
+	rolePermissions.perms = buildPermissionSets(assigned)
+	rolePermissions.Unlock()
+}
+
+// GetPolicies 获取权限目录和各角色当前权限
+func (s *RBACService) GetPolicies() map[string]interface{} {
+	permissions := make([]map[string]interface{}, 0, len(PermissionCatalog))
+	for p, desc := range PermissionCatalog {
+		permissions = append(permissions, map[string]interface{}{
+			"permission":  p,
+			"description": desc,
+		})
+	}
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissions[i]["permission"].(string) < permissions[j]["permission"].(string)
+	})
+
+	rolePermissions.RLock()
+	roles := make(map[string][]string, len(Roles))
+	for _, role := range Roles {
+		list := make([]string, 0, len(rolePermissions.perms[role]))
+		for p := range rolePermissions.perms[role] {
+			list = append(list, p)
+		}
+		sort.Strings(list)
+		roles[role] = list
+	}
+	rolePermissions.RUnlock()
+
+	return map[string]interface{}{
+		"roles":       roles,
+		"permissions": permissions,
+	}
+}
+
+// UpdateRolePermissions 替换角色的全部权限
+func (s *RBACService) UpdateRolePermissions(adminID int64, role string, permissions []string) error {
+	if !isValidRole(role) {
+		return errors.New("角色不存在")
+	}
+
+	seen := make(map[string]bool, len(permissions))
+	unique := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		if _, ok := PermissionCatalog[p]; !ok {
+			return errors.New("未知的权限: " + p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			unique = append(unique, p)
+		}
+	}
+
+	// 防止管理员移除自己管理权限的能力后无法恢复
+	if role == "admin" && !seen[PermRBACManage] {
+		return errors.New("不能移除管理员的角色权限管理权限")
+	}
+
+	if err := s.repo.ReplaceRole(role, unique, adminID); err != nil {
+		return err
+	}
+	s.Load()
+
+	log.Printf("[权限] 角色权限已更新 - 管理员ID: %d, 角色: %s, 权限: %v", adminID, role, unique)
+	return nil
+}
+
+// isValidRole 判断角色是否存在
+func isValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPermissionSets 将权限列表转换为集合
+func buildPermissionSets(assigned map[string][]string) map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(assigned))
+	for role, perms := range assigned {
+		set := make(map[string]bool, len(perms))
+		for _, p := range perms {
+			set[p] = true
+		}
+		sets[role] = set
+	}
+	return sets
+}
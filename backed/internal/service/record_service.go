@@ -3,7 +3,6 @@ package service
 import (
 	"errors"
 	"log"
-	"sm-medical/internal/crypto"
 	"sm-medical/internal/model"
 	"sm-medical/internal/repository"
 )
@@ -11,12 +10,14 @@ import (
 type RecordService struct {
 	repo *repository.RecordRepository
 	userRepo *repository.UserRepository
+	participantRepo *repository.ConsultationParticipantRepository
 }
 
 func NewRecordService() *RecordService {
 	return &RecordService{
 		repo: repository.NewRecordRepository(),
 		userRepo: repository.NewUserRepository(),
+		participantRepo: repository.NewConsultationParticipantRepository(),
 	}
 }
 
@@ -54,18 +55,14 @@ func (s *RecordService) GetList(userID int64, page, pageSize int, startDate, end
 
 	var result []map[string]interface{}
 	for _, r := range records {
-		// 解密
-		chiefComplaint, _ := crypto.SM4Decrypt(r.ChiefComplaint)
-		diagnosis, _ := crypto.SM4Decrypt(r.Diagnosis)
-
 		// 根据角色返回不同的字段
 		if user.Role == "doctor" {
 			// 医生看到的是患者名
 			result = append(result, map[string]interface{}{
 				"recordId":       r.ID,
 				"recordNo":       r.RecordNo,
-				"chiefComplaint": chiefComplaint,
-				"diagnosis":      diagnosis,
+				"chiefComplaint": r.ChiefComplaint,
+				"diagnosis":      r.Diagnosis,
 				"patientName":    r.DoctorName, // 注意：这里复用了 DoctorName 字段存储患者名
 				"createdAt":      r.CreatedAt.Format("2006-01-02 15:04:05"),
 			})
@@ -74,8 +71,8 @@ func (s *RecordService) GetList(userID int64, page, pageSize int, startDate, end
 			result = append(result, map[string]interface{}{
 				"recordId":       r.ID,
 				"recordNo":       r.RecordNo,
-				"chiefComplaint": chiefComplaint,
-				"diagnosis":      diagnosis,
+				"chiefComplaint": r.ChiefComplaint,
+				"diagnosis":      r.Diagnosis,
 				"doctorName":     r.DoctorName,
 				"doctorDept":     r.DoctorDept,
 				"createdAt":      r.CreatedAt.Format("2006-01-02 15:04:05"),
@@ -103,9 +100,12 @@ func (s *RecordService) GetDetail(userID, recordID int64) (map[string]interface{
 		return nil, err
 	}
 
-	// 权限检查：患者本人 或 接诊医生 可以查看
+	// 权限检查：患者本人、接诊医生 或 该问诊的会诊医生 可以查看
 	isPatient := record.PatientID == userID
 	isDoctor := record.DoctorID != nil && *record.DoctorID == userID
+	if !isDoctor && record.ConsultationID != nil {
+		isDoctor = s.participantRepo.IsActive(*record.ConsultationID, userID)
+	}
 	
 	if !isPatient && !isDoctor {
 		log.Printf("[RecordService.GetDetail] 无权限访问 - 用户角色: %s, 患者ID: %d, 医生ID: %v", 
@@ -115,17 +115,12 @@ func (s *RecordService) GetDetail(userID, recordID int64) (map[string]interface{
 	
 	log.Printf("[RecordService.GetDetail] 权限验证通过 - 患者: %v, 医生: %v", isPatient, isDoctor)
 
-	// 解密数据
-	chiefComplaint, _ := crypto.SM4Decrypt(record.ChiefComplaint)
-	diagnosis, _ := crypto.SM4Decrypt(record.Diagnosis)
-	treatment, _ := crypto.SM4Decrypt(record.Treatment)
-
 	result := map[string]interface{}{
 		"recordId":       record.ID,
 		"recordNo":       record.RecordNo,
-		"chiefComplaint": chiefComplaint,
-		"diagnosis":      diagnosis,
-		"treatment":      treatment,
+		"chiefComplaint": record.ChiefComplaint,
+		"diagnosis":      record.Diagnosis,
+		"treatment":      record.Treatment,
 		"doctorName":     record.DoctorName,
 		"doctorDept":     record.DoctorDept,
 		"aiAdvice":       record.AIAdvice,
@@ -134,3 +129,40 @@ func (s *RecordService) GetDetail(userID, recordID int64) (map[string]interface{
 
 	return result, nil
 }
+
+// ExportRecords 院内系统导出病历（解密后的完整字段及SM3哈希、SM2签名，接收方可验签）
+func (s *RecordService) ExportRecords(patientID int64, startDate, endDate string, page, pageSize int) ([]map[string]interface{}, int64, error) {
+	records, total, err := s.repo.FindForExport(patientID, startDate, endDate, page, pageSize)
+	if err != nil {
+		log.Printf("[RecordService.ExportRecords] 查询失败: %v", err)
+		return nil, 0, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(records))
+	for _, r := range records {
+		item := map[string]interface{}{
+			"recordId":       r.ID,
+			"recordNo":       r.RecordNo,
+			"patientId":      r.PatientID,
+			"consultationId": r.ConsultationID,
+			"recordType":     r.RecordType,
+			"chiefComplaint": r.ChiefComplaint,
+			"presentIllness": r.PresentIllness,
+			"pastHistory":    r.PastHistory,
+			"diagnosis":      r.Diagnosis,
+			"treatment":      r.Treatment,
+			"doctorId":       r.DoctorID,
+			"dataHash":       r.DataHash,
+			"signature":      r.Signature,
+			"signerKeyId":    r.SignerKeyID,
+			"createdAt":      r.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+		if r.SignedAt != nil {
+			item["signedAt"] = r.SignedAt.Format("2006-01-02 15:04:05")
+		}
+		result = append(result, item)
+	}
+
+	log.Printf("[RecordService.ExportRecords] 导出病历 - 患者ID: %d, 本页: %d, 总数: %d", patientID, len(result), total)
+	return result, total, nil
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// reencryptBatchSize 每批处理的行数
+const reencryptBatchSize = 200
+
+// reencryptTarget 需要重加密的表及其SM4加密字段
+type reencryptTarget struct {
+	Table   string
+	Columns []string
+}
+
+// reencryptMaxRetries 行在读取后被并发修改时重新读取的次数
+const reencryptMaxRetries = 3
+
+// reencryptModels 按顺序处理的表，任务断点记录在表名和ID上，新增的表追加在末尾以便恢复旧任务
+// 新增使用sm4序列化器的模型时需加入此列表
+var reencryptModels = []interface{}{
+	&model.User{},
+	&model.Consultation{},
+	&model.MedicalRecord{},
+	&model.ChatMessage{},
+	&model.Prescription{},
+	&model.LoginLog{},
+	&model.DoctorApplication{},
+	&model.ConsultationParticipant{},
+	&model.UserSession{},
+	&model.UserMFA{},
+	&model.SecurityEvent{},
+	&model.APIKeyAudit{},
+}
+
+// reencryptTargets 需要重加密的表，加密字段取自模型中使用sm4序列化器的字段
+var reencryptTargets = buildReencryptTargets(reencryptModels)
+
+// buildReencryptTargets 解析模型的表名和sm4加密字段
+func buildReencryptTargets(models []interface{}) []reencryptTarget {
+	cache := &sync.Map{}
+	targets := make([]reencryptTarget, 0, len(models))
+	for _, m := range models {
+		s, err := schema.Parse(m, cache, schema.NamingStrategy{})
+		if err != nil {
+			panic(fmt.Sprintf("解析重加密模型失败: %v", err))
+		}
+
+		target := reencryptTarget{Table: s.Table}
+		for _, field := range s.Fields {
+			if field.DBName != "" && field.TagSettings["SERIALIZER"] == "sm4" {
+				target.Columns = append(target.Columns, field.DBName)
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// reencryptRunner 进程内唯一的任务运行状态
+var reencryptRunner struct {
+	mu      sync.Mutex
+	running bool
+	stop    bool
+}
+
+// ReencryptService SM4密钥轮换重加密服务（也用于迁移到信封加密或轮换主密钥）
+type ReencryptService struct {
+	repo *repository.ReencryptJobRepository
+}
+
+func NewReencryptService() *ReencryptService {
+	return &ReencryptService{
+		repo: repository.NewReencryptJobRepository(),
+	}
+}
+
+// Start 启动或恢复重加密任务
+func (s *ReencryptService) Start(adminID int64) (*model.CryptoReencryptJob, error) {
+	reencryptRunner.mu.Lock()
+	defer reencryptRunner.mu.Unlock()
+
+	if reencryptRunner.running {
+		return nil, errors.New("已有重加密任务正在运行")
+	}
+
+	activeKeyID := crypto.ActiveEncryptionKeyID()
+
+	// 优先恢复同一目标密钥下未完成的任务
+	job, err := s.repo.FindLatest()
+	if err != nil || job.Status == "completed" || job.TargetKeyID != activeKeyID {
+		if job != nil && job.Status != "completed" && job.TargetKeyID != activeKeyID {
+			job.Status = "failed"
+			job.ErrorMsg = fmt.Sprintf("活动密钥已切换为 %s，任务作废", activeKeyID)
+			s.repo.Update(job)
+		}
+
+		now := time.Now()
+		job = &model.CryptoReencryptJob{
+			TargetKeyID:  activeKeyID,
+			Status:       "running",
+			CurrentTable: reencryptTargets[0].Table,
+			CreatedBy:    adminID,
+			StartedAt:    &now,
+		}
+		if err := s.repo.Create(job); err != nil {
+			return nil, err
+		}
+	} else {
+		job.Status = "running"
+		job.ErrorMsg = ""
+		if err := s.repo.Update(job); err != nil {
+			return nil, err
+		}
+	}
+
+	reencryptRunner.running = true
+	reencryptRunner.stop = false
+	go s.run(job)
+
+	log.Printf("[重加密] 任务已启动 - 任务ID: %d, 目标密钥: %s, 断点: %s#%d",
+		job.ID, job.TargetKeyID, job.CurrentTable, job.LastID)
+	return job, nil
+}
+
+// Pause 暂停正在运行的任务，当前批次处理完后生效
+func (s *ReencryptService) Pause() error {
+	reencryptRunner.mu.Lock()
+	defer reencryptRunner.mu.Unlock()
+
+	if !reencryptRunner.running {
+		return errors.New("没有正在运行的重加密任务")
+	}
+	reencryptRunner.stop = true
+	return nil
+}
+
+// GetProgress 获取重加密进度
+func (s *ReencryptService) GetProgress() (map[string]interface{}, error) {
+	reencryptRunner.mu.Lock()
+	running := reencryptRunner.running
+	reencryptRunner.mu.Unlock()
+
+	result := map[string]interface{}{
+		"activeKeyId": crypto.ActiveEncryptionKeyID(),
+		"keyIds":      crypto.SM4Keys.KeyIDs(),
+		"running":     running,
+	}
+
+	job, err := s.repo.FindLatest()
+	if err != nil {
+		result["job"] = nil
+		return result, nil
+	}
+
+	tables := make([]string, 0, len(reencryptTargets))
+	tableIndex := len(reencryptTargets)
+	for i, t := range reencryptTargets {
+		tables = append(tables, t.Table)
+		if t.Table == job.CurrentTable {
+			tableIndex = i
+		}
+	}
+	if job.Status == "completed" {
+		tableIndex = len(reencryptTargets)
+	}
+
+	result["job"] = job
+	result["tables"] = tables
+	result["tablesDone"] = tableIndex
+	result["tablesTotal"] = len(reencryptTargets)
+	return result, nil
+}
+
+// ResumeInterrupted 服务启动时恢复因重启中断的任务
+func (s *ReencryptService) ResumeInterrupted() {
+	job, err := s.repo.FindByStatus("running")
+	if err != nil {
+		return
+	}
+
+	log.Printf("[重加密] 发现中断的任务 - 任务ID: %d，正在恢复", job.ID)
+	if _, err := s.Start(job.CreatedBy); err != nil {
+		log.Printf("[重加密] 恢复任务失败: %v", err)
+	}
+}
+
+// run 执行重加密任务
+func (s *ReencryptService) run(job *model.CryptoReencryptJob) {
+	defer func() {
+		reencryptRunner.mu.Lock()
+		reencryptRunner.running = false
+		reencryptRunner.stop = false
+		reencryptRunner.mu.Unlock()
+	}()
+
+	start := 0
+	for i, t := range reencryptTargets {
+		if t.Table == job.CurrentTable {
+			start = i
+			break
+		}
+	}
+
+	for i := start; i < len(reencryptTargets); i++ {
+		target := reencryptTargets[i]
+		if job.CurrentTable != target.Table {
+			job.CurrentTable = target.Table
+			job.LastID = 0
+		}
+
+		for {
+			if s.stopRequested() {
+				job.Status = "paused"
+				s.repo.Update(job)
+				log.Printf("[重加密] 任务已暂停 - 任务ID: %d, 断点: %s#%d", job.ID, job.CurrentTable, job.LastID)
+				return
+			}
+
+			if crypto.ActiveEncryptionKeyID() != job.TargetKeyID {
+				s.fail(job, "活动密钥在任务执行期间发生变化")
+				return
+			}
+
+			rows, err := s.repo.FindEncryptedRows(target.Table, target.Columns, job.LastID, reencryptBatchSize)
+			if err != nil {
+				s.fail(job, fmt.Sprintf("读取 %s 失败: %v", target.Table, err))
+				return
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			for _, row := range rows {
+				id := toInt64(row["id"])
+				if err := s.reencryptRow(job, target, id, row); err != nil {
+					s.fail(job, fmt.Sprintf("更新 %s#%d 失败: %v", target.Table, id, err))
+					return
+				}
+				job.Scanned++
+				job.LastID = id
+			}
+
+			// 每批保存一次断点
+			if err := s.repo.Update(job); err != nil {
+				log.Printf("[重加密] 保存断点失败: %v", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	job.Status = "completed"
+	job.FinishedAt = &now
+	s.repo.Update(job)
+	log.Printf("[重加密] 任务完成 - 任务ID: %d, 扫描: %d, 重加密: %d, 失败: %d",
+		job.ID, job.Scanned, job.Reencrypted, job.Failed)
+}
+
+// reencryptRow 重加密一行的加密字段
+// 回写时要求字段仍为读取时的密文，期间被业务并发修改的行重新读取后再处理，避免覆盖新写入的数据
+func (s *ReencryptService) reencryptRow(job *model.CryptoReencryptJob, target reencryptTarget, id int64, row map[string]interface{}) error {
+	for attempt := 0; ; attempt++ {
+		updates := make(map[string]interface{})
+		previous := make(map[string]interface{})
+		for _, col := range target.Columns {
+			value := toString(row[col])
+			if !crypto.NeedsReencrypt(value) {
+				continue
+			}
+			reencrypted, err := crypto.SM4Reencrypt(value)
+			if err != nil {
+				job.Failed++
+				log.Printf("[重加密] 解密失败 - 表: %s, ID: %d, 字段: %s, 错误: %v", target.Table, id, col, err)
+				continue
+			}
+			updates[col] = reencrypted
+			previous[col] = row[col]
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+
+		updated, err := s.repo.UpdateEncryptedColumns(target.Table, id, updates, previous)
+		if err != nil {
+			return err
+		}
+		if updated {
+			job.Reencrypted++
+			return nil
+		}
+		if attempt >= reencryptMaxRetries {
+			job.Failed++
+			log.Printf("[重加密] 行持续被并发修改，跳过 - 表: %s, ID: %d", target.Table, id)
+			return nil
+		}
+
+		// 读取后被并发修改或删除，重新读取最新密文
+		row, err = s.repo.FindEncryptedRow(target.Table, target.Columns, id)
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			return nil
+		}
+	}
+}
+
+// fail 标记任务失败（保留断点，可再次启动恢复）
+func (s *ReencryptService) fail(job *model.CryptoReencryptJob, msg string) {
+	job.Status = "failed"
+	job.ErrorMsg = msg
+	s.repo.Update(job)
+	log.Printf("[重加密] 任务失败 - 任务ID: %d, 原因: %s", job.ID, msg)
+}
+
+// stopRequested 是否收到暂停请求
+func (s *ReencryptService) stopRequested() bool {
+	reencryptRunner.mu.Lock()
+	defer reencryptRunner.mu.Unlock()
+	return reencryptRunner.stop
+}
+
+// toString 将数据库原始值转换为字符串
+func toString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// toInt64 将数据库原始值转换为int64
+func toInt64(v interface{}) int64 {
+	switch val := v.(type) {
+	case int64:
+		return val
+	case int32:
+		return int64(val)
+	case int:
+		return int64(val)
+	case uint64:
+		return int64(val)
+	case uint32:
+		return int64(val)
+	case []byte:
+		var n int64
+		fmt.Sscan(string(val), &n)
+		return n
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sm-medical/internal/repository"
+)
+
+// securityEventTypeText 安全事件类型说明
+var securityEventTypeText = map[string]string{
+	EventImpossibleTravel:   "不可能的移动",
+	EventNewDevice:          "新设备登录",
+	EventCredentialStuffing: "疑似撞库",
+	EventOffHoursAdmin:      "管理员非工作时间登录",
+}
+
+// SecurityEventService 安全事件查询和处理（管理员）
+type SecurityEventService struct {
+	eventRepo *repository.SecurityEventRepository
+}
+
+func NewSecurityEventService() *SecurityEventService {
+	return &SecurityEventService{
+		eventRepo: repository.NewSecurityEventRepository(),
+	}
+}
+
+// GetList 分页查询安全事件
+func (s *SecurityEventService) GetList(page, pageSize int, eventType string, status *int, userID *int64) ([]map[string]interface{}, int64, error) {
+	events, total, err := s.eventRepo.FindAll(page, pageSize, eventType, status, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(events))
+	for _, e := range events {
+		item := map[string]interface{}{
+			"eventId":       e.ID,
+			"eventType":     e.EventType,
+			"eventTypeText": securityEventTypeText[e.EventType],
+			"severity":      e.Severity,
+			"userId":        e.UserID,
+			"username":      e.Username,
+			"loginLogId":    e.LoginLogID,
+			"ip":            e.IP,
+			"location":      e.Location,
+			"detail":        e.Detail,
+			"status":        e.Status,
+			"handleNote":    e.HandleNote,
+			"createdAt":     e.CreatedAt.Format("2006-01-02 15:04:05"),
+		}
+		if e.HandledAt != nil {
+			item["handledBy"] = e.HandledBy
+			item["handledAt"] = e.HandledAt.Format("2006-01-02 15:04:05")
+		}
+		result = append(result, item)
+	}
+	return result, total, nil
+}
+
+// Handle 处理安全事件：确认(1)或标记为误报(2)
+func (s *SecurityEventService) Handle(adminID, eventID int64, status int, note string) error {
+	if status != SecurityEventConfirmed && status != SecurityEventFalsePositive {
+		return errors.New("处理状态无效")
+	}
+	if _, err := s.eventRepo.FindByID(eventID); err != nil {
+		return errors.New("安全事件不存在")
+	}
+	if err := s.eventRepo.Handle(eventID, status, adminID, truncate(note, 255)); err != nil {
+		return err
+	}
+
+	log.Printf("[安全事件] 已处理 - 事件ID: %d, 状态: %d, 管理员ID: %d", eventID, status, adminID)
+	return nil
+}
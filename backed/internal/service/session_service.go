@@ -0,0 +1,300 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sm-medical/pkg/config"
+	"sm-medical/pkg/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 刷新令牌格式: <会话标识>.<base64url随机串>，数据库只保存SM3哈希
+
+var (
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效，请重新登录")
+	ErrSessionRevoked      = errors.New("登录已失效，请重新登录")
+)
+
+// revocationGrace 吊销记录在访问令牌有效期之外多保留的时间，容忍各实例时钟偏差
+const revocationGrace = time.Minute
+
+// SessionService 登录会话服务：签发访问令牌和刷新令牌、刷新轮换、退出和吊销
+type SessionService struct {
+	sessionRepo *repository.SessionRepository
+	userRepo    *repository.UserRepository
+}
+
+func NewSessionService() *SessionService {
+	return &SessionService{
+		sessionRepo: repository.NewSessionRepository(),
+		userRepo:    repository.NewUserRepository(),
+	}
+}
+
+// CreateSession 登录成功后创建会话，返回访问令牌、刷新令牌和会话记录
+func (s *SessionService) CreateSession(user *model.User, clientIP, userAgent string) (map[string]interface{}, *model.UserSession, error) {
+	sessionID, err := randomToken(16, hex.EncodeToString)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken, refreshHash, err := newRefreshToken(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 超过角色最大同时登录数时踢出最早的会话
+	if limit := maxSessions(user.Role); limit > 0 {
+		s.evictOldest(user.ID, limit-1)
+	}
+
+	session := &model.UserSession{
+		SessionID:        sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: refreshHash,
+		ExpiresAt:        time.Now().Add(utils.RefreshTokenTTL()),
+	}
+	setSessionClient(session, clientIP, userAgent)
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.issueTokens(user, sessionID, refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, session, nil
+}
+
+// ListSessions 获取用户当前登录的会话（设备、浏览器、系统和IP）
+func (s *SessionService) ListSessions(userID int64, currentSessionID string) ([]map[string]interface{}, error) {
+	sessions, err := s.sessionRepo.FindActiveByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, map[string]interface{}{
+			"sessionId":    session.SessionID,
+			"device":       session.Device,
+			"browser":      session.Browser,
+			"os":           session.OS,
+			"ip":           session.ClientIP,
+			"current":      session.SessionID == currentSessionID,
+			"loginTime":    session.CreatedAt.Format("2006-01-02 15:04:05"),
+			"lastActiveAt": lastActiveAt(&session).Format("2006-01-02 15:04:05"),
+			"expiresAt":    session.ExpiresAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return result, nil
+}
+
+// RevokeSession 用户下线自己的某个会话
+func (s *SessionService) RevokeSession(userID int64, sessionID string) error {
+	session, err := s.sessionRepo.FindBySessionID(sessionID)
+	if err != nil || session.UserID != userID {
+		return errors.New("会话不存在")
+	}
+	if session.RevokedAt != nil {
+		return nil
+	}
+
+	log.Printf("[会话] 用户下线会话 - 用户ID: %d, 会话: %s", userID, sessionID)
+	return s.revoke(userID, sessionID, "用户手动下线")
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌，同时轮换刷新令牌
+// 已轮换的旧刷新令牌再次出现时视为被盗用，吊销整个会话
+func (s *SessionService) Refresh(refreshToken, clientIP, userAgent string) (map[string]interface{}, error) {
+	sessionID, _, found := strings.Cut(refreshToken, ".")
+	if !found || sessionID == "" {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	session, err := s.sessionRepo.FindBySessionID(sessionID)
+	if err != nil {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if session.RevokedAt != nil || IsSessionRevoked(sessionID) {
+		return nil, ErrSessionRevoked
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionRevoked
+	}
+
+	hash := crypto.SM3Hash(refreshToken)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(session.RefreshTokenHash)) != 1 {
+		if session.PrevTokenHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(session.PrevTokenHash)) == 1 {
+			log.Printf("[会话] 检测到刷新令牌重复使用，吊销会话 - 用户ID: %d, 会话: %s, IP: %s", session.UserID, sessionID, clientIP)
+			s.revoke(session.UserID, sessionID, "刷新令牌重复使用")
+			return nil, ErrSessionRevoked
+		}
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	// 角色、用户名以数据库为准，禁用账号不能续期
+	user, err := s.userRepo.FindByID(session.UserID)
+	if err != nil {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if user.Status == 1 {
+		s.revoke(user.ID, sessionID, "账号已被禁用")
+		return nil, errors.New("账号已被禁用")
+	}
+
+	newToken, newHash, err := newRefreshToken(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session.PrevTokenHash = session.RefreshTokenHash
+	session.RefreshTokenHash = newHash
+	setSessionClient(session, clientIP, userAgent)
+	session.LastRefreshAt = &now
+	rotated, err := s.sessionRepo.Rotate(session, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// 同一刷新令牌已被并发请求轮换，同样视为重复使用
+		log.Printf("[会话] 检测到刷新令牌并发使用，吊销会话 - 用户ID: %d, 会话: %s, IP: %s", session.UserID, sessionID, clientIP)
+		s.revoke(session.UserID, sessionID, "刷新令牌重复使用")
+		return nil, ErrSessionRevoked
+	}
+
+	return s.issueTokens(user, sessionID, newToken)
+}
+
+// Logout 退出登录，吊销当前会话
+func (s *SessionService) Logout(userID int64, sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return s.revoke(userID, sessionID, "退出登录")
+}
+
+// RevokeAllSessions 吊销用户的全部会话（修改密码、禁用账号、角色变更时调用）
+func (s *SessionService) RevokeAllSessions(userID int64, reason string) error {
+	sessions, err := s.sessionRepo.FindActiveByUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, session := range sessions {
+		if err := s.revoke(userID, session.SessionID, reason); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(sessions) > 0 {
+		log.Printf("[会话] 已吊销用户全部会话 - 用户ID: %d, 数量: %d, 原因: %s", userID, len(sessions), reason)
+	}
+	return firstErr
+}
+
+// evictOldest 只保留最近活跃的keep个会话，其余吊销
+func (s *SessionService) evictOldest(userID int64, keep int) {
+	sessions, err := s.sessionRepo.FindActiveByUserID(userID)
+	if err != nil {
+		log.Printf("[会话] 查询会话失败 - 用户ID: %d, 错误: %v", userID, err)
+		return
+	}
+	if len(sessions) <= keep {
+		return
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return lastActiveAt(&sessions[i]).After(lastActiveAt(&sessions[j]))
+	})
+	for _, session := range sessions[keep:] {
+		if err := s.revoke(userID, session.SessionID, "超过最大同时登录数"); err != nil {
+			log.Printf("[会话] 踢出会话失败 - 用户ID: %d, 会话: %s, 错误: %v", userID, session.SessionID, err)
+			continue
+		}
+		log.Printf("[会话] 超过最大同时登录数，踢出最早的会话 - 用户ID: %d, 会话: %s", userID, session.SessionID)
+	}
+}
+
+// revoke 吊销会话并加入访问令牌吊销列表，同时释放会话持有的医生签名私钥
+func (s *SessionService) revoke(userID int64, sessionID, reason string) error {
+	releaseDoctorSigningKey(userID, sessionID)
+	if _, err := s.sessionRepo.Revoke(sessionID, reason); err != nil {
+		return err
+	}
+	return currentRevocationStore().Revoke(userID, sessionID, reason, time.Now().Add(utils.AccessTokenTTL()+revocationGrace))
+}
+
+// issueTokens 签发访问令牌
+func (s *SessionService) issueTokens(user *model.User, sessionID, refreshToken string) (map[string]interface{}, error) {
+	token, err := utils.GenerateToken(user.ID, user.Username, user.Role, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"token":            token,
+		"tokenType":        "Bearer",
+		"expiresIn":        int(utils.AccessTokenTTL().Seconds()),
+		"refreshToken":     refreshToken,
+		"refreshExpiresIn": int(utils.RefreshTokenTTL().Seconds()),
+	}, nil
+}
+
+// maxSessions 角色最大同时登录数，0表示不限制
+func maxSessions(role string) int {
+	if config.AppConfig == nil {
+		return 0
+	}
+	return config.AppConfig.Session.MaxSessions[role]
+}
+
+// lastActiveAt 会话最近活跃时间
+func lastActiveAt(session *model.UserSession) time.Time {
+	if session.LastRefreshAt != nil {
+		return *session.LastRefreshAt
+	}
+	return session.CreatedAt
+}
+
+// setSessionClient 记录会话的客户端IP、设备、浏览器和系统
+func setSessionClient(session *model.UserSession, clientIP, userAgent string) {
+	session.ClientIP = clientIP
+	session.UserAgent = truncate(userAgent, 255)
+	session.Device, session.Browser, session.OS = utils.ParseUserAgent(userAgent)
+}
+
+// newRefreshToken 生成刷新令牌及其SM3哈希
+func newRefreshToken(sessionID string) (string, string, error) {
+	secret, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", "", err
+	}
+	token := sessionID + "." + secret
+	return token, crypto.SM3Hash(token), nil
+}
+
+// randomToken 生成n字节随机数并编码
+func randomToken(n int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encode(buf), nil
+}
+
+// truncate 截断过长的字符串
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
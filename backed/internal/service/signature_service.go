@@ -0,0 +1,321 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"time"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+// SignatureService 病历和处方的SM2数字签名服务
+// 签名覆盖解密后的明文字段，SM4密钥轮换重加密不会影响签名有效性
+// 有开具医生的文档必须使用该医生登录时解锁的证书私钥签名，未解锁则拒绝签署；没有医生的文档使用医院密钥
+type SignatureService struct {
+	recordRepo       *repository.RecordRepository
+	prescriptionRepo *repository.PrescriptionRepository
+	certService      *DoctorCertService
+}
+
+func NewSignatureService() *SignatureService {
+	return &SignatureService{
+		recordRepo:       repository.NewRecordRepository(),
+		prescriptionRepo: repository.NewPrescriptionRepository(),
+		certService:      NewDoctorCertService(),
+	}
+}
+
+// recordSignPayload 病历签名内容
+type recordSignPayload struct {
+	DocumentType   string `json:"documentType"`
+	RecordNo       string `json:"recordNo"`
+	PatientID      int64  `json:"patientId"`
+	ConsultationID *int64 `json:"consultationId"`
+	DoctorID       *int64 `json:"doctorId"`
+	RecordType     int    `json:"recordType"`
+	ChiefComplaint string `json:"chiefComplaint"`
+	PresentIllness string `json:"presentIllness"`
+	PastHistory    string `json:"pastHistory"`
+	Diagnosis      string `json:"diagnosis"`
+	Treatment      string `json:"treatment"`
+	AIAdvice       string `json:"aiAdvice"`
+}
+
+// prescriptionSignPayload 处方签名内容
+type prescriptionSignPayload struct {
+	DocumentType     string                          `json:"documentType"`
+	PrescriptionNo   string                          `json:"prescriptionNo"`
+	ConsultationID   int64                           `json:"consultationId"`
+	PatientID        int64                           `json:"patientId"`
+	DoctorID         int64                           `json:"doctorId"`
+	Diagnosis        string                          `json:"diagnosis"`
+	PrescriptionType int                             `json:"prescriptionType"`
+	TotalAmount      string                          `json:"totalAmount"`
+	Details          []prescriptionDetailSignPayload `json:"details"`
+}
+
+// prescriptionDetailSignPayload 处方明细签名内容
+type prescriptionDetailSignPayload struct {
+	MedicineID    int64  `json:"medicineId"`
+	MedicineName  string `json:"medicineName"`
+	Specification string `json:"specification"`
+	Quantity      int    `json:"quantity"`
+	Unit          string `json:"unit"`
+	UnitPrice     string `json:"unitPrice"`
+	Usage         string `json:"usage"`
+	Frequency     string `json:"frequency"`
+	Dosage        string `json:"dosage"`
+	Duration      string `json:"duration"`
+	Notes         string `json:"notes"`
+}
+
+// SignRecord 对病历签名，写入DataHash、Signature、SignerKeyID、SignedAt（record中敏感字段为明文，由序列化器负责加解密）
+func (s *SignatureService) SignRecord(record *model.MedicalRecord) error {
+	payload, err := buildRecordSignPayload(record)
+	if err != nil {
+		return err
+	}
+
+	var doctorID int64
+	if record.DoctorID != nil {
+		doctorID = *record.DoctorID
+	}
+	signature, keyID, err := signAs(doctorID, payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	record.DataHash = crypto.SM3Hash(string(payload))
+	record.Signature = signature
+	record.SignerKeyID = keyID
+	record.SignedAt = &now
+	return nil
+}
+
+// SignPrescription 对处方及其明细签名
+func (s *SignatureService) SignPrescription(prescription *model.Prescription, details []model.PrescriptionDetail) error {
+	payload, err := buildPrescriptionSignPayload(prescription, details)
+	if err != nil {
+		return err
+	}
+
+	signature, keyID, err := signAs(prescription.DoctorID, payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	prescription.DataHash = crypto.SM3Hash(string(payload))
+	prescription.Signature = signature
+	prescription.SignerKeyID = keyID
+	prescription.SignedAt = &now
+	return nil
+}
+
+// VerifyRecord 验证病历签名（患者本人或接诊医生）
+func (s *SignatureService) VerifyRecord(userID, recordID int64) (map[string]interface{}, error) {
+	record, err := s.recordRepo.FindByID(recordID)
+	if err != nil {
+		if errors.Is(err, crypto.ErrCiphertextTampered) {
+			log.Printf("[签名验证] 病历解密失败 - 病历ID: %d, 错误: %v", recordID, err)
+			return nil, errors.New("病历数据无法解密，可能已被篡改")
+		}
+		return nil, errors.New("病历不存在")
+	}
+
+	if record.PatientID != userID && (record.DoctorID == nil || *record.DoctorID != userID) {
+		return nil, errors.New("无权限访问")
+	}
+
+	payload, err := buildRecordSignPayload(record)
+	result := map[string]interface{}{
+		"documentType": "medical_record",
+		"documentNo":   record.RecordNo,
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.verifyDocument(result, payload, record.DataHash, record.Signature, record.SignerKeyID, record.SignedAt), nil
+}
+
+// VerifyPrescription 按处方编号验证处方签名（供患者、药师核验）
+func (s *SignatureService) VerifyPrescription(prescriptionNo string) (map[string]interface{}, error) {
+	prescription, err := s.prescriptionRepo.GetByPrescriptionNo(prescriptionNo)
+	if err != nil {
+		if errors.Is(err, crypto.ErrCiphertextTampered) {
+			log.Printf("[签名验证] 处方解密失败 - 处方编号: %s, 错误: %v", prescriptionNo, err)
+			return fillVerifyResult(map[string]interface{}{
+				"documentType": "prescription",
+				"documentNo":   prescriptionNo,
+			}, "tampered", "处方数据无法解密，可能已被篡改", "", nil, ""), nil
+		}
+		return nil, errors.New("处方不存在")
+	}
+
+	details, err := s.prescriptionRepo.GetDetailsByPrescriptionID(prescription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"documentType": "prescription",
+		"documentNo":   prescription.PrescriptionNo,
+		"createdAt":    prescription.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	payload, err := buildPrescriptionSignPayload(prescription, details)
+	if err != nil {
+		return nil, err
+	}
+
+	result = s.verifyDocument(result, payload, prescription.DataHash, prescription.Signature, prescription.SignerKeyID, prescription.SignedAt)
+	if prescription.Status == PrescriptionStatusVoided && result["status"] == "valid" {
+		return fillVerifyResult(result, "voided", "签名有效，但处方已作废，不能配药", prescription.SignerKeyID, prescription.SignedAt, prescription.DataHash), nil
+	}
+	return result, nil
+}
+
+// ErrSigningKeyLocked 医生签名私钥未解锁（服务重启或会话已退出），需重新登录
+var ErrSigningKeyLocked = errors.New("签名私钥未解锁，请重新登录后再签署")
+
+// requireSigningKey 医生签署前确认签名私钥已解锁
+func requireSigningKey(doctorID int64) error {
+	if _, _, ok := doctorSigningKey(doctorID); !ok {
+		return ErrSigningKeyLocked
+	}
+	return nil
+}
+
+// signAs 使用医生已解锁的证书私钥签名，没有医生的文档使用医院密钥
+// 医生私钥未解锁时返回错误，不以医院密钥代签，避免签名人与开具医生不一致
+func signAs(doctorID int64, payload []byte) (string, string, error) {
+	if doctorID <= 0 {
+		return crypto.SM2Sign(payload)
+	}
+
+	key, keyID, ok := doctorSigningKey(doctorID)
+	if !ok {
+		log.Printf("[签名] 医生签名私钥未解锁 - 医生ID: %d", doctorID)
+		return "", "", ErrSigningKeyLocked
+	}
+	signature, err := crypto.SM2SignWithKey(key, payload)
+	if err != nil {
+		return "", "", err
+	}
+	return signature, keyID, nil
+}
+
+// verifyDocument 校验摘要和签名
+func (s *SignatureService) verifyDocument(result map[string]interface{}, payload []byte, dataHash, signature, keyID string, signedAt *time.Time) map[string]interface{} {
+	if signature == "" {
+		return fillVerifyResult(result, "unsigned", "该文档签发于签名功能上线之前，未签名", keyID, signedAt, dataHash)
+	}
+
+	pub, err := s.resolveSignerPublicKey(result, keyID, signedAt)
+	if err != nil {
+		return fillVerifyResult(result, "unknown_signer", err.Error(), keyID, signedAt, dataHash)
+	}
+
+	if crypto.SM3Hash(string(payload)) != dataHash || !crypto.SM2Verify(pub, payload, signature) {
+		return fillVerifyResult(result, "tampered", "签名校验失败，文档在签发后被修改", keyID, signedAt, dataHash)
+	}
+
+	return fillVerifyResult(result, "valid", "签名有效，文档自签发后未被修改", keyID, signedAt, dataHash)
+}
+
+// fillVerifyResult 填充验证结果
+func fillVerifyResult(result map[string]interface{}, status, message, keyID string, signedAt *time.Time, dataHash string) map[string]interface{} {
+	result["status"] = status
+	result["authentic"] = status == "valid"
+	result["message"] = message
+	result["signerKeyId"] = keyID
+	result["dataHash"] = dataHash
+	if signedAt != nil {
+		result["signedAt"] = signedAt.Format("2006-01-02 15:04:05")
+	}
+	return result
+}
+
+// resolveSignerPublicKey 根据签名密钥标识查找验签公钥（医院密钥或医生证书），并写入签名人信息
+func (s *SignatureService) resolveSignerPublicKey(result map[string]interface{}, keyID string, signedAt *time.Time) (*sm2.PublicKey, error) {
+	if keyID == "" {
+		return nil, errors.New("缺少签名密钥标识")
+	}
+	if keyID == crypto.SM2KeyID {
+		result["signerType"] = "hospital"
+		return crypto.SM2PublicKey, nil
+	}
+
+	at := time.Now()
+	if signedAt != nil {
+		at = *signedAt
+	}
+	pub, cert, err := s.certService.resolveCertificate(keyID, at)
+	if cert != nil {
+		result["signerType"] = "doctor"
+		result["signerDoctorId"] = cert.DoctorID
+		result["signerCertSerial"] = cert.SerialNumber
+		result["signerCertStatus"] = cert.Status
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// buildRecordSignPayload 构造病历签名内容
+func buildRecordSignPayload(record *model.MedicalRecord) ([]byte, error) {
+	return json.Marshal(recordSignPayload{
+		DocumentType:   "medical_record",
+		RecordNo:       record.RecordNo,
+		PatientID:      record.PatientID,
+		ConsultationID: record.ConsultationID,
+		DoctorID:       record.DoctorID,
+		RecordType:     record.RecordType,
+		ChiefComplaint: record.ChiefComplaint,
+		PresentIllness: record.PresentIllness,
+		PastHistory:    record.PastHistory,
+		Diagnosis:      record.Diagnosis,
+		Treatment:      record.Treatment,
+		AIAdvice:       record.AIAdvice,
+	})
+}
+
+// buildPrescriptionSignPayload 构造处方签名内容
+func buildPrescriptionSignPayload(prescription *model.Prescription, details []model.PrescriptionDetail) ([]byte, error) {
+	items := make([]prescriptionDetailSignPayload, 0, len(details))
+	for _, d := range details {
+		items = append(items, prescriptionDetailSignPayload{
+			MedicineID:    d.MedicineID,
+			MedicineName:  d.MedicineName,
+			Specification: d.Specification,
+			Quantity:      d.Quantity,
+			Unit:          d.Unit,
+			UnitPrice:     fmt.Sprintf("%.2f", d.UnitPrice),
+			Usage:         d.Usage,
+			Frequency:     d.Frequency,
+			Dosage:        d.Dosage,
+			Duration:      d.Duration,
+			Notes:         d.Notes,
+		})
+	}
+
+	return json.Marshal(prescriptionSignPayload{
+		DocumentType:     "prescription",
+		PrescriptionNo:   prescription.PrescriptionNo,
+		ConsultationID:   prescription.ConsultationID,
+		PatientID:        prescription.PatientID,
+		DoctorID:         prescription.DoctorID,
+		Diagnosis:        prescription.Diagnosis,
+		PrescriptionType: prescription.PrescriptionType,
+		TotalAmount:      fmt.Sprintf("%.2f", prescription.TotalAmount),
+		Details:          items,
+	})
+}
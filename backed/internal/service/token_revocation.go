@@ -0,0 +1,146 @@
+package service
+
+import (
+	"log"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sync"
+	"time"
+)
+
+// revocationSyncInterval 数据库吊销列表同步间隔，多实例部署时其他实例最迟在该间隔后生效
+const revocationSyncInterval = 30 * time.Second
+
+// RevocationStore 访问令牌吊销列表，按会话标识吊销，AuthMiddleware 每次请求检查
+type RevocationStore interface {
+	// Revoke 吊销会话，expiresAt之后该会话签发的访问令牌均已过期，可以移除记录
+	Revoke(userID int64, sessionID, reason string, expiresAt time.Time) error
+	// IsRevoked 会话是否已吊销
+	IsRevoked(sessionID string) bool
+}
+
+var (
+	revocationMu    sync.RWMutex
+	revocationStore RevocationStore = NewMemoryRevocationStore()
+)
+
+// SetRevocationStore 设置吊销列表存储
+func SetRevocationStore(store RevocationStore) {
+	revocationMu.Lock()
+	revocationStore = store
+	revocationMu.Unlock()
+}
+
+// currentRevocationStore 获取当前吊销列表存储
+func currentRevocationStore() RevocationStore {
+	revocationMu.RLock()
+	defer revocationMu.RUnlock()
+	return revocationStore
+}
+
+// IsSessionRevoked 判断访问令牌所属会话是否已吊销
+func IsSessionRevoked(sessionID string) bool {
+	return currentRevocationStore().IsRevoked(sessionID)
+}
+
+// MemoryRevocationStore 内存吊销列表，仅适用于单实例部署，重启后丢失
+type MemoryRevocationStore struct {
+	mu        sync.RWMutex
+	sessions  map[string]time.Time // 会话标识 -> 过期时间
+	lastPurge time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{sessions: make(map[string]time.Time)}
+}
+
+// Revoke 吊销会话
+func (m *MemoryRevocationStore) Revoke(userID int64, sessionID, reason string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastPurge) > time.Minute {
+		for id, exp := range m.sessions {
+			if now.After(exp) {
+				delete(m.sessions, id)
+			}
+		}
+		m.lastPurge = now
+	}
+
+	m.sessions[sessionID] = expiresAt
+	return nil
+}
+
+// IsRevoked 会话是否已吊销
+func (m *MemoryRevocationStore) IsRevoked(sessionID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	exp, ok := m.sessions[sessionID]
+	return ok && time.Now().Before(exp)
+}
+
+// DBRevocationStore 数据库吊销列表，内存中保存副本供每次请求检查，定期从数据库同步其他实例的吊销记录
+type DBRevocationStore struct {
+	repo   *repository.SessionRepository
+	cache  *MemoryRevocationStore
+	mu     sync.Mutex
+	lastID int64
+}
+
+// NewDBRevocationStore 创建数据库吊销列表，加载未过期的记录并启动定期同步
+func NewDBRevocationStore() *DBRevocationStore {
+	s := &DBRevocationStore{
+		repo:  repository.NewSessionRepository(),
+		cache: NewMemoryRevocationStore(),
+	}
+
+	if n, err := s.repo.DeleteExpiredRevocations(); err != nil {
+		log.Printf("[会话] 清理过期吊销记录失败: %v", err)
+	} else if n > 0 {
+		log.Printf("[会话] 已清理过期吊销记录 - 共 %d 条", n)
+	}
+	s.sync()
+
+	go func() {
+		ticker := time.NewTicker(revocationSyncInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.sync()
+		}
+	}()
+	return s
+}
+
+// Revoke 吊销会话，写入数据库后立即在本实例生效
+func (s *DBRevocationStore) Revoke(userID int64, sessionID, reason string, expiresAt time.Time) error {
+	s.cache.Revoke(userID, sessionID, reason, expiresAt)
+	return s.repo.CreateRevocation(&model.TokenRevocation{
+		SessionID: sessionID,
+		UserID:    userID,
+		Reason:    reason,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// IsRevoked 会话是否已吊销
+func (s *DBRevocationStore) IsRevoked(sessionID string) bool {
+	return s.cache.IsRevoked(sessionID)
+}
+
+// sync 从数据库加载新增的吊销记录
+func (s *DBRevocationStore) sync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.repo.FindRevocationsAfter(s.lastID)
+	if err != nil {
+		log.Printf("[会话] 同步吊销列表失败: %v", err)
+		return
+	}
+	for _, r := range list {
+		s.cache.Revoke(r.UserID, r.SessionID, r.Reason, r.ExpiresAt)
+		s.lastID = r.ID
+	}
+}
@@ -22,15 +22,27 @@ func NewTriageService() *TriageService {
 
 // TriageRule 分诊规则
 type TriageRule struct {
-	Priority int    // 优先级(数字越小优先级越高)
-	Name     string // 规则名称
-	Match    func(doctor *model.User, recommendedDept string) bool
-	Score    func(doctor *model.User) int
+	Priority  int    // 优先级(数字越小优先级越高)
+	Name      string // 规则名称
+	DeptMatch bool   // 规则要求医生科室与推荐科室一致
+	Match     func(doctor *model.User, recommendedDept string) bool
+	Score     func(doctor *model.User) int
 }
 
 // AutoAssignDoctor 自动分配医生
 // recommendedDept: AI推荐的科室
-func (s *TriageService) AutoAssignDoctor(consultationID int64, recommendedDept string) (*model.User, string, error) {
+// exclude: 不参与分配的医生（重新分诊时排除已超时未接诊的医生）
+func (s *TriageService) AutoAssignDoctor(consultationID int64, recommendedDept string, exclude ...int64) (*model.User, string, error) {
+	return s.assignDoctor(consultationID, recommendedDept, false, exclude)
+}
+
+// AutoAssignDoctorInDept 在指定科室内自动分配医生，只使用科室匹配的规则，科室内无可用医生时返回错误（用于转到科室）
+func (s *TriageService) AutoAssignDoctorInDept(consultationID int64, dept string, exclude ...int64) (*model.User, string, error) {
+	return s.assignDoctor(consultationID, dept, true, exclude)
+}
+
+// assignDoctor 按分诊规则分配医生，deptOnly为true时跳过不要求科室匹配的兜底规则
+func (s *TriageService) assignDoctor(consultationID int64, recommendedDept string, deptOnly bool, exclude []int64) (*model.User, string, error) {
 	log.Printf("[智能分诊] 开始为问诊 %d 分配医生,推荐科室: %s", consultationID, recommendedDept)
 
 	// 获取所有可用医生
@@ -38,6 +50,19 @@ func (s *TriageService) AutoAssignDoctor(consultationID int64, recommendedDept s
 	if err != nil {
 		return nil, "", errors.New("无可用医生")
 	}
+	if len(exclude) > 0 {
+		excluded := make(map[int64]bool, len(exclude))
+		for _, id := range exclude {
+			excluded[id] = true
+		}
+		remaining := doctors[:0]
+		for _, d := range doctors {
+			if !excluded[d.ID] {
+				remaining = append(remaining, d)
+			}
+		}
+		doctors = remaining
+	}
 
 	if len(doctors) == 0 {
 		return nil, "", errors.New("暂无医生在线,请稍后重试")
@@ -47,8 +72,9 @@ func (s *TriageService) AutoAssignDoctor(consultationID int64, recommendedDept s
 	rules := []TriageRule{
 		// 规则1: 在线 + 科室匹配 + 负载最低
 		{
-			Priority: 1,
-			Name:     "在线科室匹配",
+			Priority:  1,
+			Name:      "在线科室匹配",
+			DeptMatch: true,
 			Match: func(d *model.User, dept string) bool {
 				return d.IsOnline == 1 && d.DoctorDept == dept && d.CurrentConsultationCount < d.MaxConsultationCount
 			},
@@ -58,8 +84,9 @@ func (s *TriageService) AutoAssignDoctor(consultationID int64, recommendedDept s
 		},
 		// 规则2: 科室匹配(不在线但负载允许)
 		{
-			Priority: 2,
-			Name:     "科室匹配",
+			Priority:  2,
+			Name:      "科室匹配",
+			DeptMatch: true,
 			Match: func(d *model.User, dept string) bool {
 				return d.DoctorDept == dept && d.CurrentConsultationCount < d.MaxConsultationCount
 			},
@@ -96,6 +123,9 @@ func (s *TriageService) AutoAssignDoctor(consultationID int64, recommendedDept s
 
 	// 按优先级匹配
 	for _, rule := range rules {
+		if deptOnly && !rule.DeptMatch {
+			continue
+		}
 		matchedDoctors := make([]*model.User, 0)
 		for i := range doctors {
 			if rule.Match(&doctors[i], recommendedDept) {
@@ -124,6 +154,9 @@ func (s *TriageService) AutoAssignDoctor(consultationID int64, recommendedDept s
 		}
 	}
 
+	if deptOnly {
+		return nil, "", errors.New("科室内暂无可接诊的医生")
+	}
 	return nil, "", errors.New("所有医生已达最大负载,请稍后重试")
 }
 
@@ -162,18 +195,7 @@ func (s *TriageService) UpdateDoctorOnlineStatus(doctorID int64, isOnline bool)
 	return s.userRepo.Update(doctor)
 }
 
-// UpdateDoctorWorkload 更新医生工作负载
+// UpdateDoctorWorkload 更新医生工作负载（原子增减，避免并发接诊时计数丢失）
 func (s *TriageService) UpdateDoctorWorkload(doctorID int64, delta int) error {
-	doctor, err := s.userRepo.FindByID(doctorID)
-	if err != nil {
-		return err
-	}
-
-	newCount := doctor.CurrentConsultationCount + delta
-	if newCount < 0 {
-		newCount = 0
-	}
-
-	doctor.CurrentConsultationCount = newCount
-	return s.userRepo.Update(doctor)
+	return s.userRepo.AdjustConsultationCount(doctorID, delta)
 }
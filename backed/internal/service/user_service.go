@@ -7,17 +7,33 @@ import (
 	"sm-medical/internal/crypto"
 	"sm-medical/internal/model"
 	"sm-medical/internal/repository"
+	"sm-medical/pkg/sender"
 	"sm-medical/pkg/utils"
+	"strings"
 	"time"
 )
 
 type UserService struct {
-	userRepo *repository.UserRepository
+	userRepo        *repository.UserRepository
+	certService     *DoctorCertService
+	sessionService  *SessionService
+	mfaService      *MFAService
+	loginGuard      *LoginGuard
+	loginLogRepo    *repository.LoginLogRepository
+	verification    *VerificationService
+	anomalyDetector *LoginAnomalyDetector
 }
 
 func NewUserService() *UserService {
 	return &UserService{
-		userRepo: repository.NewUserRepository(),
+		userRepo:        repository.NewUserRepository(),
+		certService:     NewDoctorCertService(),
+		sessionService:  NewSessionService(),
+		mfaService:      NewMFAService(),
+		loginGuard:      NewLoginGuard(),
+		loginLogRepo:    repository.NewLoginLogRepository(),
+		verification:    NewVerificationService(),
+		anomalyDetector: NewLoginAnomalyDetector(),
 	}
 }
 
@@ -28,24 +44,26 @@ func (s *UserService) Register(username, password, email, phone string) (*model.
 		return nil, errors.New("用户名已存在")
 	}
 
-	// 检查邮箱是否存在（需要先加密再查询）
-	encryptedEmailForCheck, _ := crypto.SM4Encrypt(email)
-	if exists, _ := s.userRepo.ExistsByEmail(encryptedEmailForCheck); exists {
+	// 检查邮箱、手机号是否已注册（按盲索引查询）
+	if exists, _ := s.userRepo.ExistsByEmailBidx(crypto.BlindIndex(crypto.BlindIndexEmail, email)); exists {
 		return nil, errors.New("邮箱已被注册")
 	}
+	if exists, _ := s.userRepo.ExistsByPhoneBidx(crypto.BlindIndex(crypto.BlindIndexPhone, phone), 0); exists {
+		return nil, errors.New("手机号已被注册")
+	}
 
-	// SM3加密密码（前端已做一次SM3，后端再加盐哈希）
-	hashedPassword := crypto.SM3HashWithSalt(password, username)
-
-	// SM4加密敏感信息
-	encryptedEmail, _ := crypto.SM4Encrypt(email)
-	encryptedPhone, _ := crypto.SM4Encrypt(phone)
+	// 密码哈希（前端已做一次SM3，后端使用随机盐的慢哈希）
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
 
+	// 邮箱、手机号由sm4序列化器加密存储
 	user := &model.User{
 		Username: username,
 		Password: hashedPassword,
-		Email:    encryptedEmail,
-		Phone:    encryptedPhone,
+		Email:    email,
+		Phone:    phone,
 		Role:     "patient",
 		Status:   0,
 	}
@@ -54,10 +72,6 @@ func (s *UserService) Register(username, password, email, phone string) (*model.
 		return nil, err
 	}
 
-	// 解密返回
-	user.Email = email
-	user.Phone = phone
-
 	return user, nil
 }
 
@@ -68,31 +82,28 @@ func (s *UserService) RegisterDoctor(username, password, email, phone, realName,
 		return nil, errors.New("用户名已存在")
 	}
 
-	// 检查邮箱是否存在（需要先加密再查询）
-	encryptedEmailForCheck, _ := crypto.SM4Encrypt(email)
-	if exists, _ := s.userRepo.ExistsByEmail(encryptedEmailForCheck); exists {
+	// 检查邮箱、手机号是否已注册（按盲索引查询）
+	if exists, _ := s.userRepo.ExistsByEmailBidx(crypto.BlindIndex(crypto.BlindIndexEmail, email)); exists {
 		return nil, errors.New("邮箱已被注册")
 	}
+	if exists, _ := s.userRepo.ExistsByPhoneBidx(crypto.BlindIndex(crypto.BlindIndexPhone, phone), 0); exists {
+		return nil, errors.New("手机号已被注册")
+	}
 
-	// SM3加密密码（前端已做一次SM3，后端再加盐哈希）
-	hashedPassword := crypto.SM3HashWithSalt(password, username)
-
-	// SM4加密敏感信息
-	encryptedEmail, _ := crypto.SM4Encrypt(email)
-	encryptedPhone, _ := crypto.SM4Encrypt(phone)
-	encryptedRealName, _ := crypto.SM4Encrypt(realName)
-	encryptedIDCard := ""
-	if idCard != "" {
-		encryptedIDCard, _ = crypto.SM4Encrypt(idCard)
+	// 密码哈希（前端已做一次SM3，后端使用随机盐的慢哈希）
+	hashedPassword, err := crypto.HashPassword(password)
+	if err != nil {
+		return nil, err
 	}
 
+	// 敏感信息由sm4序列化器加密存储
 	user := &model.User{
 		Username:     username,
 		Password:     hashedPassword,
-		Email:        encryptedEmail,
-		Phone:        encryptedPhone,
-		RealName:     encryptedRealName,
-		IDCard:       encryptedIDCard,
+		Email:        email,
+		Phone:        phone,
+		RealName:     realName,
+		IDCard:       idCard,
 		Role:         "doctor",
 		Status:       0, // 正常状态
 		DoctorCert:   certImage,
@@ -108,66 +119,143 @@ func (s *UserService) RegisterDoctor(username, password, email, phone, realName,
 		return nil, err
 	}
 
-	// 解密返回
-	user.Email = email
-	user.Phone = phone
-	user.RealName = realName
-	user.IDCard = idCard
+	// 签发医生SM2签名证书，私钥使用登录口令派生的密钥加密（失败时在下次登录补发）
+	if _, _, err := s.certService.IssueCertificate(user, password); err != nil {
+		log.Printf("[Service] 医生证书签发失败 - 医生ID: %d, 错误: %v", user.ID, err)
+	}
 
 	return user, nil
 }
 
-// Login 用户登录
-func (s *UserService) Login(username, password, clientIP string) (string, map[string]interface{}, error) {
+// Login 用户登录，返回访问令牌、刷新令牌和用户信息；需要两步验证时返回第二步凭证(mfaToken)
+func (s *UserService) Login(username, password, clientIP, userAgent string) (map[string]interface{}, error) {
 	log.Printf("[Service] 开始登录 - 用户名: %s", username)
+
+	// 同一IP失败次数过多时直接拒绝
+	if err := s.loginGuard.CheckIP(clientIP); err != nil {
+		s.recordLoginLog(nil, username, clientIP, userAgent, false, err.Error())
+		return nil, err
+	}
 	
-	// 查询用户
-	user, err := s.userRepo.FindByUsername(username)
+	// 查询用户（支持用户名、邮箱、手机号登录）
+	user, err := s.findLoginUser(username)
 	if err != nil {
 		log.Printf("[Service] 查找用户失败: %v", err)
-		return "", nil, errors.New("用户名或密码错误")
+		// 与校验真实密码的开销保持一致，避免通过响应时间枚举账号
+		crypto.VerifyDummyPassword(password)
+		s.loginGuard.RecordFailure(0, clientIP)
+		s.recordLoginLog(nil, username, clientIP, userAgent, false, "用户不存在")
+		return nil, errors.New("用户名或密码错误")
 	}
 	log.Printf("[Service] 找到用户 - ID: %d, 用户名: %s", user.ID, user.Username)
 
+	// 账号处于渐进延迟或锁定中
+	if err := s.loginGuard.CheckAccount(user.ID); err != nil {
+		s.recordLoginLog(user, user.Username, clientIP, userAgent, false, err.Error())
+		return nil, err
+	}
+
 	// 验证密码
-	hashedPassword := crypto.SM3HashWithSalt(password, username)
-	log.Printf("[Service] 前端发送的密码: %s", password)
-	log.Printf("[Service] 后端计算的哈希: %s", hashedPassword)
-	log.Printf("[Service] 数据库存储的哈希: %s", user.Password)
-	
-	if user.Password != hashedPassword {
+	ok, needsRehash := crypto.VerifyPassword(password, user.Password, user.Username)
+	if !ok {
 		log.Printf("[Service] 密码不匹配!")
-		return "", nil, errors.New("用户名或密码错误")
+		s.loginGuard.RecordFailure(user.ID, clientIP)
+		s.recordLoginLog(user, user.Username, clientIP, userAgent, false, "密码错误")
+		return nil, errors.New("用户名或密码错误")
 	}
 	log.Printf("[Service] 密码验证成功")
 
+	// 旧格式或参数过时的密码哈希，登录成功后自动升级
+	if needsRehash {
+		if upgraded, err := crypto.HashPassword(password); err == nil {
+			user.Password = upgraded
+			log.Printf("[Service] 密码哈希已升级 - 用户ID: %d", user.ID)
+		} else {
+			log.Printf("[Service] 密码哈希升级失败 - 用户ID: %d, 错误: %v", user.ID, err)
+		}
+	}
+
 	// 检查账号状态
 	if user.Status == 1 {
-		return "", nil, errors.New("账号已被禁用")
+		s.recordLoginLog(user, user.Username, clientIP, userAgent, false, "账号已被禁用")
+		return nil, errors.New("账号已被禁用")
+	}
+
+	// 医生解锁个人签名私钥（需要登录口令，第二步只提交动态口令，因此在此解锁）
+	// 需要两步验证时私钥随第二步凭证保存，第二步通过后才放入缓存
+	signingKey := s.certService.UnlockSigningKey(user, password)
+
+	// 已启用或角色强制两步验证时，先返回第二步凭证
+	challenge, err := s.mfaService.LoginChallenge(user, signingKey)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		if needsRehash {
+			if err := s.userRepo.Update(user); err != nil {
+				log.Printf("[Service] 保存升级后的密码哈希失败 - 用户ID: %d, 错误: %v", user.ID, err)
+			}
+		}
+		log.Printf("[Service] 需要两步验证 - 用户ID: %d", user.ID)
+		return challenge, nil
 	}
 
-	// 生成JWT token
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Role)
+	return s.completeLogin(user, signingKey, clientIP, userAgent)
+}
+
+// CompleteMFALogin 登录第二步：校验动态口令或恢复码后签发令牌，强制绑定时同时返回恢复码
+func (s *UserService) CompleteMFALogin(mfaToken, code, clientIP, userAgent string) (map[string]interface{}, error) {
+	user, signingKey, recoveryCodes, err := s.mfaService.VerifyLoginChallenge(mfaToken, code)
 	if err != nil {
-		return "", nil, err
+		// 凭证有效但口令错误时计入账号失败次数
+		if user != nil {
+			s.loginGuard.RecordFailure(user.ID, clientIP)
+			s.recordLoginLog(user, user.Username, clientIP, userAgent, false, "两步验证失败")
+		}
+		return nil, err
 	}
+	if user.Status == 1 {
+		s.recordLoginLog(user, user.Username, clientIP, userAgent, false, "账号已被禁用")
+		return nil, errors.New("账号已被禁用")
+	}
+
+	result, err := s.completeLogin(user, signingKey, clientIP, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	if recoveryCodes != nil {
+		result["recoveryCodes"] = recoveryCodes
+	}
+	return result, nil
+}
+
+// completeLogin 创建登录会话，签发访问令牌和刷新令牌，并返回用户信息
+// 医生签名私钥在此放入缓存，由本次会话持有，会话退出、吊销或过期后释放
+func (s *UserService) completeLogin(user *model.User, signingKey *unlockedDoctorKey, clientIP, userAgent string) (map[string]interface{}, error) {
+	result, session, err := s.sessionService.CreateSession(user, clientIP, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	if signingKey != nil {
+		cacheDoctorSigningKey(user.ID, session.SessionID, session.ExpiresAt, signingKey)
+	}
+
+	s.loginGuard.RecordSuccess(user.ID)
+	s.recordLoginLog(user, user.Username, clientIP, userAgent, true, "登录成功")
 
 	// 更新最后登录时间和IP
 	now := time.Now()
-	encryptedIP, _ := crypto.SM4Encrypt(clientIP)
 	user.LastLoginTime = &now
-	user.LastLoginIP = encryptedIP
-	s.userRepo.Update(user)
-
-	// 解密敏感信息返回
-	email, _ := crypto.SM4Decrypt(user.Email)
-	phone, _ := crypto.SM4Decrypt(user.Phone)
+	user.LastLoginIP = clientIP
+	if err := s.userRepo.Update(user); err != nil {
+		log.Printf("[Service] 更新登录信息失败 - 用户ID: %d, 错误: %v", user.ID, err)
+	}
 
-	userInfo := map[string]interface{}{
+	result["userInfo"] = map[string]interface{}{
 		"userId":      user.ID,
 		"username":    user.Username,
-		"email":       email,
-		"phone":       phone,
+		"email":       user.Email,
+		"phone":       user.Phone,
 		"role":        user.Role,
 		"avatar":      user.Avatar,
 		"gender":      user.Gender,
@@ -179,7 +267,93 @@ func (s *UserService) Login(username, password, clientIP string) (string, map[st
 		"certStatus":  user.CertStatus,
 	}
 
-	return token, userInfo, nil
+	return result, nil
+}
+
+// recordLoginLog 记录登录日志（成功和失败都记录），IP由sm4序列化器加密存储，写入后异步做异常检测
+// user为nil表示账号不存在
+func (s *UserService) recordLoginLog(user *model.User, username, clientIP, userAgent string, success bool, msg string) {
+	_, browser, os := utils.ParseUserAgent(userAgent)
+	entry := &model.LoginLog{
+		Username: truncate(username, 50),
+		LoginIP:  clientIP,
+		IPBidx:   ipSubject(clientIP),
+		Browser:  browser,
+		OS:       os,
+		Msg:      truncate(msg, 255),
+	}
+	if location, ok := LocateIP(clientIP); ok {
+		entry.LoginLocation = truncate(location.Name, 100)
+	}
+	role := ""
+	if user != nil {
+		entry.UserID = &user.ID
+		role = user.Role
+	}
+	if success {
+		entry.Status = 1
+	}
+	if err := s.loginLogRepo.Create(entry); err != nil {
+		log.Printf("[Service] 记录登录日志失败 - 用户名: %s, 错误: %v", username, err)
+		return
+	}
+	go s.anomalyDetector.Inspect(entry, role)
+}
+
+// findLoginUser 按用户名查找，未找到时按邮箱或手机号的盲索引查找
+func (s *UserService) findLoginUser(account string) (*model.User, error) {
+	user, err := s.userRepo.FindByUsername(account)
+	if err == nil {
+		return user, nil
+	}
+
+	if strings.Contains(account, "@") {
+		return s.userRepo.FindByEmailBidx(crypto.BlindIndex(crypto.BlindIndexEmail, account))
+	}
+
+	if phoneBidx := crypto.BlindIndex(crypto.BlindIndexPhone, account); phoneBidx != "" {
+		users, err := s.userRepo.FindByPhoneBidx(phoneBidx)
+		if err != nil {
+			return nil, err
+		}
+		// 历史数据中手机号重复时不允许手机号登录
+		if len(users) == 1 {
+			return &users[0], nil
+		}
+	}
+	return nil, err
+}
+
+// BackfillBlindIndexes 为盲索引上线前的用户补算盲索引，保存时旧版ECB密文同时升级为SM4-GCM
+func (s *UserService) BackfillBlindIndexes() {
+	var lastID int64
+	var updated, failed int
+	for {
+		users, err := s.userRepo.FindMissingBlindIndex(lastID, 200)
+		if err != nil {
+			log.Printf("[盲索引] 查询用户失败: %v", err)
+			return
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		for i := range users {
+			user := &users[i]
+			lastID = user.ID
+			// 保存时由BeforeSave钩子计算盲索引
+			if err := s.userRepo.Update(user); err != nil {
+				log.Printf("[盲索引] 更新用户失败 - 用户ID: %d, 错误: %v", user.ID, err)
+				failed++
+				continue
+			}
+			updated++
+		}
+	}
+
+	if updated > 0 || failed > 0 {
+		log.Printf("[盲索引] 补算完成 - 成功: %d, 失败: %d", updated, failed)
+	}
 }
 
 // GetUserInfo 获取用户信息
@@ -189,29 +363,26 @@ func (s *UserService) GetUserInfo(userID int64) (map[string]interface{}, error)
 		return nil, err
 	}
 
-	// 解密敏感信息
-	email, _ := crypto.SM4Decrypt(user.Email)
-	phone, _ := crypto.SM4Decrypt(user.Phone)
-	realName, _ := crypto.SM4Decrypt(user.RealName)
-
 	userInfo := map[string]interface{}{
-		"userId":       user.ID,
-		"username":     user.Username,
-		"email":        email,
-		"phone":        phone,
-		"realName":     realName,
-		"role":         user.Role,
-		"avatar":       user.Avatar,
-		"gender":       user.Gender,
-		"birthDate":    user.BirthDate,
-		"status":       user.Status,
-		"doctorTitle":  user.DoctorTitle,
-		"doctorDept":   user.DoctorDept,
-		"specialty":    user.Specialty,
-		"introduction": user.Introduction,
-		"certNumber":   user.CertNumber,
-		"certStatus":   user.CertStatus,
-		"createdAt":    user.CreatedAt.Format("2006-01-02 15:04:05"),
+		"userId":        user.ID,
+		"username":      user.Username,
+		"email":         user.Email,
+		"phone":         user.Phone,
+		"realName":      user.RealName,
+		"role":          user.Role,
+		"avatar":        user.Avatar,
+		"gender":        user.Gender,
+		"birthDate":     user.BirthDate,
+		"status":        user.Status,
+		"doctorTitle":   user.DoctorTitle,
+		"doctorDept":    user.DoctorDept,
+		"specialty":     user.Specialty,
+		"introduction":  user.Introduction,
+		"certNumber":    user.CertNumber,
+		"certStatus":    user.CertStatus,
+		"createdAt":     user.CreatedAt.Format("2006-01-02 15:04:05"),
+		"emailVerified": user.EmailVerifiedAt != nil,
+		"phoneVerified": user.PhoneVerifiedAt != nil,
 	}
 
 	if user.LastLoginTime != nil {
@@ -232,8 +403,7 @@ func (s *UserService) UpdateProfile(userID int64, avatar, realName string, gende
 		user.Avatar = avatar
 	}
 	if realName != "" {
-		encrypted, _ := crypto.SM4Encrypt(realName)
-		user.RealName = encrypted
+		user.RealName = realName
 	}
 	if gender >= 0 {
 		user.Gender = gender
@@ -242,12 +412,24 @@ func (s *UserService) UpdateProfile(userID int64, avatar, realName string, gende
 		user.BirthDate = birthDate
 	}
 	if phone != "" {
-		encrypted, _ := crypto.SM4Encrypt(phone)
-		user.Phone = encrypted
+		bidx := crypto.BlindIndex(crypto.BlindIndexPhone, phone)
+		if exists, _ := s.userRepo.ExistsByPhoneBidx(bidx, user.ID); exists {
+			return errors.New("手机号已被其他账号使用")
+		}
+		// 更换手机号后需重新验证
+		if bidx != user.PhoneBidx {
+			user.PhoneVerifiedAt = nil
+		}
+		user.Phone = phone
 	}
 	if email != "" {
-		encrypted, _ := crypto.SM4Encrypt(email)
-		user.Email = encrypted
+		if bidx := crypto.BlindIndex(crypto.BlindIndexEmail, email); bidx != user.EmailBidx {
+			if exists, _ := s.userRepo.ExistsByEmailBidx(bidx); exists {
+				return errors.New("邮箱已被其他账号使用")
+			}
+			user.EmailVerifiedAt = nil
+		}
+		user.Email = email
 	}
 
 	return s.userRepo.Update(user)
@@ -261,16 +443,196 @@ func (s *UserService) ChangePassword(userID int64, oldPassword, newPassword stri
 	}
 
 	// 验证旧密码
-	hashedOldPassword := crypto.SM3HashWithSalt(oldPassword, user.Username)
-	if user.Password != hashedOldPassword {
+	if ok, _ := crypto.VerifyPassword(oldPassword, user.Password, user.Username); !ok {
 		return errors.New("旧密码错误")
 	}
 
 	// 加密新密码
-	hashedNewPassword := crypto.SM3HashWithSalt(newPassword, user.Username)
+	hashedNewPassword, err := crypto.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
 	user.Password = hashedNewPassword
 
-	return s.userRepo.Update(user)
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// 医生证书私钥改用新口令加密，无法解锁时吊销旧证书，下次登录重新签发
+	if user.Role == "doctor" {
+		if err := s.certService.RewrapPrivateKey(user.ID, oldPassword, newPassword); err != nil {
+			log.Printf("[Service] 医生私钥重新加密失败 - 医生ID: %d, 错误: %v", user.ID, err)
+			s.certService.RevokeCertificates(user.ID, "修改密码后私钥无法解锁")
+		}
+	}
+
+	// 退出全部会话，需使用新密码重新登录
+	if err := s.sessionService.RevokeAllSessions(user.ID, "修改密码"); err != nil {
+		log.Printf("[Service] 吊销会话失败 - 用户ID: %d, 错误: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// SendContactCode 向当前用户的邮箱（channel=email）或手机号（channel=phone）发送验证码
+func (s *UserService) SendContactCode(userID int64, channel, clientIP string) (map[string]interface{}, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	var purpose, sendChannel, to, bidx string
+	var verifiedAt *time.Time
+	switch channel {
+	case "email":
+		purpose, sendChannel, to, bidx, verifiedAt = PurposeVerifyEmail, sender.ChannelEmail, user.Email, user.EmailBidx, user.EmailVerifiedAt
+	case "phone":
+		purpose, sendChannel, to, bidx, verifiedAt = PurposeVerifyPhone, sender.ChannelSMS, user.Phone, user.PhoneBidx, user.PhoneVerifiedAt
+	default:
+		return nil, errors.New("不支持的验证方式")
+	}
+	if to == "" {
+		return nil, errors.New("请先在个人资料中填写")
+	}
+	if verifiedAt != nil {
+		return nil, errors.New("已验证，无需重复验证")
+	}
+
+	ttl, err := s.verification.SendCode(user.ID, purpose, sendChannel, to, bidx, clientIP)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"channel":        channel,
+		"expiresIn":      int(ttl.Seconds()),
+		"resendInterval": verificationConfig().ResendInterval,
+	}, nil
+}
+
+// ConfirmContact 校验验证码，标记邮箱或手机号已验证
+func (s *UserService) ConfirmContact(userID int64, channel, code string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return errors.New("用户不存在")
+	}
+
+	var purpose, bidx string
+	switch channel {
+	case "email":
+		purpose, bidx = PurposeVerifyEmail, user.EmailBidx
+	case "phone":
+		purpose, bidx = PurposeVerifyPhone, user.PhoneBidx
+	default:
+		return errors.New("不支持的验证方式")
+	}
+
+	record, err := s.verification.CheckCode(user.ID, purpose, code)
+	if err != nil {
+		return err
+	}
+	// 发送验证码后修改过邮箱或手机号，验证码不再有效
+	if record.TargetBidx != bidx {
+		return ErrVerificationCodeInvalid
+	}
+
+	now := time.Now()
+	if channel == "email" {
+		user.EmailVerifiedAt = &now
+	} else {
+		user.PhoneVerifiedAt = &now
+	}
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	log.Printf("[Service] 联系方式验证成功 - 用户ID: %d, 方式: %s", user.ID, channel)
+	return nil
+}
+
+// ForgotPassword 忘记密码：向账号绑定的邮箱或手机号发送重置验证码
+// 账号不存在、已禁用或发送受限时同样返回成功，避免通过该接口探测账号
+func (s *UserService) ForgotPassword(account, clientIP string) map[string]interface{} {
+	result := map[string]interface{}{
+		"expiresIn":      verificationConfig().CodeExpiresIn,
+		"resendInterval": verificationConfig().ResendInterval,
+	}
+
+	user, err := s.findLoginUser(account)
+	if err != nil || user.Status == 1 {
+		log.Printf("[Service] 忘记密码 - 账号不存在或已禁用: %s", account)
+		return result
+	}
+
+	// 使用手机号找回时发短信，其余情况发邮件
+	channel, to, bidx := sender.ChannelEmail, user.Email, user.EmailBidx
+	if user.Phone != "" && crypto.BlindIndex(crypto.BlindIndexPhone, account) == user.PhoneBidx {
+		channel, to, bidx = sender.ChannelSMS, user.Phone, user.PhoneBidx
+	}
+	if _, err := s.verification.SendCode(user.ID, PurposeResetPassword, channel, to, bidx, clientIP); err != nil {
+		log.Printf("[Service] 忘记密码 - 发送验证码失败 - 用户ID: %d, 错误: %v", user.ID, err)
+	}
+	return result
+}
+
+// VerifyResetCode 校验重置验证码，返回一次性密码重置令牌
+func (s *UserService) VerifyResetCode(account, code string) (map[string]interface{}, error) {
+	user, err := s.findLoginUser(account)
+	if err != nil {
+		return nil, ErrVerificationCodeInvalid
+	}
+
+	record, err := s.verification.CheckCode(user.ID, PurposeResetPassword, code)
+	if err != nil {
+		return nil, err
+	}
+	token, ttl, err := s.verification.IssueResetToken(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"resetToken": token,
+		"expiresIn":  int(ttl.Seconds()),
+	}, nil
+}
+
+// ResetPassword 使用重置令牌设置新密码，吊销全部会话并解除账号登录锁定
+func (s *UserService) ResetPassword(resetToken, newPassword string) error {
+	userID, err := s.verification.ConsumeResetToken(resetToken)
+	if err != nil {
+		return err
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return ErrResetTokenInvalid
+	}
+	if user.Status == 1 {
+		return errors.New("账号已被禁用")
+	}
+
+	hashed, err := crypto.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	user.Password = hashed
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// 医生证书私钥由旧密码加密，重置后无法解锁，吊销旧证书，下次登录重新签发
+	if user.Role == "doctor" {
+		s.certService.RevokeCertificates(user.ID, "重置密码后私钥无法解锁")
+	}
+
+	if err := s.sessionService.RevokeAllSessions(user.ID, "重置密码"); err != nil {
+		log.Printf("[Service] 吊销会话失败 - 用户ID: %d, 错误: %v", user.ID, err)
+	}
+	if _, err := s.loginGuard.Unlock(user.ID, ""); err != nil {
+		log.Printf("[Service] 解除登录锁定失败 - 用户ID: %d, 错误: %v", user.ID, err)
+	}
+
+	log.Printf("[Service] 密码已重置 - 用户ID: %d", user.ID)
+	return nil
 }
 
 // ApplyDoctor 申请成为医生
@@ -294,19 +656,14 @@ func (s *UserService) ApplyDoctor(userID int64, realName, idCard, phone, certIma
 	// 生成申请编号：DA + 时间戳 + 4位用户ID
 	applicationNo := fmt.Sprintf("DA%d%04d", time.Now().Unix(), userID%10000)
 
-	// 加密敏感信息
-	encryptedRealName, _ := crypto.SM4Encrypt(realName)
-	encryptedIDCard, _ := crypto.SM4Encrypt(idCard)
-	encryptedPhone, _ := crypto.SM4Encrypt(phone)
-	encryptedEmail, _ := crypto.SM4Encrypt(user.Email) // 使用用户的邮箱
-
+	// 敏感信息由sm4序列化器加密存储
 	application := &model.DoctorApplication{
 		UserID:        userID,
 		ApplicationNo: applicationNo,
-		RealName:      encryptedRealName,
-		IDCard:        encryptedIDCard,
-		Phone:         encryptedPhone,
-		Email:         encryptedEmail,
+		RealName:      realName,
+		IDCard:        idCard,
+		Phone:         phone,
+		Email:         user.Email, // 使用用户的邮箱
 		DoctorCert:    certImage,
 		DoctorTitle:   doctorTitle,
 		DoctorDept:    doctorDept,
@@ -330,9 +687,6 @@ func (s *UserService) GetDoctorApplication(userID int64) (map[string]interface{}
 		return nil, err
 	}
 
-	// 解密
-	realName, _ := crypto.SM4Decrypt(application.RealName)
-
 	statusText := "待审核"
 	if application.Status == 1 {
 		statusText = "已通过"
@@ -344,7 +698,7 @@ func (s *UserService) GetDoctorApplication(userID int64) (map[string]interface{}
 		"applicationId": application.ID,
 		"status":        application.Status,
 		"statusText":    statusText,
-		"realName":      realName,
+		"realName":      application.RealName,
 		"doctorTitle":   application.DoctorTitle,
 		"doctorDept":    application.DoctorDept,
 		"createdAt":     application.CreatedAt.Format("2006-01-02 15:04:05"),
@@ -360,19 +714,17 @@ func (s *UserService) GetDoctorApplication(userID int64) (map[string]interface{}
 
 // GetDoctors 获取医生列表
 func (s *UserService) GetDoctors(page, pageSize int, dept, keyword string) ([]map[string]interface{}, int64, error) {
-	users, total, err := s.userRepo.FindDoctors(page, pageSize, dept, keyword)
+	users, total, err := s.userRepo.FindDoctors(page, pageSize, dept, keyword, crypto.BlindIndex(crypto.BlindIndexRealName, keyword))
 	if err != nil {
 		return nil, 0, err
 	}
 
 	var result []map[string]interface{}
 	for _, user := range users {
-		realName, _ := crypto.SM4Decrypt(user.RealName)
-		
 		result = append(result, map[string]interface{}{
 			"userId":       user.ID,
 			"username":     user.Username,
-			"realName":     realName,
+			"realName":     user.RealName,
 			"avatar":       user.Avatar,
 			"doctorTitle":  user.DoctorTitle,
 			"doctorDept":   user.DoctorDept,
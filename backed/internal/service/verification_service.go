@@ -0,0 +1,260 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sm-medical/internal/crypto"
+	"sm-medical/internal/model"
+	"sm-medical/internal/repository"
+	"sm-medical/pkg/config"
+	"sm-medical/pkg/sender"
+	"time"
+)
+
+// 验证码用途
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeVerifyPhone   = "verify_phone"
+	PurposeResetPassword = "reset_password"
+	PurposeResetToken    = "reset_token" // 重置验证码校验通过后签发，用于提交新密码
+)
+
+// verificationCodeDigits 验证码位数
+const verificationCodeDigits = 6
+
+var (
+	ErrVerificationCodeInvalid = errors.New("验证码错误或已过期")
+	ErrResetTokenInvalid       = errors.New("重置凭证已失效，请重新获取验证码")
+)
+
+// SendRateLimitError 验证码发送过于频繁
+type SendRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SendRateLimitError) Error() string {
+	return "发送过于频繁，请" + retryAfterText(e.RetryAfter) + "后再试"
+}
+
+// VerificationService 验证码的发送、校验和密码重置令牌，验证码和令牌只保存SM3哈希
+type VerificationService struct {
+	codeRepo *repository.VerificationRepository
+}
+
+func NewVerificationService() *VerificationService {
+	return &VerificationService{
+		codeRepo: repository.NewVerificationRepository(),
+	}
+}
+
+// SendCode 生成验证码并投递，同一用户同一用途之前未使用的验证码作废
+// targetBidx 为收件邮箱或手机号的盲索引，用于按收件人限流
+func (s *VerificationService) SendCode(userID int64, purpose, channel, to, targetBidx, clientIP string) (time.Duration, error) {
+	cfg := verificationConfig()
+	ipBidx := ipSubject(clientIP)
+	if err := s.checkRateLimit(targetBidx, ipBidx, cfg); err != nil {
+		return 0, err
+	}
+
+	code, err := randomDigits(verificationCodeDigits)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.codeRepo.InvalidateActive(userID, purpose); err != nil {
+		return 0, err
+	}
+
+	ttl := time.Duration(cfg.CodeExpiresIn) * time.Second
+	record := &model.VerificationCode{
+		UserID:     userID,
+		Purpose:    purpose,
+		Channel:    channel,
+		TargetBidx: targetBidx,
+		IPBidx:     ipBidx,
+		CodeHash:   verificationCodeHash(userID, purpose, code),
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	if err := s.codeRepo.Create(record); err != nil {
+		return 0, err
+	}
+
+	subject, body := verificationMessage(purpose, code, ttl)
+	if err := sender.Send(&sender.Message{Channel: channel, To: to, Subject: subject, Body: body}); err != nil {
+		log.Printf("[验证码] 发送失败 - 用户ID: %d, 用途: %s, 渠道: %s, 错误: %v", userID, purpose, channel, err)
+		s.codeRepo.MarkUsed(record.ID)
+		return 0, errors.New("验证码发送失败，请稍后重试")
+	}
+
+	log.Printf("[验证码] 已发送 - 用户ID: %d, 用途: %s, 渠道: %s", userID, purpose, channel)
+	return ttl, nil
+}
+
+// CheckCode 校验验证码，成功后立即作废；错误次数达到上限后验证码作废
+func (s *VerificationService) CheckCode(userID int64, purpose, code string) (*model.VerificationCode, error) {
+	record, err := s.codeRepo.FindLatestActive(userID, purpose)
+	if err != nil {
+		return nil, ErrVerificationCodeInvalid
+	}
+
+	maxAttempts := verificationConfig().MaxAttempts
+	if record.Attempts >= maxAttempts {
+		s.codeRepo.MarkUsed(record.ID)
+		return nil, ErrVerificationCodeInvalid
+	}
+
+	hash := verificationCodeHash(userID, purpose, code)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(record.CodeHash)) != 1 {
+		if err := s.codeRepo.IncrementAttempts(record.ID); err != nil {
+			return nil, err
+		}
+		if record.Attempts+1 >= maxAttempts {
+			s.codeRepo.MarkUsed(record.ID)
+			log.Printf("[验证码] 错误次数过多，已作废 - 用户ID: %d, 用途: %s", userID, purpose)
+			return nil, errors.New("验证码错误次数过多，请重新获取")
+		}
+		return nil, ErrVerificationCodeInvalid
+	}
+
+	used, err := s.codeRepo.MarkUsed(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrVerificationCodeInvalid
+	}
+	return record, nil
+}
+
+// IssueResetToken 重置验证码校验通过后签发一次性密码重置令牌
+func (s *VerificationService) IssueResetToken(verified *model.VerificationCode) (string, time.Duration, error) {
+	token, err := randomToken(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := s.codeRepo.InvalidateActive(verified.UserID, PurposeResetToken); err != nil {
+		return "", 0, err
+	}
+
+	ttl := time.Duration(verificationConfig().ResetTokenExpiresIn) * time.Second
+	record := &model.VerificationCode{
+		UserID:     verified.UserID,
+		Purpose:    PurposeResetToken,
+		Channel:    verified.Channel,
+		TargetBidx: verified.TargetBidx,
+		CodeHash:   crypto.SM3Hash(token),
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	if err := s.codeRepo.Create(record); err != nil {
+		return "", 0, err
+	}
+	return token, ttl, nil
+}
+
+// ConsumeResetToken 使用密码重置令牌，返回用户ID；令牌只能使用一次
+func (s *VerificationService) ConsumeResetToken(token string) (int64, error) {
+	record, err := s.codeRepo.FindActiveByHash(PurposeResetToken, crypto.SM3Hash(token))
+	if err != nil {
+		return 0, ErrResetTokenInvalid
+	}
+	used, err := s.codeRepo.MarkUsed(record.ID)
+	if err != nil {
+		return 0, err
+	}
+	if !used {
+		return 0, ErrResetTokenInvalid
+	}
+
+	// 同一用户其他未使用的重置验证码一并作废
+	if err := s.codeRepo.InvalidateActive(record.UserID, PurposeResetPassword); err != nil {
+		log.Printf("[验证码] 作废重置验证码失败 - 用户ID: %d, 错误: %v", record.UserID, err)
+	}
+	return record.UserID, nil
+}
+
+// checkRateLimit 检查收件人发送间隔、收件人每小时次数和IP每小时次数
+func (s *VerificationService) checkRateLimit(targetBidx, ipBidx string, cfg config.VerificationConfig) error {
+	now := time.Now()
+	interval := time.Duration(cfg.ResendInterval) * time.Second
+
+	if n, err := s.codeRepo.CountByTargetSince(targetBidx, now.Add(-interval)); err != nil {
+		return err
+	} else if n > 0 {
+		return &SendRateLimitError{RetryAfter: interval}
+	}
+	if n, err := s.codeRepo.CountByTargetSince(targetBidx, now.Add(-time.Hour)); err != nil {
+		return err
+	} else if n >= int64(cfg.MaxPerHour) {
+		return &SendRateLimitError{RetryAfter: time.Hour}
+	}
+	if ipBidx != "" {
+		if n, err := s.codeRepo.CountByIPSince(ipBidx, now.Add(-time.Hour)); err != nil {
+			return err
+		} else if n >= int64(cfg.IPMaxPerHour) {
+			return &SendRateLimitError{RetryAfter: time.Hour}
+		}
+	}
+	return nil
+}
+
+// verificationConfig 验证码配置，未配置的项使用默认值
+func verificationConfig() config.VerificationConfig {
+	var cfg config.VerificationConfig
+	if config.AppConfig != nil {
+		cfg = config.AppConfig.Verification
+	}
+	if cfg.CodeExpiresIn <= 0 {
+		cfg.CodeExpiresIn = 600
+	}
+	if cfg.ResetTokenExpiresIn <= 0 {
+		cfg.ResetTokenExpiresIn = 900
+	}
+	if cfg.ResendInterval <= 0 {
+		cfg.ResendInterval = 60
+	}
+	if cfg.MaxPerHour <= 0 {
+		cfg.MaxPerHour = 5
+	}
+	if cfg.IPMaxPerHour <= 0 {
+		cfg.IPMaxPerHour = 20
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	return cfg
+}
+
+// verificationCodeHash 验证码哈希，按用户和用途加盐，避免6位验证码的哈希可被直接查表
+func verificationCodeHash(userID int64, purpose, code string) string {
+	return crypto.SM3HashWithSalt(code, fmt.Sprintf(":%d:%s", userID, purpose))
+}
+
+// verificationMessage 验证码消息内容
+func verificationMessage(purpose, code string, ttl time.Duration) (string, string) {
+	minutes := int(ttl.Minutes())
+	switch purpose {
+	case PurposeResetPassword:
+		return "重置密码验证码", fmt.Sprintf("【%s】您正在重置登录密码，验证码 %s，%d分钟内有效。如非本人操作，请忽略本消息并检查账号安全。", mfaIssuer(), code, minutes)
+	case PurposeVerifyEmail:
+		return "邮箱验证码", fmt.Sprintf("【%s】您正在验证邮箱，验证码 %s，%d分钟内有效。", mfaIssuer(), code, minutes)
+	default:
+		return "手机验证码", fmt.Sprintf("【%s】您正在验证手机号，验证码 %s，%d分钟内有效。", mfaIssuer(), code, minutes)
+	}
+}
+
+// randomDigits 生成n位数字验证码
+func randomDigits(n int) (string, error) {
+	buf := make([]byte, n)
+	for i := range buf {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		buf[i] = byte('0' + d.Int64())
+	}
+	return string(buf), nil
+}
@@ -10,6 +10,13 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// 自定义关闭码，客户端据此判断是否需要重新登录或停止重连
+const (
+	CloseConsultationEnded = 4000 // 问诊已结束
+	CloseTokenExpired      = 4001 // 登录Token已过期
+	CloseMemberRemoved     = 4002 // 已不是问诊参与人（问诊已转给其他医生或退出会诊）
+)
+
 // Client WebSocket客户端
 type Client struct {
 	Hub            *ChatHub
@@ -17,6 +24,7 @@ type Client struct {
 	Send           chan []byte
 	UserID         int64
 	ConsultationID int64
+	ExpiresAt      time.Time // 握手Token的过期时间，到期后断开连接
 }
 
 // ChatHub WebSocket连接管理中心
@@ -47,6 +55,7 @@ type ChatHub struct {
 type BroadcastMessage struct {
 	ConsultationID int64       // 问诊ID
 	TargetUserID   int64       // 目标用户ID(0表示发送给问诊的所有人)
+	ExcludeUserID  int64       // 发送给所有人时跳过的用户(通常是发送者)
 	MessageType    string      // 消息类型: "chat", "status", "typing", "notification"
 	Data           interface{} // 消息数据
 }
@@ -198,6 +207,9 @@ func (h *ChatHub) broadcastMessage(msg *BroadcastMessage) {
 	// 否则发送给问诊的所有在线用户
 	clients := h.ConsultationClients[msg.ConsultationID]
 	for _, client := range clients {
+		if msg.ExcludeUserID > 0 && client.UserID == msg.ExcludeUserID {
+			continue
+		}
 		select {
 		case client.Send <- messageBytes:
 		default:
@@ -270,6 +282,56 @@ func (h *ChatHub) SendToConsultation(consultationID int64, messageType string, d
 	}
 }
 
+// SendToOthers 发送消息给问诊中除指定用户外的所有用户（多学科会诊时问诊有多个医生）
+func (h *ChatHub) SendToOthers(consultationID, excludeUserID int64, messageType string, data interface{}) {
+	h.Broadcast <- &BroadcastMessage{
+		ConsultationID: consultationID,
+		ExcludeUserID:  excludeUserID,
+		MessageType:    messageType,
+		Data:           data,
+	}
+}
+
+// CloseConsultation 断开问诊的所有连接（问诊结束时调用）
+func (h *ChatHub) CloseConsultation(consultationID int64, reason string) {
+	h.mu.RLock()
+	clients := append([]*Client(nil), h.ConsultationClients[consultationID]...)
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.close(CloseConsultationEnded, reason)
+	}
+	if len(clients) > 0 {
+		log.Printf("[WebSocket] 问诊连接已关闭 - 问诊ID: %d, 连接数: %d, 原因: %s", consultationID, len(clients), reason)
+	}
+}
+
+// CloseMember 断开指定用户在问诊中的连接（转诊后原医生不再是参与人）
+func (h *ChatHub) CloseMember(consultationID, userID int64, reason string) {
+	h.mu.RLock()
+	var clients []*Client
+	for _, client := range h.ConsultationClients[consultationID] {
+		if client.UserID == userID {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.close(CloseMemberRemoved, reason)
+	}
+	if len(clients) > 0 {
+		log.Printf("[WebSocket] 已断开问诊参与人连接 - 问诊ID: %d, 用户ID: %d, 原因: %s", consultationID, userID, reason)
+	}
+}
+
+// close 发送关闭帧并关闭连接，ReadPump随后退出并注销客户端
+func (c *Client) close(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.Conn.Close()
+}
+
 // getClientKey 生成客户端唯一键
 func getClientKey(consultationID, userID int64) string {
 	return fmt.Sprintf("%d_%d", consultationID, userID)
@@ -330,6 +392,15 @@ func (c *Client) ReadPump() {
 // WritePump 写入消息到客户端
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(54 * time.Second)
+
+	// Token到期后断开连接，客户端需使用新Token重新连接
+	var expired <-chan time.Time
+	if !c.ExpiresAt.IsZero() {
+		timer := time.NewTimer(time.Until(c.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
@@ -337,6 +408,11 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
+		case <-expired:
+			log.Printf("[WebSocket] Token已过期，断开连接 - 用户ID: %d, 问诊ID: %d", c.UserID, c.ConsultationID)
+			c.close(CloseTokenExpired, "token expired")
+			return
+
 		case message, ok := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
@@ -6,12 +6,20 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Crypto   CryptoConfig   `mapstructure:"crypto"`
-	Upload   UploadConfig   `mapstructure:"upload"`
+	Server       ServerConfig       `mapstructure:"server"`
+	Database     DatabaseConfig     `mapstructure:"database"`
+	Redis        RedisConfig        `mapstructure:"redis"`
+	JWT          JWTConfig          `mapstructure:"jwt"`
+	Session      SessionConfig      `mapstructure:"session"`
+	MFA          MFAConfig          `mapstructure:"mfa"`
+	LoginGuard   LoginGuardConfig   `mapstructure:"login_guard"`
+	LoginAnomaly LoginAnomalyConfig `mapstructure:"login_anomaly"`
+	Verification VerificationConfig `mapstructure:"verification"`
+	Integration  IntegrationConfig  `mapstructure:"integration"`
+	Consultation ConsultationConfig `mapstructure:"consultation"`
+	Sender       SenderConfig       `mapstructure:"sender"`
+	Crypto       CryptoConfig       `mapstructure:"crypto"`
+	Upload       UploadConfig       `mapstructure:"upload"`
 }
 
 type ServerConfig struct {
@@ -38,14 +46,139 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret    string `mapstructure:"secret"`
-	ExpiresIn int    `mapstructure:"expires_in"`
+	Secret           string `mapstructure:"secret"`
+	ExpiresIn        int    `mapstructure:"expires_in"`         // 访问令牌有效期(秒)
+	RefreshExpiresIn int    `mapstructure:"refresh_expires_in"` // 刷新令牌有效期(秒)，默认7天
+	RevocationStore  string `mapstructure:"revocation_store"`   // 吊销列表存储: db(默认，多实例共享) 或 memory(单实例/开发)
+}
+
+// SessionConfig 登录会话
+type SessionConfig struct {
+	MaxSessions map[string]int `mapstructure:"max_sessions"` // 角色 -> 最大同时登录数，超出时踢出最早的会话；未配置或0表示不限制
+}
+
+// MFAConfig TOTP两步验证
+type MFAConfig struct {
+	Issuer             string   `mapstructure:"issuer"`               // 身份验证器App中显示的发行方
+	RequiredRoles      []string `mapstructure:"required_roles"`       // 强制启用两步验证的角色，未绑定时登录需先完成绑定
+	ChallengeExpiresIn int      `mapstructure:"challenge_expires_in"` // 登录第二步凭证有效期(秒)，默认300
+}
+
+// LoginGuardConfig 登录防暴力破解，未配置的项使用默认值
+type LoginGuardConfig struct {
+	MaxFailures     int `mapstructure:"max_failures"`      // 账号连续失败次数达到后锁定，默认5
+	IPMaxFailures   int `mapstructure:"ip_max_failures"`   // 同一IP连续失败次数达到后锁定，默认20
+	DelayAfter      int `mapstructure:"delay_after"`       // 账号失败次数超过后开始渐进延迟，默认2
+	IPDelayAfter    int `mapstructure:"ip_delay_after"`    // IP失败次数超过后开始渐进延迟，默认10
+	MaxDelaySeconds int `mapstructure:"max_delay_seconds"` // 渐进延迟上限(秒)，默认30
+	LockMinutes     int `mapstructure:"lock_minutes"`      // 锁定时长(分钟)，默认15
+	WindowMinutes   int `mapstructure:"window_minutes"`    // 失败计数窗口(分钟)，超过窗口未再失败则重新计数，默认15
+}
+
+// LoginAnomalyConfig 登录异常检测，未配置的项使用默认值
+type LoginAnomalyConfig struct {
+	Disabled                bool         `mapstructure:"disabled"`                  // 为true时关闭检测
+	MaxSpeedKmh             float64      `mapstructure:"max_speed_kmh"`             // 两次登录之间超过该速度视为不可能的移动，默认900
+	MinDistanceKm           float64      `mapstructure:"min_distance_km"`           // 距离小于该值不判定不可能的移动，默认300
+	NewDeviceLookbackDays   int          `mapstructure:"new_device_lookback_days"`  // 新设备判定参考的历史登录天数，默认90
+	StuffingWindowMinutes   int          `mapstructure:"stuffing_window_minutes"`   // 撞库统计窗口(分钟)，默认10
+	StuffingIPUsernames     int          `mapstructure:"stuffing_ip_usernames"`     // 窗口内同一IP登录失败涉及的不同用户名数，默认10
+	StuffingGlobalUsernames int          `mapstructure:"stuffing_global_usernames"` // 窗口内全站登录失败涉及的不同用户名数，默认100
+	AdminWorkStartHour      int          `mapstructure:"admin_work_start_hour"`     // 管理员工作时间开始(时)，默认8
+	AdminWorkEndHour        int          `mapstructure:"admin_work_end_hour"`       // 管理员工作时间结束(时)，默认20，早于开始或等于开始时不检测
+	IPLocations             []IPLocation `mapstructure:"ip_locations"`              // IP段所在地，用于登录地点和不可能的移动判断
+}
+
+// IPLocation IP段所在地
+type IPLocation struct {
+	CIDR      string  `mapstructure:"cidr"`
+	Name      string  `mapstructure:"name"`
+	Latitude  float64 `mapstructure:"lat"`
+	Longitude float64 `mapstructure:"lon"`
+}
+
+// VerificationConfig 邮箱/手机验证码和密码重置，未配置的项使用默认值
+type VerificationConfig struct {
+	CodeExpiresIn       int `mapstructure:"code_expires_in"`        // 验证码有效期(秒)，默认600
+	ResetTokenExpiresIn int `mapstructure:"reset_token_expires_in"` // 密码重置令牌有效期(秒)，默认900
+	ResendInterval      int `mapstructure:"resend_interval"`        // 同一收件人两次发送的最小间隔(秒)，默认60
+	MaxPerHour          int `mapstructure:"max_per_hour"`           // 同一收件人每小时最多发送次数，默认5
+	IPMaxPerHour        int `mapstructure:"ip_max_per_hour"`        // 同一IP每小时最多发送次数，默认20
+	MaxAttempts         int `mapstructure:"max_attempts"`           // 每个验证码允许的错误次数，超过后作废，默认5
+}
+
+// IntegrationConfig 院内系统集成（服务账号和API密钥）
+type IntegrationConfig struct {
+	DefaultRateLimit int `mapstructure:"default_rate_limit"` // 创建密钥时未指定限流的默认值(次/分钟)，默认60
+	MaxKeyDays       int `mapstructure:"max_key_days"`       // 密钥最长有效期(天)，默认365
+	SignatureWindow  int `mapstructure:"signature_window"`   // SM2签名请求时间戳允许的偏差(秒)，默认300
+}
+
+// ConsultationConfig 问诊状态流转，未配置的项使用默认值
+type ConsultationConfig struct {
+	ReopenDays          int `mapstructure:"reopen_days"`            // 已完成或已超时的问诊在该天数内可以重新打开，默认7
+	TimeoutHours        int `mapstructure:"timeout_hours"`          // 问诊中超过该时长未完成的自动结束为已超时(小时)，默认48
+	CheckInterval       int `mapstructure:"check_interval"`         // 超时检查间隔(秒)，默认60
+	PendingSLAMinutes   int `mapstructure:"pending_sla_minutes"`    // 待接诊超过该时长未被接诊时重新分诊(分钟)，默认30
+	UrgentSLAMinutes    int `mapstructure:"urgent_sla_minutes"`     // AI判定为urgent的问诊的待接诊时限(分钟)，默认10
+	EmergencySLAMinutes int `mapstructure:"emergency_sla_minutes"`  // AI判定为emergency的问诊的待接诊时限(分钟)，默认5
+	MaxReassign         int `mapstructure:"max_reassign"`           // 最多重新分诊次数，用完后仍无人接诊则取消问诊，默认2
+	MaxParticipants     int `mapstructure:"max_participants"`       // 多学科会诊最多邀请的会诊医生人数(不含主诊医生)，默认5
+	FollowUpRemindHours int `mapstructure:"follow_up_remind_hours"` // 复诊日期前多少小时提醒患者，默认24
+}
+
+// SenderConfig 验证码投递方式
+type SenderConfig struct {
+	Mail     string           `mapstructure:"mail"`      // console(默认)、file 或 smtp
+	SMS      string           `mapstructure:"sms"`       // console(默认) 或 file，接入短信服务商时在此扩展
+	FilePath string           `mapstructure:"file_path"` // file 方式的输出文件，每行一条JSON
+	SMTP     SMTPSenderConfig `mapstructure:"smtp"`
+}
+
+type SMTPSenderConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	SSL      bool   `mapstructure:"ssl"` // 465端口隐式TLS
 }
 
 type CryptoConfig struct {
-	SM4Key         string `mapstructure:"sm4_key"`
-	SM2PrivateKey  string `mapstructure:"sm2_private_key"`
-	SM2PublicKey   string `mapstructure:"sm2_public_key"`
+	SM4Key         string            `mapstructure:"sm4_key"`
+	SM4Keys        map[string]string `mapstructure:"sm4_keys"`          // 轮换后的附加密钥: 标识 -> 密钥
+	SM4ActiveKeyID string            `mapstructure:"sm4_active_key_id"` // 当前加密使用的密钥标识
+	SM2PrivateKey  string            `mapstructure:"sm2_private_key"` // PEM或16进制，优先于sm2_key_file
+	SM2PublicKey   string            `mapstructure:"sm2_public_key"`  // 可选，用于校验与私钥是否匹配
+	SM2KeyFile     string            `mapstructure:"sm2_key_file"`    // PEM私钥文件路径
+	BlindIndexKey  string            `mapstructure:"blind_index_key"` // 盲索引HMAC-SM3密钥(16进制)，为空时由sm4_key派生
+	PasswordHash   PasswordHashConfig `mapstructure:"password_hash"`
+	KeyProvider    KeyProviderConfig  `mapstructure:"key_provider"`
+	Transport      TransportConfig    `mapstructure:"transport"`
+}
+
+// TransportConfig 传输层SM2+SM4混合加密（注册、登录、修改资料、创建问诊）
+type TransportConfig struct {
+	Required     bool `mapstructure:"required"`      // 为true时拒绝未加密的请求
+	ReplayWindow int  `mapstructure:"replay_window"` // 请求时间戳允许的偏差(秒)，默认300
+}
+
+// KeyProviderConfig 信封加密主密钥提供者，配置后新数据使用独立数据密钥加密
+type KeyProviderConfig struct {
+	Type        string            `mapstructure:"type"`          // 为空不启用；config 主密钥写在本配置中；kms 使用本地KMS模拟服务
+	MasterKeyID string            `mapstructure:"master_key_id"` // type=config 时当前主密钥标识
+	MasterKeys  map[string]string `mapstructure:"master_keys"`   // type=config 时的主密钥: 标识 -> 32位16进制
+	KMSEndpoint string            `mapstructure:"kms_endpoint"`  // type=kms 时KMS服务地址
+	KMSToken    string            `mapstructure:"kms_token"`     // type=kms 时访问令牌
+}
+
+// PasswordHashConfig 密码哈希参数，调整后用户下次登录时自动升级
+type PasswordHashConfig struct {
+	Algorithm        string `mapstructure:"algorithm"` // scrypt 或 pbkdf2-sm3
+	ScryptN          int    `mapstructure:"scrypt_n"`
+	ScryptR          int    `mapstructure:"scrypt_r"`
+	ScryptP          int    `mapstructure:"scrypt_p"`
+	PBKDF2Iterations int    `mapstructure:"pbkdf2_iterations"`
 }
 
 type UploadConfig struct {
@@ -0,0 +1,67 @@
+package sender
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ConsoleSender 把消息写到服务日志，仅用于开发环境
+type ConsoleSender struct{}
+
+func NewConsoleSender() *ConsoleSender {
+	return &ConsoleSender{}
+}
+
+func (s *ConsoleSender) Name() string {
+	return "console"
+}
+
+func (s *ConsoleSender) Send(msg *Message) error {
+	log.Printf("[消息发送] 渠道: %s, 收件人: %s, 主题: %s, 内容: %s", msg.Channel, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender 把消息按JSON行追加到本地文件，测试时从文件读取验证码
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileSender 创建文件发送器，目录不存在时自动创建
+func NewFileSender(path string) (*FileSender, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return &FileSender{path: path}, nil
+}
+
+func (s *FileSender) Name() string {
+	return "file"
+}
+
+func (s *FileSender) Send(msg *Message) error {
+	line, err := json.Marshal(map[string]interface{}{
+		"channel": msg.Channel,
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+		"sentAt":  time.Now().Format("2006-01-02 15:04:05"),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,59 @@
+package sender
+
+import (
+	"errors"
+	"sync"
+)
+
+// 验证码、密码重置等消息的投递：邮件和短信分别使用可替换的发送器
+// 生产环境邮件使用SMTP，开发和测试环境使用 console（写日志）或 file（追加到本地文件），无需联网
+
+// 投递渠道
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+var ErrUnknownChannel = errors.New("未知的消息渠道")
+
+// Message 待投递的消息
+type Message struct {
+	Channel string // email 或 sms
+	To      string // 邮箱地址或手机号
+	Subject string // 邮件主题，短信忽略
+	Body    string
+}
+
+// Sender 消息发送器
+type Sender interface {
+	// Name 发送器名称，用于日志
+	Name() string
+	// Send 投递消息，返回错误时调用方不应视为已发送
+	Send(msg *Message) error
+}
+
+var (
+	sendersMu sync.RWMutex
+	senders   = map[string]Sender{
+		ChannelEmail: NewConsoleSender(),
+		ChannelSMS:   NewConsoleSender(),
+	}
+)
+
+// SetSender 设置渠道的发送器，未设置时使用 console
+func SetSender(channel string, s Sender) {
+	sendersMu.Lock()
+	senders[channel] = s
+	sendersMu.Unlock()
+}
+
+// Send 按消息渠道选择发送器投递
+func Send(msg *Message) error {
+	sendersMu.RLock()
+	s, ok := senders[msg.Channel]
+	sendersMu.RUnlock()
+	if !ok {
+		return ErrUnknownChannel
+	}
+	return s.Send(msg)
+}
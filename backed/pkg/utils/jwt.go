@@ -8,22 +8,24 @@ import (
 )
 
 type Claims struct {
-	UserID   int64  `json:"userId"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID    int64  `json:"userId"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"` // 登录会话标识，会话吊销后该会话签发的访问令牌全部失效
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 生成JWT Token
-func GenerateToken(userID int64, username, role string) (string, error) {
+// GenerateToken 生成JWT访问令牌
+func GenerateToken(userID int64, username, role, sessionID string) (string, error) {
 	cfg := config.AppConfig.JWT
 	
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.ExpiresIn) * time.Second)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -50,3 +52,59 @@ func ParseToken(tokenString string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// AccessTokenTTL 访问令牌有效期
+func AccessTokenTTL() time.Duration {
+	return time.Duration(config.AppConfig.JWT.ExpiresIn) * time.Second
+}
+
+// RefreshTokenTTL 刷新令牌有效期，未配置时为7天
+func RefreshTokenTTL() time.Duration {
+	if seconds := config.AppConfig.JWT.RefreshExpiresIn; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 7 * 24 * time.Hour
+}
+
+// MFAClaims 登录第二步凭证，密码校验通过后签发，只能用于提交两步验证动态口令
+type MFAClaims struct {
+	UserID int64  `json:"userId"`
+	Stage  string `json:"stage"` // verify: 校验动态口令；enroll: 强制绑定后校验
+	jwt.RegisteredClaims
+}
+
+// GenerateMFAToken 生成登录第二步凭证，使用独立的签名密钥，不能当作访问令牌使用
+func GenerateMFAToken(userID int64, stage, tokenID string, ttl time.Duration) (string, error) {
+	claims := MFAClaims{
+		UserID: userID,
+		Stage:  stage,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(mfaSigningKey())
+}
+
+// ParseMFAToken 解析登录第二步凭证
+func ParseMFAToken(tokenString string) (*MFAClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &MFAClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return mfaSigningKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*MFAClaims); ok && token.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid mfa token")
+}
+
+// mfaSigningKey 第二步凭证签名密钥，与访问令牌密钥区分
+func mfaSigningKey() []byte {
+	return []byte(config.AppConfig.JWT.Secret + ":mfa")
+}
@@ -57,6 +57,11 @@ func Forbidden(c *gin.Context, message string) {
 	Error(c, 403, message)
 }
 
+// TooManyRequests 429错误
+func TooManyRequests(c *gin.Context, message string) {
+	Error(c, 429, message)
+}
+
 // NotFound 404错误
 func NotFound(c *gin.Context, message string) {
 	Error(c, 404, message)
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 设备类型
+const (
+	DevicePC      = "PC"
+	DeviceMobile  = "Mobile"
+	DeviceTablet  = "Tablet"
+	DeviceUnknown = "Unknown"
+)
+
+// browserRules 浏览器识别规则，按顺序匹配（Edge、Opera等的UA中同时包含Chrome，需排在前面）
+var browserRules = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"WeChat", regexp.MustCompile(`MicroMessenger/([\d.]+)`)},
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+	{"QQBrowser", regexp.MustCompile(`QQBrowser/([\d.]+)`)},
+	{"UCBrowser", regexp.MustCompile(`UCBrowser/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+	{"IE", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+}
+
+var (
+	windowsPattern = regexp.MustCompile(`Windows NT ([\d.]+)`)
+	androidPattern = regexp.MustCompile(`Android ([\d.]+)`)
+	iosPattern     = regexp.MustCompile(`(?:iPhone|CPU) OS ([\d_]+)`)
+	macPattern     = regexp.MustCompile(`Mac OS X ([\d_.]+)`)
+)
+
+// windowsVersions Windows NT版本号对应的系统名称
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+}
+
+// ParseUserAgent 从User-Agent解析设备类型、浏览器和操作系统，无法识别时返回 Unknown
+func ParseUserAgent(ua string) (device, browser, os string) {
+	if ua == "" {
+		return DeviceUnknown, "Unknown", "Unknown"
+	}
+	return parseDevice(ua), parseBrowser(ua), parseOS(ua)
+}
+
+func parseDevice(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPad") || (strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		return DeviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone"):
+		return DeviceMobile
+	case strings.Contains(ua, "Windows") || strings.Contains(ua, "Macintosh") || strings.Contains(ua, "X11"):
+		return DevicePC
+	}
+	return DeviceUnknown
+}
+
+func parseBrowser(ua string) string {
+	for _, rule := range browserRules {
+		if m := rule.pattern.FindStringSubmatch(ua); m != nil {
+			return rule.name + " " + majorVersion(m[1])
+		}
+	}
+	return "Unknown"
+}
+
+func parseOS(ua string) string {
+	if m := windowsPattern.FindStringSubmatch(ua); m != nil {
+		if name, ok := windowsVersions[m[1]]; ok {
+			return "Windows " + name
+		}
+		return "Windows"
+	}
+	if m := androidPattern.FindStringSubmatch(ua); m != nil {
+		return "Android " + m[1]
+	}
+	if m := iosPattern.FindStringSubmatch(ua); m != nil {
+		return "iOS " + strings.ReplaceAll(m[1], "_", ".")
+	}
+	if m := macPattern.FindStringSubmatch(ua); m != nil {
+		return "macOS " + strings.ReplaceAll(m[1], "_", ".")
+	}
+	if strings.Contains(ua, "Linux") {
+		return "Linux"
+	}
+	return "Unknown"
+}
+
+// majorVersion 只保留主版本号
+func majorVersion(v string) string {
+	if i := strings.Index(v, "."); i > 0 {
+		return v[:i]
+	}
+	return v
+}
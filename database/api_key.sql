@@ -0,0 +1,58 @@
+-- 服务账号与API密钥脚本
+-- 说明：HIS、药房等院内系统使用服务账号的API密钥（X-API-Key）调用 /api/integration 下的接口
+-- 密钥格式为 smk_<前缀>.<随机串>，数据库只保存完整密钥的SM3哈希；密钥可绑定SM2公钥，要求调用方对请求签名
+-- 每个密钥有独立的授权范围、每分钟调用上限和有效期（integration 配置），每次调用写入审计表
+
+USE SM;
+
+CREATE TABLE IF NOT EXISTS SM_service_account (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  name VARCHAR(50) NOT NULL COMMENT '服务账号名称',
+  description VARCHAR(255) NULL COMMENT '说明',
+  status TINYINT NOT NULL DEFAULT 0 COMMENT '0:正常 1:禁用',
+  created_by BIGINT NOT NULL COMMENT '创建管理员ID',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  UNIQUE KEY uk_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='服务账号表';
+
+CREATE TABLE IF NOT EXISTS SM_api_key (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  key_id VARCHAR(32) NOT NULL COMMENT '密钥前缀(随密钥出示，用于查找)',
+  service_account_id BIGINT NOT NULL COMMENT '服务账号ID',
+  name VARCHAR(50) NULL COMMENT '密钥名称',
+  secret_hash VARCHAR(64) NOT NULL COMMENT '完整密钥的SM3哈希',
+  scopes VARCHAR(255) NOT NULL COMMENT '授权范围(逗号分隔): record:export, prescription:read',
+  sm2_public_key TEXT NULL COMMENT '调用方SM2公钥(16进制)，配置后要求请求签名',
+  rate_limit INT NOT NULL DEFAULT 0 COMMENT '每分钟调用上限',
+  expires_at DATETIME NULL COMMENT '过期时间',
+  last_used_at DATETIME NULL COMMENT '最近使用时间',
+  revoked_at DATETIME NULL COMMENT '吊销时间',
+  created_by BIGINT NOT NULL COMMENT '创建管理员ID',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  UNIQUE KEY uk_key_id (key_id),
+  KEY idx_service_account_id (service_account_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='API密钥表';
+
+CREATE TABLE IF NOT EXISTS SM_api_key_audit (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  api_key_id BIGINT NULL COMMENT 'API密钥ID(密钥不存在时为空)',
+  key_id VARCHAR(32) NULL COMMENT '请求出示的密钥前缀',
+  service_account_id BIGINT NULL COMMENT '服务账号ID',
+  method VARCHAR(10) NOT NULL COMMENT '请求方法',
+  path VARCHAR(255) NOT NULL COMMENT '请求路径',
+  scope VARCHAR(50) NULL COMMENT '接口要求的授权范围',
+  status_code INT NOT NULL DEFAULT 0 COMMENT '响应状态码',
+  signed TINYINT NOT NULL DEFAULT 0 COMMENT '是否通过SM2签名校验',
+  client_ip VARCHAR(512) NULL COMMENT '调用方IP(SM4加密)',
+  msg VARCHAR(255) NULL COMMENT '拒绝原因',
+  duration_ms BIGINT NOT NULL DEFAULT 0 COMMENT '耗时(毫秒)',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '调用时间',
+  KEY idx_api_key_id (api_key_id),
+  KEY idx_service_account_id (service_account_id),
+  KEY idx_key_id (key_id),
+  KEY idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='API调用审计表';
+
+-- 管理员默认拥有服务账号管理权限
+INSERT IGNORE INTO SM_role_permission (role, permission) VALUES ('admin', 'integration:manage');
@@ -0,0 +1,22 @@
+-- 敏感字段盲索引
+-- email_bidx等列保存规范化明文的HMAC-SM3值，用于唯一性校验、邮箱/手机号登录和管理员搜索
+-- 邮箱改为随机化SM4-GCM加密，唯一约束从email列移到email_bidx列
+-- 执行后启动服务，历史用户的盲索引在启动时自动补算
+
+USE SM;
+
+ALTER TABLE SM_user
+MODIFY COLUMN email VARCHAR(512) NOT NULL COMMENT '邮箱(SM4-GCM加密)',
+ADD COLUMN email_bidx VARCHAR(64) NULL COMMENT '邮箱盲索引(HMAC-SM3)' AFTER id_card,
+ADD COLUMN phone_bidx VARCHAR(64) NULL COMMENT '手机号盲索引(HMAC-SM3)' AFTER email_bidx,
+ADD COLUMN real_name_bidx VARCHAR(64) NULL COMMENT '真实姓名盲索引(HMAC-SM3)' AFTER phone_bidx,
+ADD COLUMN id_card_bidx VARCHAR(64) NULL COMMENT '身份证号盲索引(HMAC-SM3)' AFTER real_name_bidx;
+
+-- 随机化加密后密文不再唯一对应明文，去掉email列上的唯一约束
+ALTER TABLE SM_user DROP INDEX email;
+
+ALTER TABLE SM_user
+ADD UNIQUE INDEX uk_email_bidx (email_bidx),
+ADD INDEX idx_phone_bidx (phone_bidx),
+ADD INDEX idx_real_name_bidx (real_name_bidx),
+ADD INDEX idx_id_card_bidx (id_card_bidx);
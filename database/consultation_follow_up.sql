@@ -0,0 +1,26 @@
+-- 复诊脚本
+-- 说明：患者可基于已完成的问诊发起复诊（follow_up_of 关联上次问诊），未指定医生时默认由原接诊医生接诊；
+-- 医生完成问诊时可安排复诊日期，复诊日期前 consultation.follow_up_remind_hours 小时由后台任务提醒患者
+
+USE SM;
+
+ALTER TABLE SM_consultation
+  ADD COLUMN follow_up_of BIGINT NULL COMMENT '复诊关联的上一次问诊ID' AFTER reassign_count,
+  ADD KEY idx_follow_up_of (follow_up_of);
+
+CREATE TABLE IF NOT EXISTS SM_consultation_follow_up (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  consultation_id BIGINT NOT NULL COMMENT '安排复诊的问诊ID',
+  patient_id BIGINT NOT NULL COMMENT '患者ID',
+  doctor_id BIGINT NOT NULL COMMENT '安排复诊的医生ID',
+  due_at DATETIME NOT NULL COMMENT '建议复诊日期',
+  note VARCHAR(500) NULL COMMENT '复诊说明',
+  status TINYINT NOT NULL DEFAULT 0 COMMENT '状态(0:待复诊,1:已复诊,2:已取消)',
+  reminded_at DATETIME NULL COMMENT '提醒时间',
+  follow_up_consultation_id BIGINT NULL COMMENT '患者发起的复诊问诊ID',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  KEY idx_consultation_id (consultation_id),
+  KEY idx_patient_id (patient_id),
+  KEY idx_due_at (due_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='复诊计划表';
@@ -0,0 +1,22 @@
+-- 多学科会诊(MDT)脚本
+-- 说明：主诊医生（问诊的接诊医生）可邀请其他医生作为会诊医生加入问诊，会诊医生可查看问诊详情和病历、
+-- 在问诊聊天室中交流并提交会诊意见，主诊医生完成问诊时汇总为联合诊断；最多邀请 consultation.max_participants 人
+
+USE SM;
+
+CREATE TABLE IF NOT EXISTS SM_consultation_participant (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  consultation_id BIGINT NOT NULL COMMENT '问诊ID',
+  doctor_id BIGINT NOT NULL COMMENT '会诊医生ID',
+  role VARCHAR(20) NOT NULL DEFAULT 'consultant' COMMENT '角色: consultant(主诊医生即问诊的接诊医生，不在本表记录)',
+  invited_by BIGINT NOT NULL COMMENT '邀请人(主诊医生)ID',
+  invite_note VARCHAR(500) NULL COMMENT '邀请说明',
+  opinion TEXT NULL COMMENT '会诊意见(SM4加密)',
+  opinion_at DATETIME NULL COMMENT '提交意见时间',
+  status TINYINT NOT NULL DEFAULT 0 COMMENT '状态(0:参与中,1:已退出)',
+  left_at DATETIME NULL COMMENT '退出时间',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  UNIQUE KEY uk_consultation_doctor (consultation_id, doctor_id),
+  KEY idx_doctor_id (doctor_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='多学科会诊参与医生表';
@@ -0,0 +1,12 @@
+-- 待接诊时限脚本
+-- 说明：待接诊超过时限（consultation.pending_sla_minutes，AI判定 urgent/emergency 的问诊使用更短的时限）仍未被接诊时，
+-- 后台任务释放原医生负载并通过智能分诊重新分配给其他医生，重新分诊 max_reassign 次后仍无人接诊则取消问诊并通知患者
+
+USE SM;
+
+ALTER TABLE SM_consultation
+  ADD COLUMN urgency_level VARCHAR(20) NULL COMMENT 'AI判定的紧急程度: normal, attention, urgent, emergency' AFTER recommended_dept,
+  ADD COLUMN reassign_count INT NOT NULL DEFAULT 0 COMMENT '超过待接诊时限后重新分诊的次数' AFTER urgency_level;
+
+ALTER TABLE SM_consultation_event
+  MODIFY COLUMN event_type VARCHAR(20) NOT NULL COMMENT '事件: create, accept, finish, cancel, decline, timeout, reopen, reassign, expire';
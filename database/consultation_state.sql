@@ -0,0 +1,39 @@
+-- 问诊状态机脚本
+-- 说明：问诊状态只能按规则流转（接诊、完成、患者取消、医生拒绝、超时、重新打开），每次变更写入 SM_consultation_event
+-- 新增状态 4:已超时；问诊中超过 consultation.timeout_hours 未完成时由后台任务自动结束，结束后 reopen_days 天内可重新打开
+-- 医生负载 current_consultation_count 等于其待接诊和问诊中的问诊数，状态变更时同步增减
+
+USE SM;
+
+ALTER TABLE SM_consultation
+  MODIFY COLUMN status TINYINT DEFAULT 0 COMMENT '状态(0:待接诊,1:问诊中,2:已完成,3:已取消,4:已超时)',
+  ADD COLUMN status_changed_at DATETIME NULL COMMENT '最近一次状态变更时间' AFTER completed_at,
+  ADD KEY idx_status_changed_at (status, status_changed_at);
+
+CREATE TABLE IF NOT EXISTS SM_consultation_event (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  consultation_id BIGINT NOT NULL COMMENT '问诊ID',
+  event_type VARCHAR(20) NOT NULL COMMENT '事件: create, accept, finish, cancel, decline, timeout, reopen',
+  from_status TINYINT NULL COMMENT '变更前状态(创建事件为空)',
+  to_status TINYINT NOT NULL COMMENT '变更后状态',
+  operator_id BIGINT NULL COMMENT '操作人ID(系统触发为空)',
+  operator_role VARCHAR(20) NULL COMMENT '操作人角色: patient, doctor, system',
+  doctor_id BIGINT NULL COMMENT '变更后的接诊医生ID',
+  note VARCHAR(500) NULL COMMENT '原因或备注',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '变更时间',
+  KEY idx_consultation_id (consultation_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='问诊状态变更历史表';
+
+-- 历史数据：以更新时间作为最近一次状态变更时间
+UPDATE SM_consultation SET status_changed_at = COALESCE(completed_at, updated_at) WHERE status_changed_at IS NULL;
+
+-- 按待接诊和问诊中的问诊数重新校准医生负载（此前指定医生的问诊未计入、自动分诊后接诊重复计入）
+UPDATE SM_user u
+LEFT JOIN (
+  SELECT doctor_id, COUNT(*) AS active_count
+  FROM SM_consultation
+  WHERE status IN (0, 1) AND doctor_id IS NOT NULL
+  GROUP BY doctor_id
+) c ON c.doctor_id = u.id
+SET u.current_consultation_count = COALESCE(c.active_count, 0)
+WHERE u.identify = 'doctor';
@@ -0,0 +1,8 @@
+-- 转诊脚本
+-- 说明：接诊医生可将问诊转给指定医生或目标科室（重新智能分诊），问诊回到待接诊并由新医生接诊，
+-- 转诊说明写入聊天记录和状态变更历史，原医生和新医生的负载同步调整
+
+USE SM;
+
+ALTER TABLE SM_consultation_event
+  MODIFY COLUMN event_type VARCHAR(20) NOT NULL COMMENT '事件: create, accept, finish, cancel, decline, timeout, reopen, reassign, expire, transfer';
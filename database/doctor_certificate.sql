@@ -0,0 +1,27 @@
+-- 医生SM2签名证书
+-- 内部CA以医院SM2密钥为根，为每位已认证医生签发证书
+-- 医生私钥使用其登录口令派生的密钥(PBKDF2-SM3 + SM4-GCM)加密保存，服务端无法在医生未登录时使用
+-- 管理员禁用账号时证书被吊销，吊销后签名的文档验证失败
+
+USE SM;
+
+CREATE TABLE IF NOT EXISTS SM_doctor_certificate (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '证书ID',
+    doctor_id BIGINT NOT NULL COMMENT '医生ID',
+    serial_number VARCHAR(64) NOT NULL COMMENT '证书序列号',
+    key_id VARCHAR(64) NOT NULL COMMENT '公钥标识(与文档signer_key_id对应)',
+    public_key VARCHAR(200) NOT NULL COMMENT 'SM2公钥(16进制)',
+    certificate_pem TEXT NOT NULL COMMENT '证书(PEM)',
+    encrypted_private_key TEXT NOT NULL COMMENT '口令派生密钥加密的私钥',
+    status VARCHAR(20) NOT NULL DEFAULT 'active' COMMENT '状态: active, revoked',
+    not_before TIMESTAMP NULL COMMENT '生效时间',
+    not_after TIMESTAMP NULL COMMENT '失效时间',
+    revoked_at TIMESTAMP NULL COMMENT '吊销时间',
+    revoke_reason VARCHAR(255) COMMENT '吊销原因',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    UNIQUE KEY uk_serial_number (serial_number),
+    INDEX idx_doctor_id (doctor_id),
+    INDEX idx_key_id (key_id),
+    INDEX idx_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='医生SM2签名证书表';
@@ -0,0 +1,15 @@
+-- 病历和处方SM2数字签名
+-- 签名覆盖解密后的明文字段，data_hash为签名内容的SM3摘要
+-- 签名功能上线前的历史数据signature为空，验证接口返回"未签名"
+
+USE SM;
+
+ALTER TABLE SM_medical_record
+ADD COLUMN signature TEXT COMMENT 'SM2签名(16进制DER)' AFTER data_hash,
+ADD COLUMN signer_key_id VARCHAR(64) COMMENT '签名密钥标识' AFTER signature,
+ADD COLUMN signed_at TIMESTAMP NULL COMMENT '签名时间' AFTER signer_key_id;
+
+ALTER TABLE SM_prescription
+ADD COLUMN signature TEXT COMMENT 'SM2签名(16进制DER)' AFTER data_hash,
+ADD COLUMN signer_key_id VARCHAR(64) COMMENT '签名密钥标识' AFTER signature,
+ADD COLUMN signed_at TIMESTAMP NULL COMMENT '签名时间' AFTER signer_key_id;
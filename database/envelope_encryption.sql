@@ -0,0 +1,10 @@
+-- 信封加密升级脚本
+-- 说明：配置 crypto.key_provider 后，新数据使用独立数据密钥加密，数据密钥由主密钥(KMS)包裹后随密文存储
+-- 新密文格式: v3:<主密钥标识>.<包裹的数据密钥>:<base64(nonce|密文|tag)>，约比v2密文多70字节，现有VARCHAR(512)/TEXT字段足够
+-- 历史v2/ECB密文仍可解密，在管理后台启动重加密任务即可迁移到信封加密，任务目标密钥标识为 kms:<主密钥标识>
+
+USE SM;
+
+-- 扩大重加密任务目标密钥标识长度
+ALTER TABLE SM_crypto_reencrypt_job
+MODIFY COLUMN target_key_id VARCHAR(64) NOT NULL COMMENT '目标密钥标识(SM4密钥标识或kms:<主密钥标识>)';
@@ -0,0 +1,20 @@
+-- 登录防暴力破解脚本
+-- 说明：每次登录尝试（成功和失败）都写入 SM_login_log，记录解析后的浏览器和操作系统
+-- 按账号和IP统计连续失败次数：超过 login_guard.delay_after 次后渐进延迟，达到 login_guard.max_failures 次后临时锁定
+-- IP只保存盲索引（HMAC-SM3），管理员可通过 /api/user/admin/unlock 解除锁定
+
+USE SM;
+
+CREATE TABLE IF NOT EXISTS SM_login_lockout (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  scope VARCHAR(10) NOT NULL COMMENT '统计范围: account, ip',
+  subject VARCHAR(64) NOT NULL COMMENT '用户ID或IP盲索引',
+  user_id BIGINT NULL COMMENT '账号锁定时的用户ID',
+  failures INT NOT NULL DEFAULT 0 COMMENT '统计窗口内的连续失败次数',
+  next_attempt_at DATETIME NULL COMMENT '渐进延迟: 此时间前拒绝登录',
+  locked_until DATETIME NULL COMMENT '锁定截止时间',
+  last_failure_at DATETIME NOT NULL COMMENT '最近失败时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  UNIQUE KEY uk_login_lockout (scope, subject),
+  KEY idx_locked_until (locked_until)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='登录失败锁定表';
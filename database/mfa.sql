@@ -0,0 +1,27 @@
+-- TOTP两步验证脚本
+-- 说明：用户可在 /api/user/mfa 绑定身份验证器（RFC 6238，HMAC-SHA1，6位，30秒），密钥SM4加密存储
+-- 启用后登录分两步：密码校验通过返回 mfaToken，再提交动态口令或恢复码到 /api/user/login/mfa 获取令牌
+-- mfa.required_roles 中的角色必须启用，未绑定的用户登录时先完成绑定
+
+USE SM;
+
+CREATE TABLE IF NOT EXISTS SM_user_mfa (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  user_id BIGINT NOT NULL COMMENT '用户ID',
+  secret VARCHAR(512) NOT NULL COMMENT 'TOTP密钥(SM4加密)',
+  enabled TINYINT(1) NOT NULL DEFAULT 0 COMMENT '是否已启用',
+  last_used_step BIGINT NOT NULL DEFAULT 0 COMMENT '最近使用的口令时间步(防重放)',
+  enabled_at DATETIME NULL COMMENT '启用时间',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  UNIQUE KEY uk_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='两步验证设置表';
+
+CREATE TABLE IF NOT EXISTS SM_mfa_recovery_code (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  user_id BIGINT NOT NULL COMMENT '用户ID',
+  code_hash VARCHAR(64) NOT NULL COMMENT '恢复码SM3哈希',
+  used_at DATETIME NULL COMMENT '使用时间',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  KEY idx_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='两步验证恢复码表';
@@ -0,0 +1,43 @@
+-- 角色权限控制脚本
+-- 说明：路由通过权限标识声明访问要求，角色与权限的对应关系存储在本表，管理员可在线调整
+-- 服务启动时若本表为空会自动写入下方的默认分配，也可以手动执行本脚本初始化
+-- 新增药师角色(pharmacist)：可查看全部处方用于审方，由管理员通过 PUT /api/user/admin/role 分配
+
+USE SM;
+
+-- 用户身份枚举增加药师，否则分配药师角色时写入失败
+ALTER TABLE SM_user MODIFY identify ENUM('patient', 'admin', 'doctor', 'pharmacist') NOT NULL DEFAULT 'patient' COMMENT '身份标识';
+
+CREATE TABLE IF NOT EXISTS SM_role_permission (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  role VARCHAR(20) NOT NULL COMMENT '角色(patient/doctor/pharmacist/admin)',
+  permission VARCHAR(64) NOT NULL COMMENT '权限标识',
+  created_by BIGINT NOT NULL DEFAULT 0 COMMENT '分配该权限的管理员ID(0表示系统初始化)',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  UNIQUE KEY uk_role_permission (role, permission)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='角色权限表';
+
+-- 默认权限分配
+INSERT IGNORE INTO SM_role_permission (role, permission) VALUES
+('patient', 'consultation:create'),
+('patient', 'prescription:view'),
+('patient', 'prescription:verify'),
+('doctor', 'consultation:accept'),
+('doctor', 'consultation:finish'),
+('doctor', 'doctor:online'),
+('doctor', 'medicine:search'),
+('doctor', 'prescription:view'),
+('doctor', 'prescription:verify'),
+('pharmacist', 'medicine:search'),
+('pharmacist', 'prescription:view'),
+('pharmacist', 'prescription:review'),
+('pharmacist', 'prescription:verify'),
+('admin', 'user:manage'),
+('admin', 'log:view'),
+('admin', 'security:manage'),
+('admin', 'integration:manage'),
+('admin', 'crypto:manage'),
+('admin', 'rbac:manage'),
+('admin', 'prescription:view'),
+('admin', 'prescription:review'),
+('admin', 'prescription:verify');
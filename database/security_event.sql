@@ -0,0 +1,35 @@
+-- 登录异常检测脚本
+-- 说明：每次登录写入登录日志后异步检测不可能的移动、新设备、撞库和管理员非工作时间登录（login_anomaly 配置）
+-- 发现异常时写入 SM_security_event，并给受影响的用户发送系统通知；管理员在 /api/user/admin/security-events 查看和处理
+-- 登录日志新增IP盲索引，用于按IP统计失败次数（IP本身为SM4随机化加密，无法直接比较）
+
+USE SM;
+
+ALTER TABLE SM_login_log
+  ADD COLUMN ip_bidx VARCHAR(64) NULL COMMENT 'IP盲索引(HMAC-SM3)' AFTER login_ip,
+  ADD KEY idx_ip_bidx (ip_bidx, login_time);
+
+CREATE TABLE IF NOT EXISTS SM_security_event (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  event_type VARCHAR(30) NOT NULL COMMENT '事件类型: impossible_travel, new_device, credential_stuffing, off_hours_admin',
+  severity VARCHAR(10) NOT NULL COMMENT '级别: low, medium, high',
+  user_id BIGINT NULL COMMENT '受影响的用户ID(撞库事件为空)',
+  username VARCHAR(50) NULL COMMENT '用户名',
+  login_log_id BIGINT NULL COMMENT '触发检测的登录日志ID',
+  subject VARCHAR(64) NULL COMMENT '去重标识: 撞库为IP盲索引或global',
+  ip VARCHAR(512) NULL COMMENT 'IP(SM4加密)',
+  location VARCHAR(100) NULL COMMENT '登录地点',
+  detail TEXT COMMENT '事件详情',
+  status TINYINT NOT NULL DEFAULT 0 COMMENT '0:待处理 1:已确认 2:误报',
+  handled_by BIGINT NULL COMMENT '处理管理员ID',
+  handled_at DATETIME NULL COMMENT '处理时间',
+  handle_note VARCHAR(255) NULL COMMENT '处理备注',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  KEY idx_event_type (event_type, subject, created_at),
+  KEY idx_user_id (user_id),
+  KEY idx_status (status),
+  KEY idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='安全事件表';
+
+-- 管理员默认拥有安全事件处理权限
+INSERT IGNORE INTO SM_role_permission (role, permission) VALUES ('admin', 'security:manage');
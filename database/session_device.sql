@@ -0,0 +1,10 @@
+-- 登录设备管理脚本
+-- 说明：会话记录登录设备类型、浏览器和操作系统（与登录日志相同的解析方式），用户可通过 GET /api/user/sessions 查看、
+-- DELETE /api/user/sessions/:sessionId 下线；医生同时登录数由 session.max_sessions.doctor 配置，超出时最早的会话被踢下线
+
+USE SM;
+
+ALTER TABLE SM_user_session
+ADD COLUMN device VARCHAR(20) NULL COMMENT '设备类型(PC/Mobile/Tablet)' AFTER user_agent,
+ADD COLUMN browser VARCHAR(50) NULL COMMENT '浏览器' AFTER device,
+ADD COLUMN os VARCHAR(50) NULL COMMENT '操作系统' AFTER browser;
@@ -0,0 +1,23 @@
+-- SM4-GCM字段加密升级脚本
+-- 新密文格式: v2:<密钥标识>:<base64(nonce|密文|tag)>，比旧版ECB密文更长
+-- 旧版ECB密文（纯16进制）仍可正常解密，无需迁移数据
+
+USE SM;
+
+-- 1. 扩大用户表加密字段长度（email在blind_index.sql中改为随机化加密）
+ALTER TABLE SM_user
+MODIFY COLUMN phone VARCHAR(512) COMMENT '手机号(SM4-GCM加密)',
+MODIFY COLUMN real_name VARCHAR(512) COMMENT '真实姓名(SM4-GCM加密)',
+MODIFY COLUMN id_card VARCHAR(512) COMMENT '身份证号(SM4-GCM加密)',
+MODIFY COLUMN last_login_ip VARCHAR(512) COMMENT '最后登录IP(SM4-GCM加密)';
+
+-- 2. 扩大医生申请表加密字段长度
+ALTER TABLE SM_doctor_application
+MODIFY COLUMN real_name VARCHAR(512) NOT NULL COMMENT '真实姓名(SM4-GCM加密)',
+MODIFY COLUMN id_card VARCHAR(512) NOT NULL COMMENT '身份证号(SM4-GCM加密)',
+MODIFY COLUMN phone VARCHAR(512) NOT NULL COMMENT '手机号(SM4-GCM加密)',
+MODIFY COLUMN email VARCHAR(512) NOT NULL COMMENT '邮箱(SM4-GCM加密)';
+
+-- 3. 扩大登录日志IP字段长度
+ALTER TABLE SM_login_log
+MODIFY COLUMN login_ip VARCHAR(512) NOT NULL COMMENT '登录IP(SM4-GCM加密)';
@@ -0,0 +1,22 @@
+-- SM4密钥轮换重加密任务表
+-- 说明：记录重加密任务的进度和断点（当前表 + 最大已处理ID），支持暂停和服务重启后恢复
+
+USE SM;
+
+CREATE TABLE IF NOT EXISTS SM_crypto_reencrypt_job (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '任务ID',
+    target_key_id VARCHAR(32) NOT NULL COMMENT '目标密钥标识',
+    status VARCHAR(20) NOT NULL COMMENT '任务状态(running,paused,completed,failed)',
+    current_table VARCHAR(64) COMMENT '当前处理的表',
+    last_id BIGINT DEFAULT 0 COMMENT '当前表已处理的最大ID',
+    scanned BIGINT DEFAULT 0 COMMENT '已扫描行数',
+    reencrypted BIGINT DEFAULT 0 COMMENT '已重加密行数',
+    failed BIGINT DEFAULT 0 COMMENT '解密失败的字段数',
+    error_msg TEXT COMMENT '失败原因',
+    created_by BIGINT COMMENT '发起管理员ID',
+    started_at TIMESTAMP NULL COMMENT '开始时间',
+    finished_at TIMESTAMP NULL COMMENT '完成时间',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    INDEX idx_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='SM4密钥轮换重加密任务表';
@@ -0,0 +1,35 @@
+-- 登录会话与令牌吊销脚本
+-- 说明：访问令牌有效期缩短为15分钟（jwt.expires_in），过期后使用刷新令牌调用 POST /api/user/refresh 换取
+-- 刷新令牌每次使用后轮换，数据库只保存SM3哈希；已轮换的刷新令牌再次出现时吊销整个会话
+-- 退出登录、修改密码、禁用账号、角色变更时吊销会话，会话签发的访问令牌通过吊销列表立即失效
+
+USE SM;
+
+CREATE TABLE IF NOT EXISTS SM_user_session (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  session_id VARCHAR(64) NOT NULL COMMENT '会话标识(访问令牌sid)',
+  user_id BIGINT NOT NULL COMMENT '用户ID',
+  refresh_token_hash VARCHAR(64) NOT NULL COMMENT '当前刷新令牌SM3哈希',
+  prev_token_hash VARCHAR(64) NULL COMMENT '上一个刷新令牌SM3哈希(用于检测重复使用)',
+  client_ip VARCHAR(512) NULL COMMENT '客户端IP(SM4加密)',
+  user_agent VARCHAR(255) NULL COMMENT '客户端User-Agent',
+  expires_at DATETIME NOT NULL COMMENT '刷新令牌过期时间',
+  last_refresh_at DATETIME NULL COMMENT '最近刷新时间',
+  revoked_at DATETIME NULL COMMENT '吊销时间',
+  revoke_reason VARCHAR(100) NULL COMMENT '吊销原因',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  UNIQUE KEY uk_session_id (session_id),
+  KEY idx_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='登录会话表';
+
+CREATE TABLE IF NOT EXISTS SM_token_revocation (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  session_id VARCHAR(64) NOT NULL COMMENT '已吊销的会话标识',
+  user_id BIGINT NOT NULL COMMENT '用户ID',
+  reason VARCHAR(100) NULL COMMENT '吊销原因',
+  expires_at DATETIME NOT NULL COMMENT '记录过期时间(此后该会话的访问令牌均已过期)',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  UNIQUE KEY uk_session_id (session_id),
+  KEY idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='访问令牌吊销列表';
@@ -0,0 +1,28 @@
+-- 邮箱/手机验证和找回密码脚本
+-- 说明：验证码6位数字，只保存SM3哈希（按用户和用途加盐），使用一次或错误次数达到上限后作废
+-- 找回密码分三步：/api/user/password/forgot 发送验证码 -> /password/reset/verify 换取一次性重置凭证 -> /password/reset 设置新密码
+-- 发送按收件人间隔、收件人每小时次数和IP每小时次数限流（verification 配置），投递方式见 sender 配置
+
+USE SM;
+
+ALTER TABLE SM_user
+  ADD COLUMN email_verified_at DATETIME NULL COMMENT '邮箱验证时间' AFTER last_login_ip,
+  ADD COLUMN phone_verified_at DATETIME NULL COMMENT '手机号验证时间' AFTER email_verified_at;
+
+CREATE TABLE IF NOT EXISTS SM_verification_code (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY COMMENT '主键ID',
+  user_id BIGINT NOT NULL COMMENT '用户ID',
+  purpose VARCHAR(20) NOT NULL COMMENT '用途: verify_email, verify_phone, reset_password, reset_token',
+  channel VARCHAR(10) NOT NULL COMMENT '投递渠道: email, sms',
+  target_bidx VARCHAR(64) NULL COMMENT '收件邮箱或手机号盲索引',
+  ip_bidx VARCHAR(64) NULL COMMENT '请求IP盲索引',
+  code_hash VARCHAR(64) NOT NULL COMMENT '验证码或重置凭证的SM3哈希',
+  attempts INT NOT NULL DEFAULT 0 COMMENT '错误次数',
+  expires_at DATETIME NOT NULL COMMENT '过期时间',
+  used_at DATETIME NULL COMMENT '使用/作废时间',
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  KEY idx_user_purpose (user_id, purpose),
+  KEY idx_target_bidx (target_bidx, created_at),
+  KEY idx_ip_bidx (ip_bidx, created_at),
+  KEY idx_code_hash (code_hash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='验证码表';
@@ -9,10 +9,20 @@ export const API = {
 	// 用户模块
 	USER_REGISTER: '/api/user/register',
 	USER_LOGIN: '/api/user/login',
+	USER_REFRESH: '/api/user/refresh',
+	USER_LOGIN_MFA: '/api/user/login/mfa',
+	USER_LOGIN_MFA_SETUP: '/api/user/login/mfa/setup',
+	USER_MFA: '/api/user/mfa',
 	USER_INFO: '/api/user/info',
 	USER_UPDATE: '/api/user/profile',
 	USER_PASSWORD: '/api/user/password',
+	USER_PASSWORD_FORGOT: '/api/user/password/forgot',
+	USER_PASSWORD_RESET_VERIFY: '/api/user/password/reset/verify',
+	USER_PASSWORD_RESET: '/api/user/password/reset',
+	USER_VERIFY_SEND: '/api/user/verify/send',
+	USER_VERIFY_CONFIRM: '/api/user/verify/confirm',
 	USER_LOGOUT: '/api/user/logout',
+	USER_SESSIONS: '/api/user/sessions',
 	USER_APPLY_DOCTOR: '/api/user/apply-doctor',
 	USER_DOCTOR_APPLICATION: '/api/user/doctor-application',
 	USER_DOCTORS: '/api/user/doctors',
@@ -24,6 +34,12 @@ export const API = {
 	USER_ADMIN_USERS: '/api/user/admin/users',
 	USER_ADMIN_STATUS: '/api/user/admin/status',
 	USER_ADMIN_LOGIN_LOGS: '/api/user/admin/login-logs',
+	USER_ADMIN_UNLOCK: '/api/user/admin/unlock',
+	USER_ADMIN_SECURITY_EVENTS: '/api/user/admin/security-events',
+	USER_ADMIN_SERVICE_ACCOUNTS: '/api/user/admin/service-accounts',
+	USER_ADMIN_SERVICE_ACCOUNT_STATUS: '/api/user/admin/service-accounts/status',
+	USER_ADMIN_API_KEYS: '/api/user/admin/service-accounts/keys',
+	USER_ADMIN_API_AUDITS: '/api/user/admin/service-accounts/audits',
 	
 	// 国密密钥管理
 	CRYPTO_PUBLIC_KEY: '/api/crypto/public-key',
@@ -40,6 +56,18 @@ export const API = {
 	CONSULTATION_DETAIL: '/api/consultation/detail',
 	CONSULTATION_ACCEPT: '/api/consultation/accept',
 	CONSULTATION_FINISH: '/api/consultation/finish',
+	CONSULTATION_CANCEL: '/api/consultation/cancel',
+	CONSULTATION_DECLINE: '/api/consultation/decline',
+	CONSULTATION_TRANSFER: '/api/consultation/transfer',
+	CONSULTATION_REOPEN: '/api/consultation/reopen',
+	CONSULTATION_EVENTS: '/api/consultation/events',
+	CONSULTATION_PARTICIPANTS: '/api/consultation/participants',
+	CONSULTATION_PARTICIPANT_INVITE: '/api/consultation/participants/invite',
+	CONSULTATION_PARTICIPANT_REMOVE: '/api/consultation/participants/remove',
+	CONSULTATION_PARTICIPANT_OPINION: '/api/consultation/participants/opinion',
+	CONSULTATION_FOLLOW_UP_PREFILL: '/api/consultation/follow-up/prefill',
+	CONSULTATION_FOLLOW_UP_SCHEDULE: '/api/consultation/follow-up/schedule',
+	CONSULTATION_FOLLOW_UPS: '/api/consultation/follow-ups',
 	CONSULTATION_MESSAGE: '/api/consultation/{id}/message',
 	CONSULTATION_MESSAGES: '/api/consultation/{id}/messages',
 	
@@ -75,6 +103,7 @@ export const API = {
 // 本地存储键名
 export const STORAGE_KEYS = {
 	TOKEN: 'token',
+	REFRESH_TOKEN: 'refreshToken',
 	USER_INFO: 'userInfo',
 	SM2_PUBLIC_KEY: 'sm2PublicKey',
 	PAILLIER_PUBLIC_KEY: 'paillierPublicKey'
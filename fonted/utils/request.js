@@ -1,6 +1,49 @@
-import { API_BASE_URL, STORAGE_KEYS } from './config.js'
+import { API_BASE_URL, API, STORAGE_KEYS } from './config.js'
 import { isMockEnabled, mockApiResponse } from './mock.js'
-import { getStorageSync } from './storage.js'
+import { getStorageSync, setStorageSync, removeStorageSync } from './storage.js'
+
+// 正在进行的刷新请求，多个请求同时遇到401时共用一次刷新
+let refreshing = null
+
+/**
+ * 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+ */
+export function refreshAccessToken() {
+	if (refreshing) {
+		return refreshing
+	}
+	
+	const refreshToken = getStorageSync(STORAGE_KEYS.REFRESH_TOKEN)
+	if (!refreshToken) {
+		return Promise.reject(new Error('no refresh token'))
+	}
+	
+	refreshing = new Promise((resolve, reject) => {
+		uni.request({
+			url: API_BASE_URL + API.USER_REFRESH,
+			method: 'POST',
+			data: { refreshToken },
+			header: { 'Content-Type': 'application/json' },
+			success: (res) => {
+				const data = res.data
+				if (data && data.code === 200) {
+					setStorageSync(STORAGE_KEYS.TOKEN, data.data.token)
+					setStorageSync(STORAGE_KEYS.REFRESH_TOKEN, data.data.refreshToken)
+					resolve(data.data.token)
+				} else {
+					removeStorageSync(STORAGE_KEYS.TOKEN)
+					removeStorageSync(STORAGE_KEYS.REFRESH_TOKEN)
+					reject(data)
+				}
+			},
+			fail: reject,
+			complete: () => {
+				refreshing = null
+			}
+		})
+	})
+	return refreshing
+}
 
 /**
  * 统一请求封装
@@ -56,6 +99,14 @@ export function request(options) {
 				// 根据后端返回的统一格式处理
 				if (data.code === 200) {
 					resolve(data)
+				} else if (data.code === 401 && !options.noAuth && !options._retried && getStorageSync(STORAGE_KEYS.REFRESH_TOKEN)) {
+					// 访问令牌过期，刷新后重试一次
+					refreshAccessToken()
+						.then(() => request({ ...options, _retried: true }).then(resolve, reject))
+						.catch(() => {
+							handleError(data)
+							reject(data)
+						})
 				} else {
 					// 错误处理
 					handleError(data)